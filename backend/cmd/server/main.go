@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	// 核心模块
@@ -14,6 +20,7 @@ import (
 	moduleapi "app-platform-backend/internal/api/v1/module"
 	statsapi "app-platform-backend/internal/api/v1/stats"
 	"app-platform-backend/internal/api/v1/baas"
+	"app-platform-backend/internal/api/v1/health"
 	"app-platform-backend/internal/api/v1/system"
 	wsapi "app-platform-backend/internal/api/v1/websocket"
 	"app-platform-backend/internal/config"
@@ -28,6 +35,9 @@ import (
 )
 
 func main() {
+	syncDryRun := flag.Bool("sync-dry-run", false, "输出模块同步计划后退出，不写数据库")
+	flag.Parse()
+
 	// 加载配置
 	cfg, err := config.LoadConfig("./configs/config.yaml")
 	if err != nil {
@@ -40,9 +50,30 @@ func main() {
 	}
 	defer database.Close()
 
+	// 只在日志中输出模块同步计划（新增/更新/孤立的功能模板），不初始化模块、不启动服务
+	if *syncDryRun {
+		if _, err := module.NewSyncer(database.GetDB()).Sync(module.SyncOptions{DryRun: true}); err != nil {
+			log.Fatalf("Failed to plan module sync: %v", err)
+		}
+		return
+	}
+
 	// 初始化JWT
 	middleware.InitJWT(&cfg.JWT)
 
+	// 初始化客户端签名认证（AppID/AppSecret）
+	if err := middleware.InitAppAuth(database.GetDB()); err != nil {
+		log.Fatalf("Failed to init app auth: %v", err)
+	}
+
+	// 初始化模块访问控制（按APP启用的模块开放路由）
+	middleware.InitModuleGate(database.GetDB())
+
+	// 初始化按APP注入的模块配置
+	if err := module.InitConfigStore(database.GetDB(), cfg.Server.Environment); err != nil {
+		log.Fatalf("Failed to init module config store: %v", err)
+	}
+
 	// 初始化审计日志数据库连接
 	middleware.InitAuditDB(database.GetDB())
 	log.Println("[Main] Audit logging initialized")
@@ -77,6 +108,13 @@ func main() {
 	// ========================================
 	log.Println("[Main] Starting modular architecture initialization...")
 
+	// 模块间事件发件箱，需在事件总线启动（StartAllModules）前启用
+	if cfg.Events.Outbox {
+		if err := module.EnableEventOutbox(database.GetDB()); err != nil {
+			log.Printf("[Main] Event outbox disabled: %v", err)
+		}
+	}
+
 	// 1. 初始化所有模块
 	if err := module.InitAllModules(); err != nil {
 		log.Fatalf("Failed to init modules: %v", err)
@@ -89,6 +127,23 @@ func main() {
 		log.Fatalf("Failed to sync modules to database: %v", err)
 	}
 
+	// 3. 按依赖顺序启动模块的后台任务，关闭时逆序停止
+	if err := module.StartAllModules(context.Background()); err != nil {
+		log.Fatalf("Failed to start modules: %v", err)
+	}
+
+	// 模块版本与环境配置迁移
+	if err := moduleapi.MigrateDB(database.GetDB()); err != nil {
+		log.Printf("[Main] Module version migration failed: %v", err)
+	}
+
+	// BaaS 数据表迁移与处理器
+	if err := baas.MigrateDB(database.GetDB()); err != nil {
+		log.Printf("[Main] BaaS migration failed: %v", err)
+	}
+	baasHandler := baas.NewHandler(database.GetDB())
+	baasHandler.StartJobs()
+
 	// ========================================
 	// API路由组
 	// ========================================
@@ -130,6 +185,7 @@ func main() {
 				appGroup.PUT("/:id", app.Update)
 				appGroup.DELETE("/:id", app.Delete)
 				appGroup.POST("/:id/reset-secret", app.ResetSecret)
+				appGroup.POST("/:id/users/token", app.IssueUserToken)
 
 				// APP模块管理
 				appGroup.GET("/:id/modules", moduleapi.GetAppModules)
@@ -156,6 +212,13 @@ func main() {
 					appGroup.POST("/:id/modules/:module_code/versions/:version_id/rollback", moduleapi.RollbackModuleVersion)
 					appGroup.GET("/:id/modules/:module_code/versions/compare", moduleapi.CompareModuleVersions)
 
+					// 环境配置与版本提升
+					appGroup.GET("/:id/modules/:module_code/environments", moduleapi.ListModuleEnvironments)
+					appGroup.GET("/:id/modules/:module_code/promotions", moduleapi.ListPromotions)
+					appGroup.POST("/:id/modules/:module_code/promotions", moduleapi.RequestPromotion)
+					appGroup.POST("/:id/modules/:module_code/promotions/:promotion_id/approve", moduleapi.ApprovePromotion)
+					appGroup.POST("/:id/modules/:module_code/promotions/:promotion_id/reject", moduleapi.RejectPromotion)
+
 				// 模块依赖管理
 				appGroup.GET("/:id/modules/:module_code/dependencies/check", moduleapi.CheckModuleDependencies)
 				appGroup.GET("/:id/modules/:module_code/dependencies/reverse", moduleapi.CheckModuleReverseDependencies)
@@ -175,14 +238,13 @@ func main() {
 			for _, m := range modules {
 				meta := m.Meta()
 				log.Printf("[Main] Registering routes for module: %s (%s)", meta.Code, meta.Name)
-				m.RegisterRoutes(auth)
+				m.RegisterRoutes(auth.Group("", middleware.ModuleGate(m)))
 			}
 			log.Printf("[Main] %d module routes registered", len(modules))
 
 // ========================================
 				// BaaS 数据模型管理
 				// ========================================
-				baasHandler := baas.NewHandler(database.GetDB())
 				baasHandler.RegisterRoutes(auth)
 				log.Println("[Main] BaaS routes registered")
 
@@ -193,6 +255,20 @@ func main() {
 				moduleGroup.GET("/dependencies/detect/:module_code", moduleapi.DetectCircularDependency)
 			}
 		}
+
+		// 客户端接口（AppID/AppSecret 签名认证）
+		client := v1.Group("/client")
+		client.Use(middleware.AppAuthMiddleware())
+		{
+			for _, m := range module.GetAllModules() {
+				if registrar, ok := m.(module.ClientRouteRegistrar); ok {
+					log.Printf("[Main] Registering client routes for module: %s", m.Meta().Code)
+					registrar.RegisterClientRoutes(client.Group("", middleware.ModuleGate(m)))
+				}
+			}
+			baasHandler.RegisterClientRoutes(client)
+			client.GET("/modules/:module_code/config", moduleapi.ClientModuleConfig)
+		}
 	}
 
 	// 静态文件服务
@@ -207,11 +283,17 @@ func main() {
 		})
 	})
 
+	// 健康探针
+	r.GET("/api/v1/health", health.Check)
+	r.GET("/api/v1/health/live", health.Liveness)
+	r.GET("/api/v1/health/ready", health.Readiness)
+
 	// 模块信息接口（用于调试）
 	r.GET("/api/v1/system/modules", func(c *gin.Context) {
 		modules := module.GetAllModules()
+		reports := module.CheckHealth(c.Request.Context())
 		result := make([]gin.H, 0, len(modules))
-		for _, m := range modules {
+		for i, m := range modules {
 			meta := m.Meta()
 			functions := m.GetFunctions()
 			funcList := make([]gin.H, 0, len(functions))
@@ -229,6 +311,8 @@ func main() {
 				"description": meta.Description,
 				"icon":        meta.Icon,
 				"functions":   funcList,
+				"state":       reports[i].State,
+				"health":      reports[i],
 			})
 		}
 		c.JSON(200, gin.H{
@@ -240,7 +324,27 @@ func main() {
 	// 启动服务器
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	log.Printf("Server starting on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{Addr: addr, Handler: r}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("[Main] Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[Main] Server shutdown failed: %v", err)
+	}
+	if err := module.StopAllModules(shutdownCtx); err != nil {
+		log.Printf("[Main] Module shutdown failed: %v", err)
 	}
+	baasHandler.StopJobs()
 }
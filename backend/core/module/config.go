@@ -0,0 +1,264 @@
+// Package module 提供按APP注入的模块配置
+// 配置来源依次为：功能 ConfigSchema 的默认值、APP模块级配置、APP功能级配置，后者覆盖前者；
+// 模块级与功能级配置取服务所在环境（InitConfigStore 指定）生效的版本：dev 为 app_modules.config，
+// staging/prod 为提升后写入 module_env_configs 的配置；未启用的模块不读取配置。
+// 结果按APP缓存，SaveModuleConfig / RollbackConfig 等修改配置后调用 ReloadConfig 立即生效
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EventModuleConfigChanged APP模块配置变更事件，数据为 ModuleChanged
+const EventModuleConfigChanged = "module.config_changed"
+
+// AppIDContextKey 请求所属APP在 gin.Context 中的键，由模块访问控制中间件写入
+const AppIDContextKey = "module_app_id"
+
+// configCacheTTL 配置缓存的有效期
+// 本实例内的修改会立即失效缓存，有效期只用于感知其他实例的修改
+const configCacheTTL = time.Minute
+
+// 配置环境，与模块环境配置（module_env_configs）一致
+const (
+	ConfigEnvDev     = "dev"
+	ConfigEnvStaging = "staging"
+	ConfigEnvProd    = "prod"
+)
+
+var (
+	configDB  *gorm.DB
+	configEnv = ConfigEnvProd
+)
+
+// configLoader 读取APP指定模块/功能在服务环境生效的原始配置（module_code => config），测试中可替换
+// 只读取已启用（status=1）且未软删除的 app_modules 记录，禁用模块的配置不再生效
+var configLoader = func(appID uint, codes []string) (map[string]string, error) {
+	if configDB == nil {
+		return nil, fmt.Errorf("module config store not initialized")
+	}
+	var rows []struct {
+		ModuleCode string
+		Config     string
+	}
+	var query *gorm.DB
+	if configEnv == ConfigEnvDev {
+		query = configDB.Table("app_modules").
+			Select("module_code, config").
+			Where("app_id = ? AND module_code IN ? AND status = ? AND deleted_at IS NULL", appID, codes, 1)
+	} else {
+		query = configDB.Table("module_env_configs AS e").
+			Select("e.module_code, e.config").
+			Joins("JOIN app_modules AS m ON m.app_id = e.app_id AND m.module_code = e.module_code AND m.status = ? AND m.deleted_at IS NULL", 1).
+			Where("e.app_id = ? AND e.module_code IN ? AND e.environment = ?", appID, codes, configEnv)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	configs := make(map[string]string, len(rows))
+	for _, row := range rows {
+		configs[row.ModuleCode] = row.Config
+	}
+	return configs, nil
+}
+
+type configKey struct {
+	appID uint
+	code  string
+}
+
+type configEntry struct {
+	data    []byte // 合并后的配置JSON，读取时解码为副本，调用方可以随意修改
+	expires time.Time
+}
+
+// configCache 按APP缓存合并后的模块配置
+var configCache = struct {
+	sync.RWMutex
+	entries map[configKey]configEntry
+}{entries: make(map[configKey]configEntry)}
+
+// InitConfigStore 初始化模块配置的数据库连接与服务所在环境，environment 为空时使用 prod
+func InitConfigStore(db *gorm.DB, environment string) error {
+	switch environment {
+	case "":
+		environment = ConfigEnvProd
+	case ConfigEnvDev, ConfigEnvStaging, ConfigEnvProd:
+	default:
+		return fmt.Errorf("无效的配置环境: %s", environment)
+	}
+	configDB = db
+	configEnv = environment
+	return nil
+}
+
+// ConfigEnvironment 返回模块配置生效的环境
+func ConfigEnvironment() string {
+	return configEnv
+}
+
+// LoadConfig 返回APP指定模块或功能的生效配置
+// appID 为 0（无法确定APP）时只返回 Schema 默认值
+func LoadConfig(appID uint, code string) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	if err := DecodeConfig(appID, code, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DecodeConfig 将APP指定模块或功能的生效配置解码到 v
+func DecodeConfig(appID uint, code string, v interface{}) error {
+	data, err := cachedConfig(appID, code)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("模块 %s 的配置无法解析: %w", code, err)
+	}
+	return nil
+}
+
+// AppConfig 返回APP指定模块或功能的类型化配置，T 按 json 标签解码
+func AppConfig[T any](appID uint, code string) (T, error) {
+	var config T
+	err := DecodeConfig(appID, code, &config)
+	return config, err
+}
+
+// RequestConfig 返回当前请求所属APP的类型化配置
+// APP由模块访问控制中间件解析；路由未经过该中间件或无法确定APP时只包含 Schema 默认值
+func RequestConfig[T any](c *gin.Context, code string) (T, error) {
+	return AppConfig[T](c.GetUint(AppIDContextKey), code)
+}
+
+// ReloadConfig 使APP的模块配置缓存失效并发布 module.config_changed，修改配置后调用
+// 持有派生状态（如推送通道实例）的模块订阅该事件自行刷新
+func ReloadConfig(ctx context.Context, appID uint, code, operator string) {
+	InvalidateConfig(appID)
+	err := Publish(ctx, EventModuleConfigChanged, "module", appID, ModuleChanged{
+		AppID:      appID,
+		ModuleCode: code,
+		Operator:   operator,
+	})
+	if err != nil {
+		log.Printf("[ModuleConfig] Failed to publish %s for %s (app %d): %v", EventModuleConfigChanged, code, appID, err)
+	}
+}
+
+// InvalidateConfig 清除APP全部模块配置的缓存
+// 模块级配置会合并进其下每个功能的配置，因此按APP整体失效
+func InvalidateConfig(appID uint) {
+	configCache.Lock()
+	defer configCache.Unlock()
+	for key := range configCache.entries {
+		if key.appID == appID {
+			delete(configCache.entries, key)
+		}
+	}
+}
+
+func cachedConfig(appID uint, code string) ([]byte, error) {
+	key := configKey{appID: appID, code: code}
+	configCache.RLock()
+	entry, ok := configCache.entries[key]
+	configCache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.data, nil
+	}
+
+	config, err := resolveConfig(appID, code)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	configCache.Lock()
+	configCache.entries[key] = configEntry{data: data, expires: time.Now().Add(configCacheTTL)}
+	configCache.Unlock()
+	return data, nil
+}
+
+// resolveConfig 合并模块级与功能级配置并补全 Schema 默认值
+func resolveConfig(appID uint, code string) (map[string]interface{}, error) {
+	schema, owner := configSchema(code)
+
+	config := map[string]interface{}{}
+	stored := false
+	if appID != 0 {
+		codes := []string{code}
+		if owner != "" && owner != code {
+			codes = []string{owner, code}
+		}
+		raw, err := configLoader(appID, codes)
+		if err != nil {
+			return nil, err
+		}
+		// 模块级配置在前，功能级配置覆盖同名字段
+		for _, c := range codes {
+			if raw[c] == "" {
+				continue
+			}
+			var layer map[string]interface{}
+			if err := json.Unmarshal([]byte(raw[c]), &layer); err != nil {
+				return nil, fmt.Errorf("APP %d 的模块 %s 配置不是合法的 JSON 对象: %w", appID, c, err)
+			}
+			config = mergeConfig(config, layer)
+			stored = true
+		}
+	}
+
+	validated, err := validator.ValidateModuleConfig(schema, config)
+	if err == nil {
+		return validated, nil
+	}
+	// 已保存的配置不满足 Schema（如历史配置不满足后来收紧的 Schema）时不注入无效配置，回退到默认值；
+	// 未配置时 Schema 的必填字段可能没有默认值，同样只补全默认值，由模块自行处理缺失字段
+	if stored {
+		log.Printf("[ModuleConfig] Config of %s for app %d does not match schema, falling back to defaults: %v", code, appID, err)
+	}
+	return validator.ApplyDefaults(schema, nil), nil
+}
+
+// configSchema 返回已注册功能的配置 Schema 及其所属模块Code
+// code 为模块Code时没有 Schema，所属模块为其自身
+func configSchema(code string) (map[string]interface{}, string) {
+	for _, m := range GetAllModules() {
+		meta := m.Meta()
+		if meta.Code == code {
+			return nil, code
+		}
+		for _, fn := range m.GetFunctions() {
+			if fn.Code == code {
+				return fn.ConfigSchema, meta.Code
+			}
+		}
+	}
+	return nil, ""
+}
+
+// mergeConfig 将 overlay 深度合并到 base，嵌套对象逐字段合并，其他值整体覆盖
+func mergeConfig(base, overlay map[string]interface{}) map[string]interface{} {
+	for k, v := range overlay {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if existing, ok := base[k].(map[string]interface{}); ok {
+				base[k] = mergeConfig(existing, sub)
+				continue
+			}
+		}
+		base[k] = v
+	}
+	return base
+}
@@ -0,0 +1,133 @@
+package module
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type uploadConfig struct {
+	MaxSizeMB int               `json:"max_size_mb"`
+	Types     []string          `json:"types"`
+	Storage   map[string]string `json:"storage"`
+}
+
+// setupConfigStore 注册带 Schema 的测试模块并替换配置来源
+func setupConfigStore(t *testing.T, stored map[uint]map[string]string) *int {
+	t.Helper()
+	Clear()
+	t.Cleanup(Clear)
+
+	Register(NewBaseModule(Meta{Code: "file_storage"}, []Function{
+		{Code: "file_upload", ConfigSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"max_size_mb": map[string]interface{}{"type": "integer", "default": 50},
+				"types":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				"storage":     map[string]interface{}{"type": "object"},
+			},
+		}},
+	}))
+
+	loads := 0
+	origLoader := configLoader
+	configLoader = func(appID uint, codes []string) (map[string]string, error) {
+		loads++
+		result := map[string]string{}
+		for _, code := range codes {
+			if config, ok := stored[appID][code]; ok {
+				result[code] = config
+			}
+		}
+		return result, nil
+	}
+	t.Cleanup(func() { configLoader = origLoader })
+	return &loads
+}
+
+func TestAppConfigMerge(t *testing.T) {
+	setupConfigStore(t, map[uint]map[string]string{
+		1: {
+			"file_storage": `{"max_size_mb": 10, "storage": {"bucket": "shared", "region": "cn"}}`,
+			"file_upload":  `{"types": ["image/png"], "storage": {"bucket": "uploads"}}`,
+		},
+		2: {"file_upload": `{"max_size_mb": 5}`},
+	})
+
+	cases := []struct {
+		appID uint
+		want  uploadConfig
+	}{
+		// 功能级配置覆盖模块级配置，嵌套对象逐字段合并
+		{1, uploadConfig{MaxSizeMB: 10, Types: []string{"image/png"}, Storage: map[string]string{"bucket": "uploads", "region": "cn"}}},
+		{2, uploadConfig{MaxSizeMB: 5}},
+		// 未配置的APP使用 Schema 默认值
+		{3, uploadConfig{MaxSizeMB: 50}},
+		{0, uploadConfig{MaxSizeMB: 50}},
+	}
+	for _, tc := range cases {
+		got, err := AppConfig[uploadConfig](tc.appID, "file_upload")
+		if err != nil {
+			t.Fatalf("app %d: %v", tc.appID, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("app %d: got %+v, want %+v", tc.appID, got, tc.want)
+		}
+	}
+}
+
+func TestAppConfigCacheAndReload(t *testing.T) {
+	stored := map[uint]map[string]string{1: {"file_upload": `{"max_size_mb": 5}`}}
+	loads := setupConfigStore(t, stored)
+
+	var changed []ModuleChanged
+	On(EventModuleConfigChanged, "test", Sync, func(ctx context.Context, e Event, change ModuleChanged) error {
+		changed = append(changed, change)
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		config, _ := LoadConfig(1, "file_upload")
+		// 调用方修改返回值不影响缓存
+		config["max_size_mb"] = 999
+	}
+	if *loads != 1 {
+		t.Errorf("expected one load, got %d", *loads)
+	}
+	if got, _ := AppConfig[uploadConfig](1, "file_upload"); got.MaxSizeMB != 5 {
+		t.Errorf("cached config was modified: %+v", got)
+	}
+
+	stored[1]["file_upload"] = `{"max_size_mb": 20}`
+	ReloadConfig(context.Background(), 1, "file_upload", "admin")
+	if got, _ := AppConfig[uploadConfig](1, "file_upload"); got.MaxSizeMB != 20 {
+		t.Errorf("expected reloaded config, got %+v", got)
+	}
+	want := []ModuleChanged{{AppID: 1, ModuleCode: "file_upload", Operator: "admin"}}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("events = %+v", changed)
+	}
+}
+
+func TestAppConfigInvalidJSON(t *testing.T) {
+	setupConfigStore(t, map[uint]map[string]string{1: {"file_upload": `not json`}})
+
+	if _, err := AppConfig[uploadConfig](1, "file_upload"); err == nil {
+		t.Error("expected error for malformed stored config")
+	}
+}
+
+func TestAppConfigInvalidStoredConfig(t *testing.T) {
+	setupConfigStore(t, map[uint]map[string]string{
+		1: {"file_upload": `{"max_size_mb": "big", "types": ["image/png"]}`},
+	})
+
+	// 不满足 Schema 的配置不会注入模块，回退到默认值
+	got, err := AppConfig[uploadConfig](1, "file_upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (uploadConfig{MaxSizeMB: 50}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
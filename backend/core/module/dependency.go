@@ -0,0 +1,187 @@
+// Package module 提供模块依赖解析功能
+// 依赖声明在 Function.Dependencies 中，节点可以是功能Code，也可以是模块Code
+// （模块节点的依赖为其全部功能对外部功能的依赖）
+package module
+
+import (
+	"sort"
+	"strings"
+)
+
+// CycleError 依赖关系中存在循环
+type CycleError struct {
+	Path []string // 形如 [a, b, c, a]
+}
+
+func (e *CycleError) Error() string {
+	return "检测到循环依赖: " + strings.Join(e.Path, " -> ")
+}
+
+// DependencyGraph 功能依赖图
+type DependencyGraph struct {
+	deps    map[string][]string
+	source  map[string]string   // 功能Code -> 所属模块Code
+	members map[string][]string // 模块Code -> 功能Code
+}
+
+// NewDependencyGraph 创建空的依赖图
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		deps:    make(map[string][]string),
+		source:  make(map[string]string),
+		members: make(map[string][]string),
+	}
+}
+
+// BuildDependencyGraph 根据已注册模块构建依赖图
+func BuildDependencyGraph() *DependencyGraph {
+	g := NewDependencyGraph()
+	for _, m := range GetAllModules() {
+		meta := m.Meta()
+		for _, fn := range m.GetFunctions() {
+			g.Add(fn.Code, meta.Code, fn.Dependencies)
+		}
+	}
+	return g
+}
+
+// Add 添加一个功能节点，重复添加时合并依赖
+func (g *DependencyGraph) Add(code, moduleCode string, deps []string) {
+	if _, exists := g.deps[code]; !exists {
+		g.deps[code] = nil
+		if moduleCode != "" && moduleCode != code {
+			g.source[code] = moduleCode
+			g.members[moduleCode] = append(g.members[moduleCode], code)
+		}
+	}
+	for _, dep := range deps {
+		if dep != "" && !contains(g.deps[code], dep) {
+			g.deps[code] = append(g.deps[code], dep)
+		}
+	}
+}
+
+// Known 判断功能或模块是否存在于依赖图中
+func (g *DependencyGraph) Known(code string) bool {
+	_, isFunction := g.deps[code]
+	_, isModule := g.members[code]
+	return isFunction || isModule
+}
+
+// Source 返回功能所属的模块Code，模块节点返回空串
+func (g *DependencyGraph) Source(code string) string {
+	return g.source[code]
+}
+
+// Dependencies 返回直接依赖
+// 模块节点返回其功能对模块外部的全部依赖
+func (g *DependencyGraph) Dependencies(code string) []string {
+	members, isModule := g.members[code]
+	if !isModule {
+		return g.deps[code]
+	}
+	var deps []string
+	for _, member := range members {
+		for _, dep := range g.deps[member] {
+			if dep != code && g.source[dep] != code && !contains(deps, dep) {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// Closure 返回全部传递依赖，按拓扑顺序排列（被依赖的在前），不含自身
+// 依赖中存在循环时返回 *CycleError
+func (g *DependencyGraph) Closure(code string) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var order, stack []string
+
+	var visit func(node string) error
+	visit = func(node string) error {
+		switch state[node] {
+		case done:
+			return nil
+		case visiting:
+			start := indexOf(stack, node)
+			path := append(append([]string{}, stack[start:]...), node)
+			return &CycleError{Path: path}
+		}
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, dep := range g.Dependencies(node) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = done
+		order = append(order, node)
+		return nil
+	}
+
+	if err := visit(code); err != nil {
+		return nil, err
+	}
+	// 后序遍历的最后一个节点是自身
+	return order[:len(order)-1], nil
+}
+
+// FindCycle 返回从 code 出发可达的一条循环依赖路径，不存在时返回 nil
+func (g *DependencyGraph) FindCycle(code string) []string {
+	if _, err := g.Closure(code); err != nil {
+		if cycle, ok := err.(*CycleError); ok {
+			return cycle.Path
+		}
+	}
+	return nil
+}
+
+// Dependents 返回直接或间接依赖 code 的全部节点，按名称排序
+// 依赖某个功能的节点同时视为依赖该功能所属的模块
+func (g *DependencyGraph) Dependents(code string) []string {
+	reverse := make(map[string][]string)
+	for node, deps := range g.deps {
+		for _, dep := range deps {
+			reverse[dep] = append(reverse[dep], node)
+			if src := g.source[dep]; src != "" && src != g.source[node] {
+				reverse[src] = append(reverse[src], node)
+			}
+		}
+	}
+
+	seen := map[string]bool{code: true}
+	queue := []string{code}
+	var result []string
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reverse[node] {
+			if seen[dependent] {
+				continue
+			}
+			seen[dependent] = true
+			result = append(result, dependent)
+			queue = append(queue, dependent)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(list []string, s string) bool {
+	return indexOf(list, s) >= 0
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package module
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testGraph() *DependencyGraph {
+	g := NewDependencyGraph()
+	g.Add("user_list", "user_management", nil)
+	g.Add("segment_manage", "segment", []string{"user_list"})
+	g.Add("segment_estimate", "segment", []string{"segment_manage"})
+	g.Add("config_rollout", "config_management", []string{"segment_estimate"})
+	g.Add("config_list", "config_management", nil)
+	return g
+}
+
+func TestClosureTopologicalOrder(t *testing.T) {
+	g := testGraph()
+	got, err := g.Closure("config_rollout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"user_list", "segment_manage", "segment_estimate"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// 模块节点的依赖为其功能对模块外部的依赖
+	got, err = g.Closure("segment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"user_list"}) {
+		t.Errorf("module closure = %v", got)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	g := testGraph()
+	want := []string{"config_rollout", "segment_estimate", "segment_manage"}
+	if got := g.Dependents("user_list"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// 依赖模块内功能的节点同样依赖该模块，模块自身的功能除外
+	if got := g.Dependents("segment"); !reflect.DeepEqual(got, []string{"config_rollout"}) {
+		t.Errorf("module dependents = %v", got)
+	}
+}
+
+func TestCycleDetection(t *testing.T) {
+	g := testGraph()
+	if path := g.FindCycle("config_rollout"); path != nil {
+		t.Fatalf("unexpected cycle %v", path)
+	}
+
+	g.Add("user_list", "user_management", []string{"config_rollout"})
+	want := []string{"config_rollout", "segment_estimate", "segment_manage", "user_list", "config_rollout"}
+	if path := g.FindCycle("config_rollout"); !reflect.DeepEqual(path, want) {
+		t.Errorf("got %v, want %v", path, want)
+	}
+
+	_, err := g.Closure("segment_estimate")
+	var cycle *CycleError
+	if !errors.As(err, &cycle) || cycle.Path[0] != cycle.Path[len(cycle.Path)-1] {
+		t.Errorf("expected closed cycle path, got %v", err)
+	}
+}
@@ -0,0 +1,383 @@
+// Package module 提供模块间的进程内事件总线
+// 模块在 Init 中订阅事件，通过 Publish 发布领域事件，彼此之间无需直接导入
+// 伴随业务数据写入的事件应在业务事务内通过 PublishTx 发布，避免提交后、发布前进程退出导致事件丢失
+package module
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 领域事件类型
+const (
+	EventAppCreated      = "app.created"
+	EventModuleEnabled   = "module.enabled"
+	EventModuleDisabled  = "module.disabled"
+	EventAlertTriggered  = "alert.triggered"
+	EventDocumentCreated = "document.created"
+
+	// EventAll 订阅全部事件
+	EventAll = "*"
+)
+
+// AppCreated app.created 事件数据
+type AppCreated struct {
+	AppID   uint     `json:"app_id"`
+	Name    string   `json:"name"`
+	Modules []string `json:"modules"`
+}
+
+// ModuleChanged module.enabled / module.disabled / module.config_changed 事件数据
+type ModuleChanged struct {
+	AppID      uint   `json:"app_id"`
+	ModuleCode string `json:"module_code"`
+	Operator   string `json:"operator,omitempty"`
+}
+
+// AlertTriggered alert.triggered 事件数据
+type AlertTriggered struct {
+	AppID      uint    `json:"app_id"`
+	AlertID    uint    `json:"alert_id"`
+	Name       string  `json:"name"`
+	MetricName string  `json:"metric_name"`
+	Condition  string  `json:"condition"`
+	Threshold  float64 `json:"threshold"`
+	Value      float64 `json:"value"`
+}
+
+// DocumentCreated document.created 事件数据
+type DocumentCreated struct {
+	AppID        uint   `json:"app_id"`
+	CollectionID uint   `json:"collection_id"`
+	Collection   string `json:"collection"`
+	DocumentID   uint   `json:"document_id"`
+	CreatedBy    uint   `json:"created_by"`
+}
+
+// Event 领域事件
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	AppID     uint            `json:"app_id"`
+	Source    string          `json:"source"` // 发布方模块Code
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEvent 创建事件，payload 会序列化为 JSON
+func NewEvent(eventType, source string, appID uint, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("序列化事件 %s 失败: %w", eventType, err)
+	}
+	return Event{
+		ID:        newEventID(),
+		Type:      eventType,
+		AppID:     appID,
+		Source:    source,
+		Payload:   data,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Decode 将事件数据解析到 v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DeliveryMode 事件投递方式
+type DeliveryMode int
+
+const (
+	// Sync 在 Publish 调用中依次执行，错误返回给发布方
+	Sync DeliveryMode = iota
+	// Async 由后台协程执行，启用 outbox 时先持久化再投递，失败会重试
+	Async
+)
+
+// EventHandler 事件处理器
+// 异步处理器可能收到重复投递（outbox 重试），应按 Event.ID 保证幂等
+type EventHandler func(ctx context.Context, e Event) error
+
+type subscription struct {
+	id        uint64
+	eventType string
+	name      string
+	mode      DeliveryMode
+	handler   EventHandler
+}
+
+type asyncDelivery struct {
+	event Event
+	sub   *subscription
+}
+
+// 总线默认参数
+const (
+	defaultEventWorkers = 4
+	eventQueueSize      = 1024
+)
+
+// EventBus 进程内事件总线
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[string][]*subscription
+	nextID uint64
+
+	workers int
+	queue   chan asyncDelivery
+	outbox  *Outbox
+
+	once     sync.Once
+	stopOnce sync.Once
+	stopped  chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewEventBus 创建事件总线，workers 为异步投递协程数
+func NewEventBus(workers int) *EventBus {
+	if workers <= 0 {
+		workers = defaultEventWorkers
+	}
+	return &EventBus{
+		subs:    make(map[string][]*subscription),
+		workers: workers,
+		queue:   make(chan asyncDelivery, eventQueueSize),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Subscribe 订阅事件，name 用于日志定位，返回取消订阅函数
+// eventType 为 EventAll 时接收全部事件
+func (b *EventBus) Subscribe(eventType, name string, mode DeliveryMode, handler EventHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &subscription{id: b.nextID, eventType: eventType, name: name, mode: mode, handler: handler}
+	b.subs[eventType] = append(b.subs[eventType], sub)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		list := b.subs[eventType]
+		for i, s := range list {
+			if s.id == sub.id {
+				b.subs[eventType] = append(list[:i:i], list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// subscribers 返回事件的订阅者，按订阅顺序排列
+func (b *EventBus) subscribers(eventType string, mode DeliveryMode) []*subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var result []*subscription
+	for _, key := range []string{eventType, EventAll} {
+		for _, sub := range b.subs[key] {
+			if sub.mode == mode {
+				result = append(result, sub)
+			}
+		}
+	}
+	return result
+}
+
+// Publish 发布事件
+// 同步订阅者在当前协程依次执行，返回它们的错误；异步订阅者由后台协程执行，不影响返回值
+func (b *EventBus) Publish(ctx context.Context, e Event) error {
+	return b.publish(ctx, nil, e)
+}
+
+// PublishTx 在业务事务 tx 内发布事件
+// 启用 outbox 时事件与业务数据在同一事务中写入，提交后才投递给异步订阅者，回滚时一并撤销；
+// 写入失败时返回错误，调用方应回滚事务。同步订阅者在提交前执行，返回错误时调用方同样应回滚。
+// 未启用 outbox 时异步订阅者立即在内存中投递，与 Publish 相同，不保证事务回滚后撤回，进程退出时可能丢失
+func (b *EventBus) PublishTx(ctx context.Context, tx *gorm.DB, e Event) error {
+	return b.publish(ctx, tx, e)
+}
+
+func (b *EventBus) publish(ctx context.Context, tx *gorm.DB, e Event) error {
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	var errs []error
+	for _, sub := range b.subscribers(e.Type, Sync) {
+		if err := deliver(ctx, sub, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	async := b.subscribers(e.Type, Async)
+	if len(async) == 0 {
+		return errors.Join(errs...)
+	}
+	if b.outbox != nil {
+		db := tx
+		if db == nil {
+			db = b.outbox.db
+		}
+		err := b.outbox.store(db, e)
+		if err == nil {
+			return errors.Join(errs...)
+		}
+		if tx != nil {
+			// 事务内写入失败时事务已不可用，由调用方回滚，不退回内存投递
+			return errors.Join(append(errs, fmt.Errorf("写入事件发件箱失败: %w", err))...)
+		}
+		log.Printf("[EventBus] Failed to store event %s in outbox, delivering in memory: %v", e.ID, err)
+	}
+	for _, sub := range async {
+		b.enqueue(ctx, asyncDelivery{event: e, sub: sub})
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue 放入异步队列，队列已满时等待，发布方取消或总线停止时丢弃
+func (b *EventBus) enqueue(ctx context.Context, d asyncDelivery) {
+	select {
+	case b.queue <- d:
+	case <-ctx.Done():
+		log.Printf("[EventBus] Dropped event %s for %s: %v", d.event.ID, d.sub.name, ctx.Err())
+	case <-b.stopped:
+		log.Printf("[EventBus] Dropped event %s for %s: bus stopped", d.event.ID, d.sub.name)
+	}
+}
+
+// deliver 调用单个订阅者，panic 被捕获并转换为错误，不影响其他订阅者
+func deliver(ctx context.Context, sub *subscription, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[EventBus] Handler %s panicked on %s: %v\n%s", sub.name, e.Type, r, debug.Stack())
+			err = fmt.Errorf("事件处理器 %s 异常: %v", sub.name, r)
+		}
+	}()
+	if err := sub.handler(ctx, e); err != nil {
+		return fmt.Errorf("事件处理器 %s 处理 %s 失败: %w", sub.name, e.Type, err)
+	}
+	return nil
+}
+
+// Start 启动异步投递协程（启用 outbox 时同时启动 outbox 投递）
+func (b *EventBus) Start() {
+	b.once.Do(func() {
+		for i := 0; i < b.workers; i++ {
+			b.wg.Add(1)
+			go b.loop()
+		}
+		if b.outbox != nil {
+			b.wg.Add(1)
+			go b.outbox.loop(b)
+		}
+		log.Printf("[EventBus] Started (%d workers, outbox: %v)", b.workers, b.outbox != nil)
+	})
+}
+
+// Stop 停止总线，内存队列中剩余的事件在 ctx 截止前处理完
+// outbox 中未投递的事件保留在表中，下次启动后继续投递
+func (b *EventBus) Stop(ctx context.Context) error {
+	b.stopOnce.Do(func() { close(b.stopped) })
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("事件总线停止超时: %w", ctx.Err())
+	}
+}
+
+func (b *EventBus) loop() {
+	defer b.wg.Done()
+	for {
+		select {
+		case d := <-b.queue:
+			b.handleAsync(d)
+		case <-b.stopped:
+			// 处理完已入队的事件再退出
+			for {
+				select {
+				case d := <-b.queue:
+					b.handleAsync(d)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *EventBus) handleAsync(d asyncDelivery) {
+	if err := deliver(context.Background(), d.sub, d.event); err != nil {
+		log.Printf("[EventBus] %v", err)
+	}
+}
+
+// defaultBus 全局事件总线，随模块生命周期启动和停止
+var defaultBus = NewEventBus(defaultEventWorkers)
+
+// Bus 返回全局事件总线
+func Bus() *EventBus {
+	return defaultBus
+}
+
+// Subscribe 在全局事件总线上订阅事件
+func Subscribe(eventType, name string, mode DeliveryMode, handler EventHandler) func() {
+	return defaultBus.Subscribe(eventType, name, mode, handler)
+}
+
+// On 订阅事件并将数据解析为 T
+func On[T any](eventType, name string, mode DeliveryMode, handler func(ctx context.Context, e Event, payload T) error) func() {
+	return defaultBus.Subscribe(eventType, name, mode, func(ctx context.Context, e Event) error {
+		var payload T
+		if err := e.Decode(&payload); err != nil {
+			return fmt.Errorf("解析事件数据失败: %w", err)
+		}
+		return handler(ctx, e, payload)
+	})
+}
+
+// Publish 在全局事件总线上发布事件
+func Publish(ctx context.Context, eventType, source string, appID uint, payload interface{}) error {
+	e, err := NewEvent(eventType, source, appID, payload)
+	if err != nil {
+		return err
+	}
+	return defaultBus.Publish(ctx, e)
+}
+
+// PublishTx 在全局事件总线上于业务事务内发布事件
+func PublishTx(ctx context.Context, tx *gorm.DB, eventType, source string, appID uint, payload interface{}) error {
+	e, err := NewEvent(eventType, source, appID, payload)
+	if err != nil {
+		return err
+	}
+	return defaultBus.PublishTx(ctx, tx, e)
+}
@@ -0,0 +1,208 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPublishSync(t *testing.T) {
+	bus := NewEventBus(1)
+
+	var got []string
+	bus.Subscribe(EventModuleEnabled, "first", Sync, func(ctx context.Context, e Event) error {
+		var payload ModuleChanged
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		got = append(got, "first:"+payload.ModuleCode)
+		return nil
+	})
+	bus.Subscribe(EventModuleEnabled, "failing", Sync, func(ctx context.Context, e Event) error {
+		return errors.New("boom")
+	})
+	bus.Subscribe(EventModuleEnabled, "panicking", Sync, func(ctx context.Context, e Event) error {
+		panic("bad handler")
+	})
+	bus.Subscribe(EventAll, "all", Sync, func(ctx context.Context, e Event) error {
+		got = append(got, "all:"+e.Type)
+		return nil
+	})
+	bus.Subscribe(EventModuleDisabled, "other", Sync, func(ctx context.Context, e Event) error {
+		got = append(got, "other")
+		return nil
+	})
+
+	e, err := NewEvent(EventModuleEnabled, "module", 1, ModuleChanged{AppID: 1, ModuleCode: "push"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Publish(context.Background(), e)
+	if err == nil {
+		t.Fatal("expected handler errors")
+	}
+
+	// 失败和 panic 的处理器不影响后续订阅者
+	want := []string{"first:push", "all:module.enabled"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPublishAsync(t *testing.T) {
+	bus := NewEventBus(2)
+
+	var (
+		mu  sync.Mutex
+		got []uint
+	)
+	bus.Subscribe(EventDocumentCreated, "panicking", Async, func(ctx context.Context, e Event) error {
+		panic("bad handler")
+	})
+	bus.Subscribe(EventDocumentCreated, "collect", Async, func(ctx context.Context, e Event) error {
+		var payload DocumentCreated
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		mu.Lock()
+		got = append(got, payload.DocumentID)
+		mu.Unlock()
+		return nil
+	})
+	bus.Start()
+
+	for i := uint(1); i <= 3; i++ {
+		e, _ := NewEvent(EventDocumentCreated, "baas", 1, DocumentCreated{AppID: 1, DocumentID: i})
+		if err := bus.Publish(context.Background(), e); err != nil {
+			t.Fatalf("async errors must not reach the publisher: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bus.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 deliveries before stop returned, got %v", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewEventBus(1)
+
+	calls := 0
+	unsubscribe := bus.Subscribe(EventAppCreated, "count", Sync, func(ctx context.Context, e Event) error {
+		calls++
+		return nil
+	})
+	bus.Publish(context.Background(), Event{Type: EventAppCreated})
+	unsubscribe()
+	bus.Publish(context.Background(), Event{Type: EventAppCreated})
+
+	if calls != 1 {
+		t.Errorf("calls = %d", calls)
+	}
+}
+
+func TestOn(t *testing.T) {
+	Clear()
+	t.Cleanup(Clear)
+
+	var got AlertTriggered
+	On(EventAlertTriggered, "typed", Sync, func(ctx context.Context, e Event, alert AlertTriggered) error {
+		got = alert
+		return nil
+	})
+	if err := Publish(context.Background(), EventAlertTriggered, "monitor", 7, AlertTriggered{AppID: 7, AlertID: 3, Value: 99}); err != nil {
+		t.Fatal(err)
+	}
+	if got.AlertID != 3 || got.Value != 99 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		4:  40 * time.Second,
+		20: outboxMaxBackoff,
+	}
+	for attempts, want := range cases {
+		if got := outboxBackoff(attempts); got != want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+// newOutboxBus 创建启用发件箱的总线，发件箱写入 sqlmock，总线不启动，异步投递停留在队列中
+func newOutboxBus(t *testing.T) (*EventBus, *gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}),
+		&gorm.Config{SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewEventBus(1)
+	bus.outbox = &Outbox{db: db, notify: make(chan struct{}, 1)}
+	bus.Subscribe(EventDocumentCreated, "async", Async, func(ctx context.Context, e Event) error { return nil })
+	return bus, db, mock
+}
+
+func TestPublishTxRollback(t *testing.T) {
+	bus, db, mock := newOutboxBus(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `event_outbox`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	e, _ := NewEvent(EventDocumentCreated, "baas", 1, DocumentCreated{AppID: 1, DocumentID: 1})
+	tx := db.Begin()
+	if err := bus.PublishTx(context.Background(), tx, e); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	// 事件只在事务内写入发件箱，回滚后随事务撤销，不会在内存中投递
+	if n := len(bus.queue); n != 0 {
+		t.Errorf("queued %d in-memory deliveries", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPublishTxOutboxFailure(t *testing.T) {
+	bus, db, mock := newOutboxBus(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `event_outbox`").WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	e, _ := NewEvent(EventDocumentCreated, "baas", 1, DocumentCreated{AppID: 1, DocumentID: 1})
+	tx := db.Begin()
+	err := bus.PublishTx(context.Background(), tx, e)
+	tx.Rollback()
+
+	if err == nil {
+		t.Fatal("expected outbox write error")
+	}
+	if n := len(bus.queue); n != 0 {
+		t.Errorf("outbox failure inside a transaction must not fall back to memory, queued %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
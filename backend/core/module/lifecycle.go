@@ -0,0 +1,248 @@
+// Package module 提供模块生命周期管理
+// 启动顺序由功能声明的依赖推导：模块A的功能依赖模块B的功能时，B先于A初始化和启动，关闭时逆序停止
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State 模块生命周期状态
+type State string
+
+const (
+	StateRegistered  State = "registered"
+	StateInitialized State = "initialized"
+	StateRunning     State = "running"
+	StateStopped     State = "stopped"
+	StateFailed      State = "failed"
+)
+
+// healthCheckTimeout 单个模块健康检查的超时时间
+const healthCheckTimeout = 5 * time.Second
+
+// HealthReport 模块健康状况
+type HealthReport struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	State     State  `json:"state"`
+	Healthy   bool   `json:"healthy"`
+	Message   string `json:"message,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+var (
+	stateLock sync.RWMutex
+	states    = make(map[string]State)
+	failures  = make(map[string]string)
+	// started 记录已启动的模块，按启动顺序
+	started []Module
+)
+
+func setState(code string, state State, err error) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	states[code] = state
+	if err != nil {
+		failures[code] = err.Error()
+	} else {
+		delete(failures, code)
+	}
+}
+
+// GetState 返回模块当前的生命周期状态
+func GetState(code string) State {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	if state, ok := states[code]; ok {
+		return state
+	}
+	return StateRegistered
+}
+
+// moduleGraph 根据功能依赖推导模块之间的依赖图，忽略未注册的模块
+func moduleGraph(all []Module) *DependencyGraph {
+	functions := NewDependencyGraph()
+	registered := make(map[string]bool, len(all))
+	for _, m := range all {
+		meta := m.Meta()
+		registered[meta.Code] = true
+		for _, fn := range m.GetFunctions() {
+			functions.Add(fn.Code, meta.Code, fn.Dependencies)
+		}
+	}
+
+	g := NewDependencyGraph()
+	for _, m := range all {
+		code := m.Meta().Code
+		var deps []string
+		for _, dep := range functions.Dependencies(code) {
+			owner := functions.Source(dep)
+			if owner == "" {
+				owner = dep // 直接依赖模块Code
+			}
+			if owner != code && registered[owner] {
+				deps = append(deps, owner)
+			}
+		}
+		g.Add(code, "", deps)
+	}
+	return g
+}
+
+// StartOrder 返回按依赖排序的模块列表，无依赖关系的模块保持注册顺序
+// 模块之间存在循环依赖时返回 *CycleError
+func StartOrder() ([]Module, error) {
+	all := GetAllModules()
+	byCode := make(map[string]Module, len(all))
+	for _, m := range all {
+		byCode[m.Meta().Code] = m
+	}
+
+	g := moduleGraph(all)
+	seen := make(map[string]bool, len(all))
+	ordered := make([]Module, 0, len(all))
+	for _, m := range all {
+		code := m.Meta().Code
+		deps, err := g.Closure(code)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range append(deps, code) {
+			if !seen[c] {
+				seen[c] = true
+				ordered = append(ordered, byCode[c])
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// InitAllModules 按依赖顺序初始化所有已注册的模块
+// 返回第一个遇到的错误
+func InitAllModules() error {
+	ordered, err := StartOrder()
+	if err != nil {
+		return err
+	}
+	for _, m := range ordered {
+		code := m.Meta().Code
+		if err := m.Init(); err != nil {
+			setState(code, StateFailed, err)
+			return fmt.Errorf("failed to init module %s: %w", code, err)
+		}
+		setState(code, StateInitialized, nil)
+	}
+	return nil
+}
+
+// StartAllModules 启动事件总线，再按依赖顺序启动已初始化的模块
+// 某个模块启动失败时，已启动的模块会被逆序停止
+func StartAllModules(ctx context.Context) error {
+	ordered, err := StartOrder()
+	if err != nil {
+		return err
+	}
+	defaultBus.Start()
+	for _, m := range ordered {
+		code := m.Meta().Code
+		if GetState(code) != StateInitialized {
+			continue
+		}
+		if starter, ok := m.(Starter); ok {
+			if err := starter.Start(ctx); err != nil {
+				setState(code, StateFailed, err)
+				if stopErr := StopAllModules(ctx); stopErr != nil {
+					log.Printf("[Module] Failed to stop modules after start failure: %v", stopErr)
+				}
+				return fmt.Errorf("failed to start module %s: %w", code, err)
+			}
+		}
+		setState(code, StateRunning, nil)
+
+		stateLock.Lock()
+		started = append(started, m)
+		stateLock.Unlock()
+	}
+	return nil
+}
+
+// StopAllModules 按启动的逆序停止模块，最后停止事件总线，返回所有停止失败的错误
+func StopAllModules(ctx context.Context) error {
+	stateLock.Lock()
+	toStop := started
+	started = nil
+	stateLock.Unlock()
+
+	var errs []error
+	for i := len(toStop) - 1; i >= 0; i-- {
+		m := toStop[i]
+		code := m.Meta().Code
+		if stopper, ok := m.(Stopper); ok {
+			if err := stopper.Stop(ctx); err != nil {
+				setState(code, StateFailed, err)
+				errs = append(errs, fmt.Errorf("failed to stop module %s: %w", code, err))
+				continue
+			}
+		}
+		setState(code, StateStopped, nil)
+		log.Printf("[Module] Stopped %s", code)
+	}
+	if err := defaultBus.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// CheckHealth 并发检查所有模块的健康状况，结果按注册顺序排列
+// 未运行的模块视为不健康；实现了 HealthChecker 的运行中模块以其检查结果为准
+func CheckHealth(ctx context.Context) []HealthReport {
+	all := GetAllModules()
+	reports := make([]HealthReport, len(all))
+
+	var wg sync.WaitGroup
+	for i, m := range all {
+		meta := m.Meta()
+		report := HealthReport{Code: meta.Code, Name: meta.Name, State: GetState(meta.Code)}
+
+		if report.State != StateRunning {
+			stateLock.RLock()
+			report.Message = failures[meta.Code]
+			stateLock.RUnlock()
+			if report.Message == "" {
+				report.Message = "模块未运行"
+			}
+			reports[i] = report
+			continue
+		}
+
+		checker, ok := m.(HealthChecker)
+		if !ok {
+			report.Healthy = true
+			reports[i] = report
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, report HealthReport, checker HealthChecker) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := checker.HealthCheck(checkCtx)
+			report.LatencyMs = time.Since(start).Milliseconds()
+			report.Healthy = err == nil
+			if err != nil {
+				report.Message = err.Error()
+			}
+			reports[i] = report
+		}(i, report, checker)
+	}
+	wg.Wait()
+	return reports
+}
@@ -0,0 +1,126 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testModule struct {
+	*BaseModule
+	events    *[]string
+	startErr  error
+	healthErr error
+}
+
+func newTestModule(code string, events *[]string, functions ...Function) *testModule {
+	return &testModule{BaseModule: NewBaseModule(Meta{Code: code, Name: code}, functions), events: events}
+}
+
+func (m *testModule) Init() error {
+	*m.events = append(*m.events, "init:"+m.Meta().Code)
+	return nil
+}
+
+func (m *testModule) Start(ctx context.Context) error {
+	*m.events = append(*m.events, "start:"+m.Meta().Code)
+	return m.startErr
+}
+
+func (m *testModule) Stop(ctx context.Context) error {
+	*m.events = append(*m.events, "stop:"+m.Meta().Code)
+	return nil
+}
+
+func (m *testModule) HealthCheck(ctx context.Context) error {
+	return m.healthErr
+}
+
+// registerTestModules 注册 config -> segment -> user 的依赖链，注册顺序与依赖顺序相反
+func registerTestModules(t *testing.T) (*[]string, map[string]*testModule) {
+	t.Helper()
+	Clear()
+	t.Cleanup(Clear)
+
+	events := &[]string{}
+	mods := map[string]*testModule{
+		"config":  newTestModule("config", events, Function{Code: "config_rollout", Dependencies: []string{"segment_manage"}}),
+		"segment": newTestModule("segment", events, Function{Code: "segment_manage", Dependencies: []string{"user_list"}}),
+		"user":    newTestModule("user", events, Function{Code: "user_list"}),
+		"log":     newTestModule("log", events, Function{Code: "log_list"}),
+	}
+	for _, code := range []string{"config", "log", "segment", "user"} {
+		Register(mods[code])
+	}
+	return events, mods
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	events, _ := registerTestModules(t)
+
+	if err := InitAllModules(); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartAllModules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopAllModules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"init:user", "init:segment", "init:config", "init:log",
+		"start:user", "start:segment", "start:config", "start:log",
+		"stop:log", "stop:config", "stop:segment", "stop:user",
+	}
+	if !reflect.DeepEqual(*events, want) {
+		t.Errorf("got %v\nwant %v", *events, want)
+	}
+	if state := GetState("config"); state != StateStopped {
+		t.Errorf("state = %s", state)
+	}
+}
+
+func TestStartFailureStopsStarted(t *testing.T) {
+	events, mods := registerTestModules(t)
+	mods["config"].startErr = errors.New("boom")
+
+	if err := InitAllModules(); err != nil {
+		t.Fatal(err)
+	}
+	*events = nil
+	if err := StartAllModules(context.Background()); err == nil {
+		t.Fatal("expected start error")
+	}
+
+	want := []string{"start:user", "start:segment", "start:config", "stop:segment", "stop:user"}
+	if !reflect.DeepEqual(*events, want) {
+		t.Errorf("got %v\nwant %v", *events, want)
+	}
+	if state := GetState("config"); state != StateFailed {
+		t.Errorf("state = %s", state)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	_, mods := registerTestModules(t)
+	mods["segment"].healthErr = errors.New("worker stopped")
+
+	if err := InitAllModules(); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartAllModules(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer StopAllModules(context.Background())
+
+	healthy := map[string]bool{}
+	for _, r := range CheckHealth(context.Background()) {
+		healthy[r.Code] = r.Healthy
+	}
+	want := map[string]bool{"config": true, "log": true, "segment": false, "user": true}
+	if !reflect.DeepEqual(healthy, want) {
+		t.Errorf("got %v, want %v", healthy, want)
+	}
+}
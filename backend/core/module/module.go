@@ -2,7 +2,11 @@
 // 所有功能模块都必须实现这些接口才能被主程序识别和加载
 package module
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
 
 // Meta 包含了模块的基本元数据
 type Meta struct {
@@ -42,6 +46,54 @@ type Module interface {
 	Init() error
 }
 
+// ClientRouteRegistrar 是模块可选实现的接口
+// 用于注册面向APP客户端的路由，这些路由使用 AppID/AppSecret 签名认证而非管理员JWT
+type ClientRouteRegistrar interface {
+	// RegisterClientRoutes 向客户端路由组注册HTTP路由
+	// router 是一个已经带有 /api/v1/client 前缀并启用签名认证的路由组
+	RegisterClientRoutes(router *gin.RouterGroup)
+}
+
+// ConfigTester 是模块可选实现的接口
+// 用于测试功能配置能否连通外部服务（如推送通道凭据、存储服务地址），
+// 调用前配置已通过 ConfigSchema 校验并补全默认值
+type ConfigTester interface {
+	// TestConfig 测试指定功能的配置，返回 nil 表示连通正常
+	// 模块不需要测试该功能时直接返回 nil
+	TestConfig(ctx context.Context, functionCode string, config map[string]interface{}) error
+}
+
+// Starter 是模块可选实现的接口
+// 所有模块 Init 完成后按依赖顺序调用 Start，用于启动后台任务（工作池、定时器等）
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper 是模块可选实现的接口
+// 应用关闭时按启动的逆序调用 Stop，模块应在 ctx 截止前停止后台任务并写出缓冲数据
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// HealthChecker 是模块可选实现的接口
+// 返回 nil 表示模块健康，结果会出现在 /api/v1/system/modules 和就绪探针中
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// RecordOwner 是模块可选实现的接口
+// 返回路由参数名到记录表的映射（表包含 id 与 app_id 列），
+// 模块访问控制据此确定 /push/:id 这类不携带 app_id 的请求所属的APP
+type RecordOwner interface {
+	RecordTables() map[string]string
+}
+
+// PlatformScoped 是模块可选实现的接口
+// 返回 true 的模块管理平台级数据（如审计日志），无法确定APP的请求不受APP启用状态限制
+type PlatformScoped interface {
+	PlatformScoped() bool
+}
+
 // BaseModule 提供了 Module 接口的基础实现
 // 模块可以嵌入此结构体来获得默认实现
 type BaseModule struct {
@@ -0,0 +1,238 @@
+// Package module 提供事件总线的持久化发件箱
+// 启用后异步事件先写入 event_outbox 表再投递，进程重启后未完成的事件继续投递，失败按退避重试
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 发件箱事件状态
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxDone       = "done"
+	OutboxFailed     = "failed"
+)
+
+// 发件箱参数
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 50
+	outboxLease        = time.Minute // 领取后的锁定时长，超时未完成的事件会被重新领取
+	outboxMaxAttempts  = 8
+	outboxMaxBackoff   = 10 * time.Minute
+	outboxRetention    = 7 * 24 * time.Hour // 已完成事件的保留时长
+)
+
+// OutboxEvent 对应数据库中的 event_outbox 表
+type OutboxEvent struct {
+	ID            uint      `gorm:"primaryKey"`
+	EventID       string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Type          string    `gorm:"type:varchar(100);index;not null"`
+	AppID         uint      `gorm:"index"`
+	Source        string    `gorm:"type:varchar(50)"`
+	Payload       string    `gorm:"type:text"`
+	Status        string    `gorm:"type:varchar(20);index;default:'pending'"`
+	Attempts      int       `gorm:"default:0"`
+	LastError     string    `gorm:"type:text"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LockedUntil   *time.Time
+	ProcessedAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName 指定表名
+func (OutboxEvent) TableName() string {
+	return "event_outbox"
+}
+
+// Outbox 事件发件箱
+type Outbox struct {
+	db     *gorm.DB
+	notify chan struct{}
+}
+
+// EnableOutbox 为总线启用持久化发件箱，需在 Start 之前调用
+func (b *EventBus) EnableOutbox(db *gorm.DB) error {
+	if err := db.AutoMigrate(&OutboxEvent{}); err != nil {
+		return fmt.Errorf("迁移 event_outbox 失败: %w", err)
+	}
+	b.outbox = &Outbox{db: db, notify: make(chan struct{}, 1)}
+	return nil
+}
+
+// EnableEventOutbox 为全局事件总线启用持久化发件箱
+func EnableEventOutbox(db *gorm.DB) error {
+	return defaultBus.EnableOutbox(db)
+}
+
+// store 通过 db（可以是业务事务）写入发件箱并唤醒投递协程
+// 事务内写入时投递协程可能先于提交被唤醒，未提交的事件在下一次轮询时投递
+func (o *Outbox) store(db *gorm.DB, e Event) error {
+	record := OutboxEvent{
+		EventID:       e.ID,
+		Type:          e.Type,
+		AppID:         e.AppID,
+		Source:        e.Source,
+		Payload:       string(e.Payload),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+		CreatedAt:     e.CreatedAt,
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return err
+	}
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// loop 定期投递发件箱中到期的事件，总线停止时退出
+func (o *Outbox) loop(b *EventBus) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		o.relay(b)
+		if time.Since(lastCleanup) > time.Hour {
+			o.cleanup()
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-ticker.C:
+		case <-o.notify:
+		case <-b.stopped:
+			return
+		}
+	}
+}
+
+// relay 领取一批到期事件并投递给异步订阅者
+func (o *Outbox) relay(b *EventBus) {
+	for {
+		records, err := o.claim()
+		if err != nil {
+			log.Printf("[EventBus] Failed to claim outbox events: %v", err)
+			return
+		}
+		for _, record := range records {
+			o.dispatch(b, record)
+		}
+		if len(records) < outboxBatchSize {
+			return
+		}
+		select {
+		case <-b.stopped:
+			return
+		default:
+		}
+	}
+}
+
+// claim 领取到期事件：待投递且到达重试时间，或处理中但锁定已过期（上次投递的进程已退出）
+// 逐条条件更新，多实例同时领取时每条事件只会被一个实例拿到
+func (o *Outbox) claim() ([]OutboxEvent, error) {
+	now := time.Now()
+	due := "(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)"
+
+	var candidates []OutboxEvent
+	if err := o.db.Where(due, OutboxPending, now, OutboxProcessing, now).
+		Order("id ASC").Limit(outboxBatchSize).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	lockedUntil := now.Add(outboxLease)
+	claimed := make([]OutboxEvent, 0, len(candidates))
+	for _, record := range candidates {
+		result := o.db.Model(&OutboxEvent{}).
+			Where("id = ?", record.ID).
+			Where(due, OutboxPending, now, OutboxProcessing, now).
+			Updates(map[string]interface{}{"status": OutboxProcessing, "locked_until": lockedUntil})
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = append(claimed, record)
+		}
+	}
+	return claimed, nil
+}
+
+// dispatch 投递单条事件，全部订阅者成功才标记完成
+// 任一订阅者失败时整条事件重试，订阅者需按 Event.ID 保证幂等
+func (o *Outbox) dispatch(b *EventBus, record OutboxEvent) {
+	e := Event{
+		ID:        record.EventID,
+		Type:      record.Type,
+		AppID:     record.AppID,
+		Source:    record.Source,
+		Payload:   json.RawMessage(record.Payload),
+		CreatedAt: record.CreatedAt,
+	}
+
+	var errs []string
+	for _, sub := range b.subscribers(e.Type, Async) {
+		if err := deliver(context.Background(), sub, e); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"locked_until": nil}
+	if len(errs) == 0 {
+		updates["status"] = OutboxDone
+		updates["processed_at"] = now
+		updates["last_error"] = ""
+	} else {
+		attempts := record.Attempts + 1
+		updates["attempts"] = attempts
+		updates["last_error"] = strings.Join(errs, "; ")
+		if attempts >= outboxMaxAttempts {
+			updates["status"] = OutboxFailed
+			log.Printf("[EventBus] Event %s (%s) failed after %d attempts: %s", e.ID, e.Type, attempts, updates["last_error"])
+		} else {
+			updates["status"] = OutboxPending
+			updates["next_attempt_at"] = now.Add(outboxBackoff(attempts))
+		}
+	}
+	if err := o.db.Model(&OutboxEvent{}).Where("id = ?", record.ID).Updates(updates).Error; err != nil {
+		log.Printf("[EventBus] Failed to update outbox event %s: %v", e.ID, err)
+	}
+}
+
+// outboxBackoff 第 n 次失败后的重试间隔：5s、10s、20s……最长 10 分钟
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxPollInterval
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
+
+// cleanup 删除超过保留期的已完成事件，失败事件保留用于排查
+func (o *Outbox) cleanup() {
+	result := o.db.Where("status = ? AND processed_at < ?", OutboxDone, time.Now().Add(-outboxRetention)).
+		Delete(&OutboxEvent{})
+	if result.Error != nil {
+		log.Printf("[EventBus] Failed to clean up outbox: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[EventBus] Cleaned up %d delivered outbox events", result.RowsAffected)
+	}
+}
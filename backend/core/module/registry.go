@@ -12,7 +12,7 @@ var (
 	modules = make(map[string]Module)
 	// lock 保证并发安全
 	lock = sync.RWMutex{}
-	// initOrder 记录模块注册顺序，用于按顺序初始化
+	// initOrder 记录模块注册顺序，无依赖关系的模块按此顺序初始化
 	initOrder []string
 )
 
@@ -76,26 +76,22 @@ func GetAllFunctions() []Function {
 	return allFunctions
 }
 
-// InitAllModules 初始化所有已注册的模块
-// 返回第一个遇到的错误
-func InitAllModules() error {
-	lock.RLock()
-	defer lock.RUnlock()
-
-	for _, code := range initOrder {
-		if m, exists := modules[code]; exists {
-			if err := m.Init(); err != nil {
-				return fmt.Errorf("failed to init module %s: %w", code, err)
-			}
-		}
-	}
-	return nil
-}
-
-// Clear 清空所有已注册的模块（主要用于测试）
+// Clear 清空所有已注册的模块、事件订阅和配置缓存（主要用于测试）
 func Clear() {
 	lock.Lock()
 	defer lock.Unlock()
 	modules = make(map[string]Module)
 	initOrder = nil
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	states = make(map[string]State)
+	failures = make(map[string]string)
+	started = nil
+
+	defaultBus = NewEventBus(defaultEventWorkers)
+
+	configCache.Lock()
+	configCache.entries = make(map[configKey]configEntry)
+	configCache.Unlock()
 }
@@ -1,11 +1,15 @@
 // Package module 提供模块同步功能
-// 在应用启动时，将所有已注册模块的功能同步到数据库
+// 在应用启动时，将所有已注册模块的功能同步到数据库；
+// 代码中已移除的功能（孤立模板）会被停用，仍启用它们的APP会在日志中告警
 package module
 
 import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -22,6 +26,7 @@ type ModuleTemplateRecord struct {
 	ConfigSchema string    `gorm:"type:text"`
 	SortOrder    int       `gorm:"default:0"`
 	IsActive     bool      `gorm:"default:true"`
+	Status       int       `gorm:"default:1"` // 与 is_active 同步，供模板列表等按 status 过滤的查询使用
 	SourceModule string    `gorm:"type:varchar(50)"` // 新增：来源模块Code
 	FunctionType string    `gorm:"type:varchar(20)"` // 新增：功能类型 active/passive
 	CreatedAt    time.Time
@@ -33,9 +38,49 @@ func (ModuleTemplateRecord) TableName() string {
 	return "module_templates"
 }
 
+// SyncAction 同步时对单个功能模板执行的操作
+type SyncAction string
+
+const (
+	SyncCreate    SyncAction = "create"
+	SyncUpdate    SyncAction = "update"
+	SyncUnchanged SyncAction = "unchanged"
+	SyncOrphan    SyncAction = "orphan" // 数据库中存在但代码中已移除
+)
+
+// SyncItem 单个功能模板的同步计划
+type SyncItem struct {
+	Code         string     `json:"code"`
+	SourceModule string     `json:"source_module"`
+	Action       SyncAction `json:"action"`
+	Fields       []string   `json:"fields,omitempty"`     // update：发生变化的字段
+	Deactivate   bool       `json:"deactivate,omitempty"` // orphan：本次需要停用（已停用的不重复处理）
+	AppIDs       []uint     `json:"app_ids,omitempty"`    // orphan：仍启用该功能的APP
+
+	record  ModuleTemplateRecord
+	updates map[string]interface{}
+}
+
+// SyncReport 同步结果
+type SyncReport struct {
+	DryRun    bool       `json:"dry_run"`
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Unchanged int        `json:"unchanged"`
+	Orphaned  int        `json:"orphaned"`
+	Items     []SyncItem `json:"items"`
+}
+
+// SyncOptions 同步选项
+type SyncOptions struct {
+	DryRun      bool // 只计算同步计划，不写数据库
+	KeepOrphans bool // 孤立模板只报告，不停用
+}
+
 // Syncer 模块同步器
 type Syncer struct {
-	db *gorm.DB
+	db   *gorm.DB
+	last SyncReport
 }
 
 // NewSyncer 创建一个新的同步器
@@ -43,38 +88,223 @@ func NewSyncer(db *gorm.DB) *Syncer {
 	return &Syncer{db: db}
 }
 
-// SyncModulesToDB 将所有已注册模块的功能同步到数据库
-// 使用 UPSERT 策略：存在则更新，不存在则插入
+// SyncModulesToDB 将所有已注册模块的功能同步到数据库并停用孤立模板
 func (s *Syncer) SyncModulesToDB() error {
+	_, err := s.Sync(SyncOptions{})
+	return err
+}
+
+// Sync 按已注册模块计算同步计划并执行
+// 新功能插入，有变化的功能更新，代码中已移除的功能停用；整个过程在一个事务内完成，
+// 任一步失败时全部回滚。DryRun 时只读取数据库并返回计划
+func (s *Syncer) Sync(opts SyncOptions) (*SyncReport, error) {
 	modules := GetAllModules()
-	log.Printf("[ModuleSync] Starting sync, found %d registered modules", len(modules))
+	log.Printf("[ModuleSync] Starting sync, found %d registered modules (dry run: %v)", len(modules), opts.DryRun)
+
+	var report *SyncReport
+	run := func(tx *gorm.DB) error {
+		r, err := planSync(tx, modules, opts)
+		if err != nil {
+			return err
+		}
+		report = r
+		if opts.DryRun {
+			return nil
+		}
+		return applySync(tx, r)
+	}
+
+	var err error
+	if opts.DryRun {
+		err = run(s.db)
+	} else {
+		err = s.db.Transaction(run)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range report.Items {
+		if item.Action == SyncOrphan && len(item.AppIDs) > 0 {
+			log.Printf("[ModuleSync] WARNING: function %s was removed from code but is still enabled by %d apps: %v",
+				item.Code, len(item.AppIDs), item.AppIDs)
+		}
+	}
+	if opts.DryRun {
+		log.Print(report.Plan())
+	}
+	log.Printf("[ModuleSync] Sync completed: %d created, %d updated, %d unchanged, %d orphaned",
+		report.Created, report.Updated, report.Unchanged, report.Orphaned)
+
+	s.last = *report
+	return report, nil
+}
+
+// GetSyncStats 返回最近一次同步的结果，尚未同步时各项为零
+func (s *Syncer) GetSyncStats() SyncReport {
+	return s.last
+}
+
+// Plan 返回可读的同步计划
+func (r *SyncReport) Plan() string {
+	var b strings.Builder
+	mode := "applied"
+	if r.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(&b, "Module sync plan (%s): %d to create, %d to update, %d unchanged, %d orphaned\n",
+		mode, r.Created, r.Updated, r.Unchanged, r.Orphaned)
+	for _, item := range r.Items {
+		switch item.Action {
+		case SyncCreate:
+			fmt.Fprintf(&b, "  + %s (%s)\n", item.Code, item.SourceModule)
+		case SyncUpdate:
+			fmt.Fprintf(&b, "  ~ %s (%s): %s\n", item.Code, item.SourceModule, strings.Join(item.Fields, ", "))
+		case SyncOrphan:
+			action := "already inactive"
+			if item.Deactivate {
+				action = "deactivate"
+			}
+			fmt.Fprintf(&b, "  - %s (%s): %s", item.Code, item.SourceModule, action)
+			if len(item.AppIDs) > 0 {
+				fmt.Fprintf(&b, ", still enabled by apps %v", item.AppIDs)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
 
+// planSync 对比已注册功能与 module_templates，生成同步计划
+func planSync(tx *gorm.DB, modules []Module, opts SyncOptions) (*SyncReport, error) {
+	var records []ModuleTemplateRecord
+	if err := tx.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load module templates: %w", err)
+	}
+	existing := make(map[string]ModuleTemplateRecord, len(records))
+	for _, record := range records {
+		existing[record.ModuleCode] = record
+	}
+
+	report := &SyncReport{DryRun: opts.DryRun}
+	declared := make(map[string]string)
 	for _, m := range modules {
 		meta := m.Meta()
-		functions := m.GetFunctions()
+		for _, fn := range m.GetFunctions() {
+			if owner, ok := declared[fn.Code]; ok {
+				return nil, fmt.Errorf("function %s is declared by both %s and %s", fn.Code, owner, meta.Code)
+			}
+			declared[fn.Code] = meta.Code
 
-		log.Printf("[ModuleSync] Syncing module: %s (%s) with %d functions",
-			meta.Code, meta.Name, len(functions))
+			record, err := templateRecord(meta, fn)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sync function %s: %w", fn.Code, err)
+			}
+			item := SyncItem{Code: fn.Code, SourceModule: meta.Code, record: record}
 
-		for _, fn := range functions {
-			if err := s.syncFunction(meta, fn); err != nil {
-				return fmt.Errorf("failed to sync function %s: %w", fn.Code, err)
+			if current, ok := existing[fn.Code]; !ok {
+				item.Action = SyncCreate
+				report.Created++
+			} else if item.updates, item.Fields = templateChanges(current, record); len(item.Fields) == 0 {
+				item.Action = SyncUnchanged
+				report.Unchanged++
+			} else {
+				item.Action = SyncUpdate
+				report.Updated++
 			}
+			report.Items = append(report.Items, item)
 		}
 	}
 
-	log.Printf("[ModuleSync] Sync completed successfully")
+	var orphans []string
+	for _, record := range records {
+		if _, ok := declared[record.ModuleCode]; !ok {
+			orphans = append(orphans, record.ModuleCode)
+		}
+	}
+	sort.Strings(orphans)
+	if len(orphans) == 0 {
+		return report, nil
+	}
+
+	references, err := orphanReferences(tx, orphans)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range orphans {
+		record := existing[code]
+		report.Items = append(report.Items, SyncItem{
+			Code:         code,
+			SourceModule: record.SourceModule,
+			Action:       SyncOrphan,
+			Deactivate:   record.IsActive && !opts.KeepOrphans,
+			AppIDs:       references[code],
+		})
+		report.Orphaned++
+	}
+	return report, nil
+}
+
+// orphanReferences 查询仍启用孤立功能的APP
+func orphanReferences(tx *gorm.DB, codes []string) (map[string][]uint, error) {
+	var rows []struct {
+		AppID      uint
+		ModuleCode string
+	}
+	if err := tx.Table("app_modules").
+		Select("app_id, module_code").
+		Where("module_code IN ? AND status = ? AND deleted_at IS NULL", codes, 1).
+		Order("app_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query app modules: %w", err)
+	}
+	references := make(map[string][]uint)
+	for _, row := range rows {
+		references[row.ModuleCode] = append(references[row.ModuleCode], row.AppID)
+	}
+	return references, nil
+}
+
+// applySync 按计划写入数据库
+func applySync(tx *gorm.DB, report *SyncReport) error {
+	now := time.Now()
+	for _, item := range report.Items {
+		switch item.Action {
+		case SyncCreate:
+			record := item.record
+			record.CreatedAt, record.UpdatedAt = now, now
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed to create function %s: %w", item.Code, err)
+			}
+			log.Printf("[ModuleSync] Created new function: %s", item.Code)
+		case SyncUpdate:
+			item.updates["updated_at"] = now
+			if err := tx.Model(&ModuleTemplateRecord{}).Where("module_code = ?", item.Code).Updates(item.updates).Error; err != nil {
+				return fmt.Errorf("failed to update function %s: %w", item.Code, err)
+			}
+			log.Printf("[ModuleSync] Updated function %s: %s", item.Code, strings.Join(item.Fields, ", "))
+		case SyncOrphan:
+			if !item.Deactivate {
+				continue
+			}
+			if err := tx.Model(&ModuleTemplateRecord{}).Where("module_code = ?", item.Code).
+				Updates(map[string]interface{}{"is_active": false, "status": 0, "updated_at": now}).Error; err != nil {
+				return fmt.Errorf("failed to deactivate function %s: %w", item.Code, err)
+			}
+			log.Printf("[ModuleSync] Deactivated orphaned function: %s", item.Code)
+		}
+	}
 	return nil
 }
 
-// syncFunction 同步单个功能到数据库
-func (s *Syncer) syncFunction(meta Meta, fn Function) error {
+// templateRecord 根据功能声明构建模板记录
+func templateRecord(meta Meta, fn Function) (ModuleTemplateRecord, error) {
 	// 序列化配置Schema
 	configSchemaJSON := "{}"
 	if fn.ConfigSchema != nil {
 		bytes, err := json.Marshal(fn.ConfigSchema)
 		if err != nil {
-			return fmt.Errorf("failed to marshal config schema: %w", err)
+			return ModuleTemplateRecord{}, fmt.Errorf("failed to marshal config schema: %w", err)
 		}
 		configSchemaJSON = string(bytes)
 	}
@@ -84,13 +314,12 @@ func (s *Syncer) syncFunction(meta Meta, fn Function) error {
 	if len(fn.Dependencies) > 0 {
 		bytes, err := json.Marshal(fn.Dependencies)
 		if err != nil {
-			return fmt.Errorf("failed to marshal dependencies: %w", err)
+			return ModuleTemplateRecord{}, fmt.Errorf("failed to marshal dependencies: %w", err)
 		}
 		dependenciesJSON = string(bytes)
 	}
 
-	// 构建记录
-	record := ModuleTemplateRecord{
+	return ModuleTemplateRecord{
 		ModuleCode:   fn.Code,
 		ModuleName:   fn.Name,
 		Description:  fn.Description,
@@ -99,52 +328,47 @@ func (s *Syncer) syncFunction(meta Meta, fn Function) error {
 		ConfigSchema: configSchemaJSON,
 		SortOrder:    fn.SortOrder,
 		IsActive:     true,
+		Status:       1,
 		SourceModule: meta.Code,
 		FunctionType: fn.Type,
-		UpdatedAt:    time.Now(),
-	}
-
-	// 使用 UPSERT：根据 ModuleCode 判断是更新还是插入
-	var existing ModuleTemplateRecord
-	result := s.db.Where("module_code = ?", fn.Code).First(&existing)
+	}, nil
+}
 
-	if result.Error == gorm.ErrRecordNotFound {
-		// 不存在，插入新记录
-		record.CreatedAt = time.Now()
-		if err := s.db.Create(&record).Error; err != nil {
-			return fmt.Errorf("failed to create record: %w", err)
+// templateChanges 对比现有记录与期望记录，返回需要更新的字段
+// JSON 字段按语义比较，数据库重新格式化（如 MySQL JSON 列）不算变化
+func templateChanges(current, desired ModuleTemplateRecord) (map[string]interface{}, []string) {
+	updates := map[string]interface{}{}
+	var fields []string
+	set := func(column string, changed bool, value interface{}) {
+		if changed {
+			updates[column] = value
+			fields = append(fields, column)
 		}
-		log.Printf("[ModuleSync] Created new function: %s", fn.Code)
-	} else if result.Error != nil {
-		return fmt.Errorf("failed to query existing record: %w", result.Error)
-	} else {
-		// 存在，更新记录
-		updates := map[string]interface{}{
-			"module_name":   record.ModuleName,
-			"description":   record.Description,
-			"dependencies":  record.Dependencies,
-			"icon":          record.Icon,
-			"config_schema": record.ConfigSchema,
-			"sort_order":    record.SortOrder,
-			"source_module": record.SourceModule,
-			"function_type": record.FunctionType,
-			"updated_at":    record.UpdatedAt,
-		}
-		if err := s.db.Model(&existing).Updates(updates).Error; err != nil {
-			return fmt.Errorf("failed to update record: %w", err)
-		}
-		log.Printf("[ModuleSync] Updated existing function: %s", fn.Code)
 	}
-
-	return nil
+	set("module_name", current.ModuleName != desired.ModuleName, desired.ModuleName)
+	set("description", current.Description != desired.Description, desired.Description)
+	set("dependencies", !jsonEquivalent(current.Dependencies, desired.Dependencies), desired.Dependencies)
+	set("icon", current.Icon != desired.Icon, desired.Icon)
+	set("config_schema", !jsonEquivalent(current.ConfigSchema, desired.ConfigSchema), desired.ConfigSchema)
+	set("sort_order", current.SortOrder != desired.SortOrder, desired.SortOrder)
+	set("source_module", current.SourceModule != desired.SourceModule, desired.SourceModule)
+	set("function_type", current.FunctionType != desired.FunctionType, desired.FunctionType)
+	if !current.IsActive || current.Status != 1 {
+		// 重新出现在代码中的孤立功能恢复启用
+		updates["is_active"], updates["status"] = true, 1
+		fields = append(fields, "is_active")
+	}
+	return updates, fields
 }
 
-// GetSyncStats 获取同步统计信息
-func (s *Syncer) GetSyncStats() (created int, updated int, total int) {
-	modules := GetAllModules()
-	for _, m := range modules {
-		total += len(m.GetFunctions())
+// jsonEquivalent 判断两个JSON文本是否等价，任一方不是合法JSON时按文本比较
+func jsonEquivalent(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
 	}
-	// 这里简化处理，实际可以在 syncFunction 中统计
-	return 0, 0, total
+	return reflect.DeepEqual(va, vb)
 }
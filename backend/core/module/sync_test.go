@@ -0,0 +1,75 @@
+package module
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateChanges(t *testing.T) {
+	fn := Function{
+		Code:         "push_send",
+		Name:         "发送推送",
+		Type:         "active",
+		Dependencies: []string{"user_list"},
+		ConfigSchema: map[string]interface{}{"type": "object"},
+	}
+	desired, err := templateRecord(Meta{Code: "push_service", Icon: "bell"}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MySQL JSON 列重新格式化后的内容不算变化
+	current := desired
+	current.Dependencies = `["user_list"]`
+	current.ConfigSchema = `{"type": "object"}`
+	if _, fields := templateChanges(current, desired); len(fields) != 0 {
+		t.Errorf("expected unchanged, got %v", fields)
+	}
+
+	if desired.Status != 1 {
+		t.Errorf("desired status = %d, want 1", desired.Status)
+	}
+
+	current.ModuleName = "推送"
+	current.Dependencies = `[]`
+	current.IsActive = false
+	current.Status = 0
+	updates, fields := templateChanges(current, desired)
+	want := []string{"module_name", "dependencies", "is_active"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	if updates["status"] != 1 || updates["is_active"] != true {
+		t.Errorf("expected reactivation, got %v", updates)
+	}
+}
+
+func TestSyncReportPlan(t *testing.T) {
+	report := &SyncReport{
+		DryRun:    true,
+		Created:   1,
+		Updated:   1,
+		Unchanged: 1,
+		Orphaned:  2,
+		Items: []SyncItem{
+			{Code: "push_create", SourceModule: "push_service", Action: SyncCreate},
+			{Code: "push_send", SourceModule: "push_service", Action: SyncUpdate, Fields: []string{"config_schema"}},
+			{Code: "push_list", SourceModule: "push_service", Action: SyncUnchanged},
+			{Code: "legacy_report", SourceModule: "stats", Action: SyncOrphan, Deactivate: true, AppIDs: []uint{3, 7}},
+			{Code: "legacy_export", SourceModule: "stats", Action: SyncOrphan},
+		},
+	}
+
+	want := strings.Join([]string{
+		"Module sync plan (dry run): 1 to create, 1 to update, 1 unchanged, 2 orphaned",
+		"  + push_create (push_service)",
+		"  ~ push_send (push_service): config_schema",
+		"  - legacy_report (stats): deactivate, still enabled by apps [3 7]",
+		"  - legacy_export (stats): already inactive",
+		"",
+	}, "\n")
+	if got := report.Plan(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
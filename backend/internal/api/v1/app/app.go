@@ -4,7 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"strconv"
+	"time"
 
+	"app-platform-backend/core/module"
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/pkg/database"
 	"app-platform-backend/internal/response"
@@ -103,7 +106,12 @@ func Create(c *gin.Context) {
 		Status:      1,
 	}
 
-	// 使用事务创建APP和关联模块
+	modules := req.Modules
+	if modules == nil {
+		modules = []string{}
+	}
+
+	// 使用事务创建APP和关联模块，app.created 事件随事务一起写入
 	err := database.WithTransaction(func(tx *database.DB) error {
 		if err := tx.Create(&app).Error; err != nil {
 			return err
@@ -122,7 +130,11 @@ func Create(c *gin.Context) {
 				return err
 			}
 		}
-		return nil
+		return module.PublishTx(c.Request.Context(), tx, module.EventAppCreated, "app", app.ID, module.AppCreated{
+			AppID:   app.ID,
+			Name:    app.Name,
+			Modules: modules,
+		})
 	})
 
 	if err != nil {
@@ -263,3 +275,54 @@ func ResetSecret(c *gin.Context) {
 		"app_secret": newSecret,
 	})
 }
+
+// IssueUserTokenRequest 签发终端用户令牌请求
+type IssueUserTokenRequest struct {
+	OpenID      string `json:"open_id" binding:"required,max=255"`
+	ExpireHours int    `json:"expire_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// IssueUserToken 为APP终端用户签发令牌
+// 由APP后端在完成自身的用户登录后调用，客户端在 X-App-User-Token 中携带令牌声明用户身份
+func IssueUserToken(c *gin.Context) {
+	id := c.Param("id")
+
+	// 验证ID
+	if _, err := validator.ValidateID(id); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	var req IssueUserTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	var app model.App
+	if err := database.GetDB().First(&app, id).Error; err != nil {
+		response.NotFound(c, "应用不存在")
+		return
+	}
+
+	var user model.User
+	if err := database.GetDB().Where("app_id = ? AND open_id = ?", app.ID, req.OpenID).First(&user).Error; err != nil {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+	if user.Status != 1 {
+		response.Forbidden(c, "用户已被禁用")
+		return
+	}
+
+	token, expiresAt, err := middleware.IssueAppUserToken(app.ID, user.OpenID, time.Duration(req.ExpireHours)*time.Hour)
+	if err != nil {
+		response.ServerError(c, "签发用户令牌失败")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
@@ -42,17 +42,35 @@ func InitDB(database *gorm.DB) {
 
 // RecordAudit 记录审计日志
 func RecordAudit(c *gin.Context, action, resource, resourceID, description string, extra map[string]interface{}) {
-	userID := c.GetString("user_id")
-	userName := c.GetString("user_name")
 	appIDStr := c.Param("app_id")
 	if appIDStr == "" {
 		appIDStr = c.Query("app_id")
 	}
-	
+
 	var appID uint
 	if id, err := strconv.ParseUint(appIDStr, 10, 32); err == nil {
 		appID = uint(id)
 	}
+	RecordAppAudit(c, appID, action, resource, resourceID, description, extra)
+}
+
+// RecordAppAudit 记录指定APP的审计日志，用于路由参数不是 app_id 的业务操作
+func RecordAppAudit(c *gin.Context, appID uint, action, resource, resourceID, description string, extra map[string]interface{}) {
+	if db == nil {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if userID == "" {
+		// 管理后台 JWT 中间件写入的是数值ID
+		if id := c.GetUint("user_id"); id > 0 {
+			userID = strconv.FormatUint(uint64(id), 10)
+		}
+	}
+	userName := c.GetString("user_name")
+	if userName == "" {
+		userName = c.GetString("username")
+	}
 
 	extraJSON := ""
 	if extra != nil {
@@ -0,0 +1,458 @@
+package baas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"app-platform-backend/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 聚合限制
+const (
+	maxGroupFields     = 3
+	maxMetrics         = 10
+	defaultGroupLimit  = 100
+	maxGroupLimit      = 1000
+	aggregateCacheTTL  = 30 * time.Second
+	maxAggregateCached = 1000 // 每个APP最多缓存的聚合结果数
+)
+
+// 日期分桶粒度
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week" // 以周一为一周的开始
+	BucketMonth = "month"
+)
+
+// 聚合函数
+var aggregateOps = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true, "distinct": true,
+}
+
+// GroupField 分组字段
+type GroupField struct {
+	Field  string `json:"field"`
+	Bucket string `json:"bucket"` // 日期字段的分桶粒度：day、week、month
+}
+
+// Metric 聚合指标
+type Metric struct {
+	Op    string `json:"op"`    // count、sum、avg、min、max、distinct（去重计数）
+	Field string `json:"field"` // count 可省略，表示文档数
+	As    string `json:"as"`    // 结果列名，默认为 op 或 op_field
+}
+
+// AggregateQuery 聚合请求
+type AggregateQuery struct {
+	Filter  map[string]interface{} `json:"filter"`
+	GroupBy []GroupField           `json:"group_by"`
+	Metrics []Metric               `json:"metrics"`
+	Sort    string                 `json:"sort"` // 按结果列排序，如 "-total,status"
+	Limit   int                    `json:"limit"`
+}
+
+// AggregateResult 聚合结果，每行包含分组字段和指标列
+type AggregateResult struct {
+	Rows      []map[string]interface{} `json:"rows"`
+	Truncated bool                     `json:"truncated"` // 分组数超过 limit
+	Cached    bool                     `json:"cached"`
+}
+
+// aggregateColumn 结果列及其值类型
+type aggregateColumn struct {
+	name string
+	typ  string // number、string、boolean、integer
+}
+
+// compiledAggregate 编译后的聚合查询
+type compiledAggregate struct {
+	selects []string
+	args    []interface{}
+	groups  []string
+	columns []aggregateColumn
+	order   string
+	limit   int
+}
+
+// compile 校验并编译聚合请求
+func (q *AggregateQuery) compile(collection *DataCollection) (*compiledAggregate, string, []interface{}, error) {
+	resolver := newFieldResolver(collection)
+	where, whereArgs, err := compileFilter(q.Filter, resolver)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(q.GroupBy) > maxGroupFields {
+		return nil, "", nil, queryErrorf("最多按%d个字段分组", maxGroupFields)
+	}
+	if len(q.Metrics) == 0 {
+		q.Metrics = []Metric{{Op: "count"}}
+	}
+	if len(q.Metrics) > maxMetrics {
+		return nil, "", nil, queryErrorf("最多%d个聚合指标", maxMetrics)
+	}
+
+	ca := &compiledAggregate{limit: q.Limit}
+	if ca.limit <= 0 {
+		ca.limit = defaultGroupLimit
+	}
+	if ca.limit > maxGroupLimit {
+		ca.limit = maxGroupLimit
+	}
+
+	names := make(map[string]bool)
+	for i, g := range q.GroupBy {
+		ref, err := resolver.resolve(g.Field, true)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if names[g.Field] {
+			return nil, "", nil, queryErrorf("分组字段重复: %s", g.Field)
+		}
+		names[g.Field] = true
+
+		expr, args := ref.expr()
+		typ := ref.Type
+		if g.Bucket != "" {
+			if !isDateField(collection, g.Field) {
+				return nil, "", nil, queryErrorf("字段 %s 不是日期字段，不能按%s分桶", g.Field, g.Bucket)
+			}
+			if expr, args, err = bucketExpr(ref, expr, args, g.Bucket); err != nil {
+				return nil, "", nil, err
+			}
+			typ = "string"
+		}
+		alias := "g" + strconv.Itoa(i)
+		ca.selects = append(ca.selects, expr+" AS "+alias)
+		ca.args = append(ca.args, args...)
+		ca.groups = append(ca.groups, alias)
+		ca.columns = append(ca.columns, aggregateColumn{name: g.Field, typ: typ})
+	}
+
+	for i, m := range q.Metrics {
+		if !aggregateOps[m.Op] {
+			return nil, "", nil, queryErrorf("不支持的聚合函数: %s", m.Op)
+		}
+		if m.As == "" {
+			m.As = m.Op
+			if m.Field != "" {
+				m.As += "_" + m.Field
+			}
+		}
+		if !fieldNamePattern.MatchString(m.As) || names[m.As] {
+			return nil, "", nil, queryErrorf("聚合结果列名无效或重复: %s", m.As)
+		}
+		names[m.As] = true
+
+		expr, args, typ, err := metricExpr(resolver, m)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		ca.selects = append(ca.selects, expr+" AS m"+strconv.Itoa(i))
+		ca.args = append(ca.args, args...)
+		ca.columns = append(ca.columns, aggregateColumn{name: m.As, typ: typ})
+	}
+
+	order, err := aggregateOrder(q.Sort, ca.columns, len(q.GroupBy))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	ca.order = order
+	return ca, where, whereArgs, nil
+}
+
+// isDateField 字段是否为日期类型（含系统时间字段）
+func isDateField(collection *DataCollection, name string) bool {
+	if name == "created_at" || name == "updated_at" {
+		return true
+	}
+	for _, f := range parseFields(collection.Fields) {
+		if f.Name == name {
+			return f.Type == "date" || f.Type == "datetime"
+		}
+	}
+	return false
+}
+
+// bucketExpr 日期分桶表达式及参数；文档中的日期取前10位（YYYY-MM-DD）
+func bucketExpr(ref fieldRef, expr string, args []interface{}, bucket string) (string, []interface{}, error) {
+	date := expr
+	if ref.Column == "" {
+		date = "CAST(LEFT(" + expr + ", 10) AS DATE)"
+	}
+	switch bucket {
+	case BucketDay:
+		return "DATE_FORMAT(" + date + ", '%Y-%m-%d')", args, nil
+	case BucketWeek:
+		// 日期表达式出现两次，参数需要重复
+		return "DATE_FORMAT(DATE_SUB(" + date + ", INTERVAL WEEKDAY(" + date + ") DAY), '%Y-%m-%d')", append(args, args...), nil
+	case BucketMonth:
+		return "DATE_FORMAT(" + date + ", '%Y-%m')", args, nil
+	}
+	return "", nil, queryErrorf("不支持的分桶粒度: %s", bucket)
+}
+
+// metricExpr 聚合指标的SQL表达式与结果类型
+func metricExpr(resolver *fieldResolver, m Metric) (string, []interface{}, string, error) {
+	if m.Field == "" {
+		if m.Op != "count" {
+			return "", nil, "", queryErrorf("聚合函数 %s 必须指定字段", m.Op)
+		}
+		return "COUNT(*)", nil, "integer", nil
+	}
+
+	ref, err := resolver.resolve(m.Field, true)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if ref.Type == "array" || ref.Type == "object" {
+		return "", nil, "", queryErrorf("字段 %s 为%s类型，不能聚合", ref.Name, ref.Type)
+	}
+	expr, args := ref.expr()
+
+	switch m.Op {
+	case "count":
+		return "COUNT(" + expr + ")", args, "integer", nil
+	case "distinct":
+		return "COUNT(DISTINCT " + expr + ")", args, "integer", nil
+	case "sum", "avg":
+		if ref.Type != "" && ref.Type != "number" {
+			return "", nil, "", queryErrorf("字段 %s 不是数字类型，不支持 %s", ref.Name, m.Op)
+		}
+		return strings.ToUpper(m.Op) + "(" + numericExpr(ref, expr) + ")", args, "number", nil
+	default: // min、max
+		typ := ref.Type
+		if typ == "" || typ == "number" {
+			expr, typ = numericExpr(ref, expr), "number"
+		}
+		return strings.ToUpper(m.Op) + "(" + expr + ")", args, typ, nil
+	}
+}
+
+// numericExpr 将JSON值转换为数字参与计算
+func numericExpr(ref fieldRef, expr string) string {
+	if ref.Column != "" {
+		return expr
+	}
+	return "CAST(" + expr + " AS DECIMAL(65,10))"
+}
+
+// aggregateOrder 解析排序，只能按结果列排序；默认按分组字段升序
+func aggregateOrder(sort string, columns []aggregateColumn, groups int) (string, error) {
+	aliases := make(map[string]string, len(columns))
+	for i, col := range columns {
+		if i < groups {
+			aliases[col.name] = "g" + strconv.Itoa(i)
+		} else {
+			aliases[col.name] = "m" + strconv.Itoa(i-groups)
+		}
+	}
+
+	var parts []string
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		dir := "ASC"
+		if strings.HasPrefix(key, "-") {
+			dir, key = "DESC", key[1:]
+		}
+		alias, ok := aliases[key]
+		if !ok {
+			return "", queryErrorf("排序字段 %s 不在聚合结果中", key)
+		}
+		parts = append(parts, alias+" "+dir)
+	}
+	if len(parts) == 0 {
+		for i := 0; i < groups; i++ {
+			parts = append(parts, "g"+strconv.Itoa(i)+" ASC")
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// run 执行聚合查询并按列类型转换结果
+func (ca *compiledAggregate) run(query *gorm.DB) (*AggregateResult, error) {
+	query = query.Select(strings.Join(ca.selects, ", "), ca.args...)
+	if len(ca.groups) > 0 {
+		query = query.Group(strings.Join(ca.groups, ", "))
+	}
+	if ca.order != "" {
+		query = query.Order(ca.order)
+	}
+
+	rows, err := query.Limit(ca.limit + 1).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &AggregateResult{Rows: []map[string]interface{}{}}
+	values := make([]*string, len(ca.columns))
+	dest := make([]interface{}, len(ca.columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result.Rows) == ca.limit {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(ca.columns))
+		for i, col := range ca.columns {
+			row[col.name] = aggregateValue(values[i], col.typ)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// aggregateValue 将查询结果的文本值转换为对应类型，JSON字符串值去掉引号
+func aggregateValue(raw *string, typ string) interface{} {
+	if raw == nil {
+		return nil
+	}
+	s := *raw
+	switch typ {
+	case "integer":
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	case "number":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	case "boolean":
+		return s == "true" || s == "1"
+	case "string":
+		return s
+	}
+	// 未定义类型的字段按JSON解析
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// aggregateCache 按APP缓存聚合结果，文档写入时清除该APP的缓存
+type aggregateCache struct {
+	mu      sync.Mutex
+	entries map[uint]map[string]aggregateEntry
+}
+
+type aggregateEntry struct {
+	result  *AggregateResult
+	expires time.Time
+}
+
+func newAggregateCache() *aggregateCache {
+	return &aggregateCache{entries: make(map[uint]map[string]aggregateEntry)}
+}
+
+func (c *aggregateCache) get(appID uint, key string) (*AggregateResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[appID][key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.result, true
+}
+
+func (c *aggregateCache) set(appID uint, key string, result *AggregateResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	app := c.entries[appID]
+	if app == nil || len(app) >= maxAggregateCached {
+		app = make(map[string]aggregateEntry)
+		c.entries[appID] = app
+	}
+	app[key] = aggregateEntry{result: result, expires: time.Now().Add(aggregateCacheTTL)}
+}
+
+func (c *aggregateCache) invalidate(appID uint) {
+	c.mu.Lock()
+	delete(c.entries, appID)
+	c.mu.Unlock()
+}
+
+// aggregateKey 缓存键：数据模型（含结构版本）、请求内容和数据范围
+func aggregateKey(collection *DataCollection, q *AggregateQuery, scope string) string {
+	body, _ := json.Marshal(q)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%s|%s", collection.ID, collection.UpdatedAt.UnixNano(), scope, body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// AggregateDocuments 对数据文档做分组聚合
+// 请求体示例：{"filter":{"status":"paid"},"group_by":[{"field":"created_at","bucket":"day"}],
+// "metrics":[{"op":"count"},{"op":"sum","field":"amount","as":"total"}],"sort":"-total","limit":30}
+func (h *Handler) AggregateDocuments(c *gin.Context) {
+	appID := resolveAppID(c)
+	collectionName := c.Param("collectionName")
+
+	var collection DataCollection
+	if err := h.db.Where("app_id = ? AND name = ?", appID, collectionName).First(&collection).Error; err != nil {
+		fail(c, 404, "数据模型不存在")
+		return
+	}
+
+	principal := principalFromContext(c)
+	decision := Evaluate(&collection, ActionRead, principal, nil)
+	if !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
+
+	var q AggregateQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		fail(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	ca, where, args, err := q.compile(&collection)
+	if err != nil {
+		fail(c, 400, "聚合条件无效: "+err.Error())
+		return
+	}
+
+	scope := ""
+	if decision.OwnOnly {
+		scope = fmt.Sprintf("%s:%d", principal.Kind, principal.UserID)
+	}
+	key := aggregateKey(&collection, &q, scope)
+	if cached, ok := h.aggregates.get(collection.AppID, key); ok {
+		result := *cached
+		result.Cached = true
+		success(c, &result)
+		return
+	}
+
+	query := h.db.Model(&DataDocument{}).Where("collection_id = ?", collection.ID)
+	if decision.OwnOnly {
+		query = query.Where("creator_type = ? AND created_by = ?", string(principal.Kind), principal.UserID)
+	}
+	if where != "" {
+		query = query.Where(where, args...)
+	}
+
+	result, err := ca.run(query)
+	if err != nil {
+		fail(c, 500, "聚合查询失败: "+err.Error())
+		return
+	}
+	h.aggregates.set(collection.AppID, key, result)
+	success(c, result)
+}
@@ -0,0 +1,105 @@
+package baas
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAggregateCompile(t *testing.T) {
+	collection := &DataCollection{Fields: json.RawMessage(`[
+		{"name":"status","type":"string"},
+		{"name":"amount","type":"number"},
+		{"name":"paid_on","type":"date"}
+	]`)}
+
+	var q AggregateQuery
+	json.Unmarshal([]byte(`{
+		"filter": {"status": "paid"},
+		"group_by": [{"field": "paid_on", "bucket": "week"}, {"field": "status"}],
+		"metrics": [{"op": "count"}, {"op": "sum", "field": "amount", "as": "total"}, {"op": "distinct", "field": "status"}],
+		"sort": "-total"
+	}`), &q)
+
+	ca, where, whereArgs, err := q.compile(collection)
+	if err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	if where != "JSON_UNQUOTE(JSON_EXTRACT(data, ?)) = ?" || !reflect.DeepEqual(whereArgs, []interface{}{"$.status", "paid"}) {
+		t.Errorf("where = %q %v", where, whereArgs)
+	}
+
+	selects := strings.Join(ca.selects, ", ")
+	for _, want := range []string{
+		"WEEKDAY(CAST(LEFT(JSON_UNQUOTE(JSON_EXTRACT(data, ?)), 10) AS DATE))",
+		"JSON_UNQUOTE(JSON_EXTRACT(data, ?)) AS g1",
+		"COUNT(*) AS m0",
+		"SUM(CAST(JSON_EXTRACT(data, ?) AS DECIMAL(65,10))) AS m1",
+		"COUNT(DISTINCT JSON_UNQUOTE(JSON_EXTRACT(data, ?))) AS m2",
+	} {
+		if !strings.Contains(selects, want) {
+			t.Errorf("selects missing %q:\n%s", want, selects)
+		}
+	}
+	if got := strings.Count(selects, "?"); got != len(ca.args) {
+		t.Errorf("%d placeholders but %d args", got, len(ca.args))
+	}
+	if ca.order != "m1 DESC" || strings.Join(ca.groups, ",") != "g0,g1" || ca.limit != defaultGroupLimit {
+		t.Errorf("order = %q, groups = %v, limit = %d", ca.order, ca.groups, ca.limit)
+	}
+
+	var names []string
+	for _, col := range ca.columns {
+		names = append(names, col.name)
+	}
+	if want := []string{"paid_on", "status", "count", "total", "distinct_status"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns = %v, want %v", names, want)
+	}
+}
+
+func TestAggregateCompile_Errors(t *testing.T) {
+	collection := &DataCollection{Fields: json.RawMessage(`[
+		{"name":"status","type":"string"},
+		{"name":"tags","type":"array"}
+	]`)}
+
+	cases := map[string]string{
+		"bucket on non-date":  `{"group_by":[{"field":"status","bucket":"day"}]}`,
+		"sum of string":       `{"metrics":[{"op":"sum","field":"status"}]}`,
+		"array metric":        `{"metrics":[{"op":"max","field":"tags"}]}`,
+		"unknown op":          `{"metrics":[{"op":"median","field":"status"}]}`,
+		"alias clash":         `{"group_by":[{"field":"status"}],"metrics":[{"op":"count","as":"status"}]}`,
+		"sort unknown column": `{"sort":"price"}`,
+		"undefined field":     `{"group_by":[{"field":"price"}]}`,
+	}
+	for name, body := range cases {
+		var q AggregateQuery
+		json.Unmarshal([]byte(body), &q)
+		if _, _, _, err := q.compile(collection); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAggregateValue(t *testing.T) {
+	s := func(v string) *string { return &v }
+	cases := []struct {
+		raw  *string
+		typ  string
+		want interface{}
+	}{
+		{nil, "number", nil},
+		{s("3"), "integer", int64(3)},
+		{s("12.5000000000"), "number", 12.5},
+		{s("true"), "boolean", true},
+		{s("2024-01"), "string", "2024-01"},
+		{s(`"draft"`), "", "draft"},
+		{s("7"), "", float64(7)},
+	}
+	for _, tc := range cases {
+		if got := aggregateValue(tc.raw, tc.typ); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("aggregateValue(%v, %q) = %#v, want %#v", tc.raw, tc.typ, got, tc.want)
+		}
+	}
+}
@@ -2,10 +2,17 @@ package baas
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"reflect"
 	"strconv"
 	"time"
 
+	"app-platform-backend/core/module"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/pkg/jsondiff"
+	"app-platform-backend/internal/response"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -32,6 +39,8 @@ type DataCollection struct {
 	IsVisible   bool            `json:"is_visible" gorm:"default:false"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
+
+	IndexStates []IndexState `json:"index_states,omitempty" gorm:"-"` // 索引构建状态，仅用于接口返回
 }
 
 func (DataCollection) TableName() string {
@@ -84,6 +93,7 @@ type DataDocument struct {
 	AppID        uint            `json:"app_id" gorm:"index"`
 	Data         json.RawMessage `json:"data" gorm:"type:json"`
 	CreatedBy    uint            `json:"created_by"`
+	CreatorType  string          `json:"creator_type" gorm:"size:20;default:admin"` // admin, user, anonymous
 	UpdatedBy    uint            `json:"updated_by"`
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
@@ -95,12 +105,25 @@ func (DataDocument) TableName() string {
 
 // Handler BaaS API处理器
 type Handler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	indexes    *IndexManager
+	migrations *MigrationRunner
+	hooks      *HookRunner
+	imports    *ImportRunner
+	aggregates *aggregateCache
 }
 
 // NewHandler 创建新的Handler
 func NewHandler(db *gorm.DB) *Handler {
-	return &Handler{db: db}
+	indexes := NewIndexManager(db)
+	return &Handler{
+		db:         db,
+		indexes:    indexes,
+		migrations: NewMigrationRunner(db),
+		hooks:      NewHookRunner(db),
+		imports:    NewImportRunner(db, indexes),
+		aggregates: newAggregateCache(),
+	}
 }
 
 // RegisterRoutes 注册路由
@@ -118,6 +141,15 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 				apps.POST("/collections/:collectionId/generate", h.GenerateFeature)
 				apps.PUT("/collections/:collectionId/visibility", h.ToggleVisibility)
 
+				// 索引管理
+				apps.GET("/collections/:collectionId/indexes", h.ListIndexes)
+				apps.POST("/collections/:collectionId/indexes", h.CreateIndex)
+				apps.DELETE("/collections/:collectionId/indexes/:indexName", h.DropIndex)
+				apps.GET("/collections/:collectionId/index-jobs", h.ListIndexJobs)
+
+				// 钩子执行日志
+				apps.GET("/collections/:collectionId/hook-logs", h.ListHookLogs)
+
 				// 版本管理（注意路由顺序：具体路径放在参数路径前面）
 				apps.GET("/collections/:collectionId/versions/compare", h.CompareFeatureVersions)
 				apps.GET("/collections/:collectionId/versions", h.ListFeatureVersions)
@@ -126,16 +158,53 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 				apps.PUT("/collections/:collectionId/versions/:versionId/publish", h.PublishFeatureVersion)
 				apps.PUT("/collections/:collectionId/versions/:versionId/rollback", h.RollbackFeatureVersion)
 
+				// 数据迁移
+				apps.GET("/collections/:collectionId/migrations", h.ListMigrations)
+				apps.GET("/collections/:collectionId/migrations/:migrationId", h.GetMigration)
+				apps.POST("/collections/:collectionId/migrations/:migrationId/resume", h.ResumeMigration)
+				apps.POST("/collections/:collectionId/migrations/:migrationId/revert", h.RevertMigration)
+
+				// 数据导入导出
+				apps.GET("/collections/:collectionId/export", h.ExportDocuments)
+				apps.GET("/collections/:collectionId/imports", h.ListImports)
+				apps.POST("/collections/:collectionId/imports", h.CreateImport)
+				apps.GET("/collections/:collectionId/imports/:jobId", h.GetImport)
+				apps.POST("/collections/:collectionId/imports/:jobId/resume", h.ResumeImport)
+				apps.POST("/collections/:collectionId/imports/:jobId/cancel", h.CancelImport)
+
 			// 数据文档管理
 			apps.GET("/data/:collectionName", h.ListDocuments)
+			apps.POST("/data/:collectionName/query", h.QueryDocuments)
+			apps.POST("/data/:collectionName/aggregate", h.AggregateDocuments)
 			apps.POST("/data/:collectionName", h.CreateDocument)
 			apps.GET("/data/:collectionName/:docId", h.GetDocument)
 			apps.PUT("/data/:collectionName/:docId", h.UpdateDocument)
 			apps.DELETE("/data/:collectionName/:docId", h.DeleteDocument)
+
+			// 实时订阅（WebSocket）
+			apps.GET("/realtime", h.Realtime)
 		}
 	}
 }
 
+// RegisterClientRoutes 注册面向APP客户端的数据文档路由（签名认证）
+// APP由签名绑定，权限按集合的 read/create/update/delete 规则评估
+func (h *Handler) RegisterClientRoutes(r *gin.RouterGroup) {
+	data := r.Group("/baas/data")
+	{
+		data.GET("/:collectionName", h.ListDocuments)
+		data.POST("/:collectionName/query", h.QueryDocuments)
+		data.POST("/:collectionName/aggregate", h.AggregateDocuments)
+		data.POST("/:collectionName", h.CreateDocument)
+		data.GET("/:collectionName/:docId", h.GetDocument)
+		data.PUT("/:collectionName/:docId", h.UpdateDocument)
+		data.DELETE("/:collectionName/:docId", h.DeleteDocument)
+	}
+
+	// 实时订阅（WebSocket）
+	r.GET("/baas/realtime", h.Realtime)
+}
+
 // Response 统一响应结构
 type Response struct {
 	Code    int         `json:"code"`
@@ -158,6 +227,34 @@ func fail(c *gin.Context, code int, message string) {
 	})
 }
 
+func failWithData(c *gin.Context, code int, message string, data interface{}) {
+	c.JSON(http.StatusOK, Response{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// resolveAppID 获取请求对应的应用ID
+// 客户端请求使用签名绑定的APP，管理端请求使用路径参数 appId
+func resolveAppID(c *gin.Context) uint64 {
+	if appID, ok := middleware.BoundAppID(c); ok {
+		return uint64(appID)
+	}
+	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	return appID
+}
+
+// validatePerms 校验集合权限规则
+func validatePerms(perms ...string) bool {
+	for _, perm := range perms {
+		if perm != "" && !ValidPerm(perm) {
+			return false
+		}
+	}
+	return true
+}
+
 // ListCollections 获取数据模型列表
 func (h *Handler) ListCollections(c *gin.Context) {
 	appID, err := strconv.ParseUint(c.Param("appId"), 10, 64)
@@ -182,6 +279,11 @@ func (h *Handler) ListCollections(c *gin.Context) {
 	query.Count(&total)
 	query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&collections)
 
+	states := h.indexes.statesFor(collections)
+	for i := range collections {
+		collections[i].IndexStates = states[collections[i].ID]
+	}
+
 	success(c, gin.H{
 		"list":  collections,
 		"total": total,
@@ -203,6 +305,7 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 		DisplayName string          `json:"display_name"`
 		Description string          `json:"description"`
 		Fields      json.RawMessage `json:"fields"`
+		Hooks       json.RawMessage `json:"hooks"`
 		ReadPerm    string          `json:"read_perm"`
 		CreatePerm  string          `json:"create_perm"`
 		UpdatePerm  string          `json:"update_perm"`
@@ -214,6 +317,21 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 		return
 	}
 
+	if !validatePerms(req.ReadPerm, req.CreatePerm, req.UpdatePerm, req.DeletePerm) {
+		fail(c, 400, "无效的权限规则，请使用: public, authenticated, creator, admin")
+		return
+	}
+
+	if err := validateFieldDefinitions(parseFields(req.Fields)); err != nil {
+		fail(c, 400, "字段定义无效: "+err.Error())
+		return
+	}
+
+	if err := validateHooks(req.Hooks); err != nil {
+		fail(c, 400, "钩子定义无效: "+err.Error())
+		return
+	}
+
 	// 检查名称是否已存在
 	var existing DataCollection
 	if err := h.db.Where("app_id = ? AND name = ?", appID, req.Name).First(&existing).Error; err == nil {
@@ -245,6 +363,7 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 		Description: req.Description,
 		Schema:      emptySchema,
 		Fields:      req.Fields,
+		Hooks:       req.Hooks,
 		ReadPerm:    req.ReadPerm,
 		CreatePerm:  req.CreatePerm,
 		UpdatePerm:  req.UpdatePerm,
@@ -257,6 +376,12 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 		return
 	}
 
+	if err := h.reconcileIndexes(&collection); err != nil {
+		fail(c, 500, "创建索引任务失败: "+err.Error())
+		return
+	}
+	collection.IndexStates = h.indexes.States(&collection)
+
 	success(c, collection)
 }
 
@@ -271,6 +396,7 @@ func (h *Handler) GetCollection(c *gin.Context) {
 		return
 	}
 
+	collection.IndexStates = h.indexes.States(&collection)
 	success(c, collection)
 }
 
@@ -290,6 +416,7 @@ func (h *Handler) UpdateCollection(c *gin.Context) {
 		DisplayName string          `json:"display_name"`
 		Description string          `json:"description"`
 		Fields      json.RawMessage `json:"fields"`
+		Hooks       json.RawMessage `json:"hooks"`
 		ReadPerm    string          `json:"read_perm"`
 		CreatePerm  string          `json:"create_perm"`
 		UpdatePerm  string          `json:"update_perm"`
@@ -301,6 +428,21 @@ func (h *Handler) UpdateCollection(c *gin.Context) {
 		return
 	}
 
+	if !validatePerms(req.ReadPerm, req.CreatePerm, req.UpdatePerm, req.DeletePerm) {
+		fail(c, 400, "无效的权限规则，请使用: public, authenticated, creator, admin")
+		return
+	}
+
+	if err := validateFieldDefinitions(parseFields(req.Fields)); err != nil {
+		fail(c, 400, "字段定义无效: "+err.Error())
+		return
+	}
+
+	if err := validateHooks(req.Hooks); err != nil {
+		fail(c, 400, "钩子定义无效: "+err.Error())
+		return
+	}
+
 	// 检查名称是否与其他模型冲突
 	if req.Name != "" && req.Name != collection.Name {
 		var existing DataCollection
@@ -320,6 +462,9 @@ func (h *Handler) UpdateCollection(c *gin.Context) {
 	if req.Fields != nil {
 		collection.Fields = req.Fields
 	}
+	if req.Hooks != nil {
+		collection.Hooks = req.Hooks
+	}
 	if req.ReadPerm != "" {
 		collection.ReadPerm = req.ReadPerm
 	}
@@ -338,6 +483,12 @@ func (h *Handler) UpdateCollection(c *gin.Context) {
 		return
 	}
 
+	if err := h.reconcileIndexes(&collection); err != nil {
+		fail(c, 500, "创建索引任务失败: "+err.Error())
+		return
+	}
+	collection.IndexStates = h.indexes.States(&collection)
+
 	success(c, collection)
 }
 
@@ -352,7 +503,8 @@ func (h *Handler) DeleteCollection(c *gin.Context) {
 		return
 	}
 
-	// 删除关联的文档
+	// 删除关联的索引和文档
+	h.dropAllIndexes(&collection)
 	h.db.Where("collection_id = ?", collectionID).Delete(&DataDocument{})
 
 	// 删除数据模型
@@ -427,8 +579,29 @@ func (h *Handler) ToggleVisibility(c *gin.Context) {
 }
 
 // ListDocuments 获取文档列表
+// 支持 filter（JSON过滤条件）、sort、fields 查询参数；携带 cursor 参数时使用游标分页
 func (h *Handler) ListDocuments(c *gin.Context) {
-	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	q, err := parseDocumentQuery(c)
+	if err != nil {
+		fail(c, 400, "查询条件无效: "+err.Error())
+		return
+	}
+	h.queryDocuments(c, q)
+}
+
+// QueryDocuments 使用请求体中的查询条件获取文档列表
+func (h *Handler) QueryDocuments(c *gin.Context) {
+	var q DocumentQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		fail(c, 400, "参数错误: "+err.Error())
+		return
+	}
+	h.queryDocuments(c, &q)
+}
+
+// queryDocuments 按查询条件列出文档，并应用集合读权限
+func (h *Handler) queryDocuments(c *gin.Context, q *DocumentQuery) {
+	appID := resolveAppID(c)
 	collectionName := c.Param("collectionName")
 
 	// 查找数据模型
@@ -438,21 +611,62 @@ func (h *Handler) ListDocuments(c *gin.Context) {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	principal := principalFromContext(c)
+	decision := Evaluate(&collection, ActionRead, principal, nil)
+	if !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
 
-	var documents []DataDocument
-	var total int64
+	cq, err := q.compile(&collection)
+	if err != nil {
+		fail(c, 400, "查询条件无效: "+err.Error())
+		return
+	}
 
 	query := h.db.Model(&DataDocument{}).Where("collection_id = ?", collection.ID)
+	if decision.OwnOnly {
+		query = query.Where("creator_type = ? AND created_by = ?", string(principal.Kind), principal.UserID)
+	}
+	query = cq.applyFilter(query)
+
+	var documents []DataDocument
+
+	if cq.paged {
+		// 多取一条用于判断是否还有下一页
+		if err := cq.applyOrder(cq.applyCursor(query)).Limit(cq.size + 1).Find(&documents).Error; err != nil {
+			fail(c, 500, "查询失败: "+err.Error())
+			return
+		}
+		hasMore := len(documents) > cq.size
+		nextCursor := ""
+		if hasMore {
+			documents = documents[:cq.size]
+			nextCursor = cq.nextCursor(&documents[len(documents)-1])
+		}
+		cq.project(documents)
+		success(c, gin.H{
+			"list":        documents,
+			"size":        cq.size,
+			"has_more":    hasMore,
+			"next_cursor": nextCursor,
+		})
+		return
+	}
+
+	var total int64
 	query.Count(&total)
-	query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&documents)
+	if err := cq.applyOrder(query).Offset((cq.page - 1) * cq.size).Limit(cq.size).Find(&documents).Error; err != nil {
+		fail(c, 500, "查询失败: "+err.Error())
+		return
+	}
+	cq.project(documents)
 
 	success(c, gin.H{
 		"list":  documents,
 		"total": total,
-		"page":  page,
-		"size":  size,
+		"page":  cq.page,
+		"size":  cq.size,
 	})
 }
 
@@ -463,6 +677,20 @@ type FieldDefinition struct {
 	Type        string `json:"type"`
 	Required    bool   `json:"required"`
 	Unique      bool   `json:"unique"`
+
+	Default interface{} `json:"default,omitempty"` // 默认值，用于数据迁移时填充新增的必填字段
+
+	// 取值约束
+	Options   []interface{} `json:"options,omitempty"`    // enum 允许的取值
+	Min       *float64      `json:"min,omitempty"`        // number 最小值
+	Max       *float64      `json:"max,omitempty"`        // number 最大值
+	MinLength *int          `json:"min_length,omitempty"` // string/array 最小长度
+	MaxLength *int          `json:"max_length,omitempty"` // string/array 最大长度
+	Pattern   string        `json:"pattern,omitempty"`    // string 正则表达式
+
+	Reference string            `json:"reference,omitempty"` // reference 引用的数据模型名称
+	OnDelete  string            `json:"on_delete,omitempty"` // reference 被引用文档删除时的策略: restrict, cascade, set_null
+	Fields    []FieldDefinition `json:"fields,omitempty"`    // object 的嵌套字段结构
 }
 
 // Schema 数据模型结构
@@ -470,148 +698,26 @@ type Schema struct {
 	Fields []FieldDefinition `json:"fields"`
 }
 
-// validateDocument 验证文档数据
-func (h *Handler) validateDocument(collection *DataCollection, data map[string]interface{}) error {
-	if collection.Fields == nil {
+// parseFields 解析数据模型的字段定义
+// 兼容 [{...}] 与 {"fields": [...]} 两种存储格式，解析失败时返回空列表
+func parseFields(raw json.RawMessage) []FieldDefinition {
+	if len(raw) == 0 {
 		return nil
 	}
-
-	var schema Schema
-	if err := json.Unmarshal(collection.Fields, &schema); err != nil {
-		return nil // 如果解析失败，跳过验证
-	}
-
-	for _, field := range schema.Fields {
-		value, exists := data[field.Name]
-
-		// 必填验证
-		if field.Required && (!exists || value == nil || value == "") {
-			return &ValidationError{Field: field.DisplayName, Message: "不能为空"}
-		}
-
-		if !exists || value == nil {
-			continue
-		}
-
-		// 类型验证
-		switch field.Type {
-		case "string":
-			if _, ok := value.(string); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为字符串类型"}
-			}
-		case "number":
-			switch value.(type) {
-			case float64, int, int64, float32:
-				// OK
-			default:
-				return &ValidationError{Field: field.DisplayName, Message: "应为数字类型"}
-			}
-		case "boolean":
-			if _, ok := value.(bool); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为布尔类型"}
-			}
-		case "array":
-			if _, ok := value.([]interface{}); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为数组类型"}
-			}
-		case "object":
-			if _, ok := value.(map[string]interface{}); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为对象类型"}
-			}
-		}
-
-		// 唯一性验证
-		if field.Unique && value != nil && value != "" {
-			var count int64
-			// 使用JSON查询检查唯一性
-			h.db.Model(&DataDocument{}).Where("collection_id = ? AND JSON_EXTRACT(data, ?) = ?", 
-				collection.ID, "$."+field.Name, value).Count(&count)
-			if count > 0 {
-				return &ValidationError{Field: field.DisplayName, Message: "已存在相同的值"}
-			}
-		}
-	}
-
-	return nil
-}
-
-// ValidationError 验证错误
-type ValidationError struct {
-	Field   string
-	Message string
-}
-
-func (e *ValidationError) Error() string {
-	return e.Field + ": " + e.Message
-}
-
-// validateDocumentForUpdate 更新时验证文档数据（排除当前文档的唯一性检查）
-func (h *Handler) validateDocumentForUpdate(collection *DataCollection, data map[string]interface{}, excludeDocID uint) error {
-	if collection.Fields == nil {
-		return nil
+	var fields []FieldDefinition
+	if err := json.Unmarshal(raw, &fields); err == nil {
+		return fields
 	}
-
 	var schema Schema
-	if err := json.Unmarshal(collection.Fields, &schema); err != nil {
-		return nil
+	if err := json.Unmarshal(raw, &schema); err == nil {
+		return schema.Fields
 	}
-
-	for _, field := range schema.Fields {
-		value, exists := data[field.Name]
-
-		// 必填验证
-		if field.Required && (!exists || value == nil || value == "") {
-			return &ValidationError{Field: field.DisplayName, Message: "不能为空"}
-		}
-
-		if !exists || value == nil {
-			continue
-		}
-
-		// 类型验证
-		switch field.Type {
-		case "string":
-			if _, ok := value.(string); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为字符串类型"}
-			}
-		case "number":
-			switch value.(type) {
-			case float64, int, int64, float32:
-				// OK
-			default:
-				return &ValidationError{Field: field.DisplayName, Message: "应为数字类型"}
-			}
-		case "boolean":
-			if _, ok := value.(bool); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为布尔类型"}
-			}
-		case "array":
-			if _, ok := value.([]interface{}); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为数组类型"}
-			}
-		case "object":
-			if _, ok := value.(map[string]interface{}); !ok {
-				return &ValidationError{Field: field.DisplayName, Message: "应为对象类型"}
-			}
-		}
-
-		// 唯一性验证（排除当前文档）
-		if field.Unique && value != nil && value != "" {
-			var count int64
-			h.db.Model(&DataDocument{}).Where("collection_id = ? AND id != ? AND JSON_EXTRACT(data, ?) = ?", 
-				collection.ID, excludeDocID, "$."+field.Name, value).Count(&count)
-			if count > 0 {
-				return &ValidationError{Field: field.DisplayName, Message: "已存在相同的值"}
-			}
-		}
-	}
-
 	return nil
 }
 
 // CreateDocument 创建文档
 func (h *Handler) CreateDocument(c *gin.Context) {
-	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	appID := resolveAppID(c)
 	collectionName := c.Param("collectionName")
 
 	// 查找数据模型
@@ -621,6 +727,12 @@ func (h *Handler) CreateDocument(c *gin.Context) {
 		return
 	}
 
+	principal := principalFromContext(c)
+	if decision := Evaluate(&collection, ActionCreate, principal, nil); !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
+
 	var req struct {
 		Data json.RawMessage `json:"data" binding:"required"`
 	}
@@ -637,37 +749,70 @@ func (h *Handler) CreateDocument(c *gin.Context) {
 		return
 	}
 
-	// 验证数据
-	if err := h.validateDocument(&collection, dataMap); err != nil {
-		fail(c, 400, "数据验证失败: "+err.Error())
+	// 执行写入前钩子（可拒绝写入或修改数据）
+	payload := &HookPayload{
+		Event:      HookBeforeCreate,
+		AppID:      collection.AppID,
+		Collection: collection.Name,
+		Data:       dataMap,
+		Principal:  principal,
+	}
+	dataMap, err := h.hooks.Before(&collection, payload)
+	if err != nil {
+		hookRejected(c, err)
 		return
 	}
+	data, _ := json.Marshal(dataMap)
 
-	// 获取当前用户ID (从 JWT中)
-	userID := uint(0)
-	if uid, exists := c.Get("user_id"); exists {
-		userID = uid.(uint)
+	// 验证数据
+	if err := h.newValidator(&collection).Validate(dataMap, 0); err != nil {
+		failWithData(c, 400, "数据验证失败: "+err.Error(), validationData(err))
+		return
 	}
 
 	document := DataDocument{
 		CollectionID: collection.ID,
 		AppID:        uint(appID),
-		Data:         req.Data,
-		CreatedBy:    userID,
-		UpdatedBy:    userID,
+		Data:         data,
+		CreatedBy:    principal.UserID,
+		CreatorType:  string(principal.Kind),
+		UpdatedBy:    principal.UserID,
 	}
 
-	if err := h.db.Create(&document).Error; err != nil {
+	// document.created 事件与文档在同一事务中写入
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		return module.PublishTx(c.Request.Context(), tx, module.EventDocumentCreated, "baas", collection.AppID, module.DocumentCreated{
+			AppID:        collection.AppID,
+			CollectionID: collection.ID,
+			Collection:   collection.Name,
+			DocumentID:   document.ID,
+			CreatedBy:    document.CreatedBy,
+		})
+	})
+	if err != nil {
+		if verr := duplicateKeyError(&collection, err); verr != nil {
+			failWithData(c, 400, "数据验证失败: "+verr.Error(), validationData(verr))
+			return
+		}
 		fail(c, 500, "创建文档失败: "+err.Error())
 		return
 	}
 
+	payload.Event = HookAfterCreate
+	payload.DocumentID = document.ID
+	h.hooks.After(&collection, payload)
+	h.publishChange(&collection, ChangeInsert, &document, nil)
+	h.aggregates.invalidate(collection.AppID)
+
 	success(c, document)
 }
 
 // GetDocument 获取单个文档
 func (h *Handler) GetDocument(c *gin.Context) {
-	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	appID := resolveAppID(c)
 	collectionName := c.Param("collectionName")
 	docID, _ := strconv.ParseUint(c.Param("docId"), 10, 64)
 
@@ -684,12 +829,17 @@ func (h *Handler) GetDocument(c *gin.Context) {
 		return
 	}
 
+	if decision := Evaluate(&collection, ActionRead, principalFromContext(c), &document); !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
+
 	success(c, document)
 }
 
 // UpdateDocument 更新文档
 func (h *Handler) UpdateDocument(c *gin.Context) {
-	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	appID := resolveAppID(c)
 	collectionName := c.Param("collectionName")
 	docID, _ := strconv.ParseUint(c.Param("docId"), 10, 64)
 
@@ -706,6 +856,12 @@ func (h *Handler) UpdateDocument(c *gin.Context) {
 		return
 	}
 
+	principal := principalFromContext(c)
+	if decision := Evaluate(&collection, ActionUpdate, principal, &document); !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
+
 	var req struct {
 		Data json.RawMessage `json:"data" binding:"required"`
 	}
@@ -722,32 +878,54 @@ func (h *Handler) UpdateDocument(c *gin.Context) {
 		return
 	}
 
-	// 验证数据（更新时跳过唯一性检查）
-	if err := h.validateDocumentForUpdate(&collection, dataMap, document.ID); err != nil {
-		fail(c, 400, "数据验证失败: "+err.Error())
+	// 执行写入前钩子（可拒绝写入或修改数据）
+	var previous map[string]interface{}
+	json.Unmarshal(document.Data, &previous)
+	payload := &HookPayload{
+		Event:      HookBeforeUpdate,
+		AppID:      collection.AppID,
+		Collection: collection.Name,
+		DocumentID: document.ID,
+		Data:       dataMap,
+		Previous:   previous,
+		Principal:  principal,
+	}
+	dataMap, err := h.hooks.Before(&collection, payload)
+	if err != nil {
+		hookRejected(c, err)
 		return
 	}
+	data, _ := json.Marshal(dataMap)
 
-	// 获取当前用户ID
-	userID := uint(0)
-	if uid, exists := c.Get("user_id"); exists {
-		userID = uid.(uint)
+	// 验证数据（唯一性检查排除当前文档）
+	if err := h.newValidator(&collection).Validate(dataMap, document.ID); err != nil {
+		failWithData(c, 400, "数据验证失败: "+err.Error(), validationData(err))
+		return
 	}
 
-	document.Data = req.Data
-	document.UpdatedBy = userID
+	document.Data = data
+	document.UpdatedBy = principal.UserID
 
 	if err := h.db.Save(&document).Error; err != nil {
+		if verr := duplicateKeyError(&collection, err); verr != nil {
+			failWithData(c, 400, "数据验证失败: "+verr.Error(), validationData(verr))
+			return
+		}
 		fail(c, 500, "更新文档失败: "+err.Error())
 		return
 	}
 
+	payload.Event = HookAfterUpdate
+	h.hooks.After(&collection, payload)
+	h.publishChange(&collection, ChangeUpdate, &document, previous)
+	h.aggregates.invalidate(collection.AppID)
+
 	success(c, document)
 }
 
 // DeleteDocument 删除文档
 func (h *Handler) DeleteDocument(c *gin.Context) {
-	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	appID := resolveAppID(c)
 	collectionName := c.Param("collectionName")
 	docID, _ := strconv.ParseUint(c.Param("docId"), 10, 64)
 
@@ -764,17 +942,51 @@ func (h *Handler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Delete(&document).Error; err != nil {
+	principal := principalFromContext(c)
+	if decision := Evaluate(&collection, ActionDelete, principal, &document); !decision.Allowed {
+		response.Forbidden(c, decision.Reason)
+		return
+	}
+
+	// 执行删除前钩子（可拒绝删除）
+	var previous map[string]interface{}
+	json.Unmarshal(document.Data, &previous)
+	payload := &HookPayload{
+		Event:      HookBeforeDelete,
+		AppID:      collection.AppID,
+		Collection: collection.Name,
+		DocumentID: document.ID,
+		Previous:   previous,
+		Principal:  principal,
+	}
+	if _, err := h.hooks.Before(&collection, payload); err != nil {
+		hookRejected(c, err)
+		return
+	}
+
+	// 按引用字段的删除策略处理引用方文档
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWithReferences(tx, &collection, &document)
+	}); err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			failWithData(c, 400, "删除失败: "+verr.Error(), validationData(verr))
+			return
+		}
 		fail(c, 500, "删除文档失败: "+err.Error())
 		return
 	}
 
+	payload.Event = HookAfterDelete
+	h.hooks.After(&collection, payload)
+	h.publishChange(&collection, ChangeDelete, &document, nil)
+	h.aggregates.invalidate(collection.AppID)
+
 	success(c, nil)
 }
 
 // MigrateDB 数据库迁移
 func MigrateDB(db *gorm.DB) error {
-	return db.AutoMigrate(&DataCollection{}, &DataDocument{}, &FeatureVersion{})
+	return db.AutoMigrate(&DataCollection{}, &DataDocument{}, &FeatureVersion{}, &IndexJob{}, &SchemaMigration{}, &MigrationBackup{}, &HookLog{}, &HookJob{}, &ImportJob{}, &ImportChunk{})
 }
 
 
@@ -897,6 +1109,7 @@ func (h *Handler) CreateFeatureVersion(c *gin.Context) {
 }
 
 // PublishFeatureVersion 发布功能版本
+// 发布时将数据模型切换到版本的字段结构，并在后台迁移已有文档；dry_run 时只返回迁移预演报告
 func (h *Handler) PublishFeatureVersion(c *gin.Context) {
 	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
 	collectionID, _ := strconv.ParseUint(c.Param("collectionId"), 10, 64)
@@ -913,29 +1126,94 @@ func (h *Handler) PublishFeatureVersion(c *gin.Context) {
 		return
 	}
 
-	// 将其他已发布版本标记为deprecated
-	h.db.Model(&FeatureVersion{}).Where("collection_id = ? AND status = ?", collectionID, "published").Update("status", "deprecated")
+	req, err := bindSchemaChange(c)
+	if err != nil {
+		fail(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var collection DataCollection
+	if err := h.db.Where("id = ? AND app_id = ?", collectionID, appID).First(&collection).Error; err != nil {
+		fail(c, 404, "数据模型不存在")
+		return
+	}
+
+	target := parseFields(version.SchemaSnapshot)
+	diff, err := diffSchemas(parseFields(collection.Fields), target, req.Renames)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	if req.DryRun {
+		report, err := h.migrations.dryRun(collection.ID, diff, target)
+		if err != nil {
+			fail(c, 500, "迁移预演失败: "+err.Error())
+			return
+		}
+		success(c, gin.H{
+			"dry_run": true,
+			"report":  report,
+		})
+		return
+	}
+
+	if h.activeMigration(collection.ID) != nil {
+		fail(c, 400, "存在进行中的数据迁移，请等待完成后再发布")
+		return
+	}
+
+	createdBy := ""
+	if username, exists := c.Get("username"); exists {
+		createdBy = username.(string)
+	}
+
+	var current FeatureVersion
+	h.db.Where("collection_id = ? AND status = ?", collectionID, "published").Order("version_num DESC").First(&current)
 
-	// 发布当前版本
 	now := time.Now()
-	if err := h.db.Model(&version).Updates(map[string]interface{}{
-		"status":       "published",
-		"published_at": now,
-	}).Error; err != nil {
+	var migration *SchemaMigration
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 将其他已发布版本标记为deprecated
+		if err := tx.Model(&FeatureVersion{}).Where("collection_id = ? AND status = ?", collectionID, "published").Update("status", "deprecated").Error; err != nil {
+			return err
+		}
+
+		// 发布当前版本
+		if err := tx.Model(&version).Updates(map[string]interface{}{
+			"status":       "published",
+			"published_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		migration, err = applySchema(tx, &collection, version.SchemaSnapshot, diff, current.ID, version.ID, createdBy)
+		return err
+	})
+	if err != nil {
 		fail(c, 500, "发布失败: "+err.Error())
 		return
 	}
 
+	if err := h.reconcileIndexes(&collection); err != nil {
+		log.Printf("[BaaS] Failed to reconcile indexes after publish: %v", err)
+	}
+	h.migrations.wake()
+
 	version.Status = "published"
 	version.PublishedAt = &now
 
 	success(c, gin.H{
-		"message": "发布成功",
-		"version": version,
+		"message":   "发布成功",
+		"version":   version,
+		"diff":      diff,
+		"migration": migration,
 	})
 }
 
 // RollbackFeatureVersion 回滚到指定版本
+// 若最近一次迁移正是从该版本发布而来，则撤销该迁移（从备份恢复文档）；否则按目标结构迁移文档
 func (h *Handler) RollbackFeatureVersion(c *gin.Context) {
 	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
 	collectionID, _ := strconv.ParseUint(c.Param("collectionId"), 10, 64)
@@ -954,9 +1232,52 @@ func (h *Handler) RollbackFeatureVersion(c *gin.Context) {
 		return
 	}
 
-	// 将数据模型的字段恢复到该版本
-	if err := h.db.Model(&collection).Update("fields", version.SchemaSnapshot).Error; err != nil {
-		fail(c, 500, "回滚失败: "+err.Error())
+	req, err := bindSchemaChange(c)
+	if err != nil {
+		fail(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 判断能否直接撤销最近一次迁移
+	var last SchemaMigration
+	reversible := h.db.Where("collection_id = ?", collectionID).Order("id DESC").First(&last).Error == nil &&
+		last.Direction == MigrationForward && last.Status == MigrationCompleted &&
+		last.FromVersionID != 0 && last.FromVersionID == version.ID
+
+	target := parseFields(version.SchemaSnapshot)
+	diff, err := diffSchemas(parseFields(collection.Fields), target, req.Renames)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	if req.DryRun {
+		if reversible {
+			var backups int64
+			h.db.Model(&MigrationBackup{}).Where("migration_id = ?", last.ID).Count(&backups)
+			success(c, gin.H{
+				"dry_run":      true,
+				"mode":         MigrationRevert,
+				"migration_id": last.ID,
+				"restorable":   backups,
+			})
+			return
+		}
+		report, err := h.migrations.dryRun(collection.ID, diff, target)
+		if err != nil {
+			fail(c, 500, "迁移预演失败: "+err.Error())
+			return
+		}
+		success(c, gin.H{
+			"dry_run": true,
+			"mode":    MigrationForward,
+			"report":  report,
+		})
+		return
+	}
+
+	if h.activeMigration(collection.ID) != nil {
+		fail(c, 400, "存在进行中的数据迁移，请等待完成后再回滚")
 		return
 	}
 
@@ -985,17 +1306,48 @@ func (h *Handler) RollbackFeatureVersion(c *gin.Context) {
 	now := time.Now()
 	rollbackVersion.PublishedAt = &now
 
-	// 将其他已发布版本标记为deprecated
-	h.db.Model(&FeatureVersion{}).Where("collection_id = ? AND status = ?", collectionID, "published").Update("status", "deprecated")
+	var current FeatureVersion
+	h.db.Where("collection_id = ? AND status = ?", collectionID, "published").Order("version_num DESC").First(&current)
 
-	if err := h.db.Create(&rollbackVersion).Error; err != nil {
+	var migration *SchemaMigration
+	if reversible {
+		migration = &last
+	}
+	// 版本记录与迁移状态在同一事务中切换，任一步失败都不会留下不一致的状态
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 将其他已发布版本标记为deprecated
+		if err := tx.Model(&FeatureVersion{}).Where("collection_id = ? AND status = ?", collectionID, "published").Update("status", "deprecated").Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&rollbackVersion).Error; err != nil {
+			return err
+		}
+		if reversible {
+			return markReverting(tx, &collection, &last)
+		}
+		var err error
+		migration, err = applySchema(tx, &collection, version.SchemaSnapshot, diff, current.ID, rollbackVersion.ID, createdBy)
+		return err
+	})
+	if err != nil {
 		fail(c, 500, "创建回滚记录失败: "+err.Error())
 		return
 	}
 
+	if reversible {
+		h.afterRevert(&collection, &last)
+	} else {
+		if err := h.reconcileIndexes(&collection); err != nil {
+			log.Printf("[BaaS] Failed to reconcile indexes after rollback: %v", err)
+		}
+		h.migrations.wake()
+	}
+
 	success(c, gin.H{
-		"message":        "回滚成功",
+		"message":         "回滚成功",
 		"rollbackVersion": rollbackVersion,
+		"diff":            diff,
+		"migration":       migration,
 	})
 }
 
@@ -1041,7 +1393,7 @@ func (h *Handler) CompareFeatureVersions(c *gin.Context) {
 	for name, f := range fieldMap2 {
 		if _, exists := fieldMap1[name]; !exists {
 			added = append(added, f)
-		} else if fieldMap1[name] != f {
+		} else if !reflect.DeepEqual(fieldMap1[name], f) {
 			modified = append(modified, f)
 		}
 	}
@@ -1051,6 +1403,8 @@ func (h *Handler) CompareFeatureVersions(c *gin.Context) {
 		}
 	}
 
+	// 字段级明细，字段数组按 name 匹配
+	changes := jsondiff.Compare(fields1, fields2, &jsondiff.Options{Keys: []string{"name"}})
 	success(c, gin.H{
 		"version1": gin.H{
 			"id":      version1.ID,
@@ -1066,6 +1420,9 @@ func (h *Handler) CompareFeatureVersions(c *gin.Context) {
 			"added":    added,
 			"removed":  removed,
 			"modified": modified,
+			"changes":  changes,
+			"summary":  jsondiff.Summarize(changes),
 		},
+		"text": jsondiff.Unified(changes, version1.Version, version2.Version),
 	})
 }
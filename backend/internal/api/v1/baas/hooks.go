@@ -0,0 +1,895 @@
+package baas
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"app-platform-backend/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 钩子触发时机
+const (
+	HookBeforeCreate = "before_create"
+	HookAfterCreate  = "after_create"
+	HookBeforeUpdate = "before_update"
+	HookAfterUpdate  = "after_update"
+	HookBeforeDelete = "before_delete"
+	HookAfterDelete  = "after_delete"
+)
+
+// 钩子动作
+const (
+	HookActionWebhook   = "webhook"    // 调用外部URL，before_* 可通过响应拒绝或修改数据
+	HookActionReject    = "reject"     // 满足条件时拒绝写入
+	HookActionSetFields = "set_fields" // 写入前设置字段值
+	HookActionMessage   = "message"    // 发送站内消息（model.Message）
+	HookActionPush      = "push"       // 创建推送记录（model.PushRecord）
+	HookActionEvent     = "event"      // 上报事件（model.Event）
+)
+
+// 钩子执行结果
+const (
+	HookStatusSuccess  = "success"
+	HookStatusRejected = "rejected"
+	HookStatusFailed   = "failed"
+	HookStatusTimeout  = "timeout"
+)
+
+const (
+	defaultHookTimeout = 5 * time.Second
+	maxHookTimeout     = 30
+	maxHookRetries     = 5
+	maxHooksPerEvent   = 10
+	maxHookResponse    = 1 << 20
+	hookPollInterval   = 2 * time.Second
+	hookWorkers        = 4
+)
+
+// 异步钩子任务状态
+const (
+	HookJobPending = "pending"
+	HookJobRunning = "running"
+)
+
+// errBlockedAddress webhook 目标为内网、回环或云元数据等禁止访问的地址
+var errBlockedAddress = errors.New("不允许访问内网地址")
+
+// blockedNetworks IsPrivate 等方法未覆盖的保留网段
+// 100.64.0.0/10 含阿里云元数据地址 100.100.100.200
+var blockedNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+var hookEvents = map[string]bool{
+	HookBeforeCreate: true, HookAfterCreate: true,
+	HookBeforeUpdate: true, HookAfterUpdate: true,
+	HookBeforeDelete: true, HookAfterDelete: true,
+}
+
+// templatePattern 模板变量，如 {{title}}、{{author.name}}
+var templatePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.]*)\s*\}\}`)
+
+// HookDefinition 钩子定义，存储于 DataCollection.Hooks
+type HookDefinition struct {
+	Name      string                 `json:"name"`
+	Event     string                 `json:"event"`
+	Action    string                 `json:"action"`
+	Disabled  bool                   `json:"disabled,omitempty"`
+	Async     bool                   `json:"async,omitempty"`     // 仅 after_* 可异步执行
+	Timeout   int                    `json:"timeout,omitempty"`   // 超时秒数，默认5秒
+	Retries   int                    `json:"retries,omitempty"`   // 异步执行失败后的重试次数
+	Condition map[string]interface{} `json:"condition,omitempty"` // 文档字段全部等于给定值时才执行
+	Config    json.RawMessage        `json:"config,omitempty"`
+}
+
+func (d *HookDefinition) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(d.Timeout) * time.Second
+}
+
+// webhookConfig webhook 动作配置
+type webhookConfig struct {
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret"` // 设置后请求携带 X-Hook-Signature（HMAC-SHA256）
+	Headers map[string]string `json:"headers"`
+}
+
+// webhookResponse before_* webhook 的响应约定
+type webhookResponse struct {
+	Allow   *bool                  `json:"allow"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// notifyConfig message/push/event 动作配置，文本支持 {{字段}} 模板
+type notifyConfig struct {
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Type       string `json:"type"`
+	UserID     uint   `json:"user_id"`
+	UserField  string `json:"user_field"` // 从文档字段读取接收用户ID
+	TargetType string `json:"target_type"`
+	TargetIDs  string `json:"target_ids"`
+	EventCode  string `json:"event_code"`
+	EventName  string `json:"event_name"`
+}
+
+// HookLog 钩子执行日志
+type HookLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	AppID        uint      `json:"app_id" gorm:"index"`
+	CollectionID uint      `json:"collection_id" gorm:"index"`
+	DocumentID   uint      `json:"document_id"`
+	HookName     string    `json:"hook_name" gorm:"size:100;index"`
+	Event        string    `json:"event" gorm:"size:30"`
+	Action       string    `json:"action" gorm:"size:30"`
+	Async        bool      `json:"async"`
+	Attempt      int       `json:"attempt"`
+	Status       string    `json:"status" gorm:"size:20;index"`
+	Message      string    `json:"message" gorm:"type:text"`
+	DurationMs   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+func (HookLog) TableName() string {
+	return "data_hook_logs"
+}
+
+// HookJob 异步钩子的待执行任务，执行结果记录在 HookLog 中，成功或重试耗尽后删除
+// 进程重启后未完成的任务会继续执行，webhook 接收方应按文档ID与事件做幂等处理
+type HookJob struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	AppID        uint            `json:"app_id" gorm:"index"`
+	CollectionID uint            `json:"collection_id" gorm:"index"`
+	HookName     string          `json:"hook_name" gorm:"size:100"`
+	Hook         json.RawMessage `json:"hook" gorm:"type:json"` // 入队时的钩子定义，之后修改数据模型不影响已排队的任务
+	Payload      json.RawMessage `json:"payload" gorm:"type:json"`
+	Attempt      int             `json:"attempt"`
+	Status       string          `json:"status" gorm:"size:20;default:pending;index:idx_hook_job_due,priority:1"`
+	NextRunAt    time.Time       `json:"next_run_at" gorm:"index:idx_hook_job_due,priority:2"`
+	ClaimToken   string          `json:"-" gorm:"size:32"` // 执行中任务的持有者，见 lease.go
+	LeaseUntil   *time.Time      `json:"-"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+func (HookJob) TableName() string {
+	return "data_hook_jobs"
+}
+
+// HookPayload 钩子收到的上下文
+type HookPayload struct {
+	Event      string                 `json:"event"`
+	AppID      uint                   `json:"app_id"`
+	Collection string                 `json:"collection"`
+	DocumentID uint                   `json:"document_id,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Previous   map[string]interface{} `json:"previous,omitempty"`
+	Principal  Principal              `json:"principal"`
+}
+
+// HookRejection 钩子拒绝写入
+type HookRejection struct {
+	Hook    string
+	Message string
+}
+
+func (e *HookRejection) Error() string {
+	return e.Message
+}
+
+// parseHooks 解析数据模型的钩子定义
+func parseHooks(raw json.RawMessage) []HookDefinition {
+	var hooks []HookDefinition
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &hooks)
+	}
+	return hooks
+}
+
+// validateHooks 校验钩子定义
+func validateHooks(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var hooks []HookDefinition
+	if err := json.Unmarshal(raw, &hooks); err != nil {
+		return errors.New("钩子定义应为数组")
+	}
+
+	names := make(map[string]bool)
+	perEvent := make(map[string]int)
+	for _, h := range hooks {
+		if h.Name == "" || names[h.Name] {
+			return fmt.Errorf("钩子名称为空或重复: %q", h.Name)
+		}
+		names[h.Name] = true
+		if !hookEvents[h.Event] {
+			return fmt.Errorf("钩子 %s 的触发时机无效", h.Name)
+		}
+		if perEvent[h.Event]++; perEvent[h.Event] > maxHooksPerEvent {
+			return fmt.Errorf("每个触发时机最多%d个钩子", maxHooksPerEvent)
+		}
+		before := strings.HasPrefix(h.Event, "before_")
+		if h.Async && before {
+			return fmt.Errorf("钩子 %s: before_* 钩子不能异步执行", h.Name)
+		}
+		if h.Timeout < 0 || h.Timeout > maxHookTimeout {
+			return fmt.Errorf("钩子 %s 的超时时间应为0-%d秒", h.Name, maxHookTimeout)
+		}
+		if h.Retries < 0 || h.Retries > maxHookRetries {
+			return fmt.Errorf("钩子 %s 的重试次数应为0-%d", h.Name, maxHookRetries)
+		}
+
+		switch h.Action {
+		case HookActionWebhook:
+			var cfg webhookConfig
+			json.Unmarshal(h.Config, &cfg)
+			u, err := url.Parse(cfg.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("钩子 %s 的URL无效", h.Name)
+			}
+			// 域名在请求时按解析结果检查，这里只能提前拒绝直接写IP或 localhost 的地址
+			host := u.Hostname()
+			if ip := net.ParseIP(host); (ip != nil && blockedIP(ip)) || strings.EqualFold(host, "localhost") {
+				return fmt.Errorf("钩子 %s 的URL%v", h.Name, errBlockedAddress)
+			}
+		case HookActionReject:
+			if !before {
+				return fmt.Errorf("钩子 %s: reject 只能用于 before_* 钩子", h.Name)
+			}
+		case HookActionSetFields:
+			if h.Event != HookBeforeCreate && h.Event != HookBeforeUpdate {
+				return fmt.Errorf("钩子 %s: set_fields 只能用于 before_create 或 before_update", h.Name)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(h.Config, &fields); err != nil || len(fields) == 0 {
+				return fmt.Errorf("钩子 %s: set_fields 的配置应为字段值对象", h.Name)
+			}
+		case HookActionMessage, HookActionPush:
+			var cfg notifyConfig
+			json.Unmarshal(h.Config, &cfg)
+			if cfg.Title == "" {
+				return fmt.Errorf("钩子 %s 必须设置标题", h.Name)
+			}
+		case HookActionEvent:
+			var cfg notifyConfig
+			json.Unmarshal(h.Config, &cfg)
+			if cfg.EventCode == "" {
+				return fmt.Errorf("钩子 %s 必须设置事件编码", h.Name)
+			}
+		default:
+			return fmt.Errorf("钩子 %s 的动作 %s 不受支持", h.Name, h.Action)
+		}
+	}
+	return nil
+}
+
+// blockedIP 是否为 webhook 禁止访问的地址：回环、私有网段、链路本地（含 169.254.169.254 元数据地址）、组播及保留网段
+func blockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookClient 创建只能访问公网地址的 HTTP 客户端
+// 在建立连接时检查DNS解析后的实际地址，重定向和DNS重绑定同样受限；不使用环境变量中的代理
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("%w: %s", errBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// HookRunner 执行数据模型钩子并记录执行日志
+// 异步钩子写入 HookJob 后由后台工作协程执行并按指数退避重试
+type HookRunner struct {
+	db      *gorm.DB
+	client  *http.Client
+	notify  chan struct{}
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// NewHookRunner 创建钩子执行器
+func NewHookRunner(db *gorm.DB) *HookRunner {
+	return &HookRunner{
+		db:      db,
+		client:  webhookClient(),
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start 启动异步钩子的后台工作协程
+func (r *HookRunner) Start() {
+	r.once.Do(func() {
+		// 中断的任务在租约过期后由任一实例重新执行
+		for i := 0; i < hookWorkers; i++ {
+			go r.loop()
+		}
+		log.Println("[BaaS] Hook job workers started")
+	})
+}
+
+// Stop 停止后台工作协程
+func (r *HookRunner) Stop() {
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+}
+
+func (r *HookRunner) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *HookRunner) loop() {
+	ticker := time.NewTicker(hookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for r.runNext() {
+		}
+		select {
+		case <-r.stopped:
+			return
+		case <-r.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// hooksFor 获取数据模型在某时机启用且满足条件的钩子
+func hooksFor(collection *DataCollection, event string, data map[string]interface{}) []HookDefinition {
+	var result []HookDefinition
+	for _, h := range parseHooks(collection.Hooks) {
+		if h.Event == event && !h.Disabled && matchCondition(h.Condition, data) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// matchCondition 文档字段是否全部等于条件中的值
+func matchCondition(condition map[string]interface{}, data map[string]interface{}) bool {
+	for field, want := range condition {
+		got, ok := data[field]
+		if !ok {
+			return false
+		}
+		a, _ := json.Marshal(got)
+		b, _ := json.Marshal(want)
+		if !bytes.Equal(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Before 依次执行 before_* 钩子，返回（可能被修改的）文档数据；钩子拒绝或执行失败时返回 *HookRejection
+func (r *HookRunner) Before(collection *DataCollection, payload *HookPayload) (map[string]interface{}, error) {
+	conditionData := payload.Data
+	if payload.Event == HookBeforeDelete {
+		conditionData = payload.Previous
+	}
+
+	for _, hook := range hooksFor(collection, payload.Event, conditionData) {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+		data, err := r.execute(ctx, collection, &hook, payload)
+		cancel()
+
+		status, message := outcome(err)
+		r.record(collection, payload, &hook, 1, status, message, time.Since(start))
+
+		if err != nil {
+			var rejection *HookRejection
+			if errors.As(err, &rejection) {
+				return nil, rejection
+			}
+			// 写入前钩子执行失败时拒绝写入，避免绕过校验
+			return nil, &HookRejection{Hook: hook.Name, Message: "钩子 " + hook.Name + " 执行失败: " + message}
+		}
+		if data != nil {
+			payload.Data = data
+		}
+	}
+	return payload.Data, nil
+}
+
+// After 执行 after_* 钩子；同步钩子的失败只记录日志，异步钩子在后台按配置重试
+func (r *HookRunner) After(collection *DataCollection, payload *HookPayload) {
+	conditionData := payload.Data
+	if payload.Event == HookAfterDelete {
+		conditionData = payload.Previous
+	}
+
+	for _, hook := range hooksFor(collection, payload.Event, conditionData) {
+		hook := hook
+		if hook.Async {
+			if err := r.enqueue(collection, &hook, payload); err != nil {
+				log.Printf("[BaaS] Failed to enqueue hook %s: %v", hook.Name, err)
+				r.record(collection, payload, &hook, 0, HookStatusFailed, "排队失败: "+err.Error(), 0)
+			}
+			continue
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+		_, err := r.execute(ctx, collection, &hook, payload)
+		cancel()
+		status, message := outcome(err)
+		r.record(collection, payload, &hook, 1, status, message, time.Since(start))
+	}
+}
+
+// enqueue 保存异步钩子任务并唤醒工作协程
+func (r *HookRunner) enqueue(collection *DataCollection, hook *HookDefinition, payload *HookPayload) error {
+	hookData, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	job := HookJob{
+		AppID:        collection.AppID,
+		CollectionID: collection.ID,
+		HookName:     hook.Name,
+		Hook:         hookData,
+		Payload:      payloadData,
+		Status:       HookJobPending,
+		NextRunAt:    time.Now(),
+	}
+	if err := r.db.Create(&job).Error; err != nil {
+		return err
+	}
+	r.wake()
+	return nil
+}
+
+// runNext 执行最早到期的一个异步钩子任务，没有任务时返回 false
+// 失败后按 1s、2s、4s… 退避重试，共执行 Retries+1 次
+func (r *HookRunner) runNext() bool {
+	job, ok := r.claim()
+	if !ok {
+		return job != nil
+	}
+	owned := r.db.Where("id = ? AND claim_token = ?", job.ID, job.ClaimToken)
+
+	var hook HookDefinition
+	var payload HookPayload
+	if err := json.Unmarshal(job.Hook, &hook); err != nil || json.Unmarshal(job.Payload, &payload) != nil {
+		log.Printf("[BaaS] Hook job %d is malformed, dropping", job.ID)
+		owned.Delete(&HookJob{})
+		return true
+	}
+	collection := &DataCollection{ID: job.CollectionID, AppID: job.AppID}
+
+	err := r.runOnce(collection, &hook, &payload, job.Attempt)
+	if err == nil || job.Attempt > hook.Retries {
+		owned.Delete(&HookJob{})
+		return true
+	}
+	owned.Model(&HookJob{}).Updates(map[string]interface{}{
+		"status":      HookJobPending,
+		"next_run_at": time.Now().Add(hookBackoff(job.Attempt)),
+		"claim_token": "",
+		"lease_until": nil,
+	})
+	return true
+}
+
+// claim 以逐行条件更新领取最早到期的任务：到期的待处理任务，或租约已过期的执行中任务
+// 钩子超时不超过 maxHookTimeout，远小于租约时长，执行期间无需续约
+// 返回 (nil, false) 表示没有可领取的任务，(非 nil, false) 表示任务已被其他实例领取
+func (r *HookRunner) claim() (*HookJob, bool) {
+	now := time.Now()
+	due := "(status = ? AND next_run_at <= ?) OR (status = ? AND lease_until < ?)"
+	var job HookJob
+	if err := r.db.Where(due, HookJobPending, now, HookJobRunning, now).
+		Order("next_run_at ASC, id ASC").First(&job).Error; err != nil {
+		return nil, false
+	}
+
+	token := newClaimToken()
+	result := r.db.Model(&HookJob{}).Where("id = ?", job.ID).Where(due, HookJobPending, now, HookJobRunning, now).
+		Updates(map[string]interface{}{
+			"status":      HookJobRunning,
+			"attempt":     gorm.Expr("attempt + 1"),
+			"claim_token": token,
+			"lease_until": now.Add(jobLease),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return &job, false
+	}
+	job.Attempt++
+	job.ClaimToken = token
+	return &job, true
+}
+
+// runOnce 执行一次钩子并记录日志
+func (r *HookRunner) runOnce(collection *DataCollection, hook *HookDefinition, payload *HookPayload, attempt int) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[BaaS] Hook %s panicked: %v", hook.Name, p)
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	_, err = r.execute(ctx, collection, hook, payload)
+	cancel()
+
+	status, message := outcome(err)
+	r.record(collection, payload, hook, attempt, status, message, time.Since(start))
+	return err
+}
+
+// hookBackoff 第 attempt 次执行失败后的等待时间
+func hookBackoff(attempt int) time.Duration {
+	return time.Second << (attempt - 1)
+}
+
+// outcome 将执行结果转换为日志状态
+func outcome(err error) (string, string) {
+	var rejection *HookRejection
+	switch {
+	case err == nil:
+		return HookStatusSuccess, ""
+	case errors.As(err, &rejection):
+		return HookStatusRejected, rejection.Message
+	case errors.Is(err, context.DeadlineExceeded):
+		return HookStatusTimeout, "执行超时"
+	}
+	return HookStatusFailed, err.Error()
+}
+
+func (r *HookRunner) record(collection *DataCollection, payload *HookPayload, hook *HookDefinition, attempt int, status, message string, duration time.Duration) {
+	entry := HookLog{
+		AppID:        collection.AppID,
+		CollectionID: collection.ID,
+		DocumentID:   payload.DocumentID,
+		HookName:     hook.Name,
+		Event:        hook.Event,
+		Action:       hook.Action,
+		Async:        hook.Async,
+		Attempt:      attempt,
+		Status:       status,
+		Message:      message,
+		DurationMs:   duration.Milliseconds(),
+	}
+	if err := r.db.Create(&entry).Error; err != nil {
+		log.Printf("[BaaS] Failed to record hook log: %v", err)
+	}
+}
+
+// execute 执行单个钩子，返回修改后的数据（未修改时为 nil）
+func (r *HookRunner) execute(ctx context.Context, collection *DataCollection, hook *HookDefinition, payload *HookPayload) (map[string]interface{}, error) {
+	data := payload.Data
+	if data == nil {
+		data = payload.Previous
+	}
+
+	switch hook.Action {
+	case HookActionWebhook:
+		return r.callWebhook(ctx, hook, payload)
+
+	case HookActionReject:
+		var cfg struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(hook.Config, &cfg)
+		if cfg.Message == "" {
+			cfg.Message = "操作被钩子 " + hook.Name + " 拒绝"
+		}
+		return nil, &HookRejection{Hook: hook.Name, Message: renderTemplate(cfg.Message, data, payload)}
+
+	case HookActionSetFields:
+		var fields map[string]interface{}
+		if err := json.Unmarshal(hook.Config, &fields); err != nil {
+			return nil, err
+		}
+		mutated := make(map[string]interface{}, len(data)+len(fields))
+		for k, v := range data {
+			mutated[k] = v
+		}
+		for k, v := range fields {
+			mutated[k] = resolveMacro(v, payload)
+		}
+		return mutated, nil
+
+	case HookActionMessage:
+		cfg, err := parseNotifyConfig(hook)
+		if err != nil {
+			return nil, err
+		}
+		msg := model.Message{
+			AppID:   collection.AppID,
+			UserID:  notifyUser(cfg, data),
+			Title:   renderTemplate(cfg.Title, data, payload),
+			Content: renderTemplate(cfg.Content, data, payload),
+			Type:    cfg.Type,
+		}
+		if msg.Type == "" {
+			msg.Type = "system"
+		}
+		return nil, r.db.WithContext(ctx).Create(&msg).Error
+
+	case HookActionPush:
+		cfg, err := parseNotifyConfig(hook)
+		if err != nil {
+			return nil, err
+		}
+		record := model.PushRecord{
+			AppID:      collection.AppID,
+			Title:      renderTemplate(cfg.Title, data, payload),
+			Content:    renderTemplate(cfg.Content, data, payload),
+			TargetType: cfg.TargetType,
+			TargetIDs:  renderTemplate(cfg.TargetIDs, data, payload),
+			Status:     "pending",
+		}
+		if record.TargetType == "" {
+			record.TargetType = "all"
+		}
+		return nil, r.db.WithContext(ctx).Create(&record).Error
+
+	case HookActionEvent:
+		cfg, err := parseNotifyConfig(hook)
+		if err != nil {
+			return nil, err
+		}
+		properties, _ := json.Marshal(map[string]interface{}{
+			"collection":  payload.Collection,
+			"document_id": payload.DocumentID,
+			"trigger":     payload.Event,
+			"data":        data,
+		})
+		event := model.Event{
+			AppID:      collection.AppID,
+			UserID:     notifyUser(cfg, data),
+			EventCode:  cfg.EventCode,
+			EventName:  renderTemplate(cfg.EventName, data, payload),
+			Properties: string(properties),
+		}
+		return nil, r.db.WithContext(ctx).Create(&event).Error
+	}
+	return nil, fmt.Errorf("不支持的钩子动作: %s", hook.Action)
+}
+
+// callWebhook 调用外部URL
+// before_* 钩子：非2xx响应或 {"allow": false} 拒绝写入，响应中的 data 替换文档数据
+func (r *HookRunner) callWebhook(ctx context.Context, hook *HookDefinition, payload *HookPayload) (map[string]interface{}, error) {
+	var cfg webhookConfig
+	if err := json.Unmarshal(hook.Config, &cfg); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hook-Name", hook.Name)
+	req.Header.Set("X-Hook-Event", hook.Event)
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Hook-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxHookResponse))
+
+	before := strings.HasPrefix(hook.Event, "before_")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if before {
+			var result webhookResponse
+			if json.Unmarshal(respBody, &result) == nil && result.Message != "" {
+				return nil, &HookRejection{Hook: hook.Name, Message: result.Message}
+			}
+		}
+		return nil, fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	if !before || len(bytes.TrimSpace(respBody)) == 0 {
+		return nil, nil
+	}
+
+	var result webhookResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, nil
+	}
+	if result.Allow != nil && !*result.Allow {
+		if result.Message == "" {
+			result.Message = "操作被钩子 " + hook.Name + " 拒绝"
+		}
+		return nil, &HookRejection{Hook: hook.Name, Message: result.Message}
+	}
+	if hook.Event == HookBeforeDelete {
+		return nil, nil
+	}
+	return result.Data, nil
+}
+
+func parseNotifyConfig(hook *HookDefinition) (*notifyConfig, error) {
+	var cfg notifyConfig
+	if err := json.Unmarshal(hook.Config, &cfg); err != nil {
+		return nil, fmt.Errorf("钩子配置无效: %w", err)
+	}
+	return &cfg, nil
+}
+
+// notifyUser 解析接收用户ID
+func notifyUser(cfg *notifyConfig, data map[string]interface{}) *uint {
+	if cfg.UserField != "" {
+		if v, ok := lookupPath(data, cfg.UserField).(float64); ok && v > 0 {
+			id := uint(v)
+			return &id
+		}
+	}
+	if cfg.UserID > 0 {
+		id := cfg.UserID
+		return &id
+	}
+	return nil
+}
+
+// lookupPath 按 a.b.c 路径读取文档字段
+func lookupPath(data map[string]interface{}, path string) interface{} {
+	var current interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[part]
+	}
+	return current
+}
+
+// renderTemplate 渲染 {{字段}} 模板，{{id}} 为文档ID
+func renderTemplate(tpl string, data map[string]interface{}, payload *HookPayload) string {
+	return templatePattern.ReplaceAllStringFunc(tpl, func(m string) string {
+		name := templatePattern.FindStringSubmatch(m)[1]
+		if name == "id" {
+			return strconv.FormatUint(uint64(payload.DocumentID), 10)
+		}
+		value := lookupPath(data, name)
+		switch v := value.(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+	})
+}
+
+// resolveMacro 解析 set_fields 中的内置变量：$now 当前时间，$user_id 调用者ID
+func resolveMacro(value interface{}, payload *HookPayload) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	switch s {
+	case "$now":
+		return time.Now().Format(time.RFC3339)
+	case "$user_id":
+		return payload.Principal.UserID
+	}
+	return value
+}
+
+// hookRejected 返回钩子拒绝写入的响应
+func hookRejected(c *gin.Context, err error) {
+	var rejection *HookRejection
+	if errors.As(err, &rejection) {
+		failWithData(c, 400, rejection.Message, gin.H{"hook": rejection.Hook})
+		return
+	}
+	fail(c, 500, err.Error())
+}
+
+// ListHookLogs 获取数据模型的钩子执行日志
+func (h *Handler) ListHookLogs(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	var logs []HookLog
+	var total int64
+	query := h.db.Model(&HookLog{}).Where("collection_id = ?", collection.ID)
+	if hook := c.Query("hook"); hook != "" {
+		query = query.Where("hook_name = ?", hook)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if docID := c.Query("document_id"); docID != "" {
+		query = query.Where("document_id = ?", docID)
+	}
+	query.Count(&total)
+	query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&logs)
+
+	success(c, gin.H{
+		"list":  logs,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
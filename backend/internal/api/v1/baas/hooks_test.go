@@ -0,0 +1,132 @@
+package baas
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestValidateHooks(t *testing.T) {
+	cases := []struct {
+		name  string
+		hooks string
+		ok    bool
+	}{
+		{"empty", `[]`, true},
+		{"webhook", `[{"name":"audit","event":"after_create","action":"webhook","async":true,"config":{"url":"https://example.com/hook"}}]`, true},
+		{"set fields", `[{"name":"stamp","event":"before_update","action":"set_fields","config":{"updated_by":"$user_id"}}]`, true},
+		{"duplicate name", `[{"name":"a","event":"before_create","action":"reject"},{"name":"a","event":"before_update","action":"reject"}]`, false},
+		{"unknown event", `[{"name":"a","event":"on_save","action":"reject"}]`, false},
+		{"async before", `[{"name":"a","event":"before_create","action":"webhook","async":true,"config":{"url":"https://example.com"}}]`, false},
+		{"reject after", `[{"name":"a","event":"after_create","action":"reject"}]`, false},
+		{"bad url", `[{"name":"a","event":"after_create","action":"webhook","config":{"url":"ftp://example.com"}}]`, false},
+		{"metadata url", `[{"name":"a","event":"after_create","action":"webhook","config":{"url":"http://169.254.169.254/latest/meta-data"}}]`, false},
+		{"localhost url", `[{"name":"a","event":"after_create","action":"webhook","config":{"url":"http://localhost:8080/hook"}}]`, false},
+		{"missing event code", `[{"name":"a","event":"after_delete","action":"event","config":{}}]`, false},
+		{"not array", `{"name":"a"}`, false},
+	}
+	for _, tc := range cases {
+		err := validateHooks(json.RawMessage(tc.hooks))
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: validateHooks() error = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestMatchCondition(t *testing.T) {
+	data := map[string]interface{}{"status": "published", "count": float64(3)}
+	if !matchCondition(map[string]interface{}{"status": "published"}, data) {
+		t.Error("expected condition to match")
+	}
+	if !matchCondition(map[string]interface{}{"count": 3}, data) {
+		t.Error("expected numeric condition to match")
+	}
+	if matchCondition(map[string]interface{}{"status": "draft"}, data) {
+		t.Error("expected condition not to match")
+	}
+	if matchCondition(map[string]interface{}{"missing": nil}, data) {
+		t.Error("expected missing field not to match")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"title":  "Hello",
+		"author": map[string]interface{}{"name": "Ann"},
+		"tags":   []interface{}{"a"},
+	}
+	got := renderTemplate("{{title}} by {{ author.name }} #{{id}} {{tags}}{{none}}", data, &HookPayload{DocumentID: 7})
+	if want := `Hello by Ann #7 ["a"]`; got != want {
+		t.Errorf("renderTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestBlockedIP(t *testing.T) {
+	blocked := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.100.100.200", "0.0.0.0", "::1", "fd00:ec2::254", "fe80::1", "::ffff:127.0.0.1"}
+	for _, addr := range blocked {
+		if !blockedIP(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be blocked", addr)
+		}
+	}
+	for _, addr := range []string{"8.8.8.8", "203.0.113.10", "2001:4860:4860::8888"} {
+		if blockedIP(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be allowed", addr)
+		}
+	}
+}
+
+func TestWebhookClientRejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := webhookClient().Get(server.URL)
+	if !errors.Is(err, errBlockedAddress) {
+		t.Errorf("expected loopback request to be blocked, got %v", err)
+	}
+}
+
+func TestHookBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 5: 16 * time.Second} {
+		if got := hookBackoff(attempt); got != want {
+			t.Errorf("hookBackoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestHookClaimRace(t *testing.T) {
+	db, mock := newMockDB(t)
+	a := NewHookRunner(db)
+	b := NewHookRunner(db)
+
+	due := `SELECT \* FROM .data_hook_jobs. WHERE \(status = \? AND next_run_at <= \?\) OR \(status = \? AND lease_until < \?\)`
+	claim := `UPDATE .data_hook_jobs. SET .*claim_token.* WHERE id = \? AND \(\(status = \? AND next_run_at <= \?\) OR \(status = \? AND lease_until < \?\)\)`
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "status", "attempt"}).AddRow(1, HookJobPending, 0)
+	}
+
+	mock.ExpectQuery(due).WillReturnRows(row())
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(due).WillReturnRows(row())
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	jobA, ok := a.claim()
+	if !ok || jobA.Attempt != 1 || jobA.ClaimToken == "" {
+		t.Fatalf("first runner claim = %+v, %v; want claimed", jobA, ok)
+	}
+	jobB, ok := b.claim()
+	if ok || jobB == nil {
+		t.Fatalf("second runner claim = %+v, %v; want lost race", jobB, ok)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,904 @@
+package baas
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 索引任务状态
+const (
+	IndexJobPending   = "pending"
+	IndexJobRunning   = "running"
+	IndexJobCompleted = "completed"
+	IndexJobFailed    = "failed"
+)
+
+// 索引任务类型
+const (
+	IndexActionCreate = "create"
+	IndexActionDrop   = "drop"
+)
+
+// 索引状态（由最近一次任务推导）
+const (
+	IndexStatusBuilding = "building"
+	IndexStatusReady    = "ready"
+	IndexStatusDropping = "dropping"
+	IndexStatusFailed   = "failed"
+)
+
+const (
+	maxIndexFields    = 4
+	autoIndexPrefix   = "uniq_"
+	indexPollInterval = 30 * time.Second
+
+	// maxDocumentIndexes InnoDB 单表最多 64 个二级索引，所有APP的数据模型共享 data_documents 表
+	maxDocumentIndexes = 64
+	// maxAppIndexes 单个APP所有数据模型的索引总数上限，避免个别APP占满整表的名额
+	maxAppIndexes = 16
+	// maxIndexedLength 普通索引中字符串虚拟列的长度，超出部分截断后参与索引
+	maxIndexedLength = 255
+)
+
+// 索引名额不足的原因
+var (
+	errAppIndexQuota   = fmt.Errorf("APP 的索引数量已达上限（%d 个），请删除不再使用的索引后重试", maxAppIndexes)
+	errTableIndexLimit = errors.New("数据表索引数量已达 MySQL 上限，暂时无法创建索引，请联系管理员")
+)
+
+// indexNamePattern 用户自定义索引名
+var indexNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// duplicateKeyPattern 从MySQL唯一键冲突信息中提取索引名
+var duplicateKeyPattern = regexp.MustCompile(`for key '(?:[^.']*\.)?([^']+)'`)
+
+// IndexDefinition 索引定义，存储于 DataCollection.Indexes
+type IndexDefinition struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+	Unique bool     `json:"unique"`
+	Auto   bool     `json:"auto,omitempty"` // 由字段的 unique 属性自动维护
+}
+
+// IndexState 索引及其构建状态
+type IndexState struct {
+	IndexDefinition
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	JobID     uint       `json:"job_id"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// IndexJob 索引创建/删除的后台任务
+type IndexJob struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	AppID        uint            `json:"app_id" gorm:"index"`
+	CollectionID uint            `json:"collection_id" gorm:"index"`
+	IndexName    string          `json:"index_name" gorm:"size:100"`
+	Action       string          `json:"action" gorm:"size:20"`
+	Spec         json.RawMessage `json:"spec" gorm:"type:json"`
+	Status       string          `json:"status" gorm:"size:20;default:pending;index"`
+	Error        string          `json:"error" gorm:"type:text"`
+	ClaimToken   string          `json:"-" gorm:"size:32"` // 执行中任务的持有者，见 lease.go
+	LeaseUntil   *time.Time      `json:"-"`
+	StartedAt    *time.Time      `json:"started_at"`
+	FinishedAt   *time.Time      `json:"finished_at"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+func (IndexJob) TableName() string {
+	return "data_index_jobs"
+}
+
+// indexSpec 任务执行所需的完整索引描述，不依赖数据模型是否仍存在
+type indexSpec struct {
+	Name    string        `json:"name"`
+	Unique  bool          `json:"unique"`
+	Columns []indexColumn `json:"columns"`
+}
+
+type indexColumn struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+	Hash  bool   `json:"hash,omitempty"` // 唯一索引中的字符串字段，按完整值的哈希建立索引
+}
+
+// parseIndexes 解析数据模型的索引定义
+func parseIndexes(raw json.RawMessage) []IndexDefinition {
+	var defs []IndexDefinition
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &defs)
+	}
+	return defs
+}
+
+// physicalName 生成物理列名/索引名，超出MySQL标识符长度时使用哈希
+func physicalName(prefix string, collectionID uint, name string) string {
+	full := fmt.Sprintf("%s_%d_%s", prefix, collectionID, name)
+	if len(full) <= 64 {
+		return full
+	}
+	sum := sha1.Sum([]byte(name))
+	return fmt.Sprintf("%s_%d_%s", prefix, collectionID, hex.EncodeToString(sum[:])[:16])
+}
+
+func indexColumnName(collectionID uint, col indexColumn) string {
+	if col.Hash {
+		return physicalName("bh", collectionID, col.Field)
+	}
+	return physicalName("bc", collectionID, col.Field)
+}
+
+func indexPhysicalName(collectionID uint, name string) string {
+	return physicalName("bi", collectionID, name)
+}
+
+// columnDefinition 生成虚拟列定义
+// 虚拟列仅对所属数据模型的文档取值，其余文档为 NULL，因此唯一索引只约束本模型内的数据
+// 普通索引的字符串取前 255 个字符，避免超长值在严格模式下导致文档写入失败；
+// 唯一索引的字符串取完整值的 SHA-256，使只有前缀相同的值不会冲突。两者均按二进制比较，区分大小写
+func columnDefinition(collectionID uint, col indexColumn) (string, error) {
+	if !fieldNamePattern.MatchString(col.Field) {
+		return "", fmt.Errorf("无效的字段名: %s", col.Field)
+	}
+	path := "'$." + col.Field + "'"
+	cond := fmt.Sprintf("collection_id = %d", collectionID)
+
+	switch col.Type {
+	case "string", "":
+		if col.Hash {
+			return fmt.Sprintf("BINARY(32) GENERATED ALWAYS AS (IF(%s, UNHEX(SHA2(JSON_UNQUOTE(JSON_EXTRACT(data, %s)), 256)), NULL)) VIRTUAL", cond, path), nil
+		}
+		return fmt.Sprintf("VARCHAR(%d) COLLATE utf8mb4_bin GENERATED ALWAYS AS (IF(%s, LEFT(JSON_UNQUOTE(JSON_EXTRACT(data, %s)), %d), NULL)) VIRTUAL", maxIndexedLength, cond, path, maxIndexedLength), nil
+	case "number":
+		return fmt.Sprintf("DOUBLE GENERATED ALWAYS AS (IF(%s, CAST(JSON_EXTRACT(data, %s) AS DOUBLE), NULL)) VIRTUAL", cond, path), nil
+	case "boolean":
+		return fmt.Sprintf("TINYINT(1) GENERATED ALWAYS AS (CASE WHEN %s AND JSON_EXTRACT(data, %s) IS NOT NULL THEN JSON_EXTRACT(data, %s) = CAST('true' AS JSON) END) VIRTUAL", cond, path, path), nil
+	}
+	return "", fmt.Errorf("字段 %s 为%s类型，不支持建立索引", col.Field, col.Type)
+}
+
+// buildIndexSpec 根据字段定义生成索引描述
+func buildIndexSpec(collection *DataCollection, def IndexDefinition) (*indexSpec, error) {
+	if len(def.Fields) == 0 || len(def.Fields) > maxIndexFields {
+		return nil, fmt.Errorf("索引字段数量应为1-%d个", maxIndexFields)
+	}
+	fields := make(map[string]FieldDefinition)
+	for _, f := range parseFields(collection.Fields) {
+		fields[f.Name] = f
+	}
+
+	spec := &indexSpec{Name: def.Name, Unique: def.Unique}
+	seen := make(map[string]bool)
+	for _, name := range def.Fields {
+		if seen[name] {
+			return nil, fmt.Errorf("索引字段重复: %s", name)
+		}
+		seen[name] = true
+		if !fieldNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("无效的字段名: %s", name)
+		}
+		typ := ""
+		if f, ok := fields[name]; ok {
+			typ = scalarType(f.Type)
+		} else if len(fields) > 0 {
+			return nil, fmt.Errorf("字段 %s 未在数据模型中定义", name)
+		}
+		col := indexColumn{Field: name, Type: typ, Hash: def.Unique && (typ == "string" || typ == "")}
+		if _, err := columnDefinition(collection.ID, col); err != nil {
+			return nil, err
+		}
+		spec.Columns = append(spec.Columns, col)
+	}
+	return spec, nil
+}
+
+// IndexManager 负责索引任务的排队与执行
+// 任务以数据库为准，单个工作协程串行执行DDL，进程重启后未完成的任务会继续执行
+type IndexManager struct {
+	db      *gorm.DB
+	notify  chan struct{}
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// NewIndexManager 创建索引管理器
+func NewIndexManager(db *gorm.DB) *IndexManager {
+	return &IndexManager{
+		db:      db,
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start 启动后台工作协程
+func (m *IndexManager) Start() {
+	m.once.Do(func() {
+		// 中断的任务在租约过期后由任一实例重新执行（DDL均为幂等操作）
+		go m.loop()
+		log.Println("[BaaS] Index job worker started")
+	})
+}
+
+// Stop 停止后台工作协程
+func (m *IndexManager) Stop() {
+	select {
+	case <-m.stopped:
+	default:
+		close(m.stopped)
+	}
+}
+
+// enqueue 创建任务并唤醒工作协程
+func (m *IndexManager) enqueue(collection *DataCollection, action string, spec *indexSpec) (*IndexJob, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	job := &IndexJob{
+		AppID:        collection.AppID,
+		CollectionID: collection.ID,
+		IndexName:    spec.Name,
+		Action:       action,
+		Spec:         data,
+		Status:       IndexJobPending,
+	}
+	if err := m.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (m *IndexManager) loop() {
+	ticker := time.NewTicker(indexPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for m.runNext() {
+		}
+		select {
+		case <-m.stopped:
+			return
+		case <-m.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext 执行最早的一个可领取任务，没有任务时返回 false
+// 大表上的DDL可能持续很久，执行期间定期续约
+func (m *IndexManager) runNext() bool {
+	job, ok := m.claim()
+	if !ok {
+		return job != nil
+	}
+
+	stopLease := keepLease(m.db, &IndexJob{}, job.ID, job.ClaimToken)
+	err := m.execute(job)
+	stopLease()
+
+	updates := map[string]interface{}{"status": IndexJobCompleted, "error": "", "finished_at": time.Now(), "claim_token": "", "lease_until": nil}
+	if err != nil {
+		updates["status"] = IndexJobFailed
+		updates["error"] = err.Error()
+		log.Printf("[BaaS] Index job %d (%s %s) failed: %v", job.ID, job.Action, job.IndexName, err)
+	}
+	m.db.Model(&IndexJob{}).Where("id = ? AND claim_token = ?", job.ID, job.ClaimToken).Updates(updates)
+	return true
+}
+
+// claim 以逐行条件更新领取最早的可领取任务：待处理的任务，或租约已过期的执行中任务
+// 返回 (nil, false) 表示没有可领取的任务，(非 nil, false) 表示任务已被其他实例领取
+func (m *IndexManager) claim() (*IndexJob, bool) {
+	now := time.Now()
+	var job IndexJob
+	if err := leaseDue(m.db, IndexJobPending, IndexJobRunning, now).Order("id ASC").First(&job).Error; err != nil {
+		return nil, false
+	}
+
+	token := newClaimToken()
+	result := leaseDue(m.db.Model(&IndexJob{}).Where("id = ?", job.ID), IndexJobPending, IndexJobRunning, now).
+		Updates(map[string]interface{}{
+			"status":      IndexJobRunning,
+			"started_at":  now,
+			"claim_token": token,
+			"lease_until": now.Add(jobLease),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return &job, false
+	}
+	job.ClaimToken = token
+	return &job, true
+}
+
+func (m *IndexManager) execute(job *IndexJob) error {
+	var spec indexSpec
+	if err := json.Unmarshal(job.Spec, &spec); err != nil {
+		return fmt.Errorf("任务描述无效: %w", err)
+	}
+
+	switch job.Action {
+	case IndexActionCreate:
+		err := m.createIndex(job.CollectionID, &spec)
+		if err != nil {
+			m.dropUnusedColumns(job.CollectionID)
+		}
+		return err
+	case IndexActionDrop:
+		if err := m.dropIndex(job.CollectionID, &spec); err != nil {
+			return err
+		}
+		return m.dropUnusedColumns(job.CollectionID)
+	}
+	return fmt.Errorf("未知的任务类型: %s", job.Action)
+}
+
+func (m *IndexManager) createIndex(collectionID uint, spec *indexSpec) error {
+	columns := make([]string, 0, len(spec.Columns))
+	for _, col := range spec.Columns {
+		name := indexColumnName(collectionID, col)
+		columns = append(columns, "`"+name+"`")
+
+		exists, err := m.columnExists(name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		definition, err := columnDefinition(collectionID, col)
+		if err != nil {
+			return err
+		}
+		if err := m.db.Exec(fmt.Sprintf("ALTER TABLE data_documents ADD COLUMN `%s` %s", name, definition)).Error; err != nil {
+			return fmt.Errorf("创建虚拟列失败: %w", err)
+		}
+	}
+
+	indexName := indexPhysicalName(collectionID, spec.Name)
+	exists, err := m.indexExists(indexName)
+	if err != nil || exists {
+		return err
+	}
+	// 排队时的名额检查无法完全避免并发请求超额，执行前按实际索引数再检查一次
+	count, err := m.indexCount()
+	if err != nil {
+		return err
+	}
+	if count >= maxDocumentIndexes {
+		return errTableIndexLimit
+	}
+
+	kind := "INDEX"
+	if spec.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	sql := fmt.Sprintf("ALTER TABLE data_documents ADD %s `%s` (%s)", kind, indexName, strings.Join(columns, ", "))
+	if err := m.db.Exec(sql).Error; err != nil {
+		if isDuplicateKey(err) {
+			return errors.New("现有数据存在重复值，无法创建唯一索引")
+		}
+		return fmt.Errorf("创建索引失败: %w", err)
+	}
+	return nil
+}
+
+func (m *IndexManager) dropIndex(collectionID uint, spec *indexSpec) error {
+	indexName := indexPhysicalName(collectionID, spec.Name)
+	exists, err := m.indexExists(indexName)
+	if err != nil || !exists {
+		return err
+	}
+	if err := m.db.Exec(fmt.Sprintf("ALTER TABLE data_documents DROP INDEX `%s`", indexName)).Error; err != nil {
+		return fmt.Errorf("删除索引失败: %w", err)
+	}
+	return nil
+}
+
+// dropUnusedColumns 删除数据模型下不再被任何索引使用的虚拟列
+func (m *IndexManager) dropUnusedColumns(collectionID uint) error {
+	plain := escapeLike(fmt.Sprintf("bc_%d_", collectionID)) + "%"
+	hashed := escapeLike(fmt.Sprintf("bh_%d_", collectionID)) + "%"
+
+	var columns []string
+	if err := m.db.Raw(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'data_documents' AND (column_name LIKE ? OR column_name LIKE ?)`,
+		plain, hashed).Scan(&columns).Error; err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	var used []string
+	if err := m.db.Raw(`SELECT DISTINCT column_name FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'data_documents' AND (column_name LIKE ? OR column_name LIKE ?)`,
+		plain, hashed).Scan(&used).Error; err != nil {
+		return err
+	}
+	inUse := make(map[string]bool, len(used))
+	for _, name := range used {
+		inUse[name] = true
+	}
+
+	for _, name := range columns {
+		if inUse[name] {
+			continue
+		}
+		if err := m.db.Exec(fmt.Sprintf("ALTER TABLE data_documents DROP COLUMN `%s`", name)).Error; err != nil {
+			return fmt.Errorf("删除虚拟列失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *IndexManager) columnExists(name string) (bool, error) {
+	var count int64
+	err := m.db.Raw(`SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'data_documents' AND column_name = ?`, name).Scan(&count).Error
+	return count > 0, err
+}
+
+// indexCount 统计 data_documents 上已有的二级索引数量（含表自身的索引）
+func (m *IndexManager) indexCount() (int, error) {
+	var count int64
+	err := m.db.Raw(`SELECT COUNT(DISTINCT index_name) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'data_documents' AND index_name <> 'PRIMARY'`).Scan(&count).Error
+	return int(count), err
+}
+
+// available 返回APP还可以排队创建的索引数量，同时受APP配额与整表上限限制
+// 整表名额中已有索引与未完成的创建任务都占用名额；没有名额时返回 errAppIndexQuota 或 errTableIndexLimit
+func (m *IndexManager) available(appID uint) (int, error) {
+	used, err := m.appIndexCount(appID)
+	if err != nil {
+		return 0, err
+	}
+	count, err := m.indexCount()
+	if err != nil {
+		return 0, err
+	}
+	var pending int64
+	if err := m.db.Model(&IndexJob{}).
+		Where("action = ? AND status IN ?", IndexActionCreate, []string{IndexJobPending, IndexJobRunning}).
+		Count(&pending).Error; err != nil {
+		return 0, err
+	}
+	return indexBudget(maxAppIndexes-used, maxDocumentIndexes-count-int(pending))
+}
+
+// indexBudget 取APP配额与整表剩余名额中较小的一个
+func indexBudget(app, table int) (int, error) {
+	if table <= 0 {
+		return 0, errTableIndexLimit
+	}
+	if app <= 0 {
+		return 0, errAppIndexQuota
+	}
+	if app < table {
+		return app, nil
+	}
+	return table, nil
+}
+
+// appIndexCount 统计APP所有数据模型已定义的索引数量（含排队中的）
+func (m *IndexManager) appIndexCount(appID uint) (int, error) {
+	var raws []json.RawMessage
+	if err := m.db.Model(&DataCollection{}).Where("app_id = ?", appID).Pluck("indexes", &raws).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, raw := range raws {
+		count += len(parseIndexes(raw))
+	}
+	return count, nil
+}
+
+func (m *IndexManager) indexExists(name string) (bool, error) {
+	var count int64
+	err := m.db.Raw(`SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'data_documents' AND index_name = ?`, name).Scan(&count).Error
+	return count > 0, err
+}
+
+// States 获取数据模型各索引的状态
+func (m *IndexManager) States(collection *DataCollection) []IndexState {
+	return m.statesFor([]DataCollection{*collection})[collection.ID]
+}
+
+// statesFor 批量获取多个数据模型的索引状态
+func (m *IndexManager) statesFor(collections []DataCollection) map[uint][]IndexState {
+	result := make(map[uint][]IndexState)
+	ids := make([]uint, 0, len(collections))
+	for _, c := range collections {
+		ids = append(ids, c.ID)
+	}
+	if len(ids) == 0 {
+		return result
+	}
+
+	// 每个索引取最近一次任务
+	var jobs []IndexJob
+	m.db.Where("id IN (?)", m.db.Model(&IndexJob{}).Select("MAX(id)").
+		Where("collection_id IN ?", ids).Group("collection_id, index_name")).Find(&jobs)
+	latest := make(map[string]IndexJob, len(jobs))
+	for _, job := range jobs {
+		latest[strconv.FormatUint(uint64(job.CollectionID), 10)+"/"+job.IndexName] = job
+	}
+
+	for _, c := range collections {
+		states := []IndexState{}
+		for _, def := range parseIndexes(c.Indexes) {
+			state := IndexState{IndexDefinition: def, Status: IndexStatusBuilding}
+			if job, ok := latest[strconv.FormatUint(uint64(c.ID), 10)+"/"+def.Name]; ok {
+				state.JobID = job.ID
+				state.UpdatedAt = &job.UpdatedAt
+				state.Status = indexStatus(job)
+				if job.Status == IndexJobFailed {
+					state.Error = job.Error
+				}
+			}
+			states = append(states, state)
+		}
+		result[c.ID] = states
+	}
+	return result
+}
+
+// indexStatus 由任务状态推导索引状态
+func indexStatus(job IndexJob) string {
+	switch {
+	case job.Status == IndexJobFailed:
+		return IndexStatusFailed
+	case job.Action == IndexActionDrop:
+		return IndexStatusDropping
+	case job.Status == IndexJobCompleted:
+		return IndexStatusReady
+	}
+	return IndexStatusBuilding
+}
+
+// uniqueFields 返回已由数据库唯一索引保证唯一性的单字段
+func (m *IndexManager) uniqueFields(collection *DataCollection) map[string]bool {
+	fields := make(map[string]bool)
+	for _, state := range m.States(collection) {
+		if state.Unique && state.Status == IndexStatusReady && len(state.Fields) == 1 {
+			fields[state.Fields[0]] = true
+		}
+	}
+	return fields
+}
+
+// isDuplicateKey 是否为唯一键冲突错误
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// duplicateKeyError 将唯一索引冲突转换为字段校验错误
+func duplicateKeyError(collection *DataCollection, err error) error {
+	if !isDuplicateKey(err) {
+		return nil
+	}
+	match := duplicateKeyPattern.FindStringSubmatch(err.Error())
+
+	displayNames := make(map[string]string)
+	for _, f := range parseFields(collection.Fields) {
+		displayNames[f.Name] = f.DisplayName
+	}
+	for _, def := range parseIndexes(collection.Indexes) {
+		if match == nil || indexPhysicalName(collection.ID, def.Name) != match[1] {
+			continue
+		}
+		names := make([]string, 0, len(def.Fields))
+		for _, field := range def.Fields {
+			if dn := displayNames[field]; dn != "" {
+				field = dn
+			}
+			names = append(names, field)
+		}
+		return &ValidationError{Field: strings.Join(names, "+"), Message: "已存在相同的值"}
+	}
+	return &ValidationError{Field: "数据", Message: "违反唯一性约束"}
+}
+
+// reconcileIndexes 根据字段的 unique 属性维护自动索引，并为变更排队任务
+// 索引名额不足时暂不创建超出的自动索引，这些字段继续使用应用层的唯一性检查，下次修改数据模型时重试
+func (h *Handler) reconcileIndexes(collection *DataCollection) error {
+	kept, drops, creates := planAutoIndexes(collection)
+	if len(creates) > 0 {
+		available, err := h.indexes.available(collection.AppID)
+		if err != nil && !errors.Is(err, errAppIndexQuota) && !errors.Is(err, errTableIndexLimit) {
+			return err
+		}
+		var deferred []IndexDefinition
+		kept, creates, deferred = fitIndexBudget(kept, creates, available)
+		for _, def := range deferred {
+			log.Printf("[BaaS] Index budget exhausted, deferring %s on collection %d", def.Name, collection.ID)
+		}
+	}
+
+	if len(drops) == 0 && len(creates) == 0 {
+		return nil
+	}
+	if err := h.saveIndexes(collection, kept); err != nil {
+		return err
+	}
+	for _, def := range drops {
+		spec := &indexSpec{Name: def.Name, Unique: def.Unique}
+		if _, err := h.indexes.enqueue(collection, IndexActionDrop, spec); err != nil {
+			return err
+		}
+	}
+	for _, def := range creates {
+		spec, _ := buildIndexSpec(collection, def)
+		if _, err := h.indexes.enqueue(collection, IndexActionCreate, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planAutoIndexes 对比字段的 unique 属性与现有索引定义
+// 返回变更后的索引定义，以及需要删除、新建的自动索引；新建的索引按名称排序追加在最后
+func planAutoIndexes(collection *DataCollection) (kept, drops, creates []IndexDefinition) {
+	desired := make(map[string]IndexDefinition)
+	for _, f := range parseFields(collection.Fields) {
+		if !f.Unique {
+			continue
+		}
+		def := IndexDefinition{Name: autoIndexPrefix + f.Name, Fields: []string{f.Name}, Unique: true, Auto: true}
+		if _, err := buildIndexSpec(collection, def); err != nil {
+			continue // 不可索引的字段（如数组）保留原有的唯一性检查
+		}
+		desired[def.Name] = def
+	}
+
+	for _, def := range parseIndexes(collection.Indexes) {
+		if !def.Auto {
+			kept = append(kept, def)
+			continue
+		}
+		if _, ok := desired[def.Name]; ok {
+			kept = append(kept, def)
+			delete(desired, def.Name)
+			continue
+		}
+		drops = append(drops, def)
+	}
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kept = append(kept, desired[name])
+		creates = append(creates, desired[name])
+	}
+	return kept, drops, creates
+}
+
+// fitIndexBudget 只保留名额内的新建索引，超出的从索引定义中移除并作为 deferred 返回
+// creates 须为 planAutoIndexes 的结果，即位于 kept 的末尾
+func fitIndexBudget(kept, creates []IndexDefinition, available int) ([]IndexDefinition, []IndexDefinition, []IndexDefinition) {
+	if available >= len(creates) {
+		return kept, creates, nil
+	}
+	if available < 0 {
+		available = 0
+	}
+	deferred := creates[available:]
+	return kept[:len(kept)-len(deferred)], creates[:available], deferred
+}
+
+// saveIndexes 保存数据模型的索引定义
+func (h *Handler) saveIndexes(collection *DataCollection, defs []IndexDefinition) error {
+	if defs == nil {
+		defs = []IndexDefinition{}
+	}
+	data, err := json.Marshal(defs)
+	if err != nil {
+		return err
+	}
+	if err := h.db.Model(collection).Update("indexes", data).Error; err != nil {
+		return err
+	}
+	collection.Indexes = data
+	return nil
+}
+
+// dropAllIndexes 为数据模型的全部索引排队删除任务（删除数据模型时调用）
+func (h *Handler) dropAllIndexes(collection *DataCollection) {
+	for _, def := range parseIndexes(collection.Indexes) {
+		spec := &indexSpec{Name: def.Name, Unique: def.Unique}
+		if _, err := h.indexes.enqueue(collection, IndexActionDrop, spec); err != nil {
+			log.Printf("[BaaS] Failed to enqueue drop of index %s: %v", def.Name, err)
+		}
+	}
+}
+
+// StartJobs 启动索引任务、数据迁移、导入和异步钩子的后台执行
+func (h *Handler) StartJobs() {
+	h.indexes.Start()
+	h.migrations.Start()
+	h.imports.Start()
+	h.hooks.Start()
+}
+
+// StopJobs 停止后台任务
+func (h *Handler) StopJobs() {
+	h.hooks.Stop()
+	h.imports.Stop()
+	h.migrations.Stop()
+	h.indexes.Stop()
+}
+
+// ==================== 索引管理 API ====================
+
+// findCollection 按路径参数查找数据模型
+func (h *Handler) findCollection(c *gin.Context) (*DataCollection, bool) {
+	appID, _ := strconv.ParseUint(c.Param("appId"), 10, 64)
+	collectionID, _ := strconv.ParseUint(c.Param("collectionId"), 10, 64)
+
+	var collection DataCollection
+	if err := h.db.Where("id = ? AND app_id = ?", collectionID, appID).First(&collection).Error; err != nil {
+		fail(c, 404, "数据模型不存在")
+		return nil, false
+	}
+	return &collection, true
+}
+
+// ListIndexes 获取数据模型的索引及构建状态
+func (h *Handler) ListIndexes(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	success(c, h.indexes.States(collection))
+}
+
+// CreateIndex 创建索引（后台执行）
+func (h *Handler) CreateIndex(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	var req IndexDefinition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if !indexNamePattern.MatchString(req.Name) || strings.HasPrefix(req.Name, autoIndexPrefix) {
+		fail(c, 400, "无效的索引名，应为小写字母开头的字母、数字或下划线，且不能以 "+autoIndexPrefix+" 开头")
+		return
+	}
+	req.Auto = false
+
+	defs := parseIndexes(collection.Indexes)
+	for _, def := range defs {
+		if def.Name == req.Name {
+			fail(c, 400, "索引名称已存在")
+			return
+		}
+		if def.Unique == req.Unique && strings.Join(def.Fields, ",") == strings.Join(req.Fields, ",") {
+			fail(c, 400, "已存在相同字段的索引: "+def.Name)
+			return
+		}
+	}
+
+	spec, err := buildIndexSpec(collection, req)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	if _, err := h.indexes.available(collection.AppID); err != nil {
+		if errors.Is(err, errAppIndexQuota) || errors.Is(err, errTableIndexLimit) {
+			fail(c, 400, err.Error())
+			return
+		}
+		fail(c, 500, "查询索引数量失败: "+err.Error())
+		return
+	}
+
+	if err := h.saveIndexes(collection, append(defs, req)); err != nil {
+		fail(c, 500, "保存索引定义失败: "+err.Error())
+		return
+	}
+	job, err := h.indexes.enqueue(collection, IndexActionCreate, spec)
+	if err != nil {
+		fail(c, 500, "创建索引任务失败: "+err.Error())
+		return
+	}
+
+	success(c, gin.H{
+		"index": req,
+		"job":   job,
+	})
+}
+
+// DropIndex 删除索引（后台执行）
+func (h *Handler) DropIndex(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	name := c.Param("indexName")
+
+	defs := parseIndexes(collection.Indexes)
+	var target *IndexDefinition
+	remaining := make([]IndexDefinition, 0, len(defs))
+	for i := range defs {
+		if defs[i].Name == name {
+			target = &defs[i]
+			continue
+		}
+		remaining = append(remaining, defs[i])
+	}
+	if target == nil {
+		fail(c, 404, "索引不存在")
+		return
+	}
+	if target.Auto {
+		fail(c, 400, "该索引由字段的唯一属性自动维护，请修改字段定义")
+		return
+	}
+
+	if err := h.saveIndexes(collection, remaining); err != nil {
+		fail(c, 500, "保存索引定义失败: "+err.Error())
+		return
+	}
+	job, err := h.indexes.enqueue(collection, IndexActionDrop, &indexSpec{Name: target.Name, Unique: target.Unique})
+	if err != nil {
+		fail(c, 500, "创建索引任务失败: "+err.Error())
+		return
+	}
+
+	success(c, gin.H{"job": job})
+}
+
+// ListIndexJobs 获取数据模型的索引任务记录
+func (h *Handler) ListIndexJobs(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	var jobs []IndexJob
+	var total int64
+	query := h.db.Model(&IndexJob{}).Where("collection_id = ?", collection.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Count(&total)
+	query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&jobs)
+
+	success(c, gin.H{
+		"list":  jobs,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
@@ -0,0 +1,232 @@
+package baas
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestColumnDefinition(t *testing.T) {
+	def, err := columnDefinition(7, indexColumn{Field: "email", Type: "string"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "VARCHAR(255) COLLATE utf8mb4_bin GENERATED ALWAYS AS (IF(collection_id = 7, LEFT(JSON_UNQUOTE(JSON_EXTRACT(data, '$.email')), 255), NULL)) VIRTUAL"
+	if def != want {
+		t.Errorf("got %s\nwant %s", def, want)
+	}
+
+	// 唯一索引按完整值的哈希比较，只有前缀相同或仅大小写不同的值不会冲突
+	def, err = columnDefinition(7, indexColumn{Field: "email", Type: "string", Hash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "BINARY(32) GENERATED ALWAYS AS (IF(collection_id = 7, UNHEX(SHA2(JSON_UNQUOTE(JSON_EXTRACT(data, '$.email')), 256)), NULL)) VIRTUAL"
+	if def != want {
+		t.Errorf("got %s\nwant %s", def, want)
+	}
+	if indexColumnName(7, indexColumn{Field: "email", Hash: true}) == indexColumnName(7, indexColumn{Field: "email"}) {
+		t.Error("hashed and prefix columns must not share a name")
+	}
+
+	def, err = columnDefinition(7, indexColumn{Field: "price", Type: "number"})
+	if err != nil || !strings.HasPrefix(def, "DOUBLE GENERATED ALWAYS AS (IF(collection_id = 7, CAST(") {
+		t.Errorf("unexpected number column: %s, %v", def, err)
+	}
+	def, err = columnDefinition(7, indexColumn{Field: "done", Type: "boolean"})
+	if err != nil || !strings.HasPrefix(def, "TINYINT(1) GENERATED ALWAYS AS (CASE WHEN collection_id = 7 AND") {
+		t.Errorf("unexpected boolean column: %s, %v", def, err)
+	}
+
+	for _, col := range []indexColumn{
+		{Field: "a'b", Type: "string"},
+		{Field: "tags", Type: "array"},
+		{Field: "location", Type: "object"},
+	} {
+		if _, err := columnDefinition(7, col); err == nil {
+			t.Errorf("expected %+v to be rejected", col)
+		}
+	}
+}
+
+func TestBuildIndexSpec(t *testing.T) {
+	fields, _ := json.Marshal([]FieldDefinition{
+		{Name: "email", Type: "string"},
+		{Name: "age", Type: "number"},
+		{Name: "status", Type: "enum"},
+		{Name: "tags", Type: "array"},
+	})
+	collection := &DataCollection{ID: 3, Fields: fields}
+
+	spec, err := buildIndexSpec(collection, IndexDefinition{Name: "by_email_age", Fields: []string{"email", "age", "status"}, Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &indexSpec{Name: "by_email_age", Unique: true, Columns: []indexColumn{
+		{Field: "email", Type: "string", Hash: true},
+		{Field: "age", Type: "number"},
+		{Field: "status", Type: "", Hash: true},
+	}}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("got %+v, want %+v", spec, want)
+	}
+
+	cases := map[string][]string{
+		"no fields":   {},
+		"too many":    {"email", "age", "status", "email", "age"},
+		"duplicate":   {"email", "email"},
+		"undefined":   {"missing"},
+		"unindexable": {"tags"},
+	}
+	for name, fields := range cases {
+		if _, err := buildIndexSpec(collection, IndexDefinition{Name: "idx", Fields: fields}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// 未定义字段的数据模型按字符串建立索引
+	spec, err = buildIndexSpec(&DataCollection{ID: 3}, IndexDefinition{Name: "idx", Fields: []string{"anything"}})
+	if err != nil || spec.Columns[0].Type != "" || spec.Columns[0].Hash {
+		t.Errorf("expected schemaless field to be indexable, got %+v, %v", spec, err)
+	}
+}
+
+func TestIndexBudget(t *testing.T) {
+	cases := []struct {
+		app, table int
+		want       int
+		err        error
+	}{
+		{16, 40, 16, nil},
+		{3, 2, 2, nil},
+		{0, 40, 0, errAppIndexQuota},
+		{-1, 40, 0, errAppIndexQuota},
+		{5, 0, 0, errTableIndexLimit},
+		{0, 0, 0, errTableIndexLimit},
+	}
+	for _, tc := range cases {
+		got, err := indexBudget(tc.app, tc.table)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("indexBudget(%d, %d) = %d, %v; want %d, %v", tc.app, tc.table, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestIndexClaimRace(t *testing.T) {
+	db, mock := newMockDB(t)
+	a := NewIndexManager(db)
+	b := NewIndexManager(db)
+
+	due := `SELECT \* FROM .data_index_jobs. WHERE status = \? OR \(status = \? AND lease_until < \?\)`
+	claim := `UPDATE .data_index_jobs. SET .*claim_token.* WHERE id = \? AND \(status = \? OR \(status = \? AND lease_until < \?\)\)`
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "status", "action"}).AddRow(1, IndexJobRunning, IndexActionCreate)
+	}
+
+	// 两个实例都读到同一个租约已过期的任务，只有先完成条件更新的实例执行DDL
+	mock.ExpectQuery(due).WillReturnRows(row())
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(due).WillReturnRows(row())
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if job, ok := a.claim(); !ok || job.ClaimToken == "" {
+		t.Fatalf("first manager claim = %+v, %v; want claimed", job, ok)
+	}
+	if job, ok := b.claim(); ok || job == nil {
+		t.Fatalf("second manager claim = %+v, %v; want lost race", job, ok)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanAutoIndexes(t *testing.T) {
+	fields, _ := json.Marshal([]FieldDefinition{
+		{Name: "email", Type: "string", Unique: true},
+		{Name: "phone", Type: "string", Unique: true},
+		{Name: "code", Type: "number", Unique: true},
+		{Name: "tags", Type: "array", Unique: true},
+		{Name: "name", Type: "string"},
+	})
+	indexes, _ := json.Marshal([]IndexDefinition{
+		{Name: "by_name", Fields: []string{"name"}},
+		{Name: "uniq_email", Fields: []string{"email"}, Unique: true, Auto: true},
+		{Name: "uniq_legacy", Fields: []string{"legacy"}, Unique: true, Auto: true},
+	})
+	collection := &DataCollection{ID: 1, Fields: fields, Indexes: indexes}
+
+	kept, drops, creates := planAutoIndexes(collection)
+	names := func(defs []IndexDefinition) []string {
+		out := []string{}
+		for _, def := range defs {
+			out = append(out, def.Name)
+		}
+		return out
+	}
+	if got, want := names(kept), []string{"by_name", "uniq_email", "uniq_code", "uniq_phone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept = %v, want %v", got, want)
+	}
+	if got, want := names(drops), []string{"uniq_legacy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drops = %v, want %v", got, want)
+	}
+	if got, want := names(creates), []string{"uniq_code", "uniq_phone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("creates = %v, want %v", got, want)
+	}
+
+	kept, creates, deferred := fitIndexBudget(kept, creates, 1)
+	if got, want := names(kept), []string{"by_name", "uniq_email", "uniq_code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept within budget = %v, want %v", got, want)
+	}
+	if got, want := names(creates), []string{"uniq_code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("creates within budget = %v, want %v", got, want)
+	}
+	if got, want := names(deferred), []string{"uniq_phone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deferred = %v, want %v", got, want)
+	}
+
+	// 字段与索引一致时无需变更
+	collection.Fields, _ = json.Marshal([]FieldDefinition{{Name: "email", Type: "string", Unique: true}})
+	collection.Indexes, _ = json.Marshal([]IndexDefinition{{Name: "uniq_email", Fields: []string{"email"}, Unique: true, Auto: true}})
+	if _, drops, creates := planAutoIndexes(collection); len(drops) != 0 || len(creates) != 0 {
+		t.Errorf("expected no changes, got drops %v creates %v", drops, creates)
+	}
+}
+
+func TestDuplicateKeyError(t *testing.T) {
+	fields, _ := json.Marshal([]FieldDefinition{
+		{Name: "email", DisplayName: "邮箱", Type: "string"},
+		{Name: "phone", Type: "string"},
+	})
+	indexes, _ := json.Marshal([]IndexDefinition{
+		{Name: "uniq_email", Fields: []string{"email"}, Unique: true, Auto: true},
+		{Name: "by_contact", Fields: []string{"email", "phone"}, Unique: true},
+	})
+	collection := &DataCollection{ID: 9, Fields: fields, Indexes: indexes}
+	duplicate := func(key string) error {
+		return &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key '" + key + "'"}
+	}
+
+	cases := []struct {
+		err   error
+		field string
+	}{
+		{duplicate("data_documents.bi_9_uniq_email"), "邮箱"},
+		{duplicate("bi_9_by_contact"), "邮箱+phone"},
+		{duplicate("bi_8_uniq_email"), "数据"},
+	}
+	for _, tc := range cases {
+		var verr *ValidationError
+		if err := duplicateKeyError(collection, tc.err); !errors.As(err, &verr) || verr.Field != tc.field {
+			t.Errorf("%v: got %v, want field %s", tc.err, err, tc.field)
+		}
+	}
+
+	if err := duplicateKeyError(collection, &mysql.MySQLError{Number: 1452, Message: "foreign key"}); err != nil {
+		t.Errorf("expected non-duplicate error to be ignored, got %v", err)
+	}
+}
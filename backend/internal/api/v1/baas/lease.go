@@ -0,0 +1,56 @@
+package baas
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 后台任务的租约：领取任务时写入 claim_token 和 lease_until，执行期间定期续约
+// 实例退出或崩溃后租约过期，其他实例才能重新领取，避免同一任务被多个实例同时执行
+const (
+	jobLease     = 2 * time.Minute
+	jobHeartbeat = 30 * time.Second // 需明显小于 jobLease
+)
+
+// errLeaseLost 执行中的任务租约已被其他实例接管，当前执行方应放弃写回
+var errLeaseLost = errors.New("任务租约已被其他实例接管")
+
+// leaseDue 可领取的任务：状态为 pending，或状态为 running 但租约已过期
+func leaseDue(db *gorm.DB, pending, running string, now time.Time) *gorm.DB {
+	return db.Where("status = ? OR (status = ? AND lease_until < ?)", pending, running, now)
+}
+
+// leaseExpired 判断执行中的任务租约是否已过期（持有者已退出）
+func leaseExpired(leaseUntil *time.Time) bool {
+	return leaseUntil == nil || leaseUntil.Before(time.Now())
+}
+
+// keepLease 在任务执行期间定期续约，返回的函数用于停止续约
+// 续约失败说明租约已被其他实例接管，执行方在下一次按 claim_token 写回时会发现
+func keepLease(db *gorm.DB, model interface{}, id uint, token string) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				db.Model(model).Where("id = ? AND claim_token = ?", id, token).
+					Update("lease_until", time.Now().Add(jobLease))
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+func newClaimToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,890 @@
+package baas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 迁移状态
+const (
+	MigrationPending    = "pending"
+	MigrationRunning    = "running"
+	MigrationCompleted  = "completed"
+	MigrationFailed     = "failed"
+	MigrationRolledBack = "rolled_back"
+)
+
+// 迁移方向
+const (
+	MigrationForward = "forward" // 按新结构转换文档
+	MigrationRevert  = "revert"  // 从备份恢复文档
+)
+
+const (
+	migrationBatchSize   = 200
+	maxMigrationFailures = 100
+	migrationPollPeriod  = 30 * time.Second
+)
+
+// SchemaMigration 数据结构迁移记录
+type SchemaMigration struct {
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	AppID         uint            `json:"app_id" gorm:"index"`
+	CollectionID  uint            `json:"collection_id" gorm:"index"`
+	FromVersionID uint            `json:"from_version_id"`
+	ToVersionID   uint            `json:"to_version_id"`
+	FromSchema    json.RawMessage `json:"from_schema" gorm:"type:json"`
+	ToSchema      json.RawMessage `json:"to_schema" gorm:"type:json"`
+	Diff          json.RawMessage `json:"diff" gorm:"type:json"`
+	Direction     string          `json:"direction" gorm:"size:20;default:forward"`
+	Status        string          `json:"status" gorm:"size:20;default:pending;index"`
+	Cursor        uint            `json:"cursor"` // 正向迁移为最后处理的文档ID，回滚时为最后恢复的备份ID
+	Total         int64           `json:"total"`
+	Processed     int64           `json:"processed"`
+	Migrated      int64           `json:"migrated"`
+	Failed        int64           `json:"failed"`
+	Reverted      int64           `json:"reverted"`
+	Skipped       int64           `json:"skipped"` // 回滚时因迁移后被修改而保留的文档数
+	Failures      json.RawMessage `json:"failures" gorm:"type:json"`
+	Error         string          `json:"error" gorm:"type:text"`
+	CreatedBy     string          `json:"created_by" gorm:"size:100"`
+	ClaimToken    string          `json:"-" gorm:"size:32"` // 执行中迁移的持有者，见 lease.go
+	LeaseUntil    *time.Time      `json:"-"`
+	StartedAt     *time.Time      `json:"started_at"`
+	FinishedAt    *time.Time      `json:"finished_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "data_schema_migrations"
+}
+
+// MigrationBackup 迁移前的文档数据备份，用于回滚
+type MigrationBackup struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	MigrationID uint            `json:"migration_id" gorm:"uniqueIndex:idx_migration_document"`
+	DocumentID  uint            `json:"document_id" gorm:"uniqueIndex:idx_migration_document"`
+	Data        json.RawMessage `json:"data" gorm:"type:json"`
+	Migrated    json.RawMessage `json:"migrated" gorm:"type:json"` // 迁移写入的数据，回滚时用于识别之后被修改的文档
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+func (MigrationBackup) TableName() string {
+	return "data_migration_backups"
+}
+
+// FieldRename 字段重命名
+type FieldRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// FieldRetype 字段类型变更
+type FieldRetype struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// FieldFill 需要为缺失值填充默认值的字段
+type FieldFill struct {
+	Field      string      `json:"field"`
+	Default    interface{} `json:"default"`
+	HasDefault bool        `json:"has_default"`
+}
+
+// SchemaDiff 两个字段结构之间的差异
+type SchemaDiff struct {
+	Added       []FieldDefinition `json:"added"`
+	Removed     []FieldDefinition `json:"removed"`
+	Renamed     []FieldRename     `json:"renamed"`
+	Retyped     []FieldRetype     `json:"retyped"`
+	NewRequired []FieldFill       `json:"new_required"`
+	Fills       []FieldFill       `json:"fills"` // 新增或变为必填、且带默认值的字段
+}
+
+// Empty 差异是否不涉及文档数据
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Removed) == 0 && len(d.Renamed) == 0 && len(d.Retyped) == 0 && len(d.Fills) == 0 && len(d.NewRequired) == 0
+}
+
+// MigrationFailure 单个文档的迁移失败信息
+type MigrationFailure struct {
+	DocumentID uint   `json:"document_id"`
+	Error      string `json:"error"`
+}
+
+// diffSchemas 计算字段结构差异
+// renames 为显式指定的重命名（旧字段名 -> 新字段名）；未指定时，显示名称和类型均相同的删除/新增字段对视为重命名
+func diffSchemas(from, to []FieldDefinition, renames map[string]string) (*SchemaDiff, error) {
+	oldFields := make(map[string]FieldDefinition, len(from))
+	for _, f := range from {
+		oldFields[f.Name] = f
+	}
+	newFields := make(map[string]FieldDefinition, len(to))
+	for _, f := range to {
+		newFields[f.Name] = f
+	}
+
+	diff := &SchemaDiff{}
+	renamedFrom := make(map[string]string) // 新字段名 -> 旧字段名
+	for oldName, newName := range renames {
+		if _, ok := oldFields[oldName]; !ok {
+			return nil, fmt.Errorf("重命名的原字段 %s 不存在", oldName)
+		}
+		if _, ok := newFields[newName]; !ok {
+			return nil, fmt.Errorf("重命名的目标字段 %s 不存在", newName)
+		}
+		if _, ok := newFields[oldName]; ok {
+			return nil, fmt.Errorf("字段 %s 在新结构中仍然存在，不能重命名", oldName)
+		}
+		if _, ok := oldFields[newName]; ok {
+			return nil, fmt.Errorf("字段 %s 在原结构中已存在，不能作为重命名目标", newName)
+		}
+		renamedFrom[newName] = oldName
+	}
+
+	// 按显示名称和类型推断重命名
+	var removed, added []FieldDefinition
+	for _, f := range from {
+		if _, ok := newFields[f.Name]; ok || renames[f.Name] != "" {
+			continue
+		}
+		removed = append(removed, f)
+	}
+	for _, f := range to {
+		if _, ok := oldFields[f.Name]; ok || renamedFrom[f.Name] != "" {
+			continue
+		}
+		added = append(added, f)
+	}
+	if len(renames) == 0 {
+		removed, added = inferRenames(removed, added, renamedFrom)
+	}
+	diff.Removed = removed
+	diff.Added = added
+
+	for _, f := range to {
+		prevName := f.Name
+		if old, ok := renamedFrom[f.Name]; ok {
+			prevName = old
+			diff.Renamed = append(diff.Renamed, FieldRename{From: old, To: f.Name})
+		}
+		prev, existed := oldFields[prevName]
+		if existed && prev.Type != f.Type && prev.Type != "" && f.Type != "" {
+			diff.Retyped = append(diff.Retyped, FieldRetype{Field: f.Name, From: prev.Type, To: f.Type})
+		}
+
+		fill := FieldFill{Field: f.Name, Default: f.Default, HasDefault: f.Default != nil}
+		if f.Required && (!existed || !prev.Required) {
+			diff.NewRequired = append(diff.NewRequired, fill)
+		}
+		if fill.HasDefault && (!existed || (f.Required && !prev.Required)) {
+			diff.Fills = append(diff.Fills, fill)
+		}
+	}
+
+	sort.Slice(diff.Renamed, func(i, j int) bool { return diff.Renamed[i].To < diff.Renamed[j].To })
+	return diff, nil
+}
+
+// inferRenames 将显示名称和类型唯一对应的删除/新增字段识别为重命名
+func inferRenames(removed, added []FieldDefinition, renamedFrom map[string]string) ([]FieldDefinition, []FieldDefinition) {
+	key := func(f FieldDefinition) string { return f.DisplayName + "\x00" + f.Type }
+
+	removedByKey := make(map[string][]FieldDefinition)
+	for _, f := range removed {
+		if f.DisplayName != "" {
+			removedByKey[key(f)] = append(removedByKey[key(f)], f)
+		}
+	}
+	addedByKey := make(map[string][]FieldDefinition)
+	for _, f := range added {
+		if f.DisplayName != "" {
+			addedByKey[key(f)] = append(addedByKey[key(f)], f)
+		}
+	}
+
+	matched := make(map[string]bool)
+	for k, olds := range removedByKey {
+		news := addedByKey[k]
+		if len(olds) != 1 || len(news) != 1 {
+			continue
+		}
+		renamedFrom[news[0].Name] = olds[0].Name
+		matched["-"+olds[0].Name] = true
+		matched["+"+news[0].Name] = true
+	}
+
+	var restRemoved, restAdded []FieldDefinition
+	for _, f := range removed {
+		if !matched["-"+f.Name] {
+			restRemoved = append(restRemoved, f)
+		}
+	}
+	for _, f := range added {
+		if !matched["+"+f.Name] {
+			restAdded = append(restAdded, f)
+		}
+	}
+	return restRemoved, restAdded
+}
+
+// migrateDocument 按差异转换文档数据，并用目标结构校验结果
+// 返回转换后的数据以及数据是否发生变化
+func migrateDocument(raw json.RawMessage, diff *SchemaDiff, fields []FieldDefinition) (json.RawMessage, bool, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, false, fmt.Errorf("文档数据格式错误")
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	original, _ := json.Marshal(data)
+
+	for _, r := range diff.Renamed {
+		if v, ok := data[r.From]; ok {
+			data[r.To] = v
+			delete(data, r.From)
+		}
+	}
+	for _, f := range diff.Removed {
+		delete(data, f.Name)
+	}
+	for _, rt := range diff.Retyped {
+		v, ok := data[rt.Field]
+		if !ok || v == nil {
+			continue
+		}
+		converted, err := convertValue(v, rt.To)
+		if err != nil {
+			return nil, false, fmt.Errorf("字段 %s 无法从%s转换为%s: %v", rt.Field, rt.From, rt.To, err)
+		}
+		data[rt.Field] = converted
+	}
+	for _, fill := range diff.Fills {
+		if v, ok := data[fill.Field]; !ok || v == nil || v == "" {
+			data[fill.Field] = fill.Default
+		}
+	}
+
+	if errs := validateFields(fields, data); len(errs) > 0 {
+		return nil, false, errs
+	}
+
+	result, err := json.Marshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, string(result) != string(original), nil
+}
+
+// convertValue 将值转换为目标类型
+func convertValue(value interface{}, to string) (interface{}, error) {
+	switch scalarType(to) {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return nil, errors.New("不是有效的数字")
+			}
+			return n, nil
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, errors.New("不是有效的布尔值")
+			}
+			return b, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+			return nil, errors.New("只有0和1可以转换为布尔值")
+		}
+	case "array":
+		if arr, ok := value.([]interface{}); ok {
+			return arr, nil
+		}
+		return []interface{}{value}, nil
+	case "object":
+		if obj, ok := value.(map[string]interface{}); ok {
+			return obj, nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("不支持的类型转换（%s）", reflect.TypeOf(value))
+}
+
+// MigrationReport 迁移预演报告
+type MigrationReport struct {
+	Diff         *SchemaDiff        `json:"diff"`
+	Total        int64              `json:"total"`
+	WouldMigrate int64              `json:"would_migrate"`
+	Unchanged    int64              `json:"unchanged"`
+	WouldFail    int64              `json:"would_fail"`
+	Failures     []MigrationFailure `json:"failures"`
+}
+
+// dryRun 在不修改数据的情况下预演迁移
+func (r *MigrationRunner) dryRun(collectionID uint, diff *SchemaDiff, fields []FieldDefinition) (*MigrationReport, error) {
+	report := &MigrationReport{Diff: diff, Failures: []MigrationFailure{}}
+	var cursor uint
+	for {
+		var docs []DataDocument
+		if err := r.db.Where("collection_id = ? AND id > ?", collectionID, cursor).
+			Order("id ASC").Limit(migrationBatchSize).Find(&docs).Error; err != nil {
+			return nil, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		for _, doc := range docs {
+			report.Total++
+			_, changed, err := migrateDocument(doc.Data, diff, fields)
+			switch {
+			case err != nil:
+				report.WouldFail++
+				if len(report.Failures) < maxMigrationFailures {
+					report.Failures = append(report.Failures, MigrationFailure{DocumentID: doc.ID, Error: err.Error()})
+				}
+			case changed:
+				report.WouldMigrate++
+			default:
+				report.Unchanged++
+			}
+		}
+		cursor = docs[len(docs)-1].ID
+	}
+	return report, nil
+}
+
+// MigrationRunner 在后台分批执行数据迁移，进度保存在迁移记录中，中断后可从断点继续
+type MigrationRunner struct {
+	db      *gorm.DB
+	notify  chan struct{}
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// NewMigrationRunner 创建迁移执行器
+func NewMigrationRunner(db *gorm.DB) *MigrationRunner {
+	return &MigrationRunner{
+		db:      db,
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start 启动后台工作协程
+func (r *MigrationRunner) Start() {
+	r.once.Do(func() {
+		// 中断的迁移在租约过期后由任一实例从断点继续
+		go r.loop()
+		log.Println("[BaaS] Schema migration worker started")
+	})
+}
+
+// Stop 停止后台工作协程
+func (r *MigrationRunner) Stop() {
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+}
+
+func (r *MigrationRunner) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *MigrationRunner) loop() {
+	ticker := time.NewTicker(migrationPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		for r.runNext() {
+		}
+		select {
+		case <-r.stopped:
+			return
+		case <-r.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext 执行最早的一个可领取迁移，没有迁移时返回 false
+func (r *MigrationRunner) runNext() bool {
+	m, ok := r.claim()
+	if !ok {
+		return m != nil
+	}
+
+	stopLease := keepLease(r.db, &SchemaMigration{}, m.ID, m.ClaimToken)
+	var err error
+	final := MigrationCompleted
+	if m.Direction == MigrationRevert {
+		err = r.revert(m)
+		final = MigrationRolledBack
+	} else {
+		err = r.forward(m)
+	}
+	stopLease()
+
+	if errors.Is(err, errLeaseLost) {
+		log.Printf("[BaaS] Schema migration %d lease was taken over, stopping", m.ID)
+		return true
+	}
+	done := map[string]interface{}{"status": final, "finished_at": time.Now(), "claim_token": "", "lease_until": nil}
+	if err != nil {
+		done["status"] = MigrationFailed
+		done["error"] = err.Error()
+		log.Printf("[BaaS] Schema migration %d (%s) failed: %v", m.ID, m.Direction, err)
+	}
+	r.db.Model(&SchemaMigration{}).Where("id = ? AND claim_token = ?", m.ID, m.ClaimToken).Updates(done)
+	return true
+}
+
+// claim 以逐行条件更新领取最早的可领取迁移：待处理的迁移，或租约已过期的执行中迁移
+// 返回 (nil, false) 表示没有可领取的迁移，(非 nil, false) 表示迁移已被其他实例领取
+func (r *MigrationRunner) claim() (*SchemaMigration, bool) {
+	now := time.Now()
+	var m SchemaMigration
+	if err := leaseDue(r.db, MigrationPending, MigrationRunning, now).Order("id ASC").First(&m).Error; err != nil {
+		return nil, false
+	}
+
+	token := newClaimToken()
+	updates := map[string]interface{}{
+		"status":      MigrationRunning,
+		"error":       "",
+		"claim_token": token,
+		"lease_until": now.Add(jobLease),
+	}
+	if m.StartedAt == nil {
+		updates["started_at"] = now
+	}
+	result := leaseDue(r.db.Model(&SchemaMigration{}).Where("id = ?", m.ID), MigrationPending, MigrationRunning, now).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return &m, false
+	}
+	// 重新读取断点，上一个持有者可能在领取前提交了最后一批
+	if err := r.db.Where("claim_token = ?", token).First(&m, m.ID).Error; err != nil {
+		return &m, false
+	}
+	m.ClaimToken = token
+	return &m, true
+}
+
+// saveProgress 在批次事务中按 claim_token 写回断点，租约已被其他实例接管时整批回滚
+func saveProgress(tx *gorm.DB, m *SchemaMigration, updates map[string]interface{}) error {
+	result := tx.Model(&SchemaMigration{}).Where("id = ? AND claim_token = ?", m.ID, m.ClaimToken).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// forward 分批转换文档，每批在一个事务中备份原数据、写入新数据并保存断点
+func (r *MigrationRunner) forward(m *SchemaMigration) error {
+	var diff SchemaDiff
+	if err := json.Unmarshal(m.Diff, &diff); err != nil {
+		return fmt.Errorf("迁移差异数据无效: %w", err)
+	}
+	fields := parseFields(m.ToSchema)
+
+	var failures []MigrationFailure
+	if len(m.Failures) > 0 {
+		json.Unmarshal(m.Failures, &failures)
+	}
+
+	if m.Total == 0 {
+		r.db.Model(&DataDocument{}).Where("collection_id = ?", m.CollectionID).Count(&m.Total)
+		r.db.Model(m).Update("total", m.Total)
+	}
+
+	for {
+		// 文档在事务中加锁读取，转换期间的并发写入会等待本批提交，不会被覆盖
+		done := false
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			var docs []DataDocument
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("collection_id = ? AND id > ?", m.CollectionID, m.Cursor).
+				Order("id ASC").Limit(migrationBatchSize).Find(&docs).Error; err != nil {
+				return err
+			}
+			if len(docs) == 0 {
+				done = true
+				return nil
+			}
+
+			var processed, migrated, failed int64
+			for _, doc := range docs {
+				processed++
+				data, changed, err := migrateDocument(doc.Data, &diff, fields)
+				if err == nil && changed {
+					if err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MigrationBackup{
+						MigrationID: m.ID,
+						DocumentID:  doc.ID,
+						Data:        doc.Data,
+						Migrated:    data,
+					}).Error; err != nil {
+						return err
+					}
+					err = tx.Model(&DataDocument{}).Where("id = ?", doc.ID).Update("data", data).Error
+					if err != nil && !isDuplicateKey(err) {
+						return err
+					}
+					if err == nil {
+						migrated++
+					}
+				}
+				if err != nil {
+					failed++
+					if len(failures) < maxMigrationFailures {
+						failures = append(failures, MigrationFailure{DocumentID: doc.ID, Error: err.Error()})
+					}
+				}
+			}
+
+			failuresJSON, _ := json.Marshal(failures)
+			cursor := docs[len(docs)-1].ID
+			if err := saveProgress(tx, m, map[string]interface{}{
+				"cursor":    cursor,
+				"processed": gorm.Expr("processed + ?", processed),
+				"migrated":  gorm.Expr("migrated + ?", migrated),
+				"failed":    gorm.Expr("failed + ?", failed),
+				"failures":  failuresJSON,
+			}); err != nil {
+				return err
+			}
+			m.Cursor = cursor
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// revert 从备份中分批恢复文档数据（迁移后新建的文档不受影响）
+// 文档加锁后与迁移写入的数据比较，迁移后又被修改的文档保留当前数据并计入 skipped
+func (r *MigrationRunner) revert(m *SchemaMigration) error {
+	for {
+		var backups []MigrationBackup
+		if err := r.db.Where("migration_id = ? AND id > ?", m.ID, m.Cursor).
+			Order("id ASC").Limit(migrationBatchSize).Find(&backups).Error; err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(backups))
+		for i, b := range backups {
+			ids[i] = b.DocumentID
+		}
+
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			var docs []DataDocument
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id, data").Where("id IN ?", ids).Find(&docs).Error; err != nil {
+				return err
+			}
+			current := make(map[uint]json.RawMessage, len(docs))
+			for _, doc := range docs {
+				current[doc.ID] = doc.Data
+			}
+
+			var reverted, skipped int64
+			for _, b := range backups {
+				data, exists := current[b.DocumentID]
+				if !exists {
+					continue
+				}
+				if !revertible(b, data) {
+					skipped++
+					continue
+				}
+				result := tx.Model(&DataDocument{}).Where("id = ?", b.DocumentID).Update("data", b.Data)
+				if result.Error != nil {
+					return result.Error
+				}
+				reverted += result.RowsAffected
+			}
+			cursor := backups[len(backups)-1].ID
+			if err := saveProgress(tx, m, map[string]interface{}{
+				"cursor":   cursor,
+				"reverted": gorm.Expr("reverted + ?", reverted),
+				"skipped":  gorm.Expr("skipped + ?", skipped),
+			}); err != nil {
+				return err
+			}
+			m.Cursor = cursor
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// revertible 文档当前数据是否仍是迁移写入的数据
+// 早期备份没有记录迁移后的数据，按原逻辑直接恢复
+func revertible(b MigrationBackup, current json.RawMessage) bool {
+	if len(b.Migrated) == 0 {
+		return true
+	}
+	var migrated, now interface{}
+	if json.Unmarshal(b.Migrated, &migrated) != nil || json.Unmarshal(current, &now) != nil {
+		return false
+	}
+	return reflect.DeepEqual(migrated, now)
+}
+
+// activeMigration 获取数据模型正在进行的迁移
+func (h *Handler) activeMigration(collectionID uint) *SchemaMigration {
+	var m SchemaMigration
+	if err := h.db.Where("collection_id = ? AND status IN ?", collectionID,
+		[]string{MigrationPending, MigrationRunning}).First(&m).Error; err != nil {
+		return nil
+	}
+	return &m
+}
+
+// schemaChangeRequest 发布/回滚时的迁移参数
+type schemaChangeRequest struct {
+	DryRun  bool              `json:"dry_run"`
+	Renames map[string]string `json:"renames"` // 旧字段名 -> 新字段名
+}
+
+// bindSchemaChange 解析可选的迁移参数，请求体为空时使用默认值
+func bindSchemaChange(c *gin.Context) (*schemaChangeRequest, error) {
+	req := &schemaChangeRequest{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(req); err != nil {
+			return nil, err
+		}
+	}
+	if c.Query("dry_run") == "true" || c.Query("dry_run") == "1" {
+		req.DryRun = true
+	}
+	return req, nil
+}
+
+// applySchema 将数据模型切换到目标字段结构，并在需要时创建迁移任务
+// 必须在事务中调用；返回 nil 表示无需迁移文档
+func applySchema(tx *gorm.DB, collection *DataCollection, target json.RawMessage, diff *SchemaDiff, fromVersionID, toVersionID uint, createdBy string) (*SchemaMigration, error) {
+	from := collection.Fields
+	if len(from) == 0 {
+		from = json.RawMessage(`[]`)
+	}
+	if err := tx.Model(collection).Update("fields", target).Error; err != nil {
+		return nil, err
+	}
+	collection.Fields = target
+
+	if diff.Empty() {
+		return nil, nil
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+	m := &SchemaMigration{
+		AppID:         collection.AppID,
+		CollectionID:  collection.ID,
+		FromVersionID: fromVersionID,
+		ToVersionID:   toVersionID,
+		FromSchema:    from,
+		ToSchema:      target,
+		Diff:          diffJSON,
+		Direction:     MigrationForward,
+		Status:        MigrationPending,
+		Failures:      json.RawMessage(`[]`),
+		CreatedBy:     createdBy,
+	}
+	if err := tx.Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ==================== 数据迁移 API ====================
+
+// ListMigrations 获取数据模型的迁移记录
+func (h *Handler) ListMigrations(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	var migrations []SchemaMigration
+	var total int64
+	query := h.db.Model(&SchemaMigration{}).Where("collection_id = ?", collection.ID)
+	query.Count(&total)
+	query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&migrations)
+
+	success(c, gin.H{
+		"list":  migrations,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// GetMigration 获取迁移详情
+func (h *Handler) GetMigration(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	var m SchemaMigration
+	if err := h.db.Where("id = ? AND collection_id = ?", c.Param("migrationId"), collection.ID).First(&m).Error; err != nil {
+		fail(c, 404, "迁移记录不存在")
+		return
+	}
+	success(c, m)
+}
+
+// ResumeMigration 从断点继续执行失败的迁移
+func (h *Handler) ResumeMigration(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	result := h.db.Model(&SchemaMigration{}).
+		Where("id = ? AND collection_id = ? AND status = ?", c.Param("migrationId"), collection.ID, MigrationFailed).
+		Updates(map[string]interface{}{"status": MigrationPending, "error": ""})
+	if result.RowsAffected == 0 {
+		fail(c, 400, "只能继续执行失败的迁移")
+		return
+	}
+	h.migrations.wake()
+	success(c, nil)
+}
+
+// RevertMigration 撤销已完成的迁移：恢复迁移前的字段结构，并从备份恢复文档数据
+func (h *Handler) RevertMigration(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	var m SchemaMigration
+	if err := h.db.Where("id = ? AND collection_id = ?", c.Param("migrationId"), collection.ID).First(&m).Error; err != nil {
+		fail(c, 404, "迁移记录不存在")
+		return
+	}
+	if err := h.revertMigration(collection, &m); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	success(c, m)
+}
+
+// revertMigration 将迁移切换为回滚方向并交给后台执行
+func (h *Handler) revertMigration(collection *DataCollection, m *SchemaMigration) error {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return markReverting(tx, collection, m)
+	}); err != nil {
+		return err
+	}
+	h.afterRevert(collection, m)
+	return nil
+}
+
+// markReverting 在事务中恢复迁移前的字段结构并将迁移切换为回滚方向
+// 迁移状态按条件更新，并发的撤销请求只有一个成功；调用方提交事务后调用 afterRevert
+func markReverting(tx *gorm.DB, collection *DataCollection, m *SchemaMigration) error {
+	if m.Direction != MigrationForward || m.Status != MigrationCompleted {
+		return errors.New("只能撤销已完成的迁移")
+	}
+	var later int64
+	if err := tx.Model(&SchemaMigration{}).
+		Where("collection_id = ? AND id > ? AND status <> ?", collection.ID, m.ID, MigrationRolledBack).
+		Count(&later).Error; err != nil {
+		return err
+	}
+	if later > 0 {
+		return errors.New("只能撤销最近一次迁移")
+	}
+
+	result := tx.Model(&SchemaMigration{}).
+		Where("id = ? AND direction = ? AND status = ?", m.ID, MigrationForward, MigrationCompleted).
+		Updates(map[string]interface{}{
+			"direction":   MigrationRevert,
+			"status":      MigrationPending,
+			"cursor":      0,
+			"error":       "",
+			"finished_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("迁移状态已变化，请刷新后重试")
+	}
+	return tx.Model(collection).Update("fields", m.FromSchema).Error
+}
+
+// afterRevert 回滚事务提交后同步内存状态、调整索引并唤醒后台执行
+func (h *Handler) afterRevert(collection *DataCollection, m *SchemaMigration) {
+	collection.Fields = m.FromSchema
+	m.Direction = MigrationRevert
+	m.Status = MigrationPending
+	m.Cursor = 0
+
+	if err := h.reconcileIndexes(collection); err != nil {
+		log.Printf("[BaaS] Failed to reconcile indexes after revert: %v", err)
+	}
+	h.migrations.wake()
+}
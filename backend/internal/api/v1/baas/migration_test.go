@@ -0,0 +1,139 @@
+package baas
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	from := []FieldDefinition{
+		{Name: "title", DisplayName: "标题", Type: "string"},
+		{Name: "cnt", DisplayName: "数量", Type: "number"},
+		{Name: "price", DisplayName: "价格", Type: "string"},
+		{Name: "legacy", DisplayName: "旧字段", Type: "string"},
+	}
+	to := []FieldDefinition{
+		{Name: "title", DisplayName: "标题", Type: "string"},
+		{Name: "count", DisplayName: "数量", Type: "number"},
+		{Name: "price", DisplayName: "价格", Type: "number"},
+		{Name: "status", DisplayName: "状态", Type: "string", Required: true, Default: "draft"},
+	}
+
+	diff, err := diffSchemas(from, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Renamed) != 1 || diff.Renamed[0] != (FieldRename{From: "cnt", To: "count"}) {
+		t.Errorf("Expected cnt -> count rename, got %+v", diff.Renamed)
+	}
+	if len(diff.Retyped) != 1 || diff.Retyped[0].Field != "price" {
+		t.Errorf("Expected price retyped, got %+v", diff.Retyped)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "legacy" {
+		t.Errorf("Expected legacy removed, got %+v", diff.Removed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Name != "status" {
+		t.Errorf("Expected status added, got %+v", diff.Added)
+	}
+	if len(diff.NewRequired) != 1 || !diff.NewRequired[0].HasDefault {
+		t.Errorf("Expected status as new required field with default, got %+v", diff.NewRequired)
+	}
+
+	if _, err := diffSchemas(from, to, map[string]string{"missing": "count"}); err == nil {
+		t.Error("Expected rename of missing field to be rejected")
+	}
+}
+
+func TestMigrateDocument(t *testing.T) {
+	to := []FieldDefinition{
+		{Name: "count", Type: "number"},
+		{Name: "price", Type: "number"},
+		{Name: "status", Type: "string", Required: true, Default: "draft"},
+	}
+	diff := &SchemaDiff{
+		Removed: []FieldDefinition{{Name: "legacy"}},
+		Renamed: []FieldRename{{From: "cnt", To: "count"}},
+		Retyped: []FieldRetype{{Field: "price", From: "string", To: "number"}},
+		Fills:   []FieldFill{{Field: "status", Default: "draft", HasDefault: true}},
+	}
+
+	data, changed, err := migrateDocument(json.RawMessage(`{"cnt":3,"price":"9.5","legacy":"x"}`), diff, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("Expected document to be changed")
+	}
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	if got["count"] != float64(3) || got["price"] != 9.5 || got["status"] != "draft" || got["legacy"] != nil || got["cnt"] != nil {
+		t.Errorf("Unexpected migrated data: %s", data)
+	}
+
+	if _, _, err := migrateDocument(json.RawMessage(`{"price":"abc"}`), diff, to); err == nil {
+		t.Error("Expected unconvertible value to fail")
+	}
+}
+
+func TestRevertible(t *testing.T) {
+	backup := MigrationBackup{
+		Data:     json.RawMessage(`{"name":"a"}`),
+		Migrated: json.RawMessage(`{"title":"a","count":0}`),
+	}
+	cases := []struct {
+		name    string
+		backup  MigrationBackup
+		current string
+		want    bool
+	}{
+		// MySQL JSON 列重新格式化后的内容视为未修改
+		{"untouched", backup, `{"count": 0, "title": "a"}`, true},
+		{"edited after migration", backup, `{"title":"b","count":0}`, false},
+		{"legacy backup", MigrationBackup{Data: backup.Data}, `{"title":"b"}`, true},
+	}
+	for _, tc := range cases {
+		if got := revertible(tc.backup, json.RawMessage(tc.current)); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMigrationClaimRace(t *testing.T) {
+	db, mock := newMockDB(t)
+	a := NewMigrationRunner(db)
+	b := NewMigrationRunner(db)
+
+	due := `SELECT \* FROM .data_schema_migrations. WHERE status = \? OR \(status = \? AND lease_until < \?\)`
+	claim := `UPDATE .data_schema_migrations. SET .*claim_token.* WHERE id = \? AND \(status = \? OR \(status = \? AND lease_until < \?\)\)`
+	reload := `SELECT \* FROM .data_schema_migrations. WHERE claim_token = \? AND .data_schema_migrations.\..id. = \?`
+	progress := `UPDATE .data_schema_migrations. SET .* WHERE id = \? AND claim_token = \?`
+	row := func(cursor uint) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "status", "cursor"}).AddRow(1, MigrationRunning, cursor)
+	}
+
+	// 两个实例都读到同一个租约已过期的迁移，只有先完成条件更新的实例领取成功
+	mock.ExpectQuery(due).WillReturnRows(row(0))
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(reload).WillReturnRows(row(300))
+	mock.ExpectQuery(due).WillReturnRows(row(0))
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 0))
+	// 租约被接管后，原持有者写回断点失败
+	mock.ExpectExec(progress).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	m, ok := a.claim()
+	if !ok || m.Cursor != 300 || m.ClaimToken == "" {
+		t.Fatalf("first runner claim = %+v, %v; want claimed at reloaded cursor", m, ok)
+	}
+	if other, ok := b.claim(); ok || other == nil {
+		t.Fatalf("second runner claim = %+v, %v; want lost race", other, ok)
+	}
+	if err := saveProgress(db, m, map[string]interface{}{"cursor": 400}); !errors.Is(err, errLeaseLost) {
+		t.Fatalf("saveProgress after takeover = %v, want errLeaseLost", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package baas
+
+import (
+	"app-platform-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 集合权限规则
+const (
+	PermPublic        = "public"        // 任何人（包括匿名）
+	PermAuthenticated = "authenticated" // 已识别的APP终端用户或管理员
+	PermCreator       = "creator"       // 文档创建者本人或管理员
+	PermAdmin         = "admin"         // 仅管理员
+)
+
+// Action 文档操作类型
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// PrincipalKind 调用者类型
+type PrincipalKind string
+
+const (
+	PrincipalAnonymous PrincipalKind = "anonymous"
+	PrincipalAppUser   PrincipalKind = "user"
+	PrincipalAdmin     PrincipalKind = "admin"
+)
+
+// Principal 发起请求的调用者
+type Principal struct {
+	Kind   PrincipalKind `json:"kind"`
+	UserID uint          `json:"user_id"` // 管理员ID或APP终端用户ID，匿名时为0
+}
+
+// IsAdmin 是否为管理员
+func (p Principal) IsAdmin() bool {
+	return p.Kind == PrincipalAdmin
+}
+
+// owns 调用者是否为文档创建者
+func (p Principal) owns(doc *DataDocument) bool {
+	if doc == nil || p.Kind == PrincipalAnonymous {
+		return false
+	}
+	return doc.CreatorType == string(p.Kind) && doc.CreatedBy == p.UserID
+}
+
+// principalFromContext 根据认证中间件写入的上下文解析调用者
+// 签名认证的客户端请求：声明了终端用户则为 user，否则为匿名；管理员JWT请求为 admin
+func principalFromContext(c *gin.Context) Principal {
+	if _, ok := middleware.GetBoundApp(c); ok {
+		if user, ok := middleware.GetAppUser(c); ok {
+			return Principal{Kind: PrincipalAppUser, UserID: user.ID}
+		}
+		return Principal{Kind: PrincipalAnonymous}
+	}
+	if uid, exists := c.Get("user_id"); exists {
+		if id, ok := uid.(uint); ok {
+			return Principal{Kind: PrincipalAdmin, UserID: id}
+		}
+	}
+	return Principal{Kind: PrincipalAnonymous}
+}
+
+// Decision 权限评估结果
+type Decision struct {
+	Allowed bool
+	// OwnOnly 为 true 时表示仅允许访问调用者自己创建的文档（用于列表查询的范围限定）
+	OwnOnly bool
+	Reason  string
+}
+
+// ValidPerm 检查权限规则是否合法
+func ValidPerm(perm string) bool {
+	switch perm {
+	case PermPublic, PermAuthenticated, PermCreator, PermAdmin:
+		return true
+	}
+	return false
+}
+
+// ruleFor 获取集合对某操作配置的权限规则
+func ruleFor(collection *DataCollection, action Action) string {
+	switch action {
+	case ActionRead:
+		return collection.ReadPerm
+	case ActionCreate:
+		return collection.CreatePerm
+	case ActionUpdate:
+		return collection.UpdatePerm
+	case ActionDelete:
+		return collection.DeletePerm
+	}
+	return ""
+}
+
+// Evaluate 评估调用者对集合/文档的操作权限
+// doc 为 nil 时评估集合级权限（列表查询、创建）；creator 规则下列表查询返回 OwnOnly
+func Evaluate(collection *DataCollection, action Action, principal Principal, doc *DataDocument) Decision {
+	if principal.IsAdmin() {
+		return Decision{Allowed: true}
+	}
+
+	rule := ruleFor(collection, action)
+	switch rule {
+	case PermPublic:
+		return Decision{Allowed: true}
+
+	case PermAuthenticated:
+		if principal.Kind == PrincipalAppUser {
+			return Decision{Allowed: true}
+		}
+		return Decision{Reason: "需要登录后才能" + actionName(action)}
+
+	case PermCreator:
+		if principal.Kind != PrincipalAppUser {
+			return Decision{Reason: "需要登录后才能" + actionName(action)}
+		}
+		// 创建时调用者即为创建者
+		if action == ActionCreate {
+			return Decision{Allowed: true}
+		}
+		if doc == nil {
+			return Decision{Allowed: true, OwnOnly: true}
+		}
+		if principal.owns(doc) {
+			return Decision{Allowed: true}
+		}
+		return Decision{Reason: "只有创建者才能" + actionName(action) + "该文档"}
+
+	case PermAdmin:
+		return Decision{Reason: "只有管理员才能" + actionName(action)}
+	}
+
+	// 未知规则一律拒绝
+	return Decision{Reason: "数据模型权限配置无效"}
+}
+
+// actionName 操作的中文名称
+func actionName(action Action) string {
+	switch action {
+	case ActionRead:
+		return "读取"
+	case ActionCreate:
+		return "创建"
+	case ActionUpdate:
+		return "更新"
+	case ActionDelete:
+		return "删除"
+	}
+	return string(action)
+}
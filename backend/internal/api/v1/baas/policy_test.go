@@ -0,0 +1,69 @@
+package baas
+
+import "testing"
+
+func TestEvaluate(t *testing.T) {
+	collection := &DataCollection{
+		ReadPerm:   PermPublic,
+		CreatePerm: PermAuthenticated,
+		UpdatePerm: PermCreator,
+		DeletePerm: PermAdmin,
+	}
+	anonymous := Principal{Kind: PrincipalAnonymous}
+	owner := Principal{Kind: PrincipalAppUser, UserID: 1}
+	other := Principal{Kind: PrincipalAppUser, UserID: 2}
+	admin := Principal{Kind: PrincipalAdmin, UserID: 1}
+	ownedDoc := &DataDocument{CreatedBy: 1, CreatorType: string(PrincipalAppUser)}
+	adminDoc := &DataDocument{CreatedBy: 1, CreatorType: string(PrincipalAdmin)}
+
+	tests := []struct {
+		name      string
+		action    Action
+		principal Principal
+		doc       *DataDocument
+		want      bool
+	}{
+		{"anonymous can read public", ActionRead, anonymous, nil, true},
+		{"anonymous cannot create authenticated", ActionCreate, anonymous, nil, false},
+		{"user can create authenticated", ActionCreate, owner, nil, true},
+		{"creator can update own document", ActionUpdate, owner, ownedDoc, true},
+		{"other user cannot update document", ActionUpdate, other, ownedDoc, false},
+		{"user id collision with admin creator", ActionUpdate, owner, adminDoc, false},
+		{"user cannot delete admin-only", ActionDelete, owner, ownedDoc, false},
+		{"admin can delete admin-only", ActionDelete, admin, ownedDoc, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(collection, tt.action, tt.principal, tt.doc)
+			if got.Allowed != tt.want {
+				t.Errorf("Evaluate() allowed = %v, want %v (reason: %s)", got.Allowed, tt.want, got.Reason)
+			}
+			if !got.Allowed && got.Reason == "" {
+				t.Error("Denied decision should carry a reason")
+			}
+		})
+	}
+}
+
+func TestEvaluate_CreatorListIsScoped(t *testing.T) {
+	collection := &DataCollection{ReadPerm: PermCreator}
+
+	got := Evaluate(collection, ActionRead, Principal{Kind: PrincipalAppUser, UserID: 3}, nil)
+	if !got.Allowed || !got.OwnOnly {
+		t.Errorf("Expected scoped list access, got %+v", got)
+	}
+
+	got = Evaluate(collection, ActionRead, Principal{Kind: PrincipalAnonymous}, nil)
+	if got.Allowed {
+		t.Error("Anonymous caller should not list creator-scoped collection")
+	}
+}
+
+func TestEvaluate_UnknownRuleDenied(t *testing.T) {
+	collection := &DataCollection{ReadPerm: "everyone"}
+
+	if Evaluate(collection, ActionRead, Principal{Kind: PrincipalAppUser, UserID: 1}, nil).Allowed {
+		t.Error("Unknown permission rule should be denied")
+	}
+}
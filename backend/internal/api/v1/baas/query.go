@@ -0,0 +1,662 @@
+package baas
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 查询限制
+const (
+	maxFilterDepth = 5   // 过滤条件最大嵌套层级
+	maxInValues    = 100 // $in 最多允许的候选值数量
+	maxSortKeys    = 3   // 最多排序字段数
+)
+
+// fieldNamePattern 合法的字段名，保证拼入JSON路径时安全
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// systemColumns 可用于过滤和排序的文档系统字段及其类型
+var systemColumns = map[string]string{
+	"id":         "number",
+	"created_by": "number",
+	"created_at": "string",
+	"updated_at": "string",
+}
+
+// QueryError 查询条件错误
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+func queryErrorf(format string, args ...interface{}) error {
+	return &QueryError{Message: fmt.Sprintf(format, args...)}
+}
+
+// DocumentQuery 文档查询参数
+type DocumentQuery struct {
+	Filter map[string]interface{} `json:"filter"` // 过滤条件，如 {"price": {"$gt": 10}, "$or": [...]}
+	Sort   string                 `json:"sort"`   // 排序，如 "-price,name"
+	Fields []string               `json:"fields"` // 返回的字段子集
+	Cursor *string                `json:"cursor"` // 非nil时使用游标分页，空字符串表示第一页
+	Page   int                    `json:"page"`
+	Size   int                    `json:"size"`
+}
+
+// parseDocumentQuery 从URL查询参数解析文档查询
+// filter 为JSON字符串，fields 为逗号分隔的字段列表，携带 cursor 参数时启用游标分页
+func parseDocumentQuery(c *gin.Context) (*DocumentQuery, error) {
+	q := &DocumentQuery{Sort: c.Query("sort")}
+	q.Page, q.Size = validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "10"))
+
+	if raw := c.Query("filter"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &q.Filter); err != nil {
+			return nil, queryErrorf("filter 不是合法的JSON对象")
+		}
+	}
+	if raw := c.Query("fields"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				q.Fields = append(q.Fields, name)
+			}
+		}
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		q.Cursor = &cursor
+	}
+	return q, nil
+}
+
+// fieldRef 已解析的查询字段
+type fieldRef struct {
+	Name   string
+	Type   string // string, number, boolean, array, object；空表示未定义类型（按值推断）
+	Column string // 系统字段对应的列名
+}
+
+// expr 返回字段的SQL表达式与参数
+func (f fieldRef) expr() (string, []interface{}) {
+	if f.Column != "" {
+		return f.Column, nil
+	}
+	if f.Type == "string" {
+		return "JSON_UNQUOTE(JSON_EXTRACT(data, ?))", []interface{}{"$." + f.Name}
+	}
+	return "JSON_EXTRACT(data, ?)", []interface{}{"$." + f.Name}
+}
+
+// withType 为未定义类型的字段按值推断类型
+func (f fieldRef) withType(value interface{}) fieldRef {
+	if f.Type != "" {
+		return f
+	}
+	switch value.(type) {
+	case string:
+		f.Type = "string"
+	case float64:
+		f.Type = "number"
+	case bool:
+		f.Type = "boolean"
+	}
+	return f
+}
+
+// fieldResolver 根据数据模型的字段定义解析查询字段
+type fieldResolver struct {
+	fields map[string]FieldDefinition
+	strict bool // 模型定义了字段时，只允许查询已定义的字段
+}
+
+func newFieldResolver(collection *DataCollection) *fieldResolver {
+	r := &fieldResolver{fields: make(map[string]FieldDefinition)}
+	for _, f := range parseFields(collection.Fields) {
+		r.fields[f.Name] = f
+	}
+	r.strict = len(r.fields) > 0
+	return r
+}
+
+func (r *fieldResolver) resolve(name string, allowSystem bool) (fieldRef, error) {
+	if typ, ok := systemColumns[name]; ok && allowSystem {
+		return fieldRef{Name: name, Type: typ, Column: name}, nil
+	}
+	if !fieldNamePattern.MatchString(name) {
+		return fieldRef{}, queryErrorf("无效的字段名: %s", name)
+	}
+	if def, ok := r.fields[name]; ok {
+		return fieldRef{Name: name, Type: scalarType(def.Type)}, nil
+	}
+	if r.strict {
+		return fieldRef{}, queryErrorf("字段 %s 未在数据模型中定义", name)
+	}
+	return fieldRef{Name: name}, nil
+}
+
+// bindValue 返回值在SQL中的占位符和参数，布尔值需转换为JSON比较
+func bindValue(ref fieldRef, value interface{}) (string, interface{}) {
+	if b, ok := value.(bool); ok && ref.Column == "" {
+		return "CAST(? AS JSON)", strconv.FormatBool(b)
+	}
+	return "?", value
+}
+
+// checkValue 校验比较值与字段类型是否匹配
+func checkValue(ref fieldRef, op string, value interface{}) error {
+	switch ref.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return queryErrorf("字段 %s 的 %s 条件应为字符串", ref.Name, op)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return queryErrorf("字段 %s 的 %s 条件应为数字", ref.Name, op)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return queryErrorf("字段 %s 的 %s 条件应为布尔值", ref.Name, op)
+		}
+	case "array", "object":
+		return queryErrorf("字段 %s 为%s类型，不支持 %s 条件", ref.Name, ref.Type, op)
+	default:
+		return queryErrorf("字段 %s 的 %s 条件值类型不受支持", ref.Name, op)
+	}
+	return nil
+}
+
+// comparisonOps 比较运算符与SQL运算符的映射
+var comparisonOps = map[string]string{
+	"$eq":  "=",
+	"$ne":  "<>",
+	"$gt":  ">",
+	"$gte": ">=",
+	"$lt":  "<",
+	"$lte": "<=",
+}
+
+// filterCompiler 将过滤条件编译为参数化的SQL谓词
+type filterCompiler struct {
+	resolver *fieldResolver
+}
+
+// compileFilter 编译过滤条件，返回SQL片段与参数；空条件返回空字符串
+func compileFilter(filter map[string]interface{}, resolver *fieldResolver) (string, []interface{}, error) {
+	if len(filter) == 0 {
+		return "", nil, nil
+	}
+	fc := &filterCompiler{resolver: resolver}
+	return fc.group(filter, 1)
+}
+
+// group 编译一组以AND连接的条件
+func (fc *filterCompiler) group(filter map[string]interface{}, depth int) (string, []interface{}, error) {
+	if depth > maxFilterDepth {
+		return "", nil, queryErrorf("过滤条件嵌套层级不能超过%d层", maxFilterDepth)
+	}
+
+	// 按键排序，保证生成的SQL稳定
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	var args []interface{}
+	for _, key := range keys {
+		value := filter[key]
+		var sql string
+		var vars []interface{}
+		var err error
+		switch key {
+		case "$and", "$or":
+			sql, vars, err = fc.logical(key, value, depth)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return "", nil, queryErrorf("不支持的逻辑运算符: %s", key)
+			}
+			sql, vars, err = fc.field(key, value)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, vars...)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
+
+// logical 编译 $and / $or
+func (fc *filterCompiler) logical(op string, value interface{}, depth int) (string, []interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return "", nil, queryErrorf("%s 的值应为非空数组", op)
+	}
+
+	joiner := " AND "
+	if op == "$or" {
+		joiner = " OR "
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, item := range items {
+		sub, ok := item.(map[string]interface{})
+		if !ok || len(sub) == 0 {
+			return "", nil, queryErrorf("%s 的每一项应为非空对象", op)
+		}
+		sql, vars, err := fc.group(sub, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, vars...)
+	}
+	return "(" + strings.Join(parts, joiner) + ")", args, nil
+}
+
+// field 编译单个字段上的条件，标量值等价于 $eq
+func (fc *filterCompiler) field(name string, cond interface{}) (string, []interface{}, error) {
+	ref, err := fc.resolver.resolve(name, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return fc.op(ref, "$eq", cond)
+	}
+	if len(ops) == 0 {
+		return "", nil, queryErrorf("字段 %s 的条件不能为空", name)
+	}
+
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	var args []interface{}
+	for _, op := range keys {
+		sql, vars, err := fc.op(ref, op, ops[op])
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, vars...)
+	}
+	if len(parts) == 1 {
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
+
+// op 编译单个运算符
+func (fc *filterCompiler) op(ref fieldRef, op string, value interface{}) (string, []interface{}, error) {
+	switch op {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		if value == nil {
+			return "", nil, queryErrorf("字段 %s 的 %s 条件不能为null，请使用 $exists", ref.Name, op)
+		}
+		ref = ref.withType(value)
+		if err := checkValue(ref, op, value); err != nil {
+			return "", nil, err
+		}
+		if ref.Type == "boolean" && op != "$eq" && op != "$ne" {
+			return "", nil, queryErrorf("布尔字段 %s 只支持 $eq 和 $ne", ref.Name)
+		}
+		expr, args := ref.expr()
+		placeholder, arg := bindValue(ref, value)
+		sql := expr + " " + comparisonOps[op] + " " + placeholder
+		args = append(args, arg)
+		if op == "$ne" {
+			// 字段不存在的文档也视为不等于
+			nullExpr, nullArgs := ref.expr()
+			sql = "(" + nullExpr + " IS NULL OR " + sql + ")"
+			args = append(nullArgs, args...)
+		}
+		return sql, args, nil
+
+	case "$in":
+		items, ok := value.([]interface{})
+		if !ok || len(items) == 0 {
+			return "", nil, queryErrorf("字段 %s 的 $in 条件应为非空数组", ref.Name)
+		}
+		if len(items) > maxInValues {
+			return "", nil, queryErrorf("字段 %s 的 $in 条件最多%d个值", ref.Name, maxInValues)
+		}
+		ref = ref.withType(items[0])
+		expr, args := ref.expr()
+		placeholders := make([]string, 0, len(items))
+		for _, item := range items {
+			if err := checkValue(ref, op, item); err != nil {
+				return "", nil, err
+			}
+			placeholder, arg := bindValue(ref, item)
+			placeholders = append(placeholders, placeholder)
+			args = append(args, arg)
+		}
+		return expr + " IN (" + strings.Join(placeholders, ", ") + ")", args, nil
+
+	case "$contains":
+		if ref.Column != "" {
+			return "", nil, queryErrorf("系统字段 %s 不支持 $contains", ref.Name)
+		}
+		path := "$." + ref.Name
+		if ref.Type == "array" {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return "", nil, queryErrorf("字段 %s 的 $contains 条件无效", ref.Name)
+			}
+			return "JSON_CONTAINS(JSON_EXTRACT(data, ?), ?)", []interface{}{path, string(encoded)}, nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return "", nil, queryErrorf("字段 %s 的 $contains 条件应为字符串", ref.Name)
+		}
+		if ref.Type != "" && ref.Type != "string" {
+			return "", nil, queryErrorf("字段 %s 为%s类型，不支持 $contains", ref.Name, ref.Type)
+		}
+		return "JSON_UNQUOTE(JSON_EXTRACT(data, ?)) LIKE ?", []interface{}{path, "%" + escapeLike(s) + "%"}, nil
+
+	case "$exists":
+		exists, ok := value.(bool)
+		if !ok {
+			return "", nil, queryErrorf("字段 %s 的 $exists 条件应为布尔值", ref.Name)
+		}
+		if ref.Column != "" {
+			return "", nil, queryErrorf("系统字段 %s 不支持 $exists", ref.Name)
+		}
+		sql := "JSON_CONTAINS_PATH(data, 'one', ?)"
+		if !exists {
+			sql = "NOT " + sql
+		}
+		return sql, []interface{}{"$." + ref.Name}, nil
+	}
+
+	return "", nil, queryErrorf("不支持的运算符: %s", op)
+}
+
+// escapeLike 转义LIKE中的通配符
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// sortKey 排序字段
+type sortKey struct {
+	ref  fieldRef
+	desc bool
+}
+
+// parseSort 解析排序表达式，如 "-price,name"；始终以 id 作为最后的排序键保证顺序稳定
+func parseSort(spec string, resolver *fieldResolver) ([]sortKey, error) {
+	var keys []sortKey
+	hasID := false
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		desc := false
+		if strings.HasPrefix(item, "-") {
+			desc = true
+			item = item[1:]
+		} else if strings.HasPrefix(item, "+") {
+			item = item[1:]
+		}
+		ref, err := resolver.resolve(item, true)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Type == "array" || ref.Type == "object" {
+			return nil, queryErrorf("不能按%s类型字段 %s 排序", ref.Type, ref.Name)
+		}
+		keys = append(keys, sortKey{ref: ref, desc: desc})
+		if ref.Column == "id" {
+			hasID = true
+			break
+		}
+	}
+	if len(keys) > maxSortKeys {
+		return nil, queryErrorf("最多支持%d个排序字段", maxSortKeys)
+	}
+	if !hasID {
+		desc := true
+		if len(keys) > 0 {
+			desc = keys[len(keys)-1].desc
+		}
+		keys = append(keys, sortKey{ref: fieldRef{Name: "id", Type: "number", Column: "id"}, desc: desc})
+	}
+	return keys, nil
+}
+
+// sortSignature 排序的规范化表示，用于校验游标与查询是否匹配
+func sortSignature(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.ref.Name
+		if k.desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// cursorToken 游标内容：上一页最后一条记录的排序键值
+type cursorToken struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     uint          `json:"id"`
+}
+
+func encodeCursor(token cursorToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*cursorToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, queryErrorf("无效的游标")
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, queryErrorf("无效的游标")
+	}
+	return &token, nil
+}
+
+// compiledQuery 编译后的文档查询
+type compiledQuery struct {
+	where  string
+	args   []interface{}
+	sort   []sortKey
+	fields []string
+	cursor *cursorToken
+	paged  bool // 是否使用游标分页
+	page   int
+	size   int
+}
+
+// compile 根据数据模型字段定义校验并编译查询
+func (q *DocumentQuery) compile(collection *DataCollection) (*compiledQuery, error) {
+	resolver := newFieldResolver(collection)
+
+	where, args, err := compileFilter(q.Filter, resolver)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseSort(q.Sort, resolver)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range q.Fields {
+		if _, err := resolver.resolve(name, false); err != nil {
+			return nil, err
+		}
+	}
+
+	cq := &compiledQuery{where: where, args: args, sort: keys, fields: q.Fields}
+	cq.page, cq.size = validator.ValidatePagination(q.Page, q.Size)
+
+	if q.Cursor != nil {
+		cq.paged = true
+		if *q.Cursor != "" {
+			token, err := decodeCursor(*q.Cursor)
+			if err != nil {
+				return nil, err
+			}
+			if token.Sort != sortSignature(keys) || len(token.Values) != len(keys)-1 {
+				return nil, queryErrorf("游标与当前排序条件不匹配")
+			}
+			cq.cursor = token
+		}
+	}
+	return cq, nil
+}
+
+// applyFilter 应用过滤条件
+func (cq *compiledQuery) applyFilter(db *gorm.DB) *gorm.DB {
+	if cq.where == "" {
+		return db
+	}
+	return db.Where(cq.where, cq.args...)
+}
+
+// applyOrder 应用排序
+func (cq *compiledQuery) applyOrder(db *gorm.DB) *gorm.DB {
+	var parts []string
+	var args []interface{}
+	for _, k := range cq.sort {
+		expr, vars := k.ref.expr()
+		dir := " ASC"
+		if k.desc {
+			dir = " DESC"
+		}
+		parts = append(parts, expr+dir)
+		args = append(args, vars...)
+	}
+	return db.Order(clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(parts, ", "), Vars: args, WithoutParentheses: true}})
+}
+
+// applyCursor 应用游标条件（keyset分页）
+// 生成 (k1 after v1) OR (k1 = v1 AND k2 after v2) OR ... 形式的条件，
+// 升序时 NULL 排在最前、降序时排在最后，与MySQL的排序规则一致
+func (cq *compiledQuery) applyCursor(db *gorm.DB) *gorm.DB {
+	if cq.cursor == nil {
+		return db
+	}
+
+	values := append(append([]interface{}{}, cq.cursor.Values...), float64(cq.cursor.ID))
+
+	var branches []string
+	var args []interface{}
+	for i, k := range cq.sort {
+		var parts []string
+		var vars []interface{}
+		// 前面的排序键全部相等
+		for j := 0; j < i; j++ {
+			expr, eargs := cq.sort[j].ref.expr()
+			placeholder, arg := bindValue(cq.sort[j].ref, values[j])
+			parts = append(parts, expr+" <=> "+placeholder)
+			vars = append(append(vars, eargs...), arg)
+		}
+		// 当前排序键严格靠后
+		after, aargs, ok := keysetAfter(k, values[i])
+		if !ok {
+			continue
+		}
+		parts = append(parts, after)
+		vars = append(vars, aargs...)
+
+		branches = append(branches, "("+strings.Join(parts, " AND ")+")")
+		args = append(args, vars...)
+	}
+	if len(branches) == 0 {
+		return db.Where("1 = 0")
+	}
+	return db.Where("("+strings.Join(branches, " OR ")+")", args...)
+}
+
+// keysetAfter 生成“排序键严格位于游标值之后”的条件；不存在这样的值时返回 false
+func keysetAfter(k sortKey, value interface{}) (string, []interface{}, bool) {
+	expr, args := k.ref.expr()
+	if value == nil {
+		if k.desc {
+			return "", nil, false
+		}
+		return expr + " IS NOT NULL", args, true
+	}
+	placeholder, arg := bindValue(k.ref, value)
+	if k.desc {
+		nullExpr, nullArgs := k.ref.expr()
+		return "(" + expr + " < " + placeholder + " OR " + nullExpr + " IS NULL)", append(append(args, arg), nullArgs...), true
+	}
+	return expr + " > " + placeholder, append(args, arg), true
+}
+
+// nextCursor 根据本页最后一条文档生成下一页游标
+func (cq *compiledQuery) nextCursor(doc *DataDocument) string {
+	var data map[string]interface{}
+	json.Unmarshal(doc.Data, &data)
+
+	token := cursorToken{Sort: sortSignature(cq.sort), ID: doc.ID}
+	for _, k := range cq.sort[:len(cq.sort)-1] {
+		token.Values = append(token.Values, documentValue(doc, data, k.ref))
+	}
+	return encodeCursor(token)
+}
+
+// documentValue 取文档中排序字段的值
+func documentValue(doc *DataDocument, data map[string]interface{}, ref fieldRef) interface{} {
+	switch ref.Column {
+	case "id":
+		return float64(doc.ID)
+	case "created_by":
+		return float64(doc.CreatedBy)
+	case "created_at":
+		return doc.CreatedAt.Format("2006-01-02 15:04:05.999999")
+	case "updated_at":
+		return doc.UpdatedAt.Format("2006-01-02 15:04:05.999999")
+	}
+	return data[ref.Name]
+}
+
+// project 仅保留文档数据中指定的字段
+func (cq *compiledQuery) project(documents []DataDocument) {
+	if len(cq.fields) == 0 {
+		return
+	}
+	for i := range documents {
+		var data map[string]interface{}
+		if err := json.Unmarshal(documents[i].Data, &data); err != nil {
+			continue
+		}
+		projected := make(map[string]interface{}, len(cq.fields))
+		for _, name := range cq.fields {
+			if v, ok := data[name]; ok {
+				projected[name] = v
+			}
+		}
+		documents[i].Data, _ = json.Marshal(projected)
+	}
+}
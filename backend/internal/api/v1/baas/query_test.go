@@ -0,0 +1,121 @@
+package baas
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testCollection() *DataCollection {
+	return &DataCollection{Fields: json.RawMessage(`[
+		{"name":"title","type":"string"},
+		{"name":"price","type":"number"},
+		{"name":"on_sale","type":"boolean"},
+		{"name":"tags","type":"array"}
+	]`)}
+}
+
+func TestCompileFilter(t *testing.T) {
+	resolver := newFieldResolver(testCollection())
+
+	tests := []struct {
+		name     string
+		filter   string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "scalar equality",
+			filter:   `{"title":"book"}`,
+			wantSQL:  "JSON_UNQUOTE(JSON_EXTRACT(data, ?)) = ?",
+			wantArgs: []interface{}{"$.title", "book"},
+		},
+		{
+			name:     "range",
+			filter:   `{"price":{"$gte":10,"$lt":20}}`,
+			wantSQL:  "(JSON_EXTRACT(data, ?) >= ? AND JSON_EXTRACT(data, ?) < ?)",
+			wantArgs: []interface{}{"$.price", float64(10), "$.price", float64(20)},
+		},
+		{
+			name:     "boolean",
+			filter:   `{"on_sale":true}`,
+			wantSQL:  "JSON_EXTRACT(data, ?) = CAST(? AS JSON)",
+			wantArgs: []interface{}{"$.on_sale", "true"},
+		},
+		{
+			name:     "or with in",
+			filter:   `{"$or":[{"price":{"$in":[1,2]}},{"tags":{"$contains":"new"}}]}`,
+			wantSQL:  "(JSON_EXTRACT(data, ?) IN (?, ?) OR JSON_CONTAINS(JSON_EXTRACT(data, ?), ?))",
+			wantArgs: []interface{}{"$.price", float64(1), float64(2), "$.tags", `"new"`},
+		},
+		{
+			name:     "contains escapes wildcards",
+			filter:   `{"title":{"$contains":"50%"}}`,
+			wantSQL:  "JSON_UNQUOTE(JSON_EXTRACT(data, ?)) LIKE ?",
+			wantArgs: []interface{}{"$.title", `%50\%%`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.filter), &filter); err != nil {
+				t.Fatal(err)
+			}
+			sql, args, err := compileFilter(filter, resolver)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("Expected SQL %q, got %q", tt.wantSQL, sql)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Expected args %v, got %v", tt.wantArgs, args)
+			}
+		})
+	}
+}
+
+func TestCompileFilter_Rejections(t *testing.T) {
+	resolver := newFieldResolver(testCollection())
+
+	filters := []string{
+		`{"unknown":1}`,
+		`{"price":"cheap"}`,
+		`{"on_sale":{"$gt":true}}`,
+		`{"title":{"$regex":"x"}}`,
+		`{"$not":[{"price":1}]}`,
+		`{"price":{"$in":[]}}`,
+	}
+	for _, raw := range filters {
+		var filter map[string]interface{}
+		json.Unmarshal([]byte(raw), &filter)
+		if _, _, err := compileFilter(filter, resolver); err == nil {
+			t.Errorf("Expected filter %s to be rejected", raw)
+		}
+	}
+}
+
+func TestFieldResolver_RejectsUnsafeNames(t *testing.T) {
+	resolver := newFieldResolver(&DataCollection{})
+	if _, err := resolver.resolve(`a") OR 1=1 --`, true); err == nil {
+		t.Error("Expected unsafe field name to be rejected")
+	}
+	if _, err := resolver.resolve("anything", true); err != nil {
+		t.Errorf("Schemaless collection should accept valid names: %v", err)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	keys, err := parseSort("-price,title", newFieldResolver(testCollection()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sortSignature(keys); got != "-price,title,id" {
+		t.Errorf("Expected id tie-breaker appended, got %s", got)
+	}
+	if _, err := parseSort("tags", newFieldResolver(testCollection())); err == nil || !strings.Contains(err.Error(), "tags") {
+		t.Errorf("Expected sorting by array field to be rejected, got %v", err)
+	}
+}
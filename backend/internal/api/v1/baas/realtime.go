@@ -0,0 +1,265 @@
+package baas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"app-platform-backend/internal/api/v1/websocket"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 文档变更类型
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// realtimeChannelPrefix 数据模型订阅频道前缀，完整频道为 baas:<集合名>
+const realtimeChannelPrefix = "baas:"
+
+// ChangeEvent 推送给订阅者的文档变更事件
+type ChangeEvent struct {
+	Type       string                 `json:"type"`
+	Collection string                 `json:"collection"`
+	DocumentID uint                   `json:"document_id"`
+	Document   *DataDocument          `json:"document"`           // 变更后的文档，删除时为被删除的文档
+	Previous   map[string]interface{} `json:"previous,omitempty"` // 更新前的数据
+
+	collection *DataCollection
+	current    map[string]interface{} // 用于匹配过滤条件的字段（含系统字段）
+	before     map[string]interface{}
+}
+
+// publishChange 向订阅了该数据模型的客户端推送文档变更
+func (h *Handler) publishChange(collection *DataCollection, changeType string, document *DataDocument, previous map[string]interface{}) {
+	event := &ChangeEvent{
+		Type:       changeType,
+		Collection: collection.Name,
+		DocumentID: document.ID,
+		Document:   document,
+		collection: collection,
+		current:    documentFields(document, nil),
+	}
+	if changeType == ChangeUpdate {
+		event.Previous = previous
+		event.before = documentFields(document, previous)
+	}
+	websocket.GetHub().Publish(collection.AppID, realtimeChannelPrefix+collection.Name, "change", event)
+}
+
+// documentFields 文档数据与系统字段合并后的字段表；data 为nil时使用文档当前数据
+func documentFields(document *DataDocument, data map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(data)+len(systemColumns))
+	if data == nil {
+		json.Unmarshal(document.Data, &data)
+	}
+	for k, v := range data {
+		fields[k] = v
+	}
+	fields["id"] = float64(document.ID)
+	fields["created_by"] = float64(document.CreatedBy)
+	fields["created_at"] = document.CreatedAt.Format("2006-01-02 15:04:05")
+	fields["updated_at"] = document.UpdatedAt.Format("2006-01-02 15:04:05")
+	return fields
+}
+
+// subscriber 返回实时连接的订阅处理器
+// 订阅时按集合的 read 规则做集合级校验，推送时对每个文档重新评估（creator 规则只推送自己的文档）
+func (h *Handler) subscriber(appID uint, principal Principal) websocket.Subscriber {
+	return func(sub *websocket.Subscription) error {
+		if !strings.HasPrefix(sub.Channel, realtimeChannelPrefix) {
+			return fmt.Errorf("不支持的频道: %s", sub.Channel)
+		}
+		name := strings.TrimPrefix(sub.Channel, realtimeChannelPrefix)
+
+		var collection DataCollection
+		if err := h.db.Where("app_id = ? AND name = ?", appID, name).First(&collection).Error; err != nil {
+			return errors.New("数据模型不存在")
+		}
+		if decision := Evaluate(&collection, ActionRead, principal, nil); !decision.Allowed {
+			return errors.New(decision.Reason)
+		}
+
+		var filter map[string]interface{}
+		if len(sub.Filter) > 0 && string(sub.Filter) != "null" {
+			if err := json.Unmarshal(sub.Filter, &filter); err != nil {
+				return errors.New("filter 不是合法的JSON对象")
+			}
+		}
+		// 与文档查询使用相同的过滤语法与校验规则
+		if _, _, err := compileFilter(filter, newFieldResolver(&collection)); err != nil {
+			return err
+		}
+
+		sub.Match = func(data interface{}) bool {
+			event, ok := data.(*ChangeEvent)
+			if !ok || event.collection.ID != collection.ID {
+				return false
+			}
+			if decision := Evaluate(event.collection, ActionRead, principal, event.Document); !decision.Allowed {
+				return false
+			}
+			// 更新前后任一版本满足条件即推送，便于客户端移除不再匹配的文档
+			if matchFilter(filter, event.current) {
+				return true
+			}
+			return event.before != nil && matchFilter(filter, event.before)
+		}
+		return nil
+	}
+}
+
+// Realtime 建立实时订阅连接
+// 客户端发送 {"type":"subscribe","id":"s1","channel":"baas:<集合名>","filter":{...}} 订阅数据模型，
+// 之后收到 type 为 change 的消息，data 为 ChangeEvent
+func (h *Handler) Realtime(c *gin.Context) {
+	appID := uint(resolveAppID(c))
+	if appID == 0 {
+		response.BadRequest(c, "无效的APP ID")
+		return
+	}
+
+	principal := principalFromContext(c)
+	userID := ""
+	if user, ok := middleware.GetAppUser(c); ok {
+		userID = user.OpenID
+	}
+	websocket.Serve(c, appID, userID, h.subscriber(appID, principal))
+}
+
+// matchFilter 在内存中判断字段是否满足过滤条件，语义与 compileFilter 生成的SQL一致
+// 调用前过滤条件应已通过 compileFilter 校验
+func matchFilter(filter map[string]interface{}, fields map[string]interface{}) bool {
+	for key, value := range filter {
+		switch key {
+		case "$and", "$or":
+			items, _ := value.([]interface{})
+			matched := false
+			for _, item := range items {
+				sub, _ := item.(map[string]interface{})
+				ok := matchFilter(sub, fields)
+				if key == "$and" && !ok {
+					return false
+				}
+				matched = matched || ok
+			}
+			if key == "$or" && !matched {
+				return false
+			}
+		default:
+			if !matchField(fields, key, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchField 判断单个字段上的条件，标量值等价于 $eq
+func matchField(fields map[string]interface{}, name string, cond interface{}) bool {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		ops = map[string]interface{}{"$eq": cond}
+	}
+	actual, exists := fields[name]
+	for op, want := range ops {
+		if !matchOp(actual, exists, op, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchOp 判断单个运算符
+func matchOp(actual interface{}, exists bool, op string, want interface{}) bool {
+	switch op {
+	case "$eq":
+		return exists && compareValues(actual, want) == 0
+	case "$ne":
+		// 字段不存在的文档也视为不等于
+		return actual == nil || compareValues(actual, want) != 0
+	case "$gt":
+		return exists && compareValues(actual, want) == 1
+	case "$gte":
+		cmp := compareValues(actual, want)
+		return exists && (cmp == 0 || cmp == 1)
+	case "$lt":
+		return exists && compareValues(actual, want) == -1
+	case "$lte":
+		cmp := compareValues(actual, want)
+		return exists && (cmp == 0 || cmp == -1)
+	case "$in":
+		items, _ := want.([]interface{})
+		for _, item := range items {
+			if exists && compareValues(actual, item) == 0 {
+				return true
+			}
+		}
+		return false
+	case "$contains":
+		if arr, ok := actual.([]interface{}); ok {
+			return containsJSON(arr, want)
+		}
+		s, ok := actual.(string)
+		sub, _ := want.(string)
+		// LIKE 在默认排序规则下不区分大小写
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+	case "$exists":
+		return exists == (want == true)
+	}
+	return false
+}
+
+// compareValues 比较两个同类型的标量，类型不同或不可比较时返回 2
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 2
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 2
+		}
+		return strings.Compare(x, y)
+	case bool:
+		if y, ok := b.(bool); ok && x == y {
+			return 0
+		}
+	}
+	return 2
+}
+
+// containsJSON 与 JSON_CONTAINS 一致：候选值为数组时要求每个元素都包含在数组中
+func containsJSON(arr []interface{}, want interface{}) bool {
+	if items, ok := want.([]interface{}); ok {
+		for _, item := range items {
+			if !containsJSON(arr, item) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range arr {
+		if reflect.DeepEqual(v, want) {
+			return true
+		}
+	}
+	return false
+}
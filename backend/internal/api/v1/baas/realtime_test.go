@@ -0,0 +1,38 @@
+package baas
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMatchFilter(t *testing.T) {
+	var fields map[string]interface{}
+	json.Unmarshal([]byte(`{"title":"Hello World","price":12,"published":true,"tags":["go","db"],"id":7}`), &fields)
+
+	cases := []struct {
+		filter string
+		want   bool
+	}{
+		{`{}`, true},
+		{`{"title":"Hello World"}`, true},
+		{`{"price":{"$gt":10,"$lte":12}}`, true},
+		{`{"price":{"$lt":12}}`, false},
+		{`{"published":{"$ne":true}}`, false},
+		{`{"missing":{"$ne":"x"}}`, true},
+		{`{"missing":{"$exists":false},"title":{"$exists":true}}`, true},
+		{`{"title":{"$contains":"world"}}`, true},
+		{`{"tags":{"$contains":"go"}}`, true},
+		{`{"tags":{"$contains":["go","js"]}}`, false},
+		{`{"price":{"$in":[1,12]}}`, true},
+		{`{"$or":[{"price":1},{"id":7}]}`, true},
+		{`{"$and":[{"price":12},{"title":"x"}]}`, false},
+		{`{"price":"12"}`, false},
+	}
+	for _, tc := range cases {
+		var filter map[string]interface{}
+		json.Unmarshal([]byte(tc.filter), &filter)
+		if got := matchFilter(filter, fields); got != tc.want {
+			t.Errorf("matchFilter(%s) = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
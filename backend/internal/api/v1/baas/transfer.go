@@ -0,0 +1,976 @@
+package baas
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 导入导出格式
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// 导入任务状态
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportCancelled = "cancelled"
+)
+
+const (
+	importBatchSize   = 200
+	maxImportErrors   = 1000
+	maxImportFileSize = 100 * 1024 * 1024
+	importPollPeriod  = 30 * time.Second
+	importChunkSize   = 1 << 20
+	exportBatchSize   = 500
+)
+
+// errImportCancelled 任务在执行过程中被取消，或租约已被其他实例接管
+var errImportCancelled = errors.New("导入任务已取消")
+
+// ImportJob 数据导入任务
+type ImportJob struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	AppID        uint            `json:"app_id" gorm:"index"`
+	CollectionID uint            `json:"collection_id" gorm:"index"`
+	Format       string          `json:"format" gorm:"size:20"`
+	FileName     string          `json:"file_name" gorm:"size:255"`
+	FilePath     string          `json:"-" gorm:"size:500"` // 旧版本暂存在本机的导入文件，新任务的文件保存在 ImportChunk 中
+	FileSize     int64           `json:"file_size"`
+	Mapping      json.RawMessage `json:"mapping" gorm:"type:json"` // CSV 列名 -> 字段名，为空时列名即字段名
+	UpsertField  string          `json:"upsert_field" gorm:"size:64"`
+	Status       string          `json:"status" gorm:"size:20;default:pending;index"`
+	Cursor       int64           `json:"cursor"` // 已处理到的文件字节偏移
+	Processed    int64           `json:"processed"`
+	Inserted     int64           `json:"inserted"`
+	Updated      int64           `json:"updated"`
+	Failed       int64           `json:"failed"`
+	Errors       json.RawMessage `json:"errors,omitempty" gorm:"type:json"`
+	Error        string          `json:"error" gorm:"type:text"`
+	CreatedBy    uint            `json:"created_by"`
+	ClaimToken   string          `json:"-" gorm:"size:32"` // 执行中任务的持有者，见 lease.go
+	LeaseUntil   *time.Time      `json:"-"`
+	StartedAt    *time.Time      `json:"started_at"`
+	FinishedAt   *time.Time      `json:"finished_at"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+func (ImportJob) TableName() string {
+	return "data_import_jobs"
+}
+
+// ImportChunk 导入文件的分块内容
+// 文件随任务保存在数据库中，任意实例都能执行或从断点继续；任务完成或取消后删除
+type ImportChunk struct {
+	ID    uint   `gorm:"primaryKey"`
+	JobID uint   `gorm:"uniqueIndex:idx_import_chunk,priority:1"`
+	Seq   int    `gorm:"uniqueIndex:idx_import_chunk,priority:2"`
+	Data  []byte `gorm:"type:mediumblob"`
+}
+
+func (ImportChunk) TableName() string {
+	return "data_import_chunks"
+}
+
+// saveImportChunks 将上传的文件按块写入数据库，返回文件大小
+func saveImportChunks(tx *gorm.DB, jobID uint, r io.Reader) (int64, error) {
+	buf := make([]byte, importChunkSize)
+	var size int64
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := tx.Create(&ImportChunk{JobID: jobID, Seq: seq, Data: buf[:n]}).Error; err != nil {
+				return 0, err
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// chunkReader 按需读取导入文件分块，支持定位到任务断点
+type chunkReader struct {
+	load      func(seq int) ([]byte, error)
+	chunkSize int64
+	size      int64
+	pos       int64
+	seq       int // 已缓存的分块序号，-1 表示未缓存
+	chunk     []byte
+}
+
+func newChunkReader(db *gorm.DB, job *ImportJob) *chunkReader {
+	return &chunkReader{
+		load: func(seq int) ([]byte, error) {
+			var chunk ImportChunk
+			if err := db.Where("job_id = ? AND seq = ?", job.ID, seq).First(&chunk).Error; err != nil {
+				return nil, fmt.Errorf("读取导入文件失败: %w", err)
+			}
+			return chunk.Data, nil
+		},
+		chunkSize: importChunkSize,
+		size:      job.FileSize,
+		seq:       -1,
+	}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	seq := int(r.pos / r.chunkSize)
+	if seq != r.seq {
+		data, err := r.load(seq)
+		if err != nil {
+			return 0, err
+		}
+		r.seq, r.chunk = seq, data
+	}
+	offset := r.pos - int64(seq)*r.chunkSize
+	if offset >= int64(len(r.chunk)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.chunk[offset:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("无效的 whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("无效的文件偏移")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// removeImportFile 删除任务的导入文件
+func removeImportFile(db *gorm.DB, job *ImportJob) {
+	if err := db.Where("job_id = ?", job.ID).Delete(&ImportChunk{}).Error; err != nil {
+		log.Printf("[BaaS] Failed to remove file of import job %d: %v", job.ID, err)
+	}
+	if job.FilePath != "" {
+		os.Remove(job.FilePath)
+	}
+}
+
+// ImportRowError 导入失败的行
+type ImportRowError struct {
+	Row     int64            `json:"row"` // 数据行号，从1开始（CSV不含表头）
+	Message string           `json:"message"`
+	Errors  ValidationErrors `json:"errors,omitempty"`
+}
+
+// importRow 从文件中读出的一行数据
+type importRow struct {
+	num  int64
+	data map[string]interface{}
+	err  error // 行格式错误
+}
+
+// rowReader 按行读取导入文件，offset 为已读取内容的文件字节偏移
+type rowReader interface {
+	next() (*importRow, error)
+	offset() int64
+}
+
+// ndjsonReader 每行一个JSON对象，空行忽略
+type ndjsonReader struct {
+	r   *bufio.Reader
+	pos int64
+	row int64
+}
+
+func (r *ndjsonReader) next() (*importRow, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		r.pos += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		r.row++
+		row := &importRow{num: r.row}
+		if jerr := json.Unmarshal(line, &row.data); jerr != nil || row.data == nil {
+			row.err = errors.New("不是合法的JSON对象")
+		}
+		delete(row.data, "_id")
+		return row, nil
+	}
+}
+
+func (r *ndjsonReader) offset() int64 {
+	return r.pos
+}
+
+// csvReader 首行为表头，按列映射和字段类型转换单元格
+type csvReader struct {
+	r       *csv.Reader
+	base    int64
+	row     int64
+	columns []string // 每列对应的字段名，空表示忽略该列
+	fields  map[string]*FieldDefinition
+}
+
+func (r *csvReader) next() (*importRow, error) {
+	record, err := r.r.Read()
+	var perr *csv.ParseError
+	if err != nil && !errors.As(err, &perr) {
+		return nil, err
+	}
+
+	r.row++
+	row := &importRow{num: r.row, data: make(map[string]interface{})}
+	if perr != nil {
+		row.err = errors.New("CSV格式错误: " + perr.Err.Error())
+		return row, nil
+	}
+	for i, cell := range record {
+		if i >= len(r.columns) || r.columns[i] == "" || cell == "" {
+			continue
+		}
+		value, err := csvCell(cell, r.fields[r.columns[i]])
+		if err != nil {
+			row.err = fmt.Errorf("列 %s: %v", r.columns[i], err)
+			break
+		}
+		row.data[r.columns[i]] = value
+	}
+	return row, nil
+}
+
+func (r *csvReader) offset() int64 {
+	return r.base + r.r.InputOffset()
+}
+
+// csvCell 按字段类型转换CSV单元格，数组和对象类型的单元格应为JSON
+func csvCell(cell string, field *FieldDefinition) (interface{}, error) {
+	if field == nil {
+		return cell, nil
+	}
+	switch scalarType(field.Type) {
+	case "array", "object":
+		var value interface{}
+		if err := json.Unmarshal([]byte(cell), &value); err != nil {
+			return nil, errors.New("不是合法的JSON")
+		}
+		return value, nil
+	}
+	return convertValue(cell, field.Type)
+}
+
+// openImportFile 打开任务的导入文件，旧版本任务从本机文件读取
+func (r *ImportRunner) openImportFile(job *ImportJob) (io.ReadSeeker, func(), error) {
+	if job.FilePath == "" {
+		return newChunkReader(r.db, job), func() {}, nil
+	}
+	f, err := os.Open(job.FilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("导入文件不存在: %w", err)
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// openImport 从导入文件中定位到任务断点
+func openImport(job *ImportJob, f io.ReadSeeker, fields []FieldDefinition) (rowReader, error) {
+	if job.Format == FormatNDJSON {
+		if _, err := f.Seek(job.Cursor, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &ndjsonReader{r: bufio.NewReader(f), pos: job.Cursor, row: job.Processed}, nil
+	}
+
+	var mapping map[string]string
+	if len(job.Mapping) > 0 {
+		json.Unmarshal(job.Mapping, &mapping)
+	}
+	defs := make(map[string]*FieldDefinition)
+	for i := range fields {
+		defs[fields[i].Name] = &fields[i]
+	}
+
+	header := csv.NewReader(f)
+	names, err := header.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV表头失败: %w", err)
+	}
+	columns := make([]string, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if len(mapping) > 0 {
+			name = mapping[name]
+		}
+		if name != "_id" {
+			columns[i] = name
+		}
+	}
+
+	base := job.Cursor
+	if base == 0 {
+		base = header.InputOffset()
+	}
+	if _, err := f.Seek(base, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return &csvReader{r: r, base: base, row: job.Processed, columns: columns, fields: defs}, nil
+}
+
+// ImportRunner 负责导入任务的排队与执行
+// 每批数据与任务断点在同一事务中提交，进程重启或任务失败后可从断点继续
+type ImportRunner struct {
+	db      *gorm.DB
+	indexes *IndexManager
+	notify  chan struct{}
+	once    sync.Once
+	stopped chan struct{}
+}
+
+// NewImportRunner 创建导入任务执行器
+func NewImportRunner(db *gorm.DB, indexes *IndexManager) *ImportRunner {
+	return &ImportRunner{
+		db:      db,
+		indexes: indexes,
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start 启动后台工作协程
+func (r *ImportRunner) Start() {
+	r.once.Do(func() {
+		// 中断的任务在租约过期后由任一实例从断点继续
+		go r.loop()
+		log.Println("[BaaS] Import job worker started")
+	})
+}
+
+// Stop 停止后台工作协程
+func (r *ImportRunner) Stop() {
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+}
+
+func (r *ImportRunner) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *ImportRunner) loop() {
+	ticker := time.NewTicker(importPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		for r.runNext() {
+		}
+		select {
+		case <-r.stopped:
+			return
+		case <-r.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext 执行最早的一个可领取任务，没有任务时返回 false
+func (r *ImportRunner) runNext() bool {
+	job, ok := r.claim()
+	if !ok {
+		return job != nil
+	}
+
+	stopLease := keepLease(r.db, &ImportJob{}, job.ID, job.ClaimToken)
+	err := r.run(job)
+	stopLease()
+
+	now := time.Now()
+	owned := r.db.Model(&ImportJob{}).Where("id = ? AND claim_token = ?", job.ID, job.ClaimToken)
+	if errors.Is(err, errImportCancelled) {
+		// 任务被取消，或租约过期后已被其他实例接管；只清理确实已取消的任务
+		result := owned.Where("status = ?", ImportCancelled).
+			Updates(map[string]interface{}{"finished_at": now, "claim_token": "", "lease_until": nil})
+		if result.RowsAffected > 0 {
+			removeImportFile(r.db, job)
+		}
+		return true
+	}
+
+	done := map[string]interface{}{"status": ImportCompleted, "finished_at": now, "claim_token": "", "lease_until": nil}
+	if err != nil {
+		// 失败的任务保留文件，便于修正后从断点继续
+		done["status"] = ImportFailed
+		done["error"] = err.Error()
+		log.Printf("[BaaS] Import job %d failed: %v", job.ID, err)
+	}
+	result := owned.Where("status = ?", ImportRunning).Updates(done)
+	if err == nil && result.RowsAffected > 0 {
+		removeImportFile(r.db, job)
+	}
+	return true
+}
+
+// claim 以逐行条件更新领取最早的可领取任务：待处理的任务，或租约已过期的执行中任务
+// 多个实例同时领取同一任务时只有一个更新成功；返回 (nil, false) 表示没有可领取的任务，
+// (非 nil, false) 表示任务已被其他实例领取
+func (r *ImportRunner) claim() (*ImportJob, bool) {
+	now := time.Now()
+	var job ImportJob
+	if err := leaseDue(r.db, ImportPending, ImportRunning, now).Order("id ASC").First(&job).Error; err != nil {
+		return nil, false
+	}
+
+	token := newClaimToken()
+	updates := map[string]interface{}{
+		"status":      ImportRunning,
+		"error":       "",
+		"claim_token": token,
+		"lease_until": now.Add(jobLease),
+	}
+	if job.StartedAt == nil {
+		updates["started_at"] = now
+	}
+	result := leaseDue(r.db.Model(&ImportJob{}).Where("id = ?", job.ID), ImportPending, ImportRunning, now).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return &job, false
+	}
+	// 重新读取断点，上一个持有者可能在领取前提交了最后一批
+	if err := r.db.Where("claim_token = ?", token).First(&job, job.ID).Error; err != nil {
+		return &job, false
+	}
+	return &job, true
+}
+
+// run 分批读取并写入文档，每批在一个事务中写入数据并保存断点
+func (r *ImportRunner) run(job *ImportJob) error {
+	var collection DataCollection
+	if err := r.db.First(&collection, job.CollectionID).Error; err != nil {
+		return fmt.Errorf("数据模型不存在: %w", err)
+	}
+	fields := parseFields(collection.Fields)
+
+	f, closeFile, err := r.openImportFile(job)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	reader, err := openImport(job, f, fields)
+	if err != nil {
+		return err
+	}
+
+	var rowErrors []ImportRowError
+	if len(job.Errors) > 0 {
+		json.Unmarshal(job.Errors, &rowErrors)
+	}
+	indexed := r.indexes.uniqueFields(&collection)
+
+	for {
+		var rows []*importRow
+		var readErr error
+		for len(rows) < importBatchSize {
+			row, err := reader.next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			rows = append(rows, row)
+		}
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("读取导入文件失败: %w", readErr)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			validator := &DocumentValidator{db: tx, collection: &collection, fields: fields, indexed: indexed}
+			var inserted, updated, failed int64
+			for _, row := range rows {
+				rowErr := row.err
+				if rowErr == nil {
+					var isUpdate bool
+					var err error
+					isUpdate, rowErr, err = r.importRow(tx, validator, job, &collection, row.data)
+					if err != nil {
+						return err
+					}
+					if rowErr == nil && isUpdate {
+						updated++
+					} else if rowErr == nil {
+						inserted++
+					}
+				}
+				if rowErr != nil {
+					failed++
+					if len(rowErrors) < maxImportErrors {
+						item := ImportRowError{Row: row.num, Message: rowErr.Error()}
+						var verrs ValidationErrors
+						if errors.As(rowErr, &verrs) {
+							item.Errors = verrs
+						}
+						rowErrors = append(rowErrors, item)
+					}
+				}
+			}
+
+			errorsJSON, _ := json.Marshal(rowErrors)
+			// 按 claim_token 写回断点，租约已被其他实例接管时整批回滚
+			result := tx.Model(&ImportJob{}).Where("id = ? AND status = ? AND claim_token = ?", job.ID, ImportRunning, job.ClaimToken).Updates(map[string]interface{}{
+				"cursor":    reader.offset(),
+				"processed": gorm.Expr("processed + ?", len(rows)),
+				"inserted":  gorm.Expr("inserted + ?", inserted),
+				"updated":   gorm.Expr("updated + ?", updated),
+				"failed":    gorm.Expr("failed + ?", failed),
+				"errors":    errorsJSON,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errImportCancelled
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// importRow 写入一行数据；指定了 upsert 字段且已存在相同值的文档时合并更新该文档
+// 返回是否为更新、行级错误（校验失败、唯一冲突）和需要中止任务的错误
+func (r *ImportRunner) importRow(tx *gorm.DB, validator *DocumentValidator, job *ImportJob, collection *DataCollection, data map[string]interface{}) (bool, error, error) {
+	var existing *DataDocument
+	if job.UpsertField != "" {
+		value := data[job.UpsertField]
+		if value == nil || value == "" {
+			return false, fmt.Errorf("缺少 upsert 字段 %s", job.UpsertField), nil
+		}
+		var doc DataDocument
+		err := tx.Where("collection_id = ? AND JSON_EXTRACT(data, ?) = ?", collection.ID, "$."+job.UpsertField, value).
+			First(&doc).Error
+		if err == nil {
+			existing = &doc
+			var merged map[string]interface{}
+			json.Unmarshal(doc.Data, &merged)
+			if merged == nil {
+				merged = make(map[string]interface{})
+			}
+			for k, v := range data {
+				merged[k] = v
+			}
+			data = merged
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, err
+		}
+	}
+
+	var excludeID uint
+	if existing != nil {
+		excludeID = existing.ID
+	}
+	if err := validator.Validate(data, excludeID); err != nil {
+		return false, err, nil
+	}
+
+	raw, _ := json.Marshal(data)
+	var err error
+	if existing != nil {
+		err = tx.Model(&DataDocument{}).Where("id = ?", existing.ID).
+			Updates(map[string]interface{}{"data": raw, "updated_by": job.CreatedBy}).Error
+	} else {
+		err = tx.Create(&DataDocument{
+			CollectionID: collection.ID,
+			AppID:        collection.AppID,
+			Data:         raw,
+			CreatedBy:    job.CreatedBy,
+			CreatorType:  string(PrincipalAdmin),
+			UpdatedBy:    job.CreatedBy,
+		}).Error
+	}
+	if err != nil {
+		if isDuplicateKey(err) {
+			return false, duplicateKeyError(collection, err), nil
+		}
+		return false, nil, err
+	}
+	return existing != nil, nil, nil
+}
+
+// ==================== 导入导出 API ====================
+
+// CreateImport 上传文件并创建导入任务
+// 表单字段：file 文件，format 为 ndjson 或 csv（默认按扩展名判断），
+// mapping 为CSV列名到字段名的JSON对象，upsert_field 为按其值合并更新的唯一字段
+// 批量导入不触发数据模型钩子和实时推送
+func (h *Handler) CreateImport(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		fail(c, 400, "请上传导入文件")
+		return
+	}
+	if header.Size > maxImportFileSize {
+		fail(c, 400, fmt.Sprintf("导入文件不能超过%dMB", maxImportFileSize/1024/1024))
+		return
+	}
+
+	format := c.PostForm("format")
+	if format == "" {
+		format = FormatNDJSON
+		if strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+			format = FormatCSV
+		}
+	}
+	if format != FormatNDJSON && format != FormatCSV {
+		fail(c, 400, "不支持的导入格式: "+format)
+		return
+	}
+
+	fields := make(map[string]FieldDefinition)
+	for _, f := range parseFields(collection.Fields) {
+		fields[f.Name] = f
+	}
+
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if format != FormatCSV {
+			fail(c, 400, "只有CSV导入支持列映射")
+			return
+		}
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			fail(c, 400, "mapping 应为列名到字段名的JSON对象")
+			return
+		}
+		for column, field := range mapping {
+			if field == "" {
+				continue
+			}
+			if _, ok := fields[field]; !fieldNamePattern.MatchString(field) || (len(fields) > 0 && !ok) {
+				fail(c, 400, fmt.Sprintf("列 %s 映射的字段 %s 未在数据模型中定义", column, field))
+				return
+			}
+		}
+	}
+
+	upsertField := c.PostForm("upsert_field")
+	if upsertField != "" {
+		def, ok := fields[upsertField]
+		if !fieldNamePattern.MatchString(upsertField) || (len(fields) > 0 && !(ok && def.Unique)) {
+			fail(c, 400, "upsert 字段必须是数据模型中的唯一字段")
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		fail(c, 500, "读取导入文件失败")
+		return
+	}
+	defer file.Close()
+
+	mappingJSON, _ := json.Marshal(mapping)
+	job := ImportJob{
+		AppID:        collection.AppID,
+		CollectionID: collection.ID,
+		Format:       format,
+		FileName:     header.Filename,
+		Mapping:      mappingJSON,
+		UpsertField:  upsertField,
+		Status:       ImportPending,
+		CreatedBy:    principalFromContext(c).UserID,
+	}
+	// 任务与文件内容在同一事务中写入，工作协程不会读到不完整的文件
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		size, err := saveImportChunks(tx, job.ID, file)
+		if err != nil {
+			return err
+		}
+		job.FileSize = size
+		return tx.Model(&job).Update("file_size", size).Error
+	})
+	if err != nil {
+		fail(c, 500, "创建导入任务失败: "+err.Error())
+		return
+	}
+	h.imports.wake()
+
+	success(c, job)
+}
+
+// ListImports 获取数据模型的导入任务
+func (h *Handler) ListImports(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	var jobs []ImportJob
+	var total int64
+	query := h.db.Model(&ImportJob{}).Where("collection_id = ?", collection.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Count(&total)
+	query.Omit("errors").Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&jobs)
+
+	success(c, gin.H{
+		"list":  jobs,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// GetImport 获取导入任务详情（含行级错误）
+func (h *Handler) GetImport(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	var job ImportJob
+	if err := h.db.Where("id = ? AND collection_id = ?", c.Param("jobId"), collection.ID).First(&job).Error; err != nil {
+		fail(c, 404, "导入任务不存在")
+		return
+	}
+	success(c, job)
+}
+
+// ResumeImport 从断点继续执行失败的导入任务
+func (h *Handler) ResumeImport(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	result := h.db.Model(&ImportJob{}).
+		Where("id = ? AND collection_id = ? AND status = ?", c.Param("jobId"), collection.ID, ImportFailed).
+		Updates(map[string]interface{}{"status": ImportPending, "error": "", "claim_token": "", "lease_until": nil})
+	if result.RowsAffected == 0 {
+		fail(c, 400, "只能继续执行失败的导入任务")
+		return
+	}
+	h.imports.wake()
+	success(c, nil)
+}
+
+// CancelImport 取消未完成的导入任务，已提交的批次不会回滚
+func (h *Handler) CancelImport(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+	var job ImportJob
+	if err := h.db.Where("id = ? AND collection_id = ?", c.Param("jobId"), collection.ID).First(&job).Error; err != nil {
+		fail(c, 404, "导入任务不存在")
+		return
+	}
+	result := h.db.Model(&ImportJob{}).
+		Where("id = ? AND status IN ?", job.ID, []string{ImportPending, ImportRunning, ImportFailed}).
+		Update("status", ImportCancelled)
+	if result.RowsAffected == 0 {
+		fail(c, 400, "导入任务已结束")
+		return
+	}
+	// 运行中的任务由持有租约的工作协程在当前批次结束后清理文件
+	if job.Status != ImportRunning || leaseExpired(job.LeaseUntil) {
+		removeImportFile(h.db, &job)
+	}
+	success(c, nil)
+}
+
+// ExportDocuments 流式导出数据模型的文档
+// 参数：format 为 ndjson（默认）或 csv，filter/fields 与文档查询相同，after 为起始文档ID（不含）
+// 每行带有 _id，导出中断后以最后收到的 _id 作为 after 参数即可继续
+func (h *Handler) ExportDocuments(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", FormatNDJSON)
+	if format != FormatNDJSON && format != FormatCSV {
+		fail(c, 400, "不支持的导出格式: "+format)
+		return
+	}
+	after, _ := strconv.ParseUint(c.Query("after"), 10, 64)
+
+	q, err := parseDocumentQuery(c)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	resolver := newFieldResolver(collection)
+	where, args, err := compileFilter(q.Filter, resolver)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	for _, name := range q.Fields {
+		if _, err := resolver.resolve(name, false); err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+	}
+
+	columns := q.Fields
+	if len(columns) == 0 {
+		for _, f := range parseFields(collection.Fields) {
+			columns = append(columns, f.Name)
+		}
+	}
+	if format == FormatCSV && len(columns) == 0 {
+		fail(c, 400, "数据模型未定义字段，导出CSV时需指定 fields")
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == FormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", collection.Name+"."+format))
+	c.Status(200)
+
+	var csvWriter *csv.Writer
+	if format == FormatCSV {
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write(append([]string{"_id"}, columns...))
+	}
+
+	cursor := uint(after)
+	for {
+		query := h.db.Where("collection_id = ? AND id > ?", collection.ID, cursor)
+		if where != "" {
+			query = query.Where(where, args...)
+		}
+		var docs []DataDocument
+		if err := query.Order("id ASC").Limit(exportBatchSize).Find(&docs).Error; err != nil {
+			log.Printf("[BaaS] Export of collection %d aborted: %v", collection.ID, err)
+			return
+		}
+
+		for _, doc := range docs {
+			var data map[string]interface{}
+			json.Unmarshal(doc.Data, &data)
+			if format == FormatCSV {
+				record := []string{strconv.FormatUint(uint64(doc.ID), 10)}
+				for _, name := range columns {
+					record = append(record, exportCell(data[name]))
+				}
+				csvWriter.Write(record)
+				continue
+			}
+			if len(q.Fields) > 0 {
+				projected := make(map[string]interface{}, len(q.Fields))
+				for _, name := range q.Fields {
+					if v, ok := data[name]; ok {
+						projected[name] = v
+					}
+				}
+				data = projected
+			}
+			c.Writer.Write(exportLine(doc.ID, data))
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if csvWriter.Error() != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+		// 客户端断开连接后停止导出
+		if c.Request.Context().Err() != nil || len(docs) < exportBatchSize {
+			return
+		}
+		cursor = docs[len(docs)-1].ID
+	}
+}
+
+// exportLine 生成一行NDJSON，_id 位于首位
+func exportLine(id uint, data map[string]interface{}) []byte {
+	body, _ := json.Marshal(data)
+	line := []byte(`{"_id":` + strconv.FormatUint(uint64(id), 10))
+	if len(data) > 0 {
+		line = append(line, ',')
+		line = append(line, body[1:]...)
+	} else {
+		line = append(line, '}')
+	}
+	return append(line, '\n')
+}
+
+// exportCell 将字段值转换为CSV单元格，数组和对象输出为JSON
+func exportCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,172 @@
+package baas
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// chunkedFile 将内容按 size 字节分块，模拟保存在数据库中的导入文件
+func chunkedFile(content string, size int) *chunkReader {
+	var chunks [][]byte
+	for i := 0; i < len(content); i += size {
+		end := i + size
+		if end > len(content) {
+			end = len(content)
+		}
+		chunks = append(chunks, []byte(content[i:end]))
+	}
+	return &chunkReader{
+		load: func(seq int) ([]byte, error) {
+			if seq >= len(chunks) {
+				return nil, fmt.Errorf("chunk %d not found", seq)
+			}
+			return chunks[seq], nil
+		},
+		chunkSize: int64(size),
+		size:      int64(len(content)),
+		seq:       -1,
+	}
+}
+
+func readAll(t *testing.T, job *ImportJob, content string, fields []FieldDefinition) ([]*importRow, int64) {
+	t.Helper()
+	reader, err := openImport(job, chunkedFile(content, 7), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*importRow
+	for {
+		row, err := reader.next()
+		if err == io.EOF {
+			return rows, reader.offset()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestImportReader_NDJSONResume(t *testing.T) {
+	content := "{\"_id\":1,\"title\":\"a\"}\n\nnot json\n{\"title\":\"c\"}"
+	job := &ImportJob{Format: FormatNDJSON}
+
+	rows, end := readAll(t, job, content, nil)
+	if len(rows) != 3 || end != int64(len(content)) {
+		t.Fatalf("got %d rows, offset %d", len(rows), end)
+	}
+	if _, ok := rows[0].data["_id"]; ok || rows[0].data["title"] != "a" {
+		t.Errorf("row 1 = %v, want _id stripped", rows[0].data)
+	}
+	if rows[1].err == nil || rows[1].num != 2 {
+		t.Errorf("row 2 should be a format error, got %+v", rows[1])
+	}
+
+	// 从第一行之后继续读取，行号延续
+	job.Cursor = int64(len("{\"_id\":1,\"title\":\"a\"}\n"))
+	job.Processed = 1
+	rows, _ = readAll(t, job, content, nil)
+	if len(rows) != 2 || rows[1].num != 3 || rows[1].data["title"] != "c" {
+		t.Errorf("resumed rows = %+v", rows)
+	}
+}
+
+func TestImportReader_CSVMappingAndTypes(t *testing.T) {
+	content := "\ufeffName,Price,Tags,_id,Skip\nfoo,1.5,\"[\"\"x\"\"]\",9,z\nbar,abc,,10,z\n"
+	fields := []FieldDefinition{
+		{Name: "title", Type: "string"},
+		{Name: "price", Type: "number"},
+		{Name: "tags", Type: "array"},
+	}
+	job := &ImportJob{
+		Format:  FormatCSV,
+		Mapping: []byte(`{"Name":"title","Price":"price","Tags":"tags"}`),
+	}
+
+	rows, end := readAll(t, job, content, fields)
+	if len(rows) != 2 || end != int64(len(content)) {
+		t.Fatalf("got %d rows, offset %d", len(rows), end)
+	}
+	first := rows[0].data
+	if first["title"] != "foo" || first["price"] != 1.5 || len(first) != 3 {
+		t.Errorf("row 1 = %v", first)
+	}
+	if tags, ok := first["tags"].([]interface{}); !ok || tags[0] != "x" {
+		t.Errorf("tags = %v", first["tags"])
+	}
+	if rows[1].err == nil {
+		t.Error("row 2 should fail number conversion")
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	content := "0123456789abcdefghij"
+	r := chunkedFile(content, 4)
+
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != content {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if _, err := r.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = io.ReadAll(r)
+	if string(data) != content[10:] {
+		t.Errorf("read after seek = %q, want %q", data, content[10:])
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected negative offset to be rejected")
+	}
+
+	// 分块缺失时返回错误而不是静默截断
+	r = chunkedFile(content, 4)
+	r.size = int64(len(content) + 4)
+	if _, err := io.ReadAll(r); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected missing chunk error, got %v", err)
+	}
+}
+
+func TestExportLine(t *testing.T) {
+	if got := string(exportLine(3, map[string]interface{}{"a": 1})); got != "{\"_id\":3,\"a\":1}\n" {
+		t.Errorf("exportLine = %q", got)
+	}
+	if got := string(exportLine(4, nil)); got != "{\"_id\":4}\n" {
+		t.Errorf("exportLine(empty) = %q", got)
+	}
+}
+
+func TestImportClaimRace(t *testing.T) {
+	db, mock := newMockDB(t)
+	a := NewImportRunner(db, nil)
+	b := NewImportRunner(db, nil)
+
+	due := `SELECT \* FROM .data_import_jobs. WHERE status = \? OR \(status = \? AND lease_until < \?\)`
+	claim := `UPDATE .data_import_jobs. SET .*claim_token.* WHERE id = \? AND \(status = \? OR \(status = \? AND lease_until < \?\)\)`
+	reload := `SELECT \* FROM .data_import_jobs. WHERE claim_token = \? AND .data_import_jobs.\..id. = \?`
+	row := func(cursor int64) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "status", "cursor", "claim_token"}).AddRow(1, ImportRunning, cursor, "expired")
+	}
+
+	// 两个实例都读到同一个租约已过期的任务，只有先完成条件更新的实例领取成功
+	mock.ExpectQuery(due).WillReturnRows(row(0))
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(reload).WillReturnRows(row(4096))
+	mock.ExpectQuery(due).WillReturnRows(row(0))
+	mock.ExpectExec(claim).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	jobA, ok := a.claim()
+	if !ok || jobA.Cursor != 4096 {
+		t.Fatalf("first runner claim = %+v, %v; want claimed at reloaded cursor", jobA, ok)
+	}
+	jobB, ok := b.claim()
+	if ok || jobB == nil {
+		t.Fatalf("second runner claim = %+v, %v; want lost race", jobB, ok)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,478 @@
+package baas
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"app-platform-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 支持的字段类型
+var fieldTypes = map[string]bool{
+	"string":    true,
+	"number":    true,
+	"boolean":   true,
+	"array":     true,
+	"object":    true,
+	"date":      true, // 2006-01-02
+	"datetime":  true, // RFC3339
+	"enum":      true,
+	"reference": true, // 引用同一应用下其他数据模型的文档ID
+	"file":      true, // model.File 的ID
+	"geopoint":  true, // {"lat": 纬度, "lng": 经度}
+}
+
+// 引用删除策略
+const (
+	OnDeleteRestrict = "restrict" // 存在引用时禁止删除（默认）
+	OnDeleteCascade  = "cascade"  // 级联删除引用方文档
+	OnDeleteSetNull  = "set_null" // 将引用字段置为 null
+)
+
+const (
+	dateLayout        = "2006-01-02"
+	maxFieldDepth     = 5
+	maxCascadeDepth   = 5
+	maxCascadeDeletes = 1000
+)
+
+// scalarType 返回字段在查询和索引中使用的基础类型
+func scalarType(typ string) string {
+	switch typ {
+	case "date", "datetime":
+		return "string"
+	case "reference", "file":
+		return "number"
+	case "enum":
+		return "" // 按取值推断
+	case "geopoint":
+		return "object"
+	}
+	return typ
+}
+
+// ValidationError 验证错误
+type ValidationError struct {
+	Field   string `json:"field"` // 字段显示名称
+	Path    string `json:"path"`  // 字段路径，嵌套字段以 . 分隔
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors 文档的全部字段错误
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// patternCache 缓存已编译的字段正则
+var patternCache sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// validateFieldDefinitions 校验数据模型的字段定义本身是否合法
+func validateFieldDefinitions(fields []FieldDefinition) error {
+	return checkDefinitions(fields, "", 1)
+}
+
+func checkDefinitions(fields []FieldDefinition, prefix string, depth int) error {
+	if depth > maxFieldDepth {
+		return fmt.Errorf("嵌套对象不能超过%d层", maxFieldDepth)
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		path := prefix + f.Name
+		if !fieldNamePattern.MatchString(f.Name) {
+			return fmt.Errorf("无效的字段名: %s", path)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("字段名重复: %s", path)
+		}
+		seen[f.Name] = true
+
+		if f.Type != "" && !fieldTypes[f.Type] {
+			return fmt.Errorf("字段 %s 的类型 %s 不受支持", path, f.Type)
+		}
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return fmt.Errorf("字段 %s 的最小值不能大于最大值", path)
+		}
+		if f.MinLength != nil && f.MaxLength != nil && *f.MinLength > *f.MaxLength {
+			return fmt.Errorf("字段 %s 的最小长度不能大于最大长度", path)
+		}
+		if f.Pattern != "" {
+			if _, err := compilePattern(f.Pattern); err != nil {
+				return fmt.Errorf("字段 %s 的正则表达式无效: %v", path, err)
+			}
+		}
+
+		switch f.Type {
+		case "enum":
+			if len(f.Options) == 0 {
+				return fmt.Errorf("枚举字段 %s 必须设置可选值", path)
+			}
+		case "reference":
+			if f.Reference == "" {
+				return fmt.Errorf("引用字段 %s 必须指定引用的数据模型", path)
+			}
+			switch f.OnDelete {
+			case "", OnDeleteRestrict, OnDeleteCascade, OnDeleteSetNull:
+			default:
+				return fmt.Errorf("引用字段 %s 的删除策略无效，请使用: restrict, cascade, set_null", path)
+			}
+		case "object":
+			if err := checkDefinitions(f.Fields, path+".", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupCheck 需要查询数据库确认的字段值（引用、文件）
+type lookupCheck struct {
+	path  string
+	field FieldDefinition
+	id    uint
+}
+
+// fieldWalker 遍历文档并收集字段错误
+type fieldWalker struct {
+	errs    ValidationErrors
+	lookups []lookupCheck
+}
+
+// validateFields 校验文档的静态约束（必填、类型、取值范围、嵌套结构），不访问数据库
+func validateFields(fields []FieldDefinition, data map[string]interface{}) ValidationErrors {
+	w := &fieldWalker{}
+	w.walk(fields, data, "")
+	return w.errs
+}
+
+func (w *fieldWalker) fail(path string, field FieldDefinition, format string, args ...interface{}) {
+	name := field.DisplayName
+	if name == "" {
+		name = path
+	}
+	w.errs = append(w.errs, &ValidationError{Field: name, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (w *fieldWalker) walk(fields []FieldDefinition, data map[string]interface{}, prefix string) {
+	for _, field := range fields {
+		value, exists := data[field.Name]
+		w.check(prefix+field.Name, field, value, exists)
+	}
+}
+
+func (w *fieldWalker) check(path string, field FieldDefinition, value interface{}, exists bool) {
+	// 必填验证
+	if field.Required && (!exists || value == nil || value == "") {
+		w.fail(path, field, "不能为空")
+		return
+	}
+	if !exists || value == nil {
+		return
+	}
+
+	switch field.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			w.fail(path, field, "应为字符串类型")
+			return
+		}
+		w.checkLength(path, field, utf8.RuneCountInString(s))
+		if field.Pattern != "" {
+			if re, err := compilePattern(field.Pattern); err == nil && !re.MatchString(s) {
+				w.fail(path, field, "格式不正确")
+			}
+		}
+
+	case "number":
+		n, ok := value.(float64)
+		if !ok {
+			w.fail(path, field, "应为数字类型")
+			return
+		}
+		w.checkRange(path, field, n)
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			w.fail(path, field, "应为布尔类型")
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			w.fail(path, field, "应为数组类型")
+			return
+		}
+		w.checkLength(path, field, len(arr))
+
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			w.fail(path, field, "应为对象类型")
+			return
+		}
+		if len(field.Fields) > 0 {
+			w.walk(field.Fields, obj, path+".")
+		}
+
+	case "date", "datetime":
+		s, ok := value.(string)
+		if !ok {
+			w.fail(path, field, "应为日期字符串")
+			return
+		}
+		layout, hint := dateLayout, "YYYY-MM-DD"
+		if field.Type == "datetime" {
+			layout, hint = time.RFC3339, "RFC3339（如 2006-01-02T15:04:05Z）"
+		}
+		if _, err := time.Parse(layout, s); err != nil {
+			w.fail(path, field, "日期格式应为%s", hint)
+		}
+
+	case "enum":
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			w.fail(path, field, "不是允许的取值")
+			return
+		}
+		for _, option := range field.Options {
+			if option == value {
+				return
+			}
+		}
+		w.fail(path, field, "不是允许的取值")
+
+	case "reference", "file":
+		n, ok := value.(float64)
+		if !ok || n <= 0 || n != math.Trunc(n) {
+			w.fail(path, field, "应为有效的ID")
+			return
+		}
+		w.lookups = append(w.lookups, lookupCheck{path: path, field: field, id: uint(n)})
+
+	case "geopoint":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			w.fail(path, field, "应为包含 lat 和 lng 的对象")
+			return
+		}
+		lat, latOK := obj["lat"].(float64)
+		lng, lngOK := obj["lng"].(float64)
+		if !latOK || !lngOK || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			w.fail(path, field, "经纬度无效（lat: -90~90, lng: -180~180）")
+		}
+	}
+}
+
+func (w *fieldWalker) checkLength(path string, field FieldDefinition, length int) {
+	if field.MinLength != nil && length < *field.MinLength {
+		w.fail(path, field, "长度不能少于%d", *field.MinLength)
+	}
+	if field.MaxLength != nil && length > *field.MaxLength {
+		w.fail(path, field, "长度不能超过%d", *field.MaxLength)
+	}
+}
+
+func (w *fieldWalker) checkRange(path string, field FieldDefinition, n float64) {
+	if field.Min != nil && n < *field.Min {
+		w.fail(path, field, "不能小于%v", *field.Min)
+	}
+	if field.Max != nil && n > *field.Max {
+		w.fail(path, field, "不能大于%v", *field.Max)
+	}
+}
+
+// DocumentValidator 数据模型的文档校验器，一次返回全部字段错误
+type DocumentValidator struct {
+	db         *gorm.DB
+	collection *DataCollection
+	fields     []FieldDefinition
+	indexed    map[string]bool // 已由数据库唯一索引保证唯一性的字段
+}
+
+// newValidator 创建数据模型的文档校验器
+func (h *Handler) newValidator(collection *DataCollection) *DocumentValidator {
+	return &DocumentValidator{
+		db:         h.db,
+		collection: collection,
+		fields:     parseFields(collection.Fields),
+		indexed:    h.indexes.uniqueFields(collection),
+	}
+}
+
+// Validate 校验文档数据；excludeDocID 为更新时的当前文档ID（唯一性检查排除自身），创建时传0
+func (v *DocumentValidator) Validate(data map[string]interface{}, excludeDocID uint) error {
+	w := &fieldWalker{}
+	w.walk(v.fields, data, "")
+
+	for _, lookup := range w.lookups {
+		if msg := v.checkLookup(lookup); msg != "" {
+			w.fail(lookup.path, lookup.field, msg)
+		}
+	}
+
+	// 唯一性验证（已建立唯一索引的字段由数据库保证）
+	for _, field := range v.fields {
+		value, exists := data[field.Name]
+		if !field.Unique || v.indexed[field.Name] || !exists || value == nil || value == "" {
+			continue
+		}
+		var count int64
+		query := v.db.Model(&DataDocument{}).Where("collection_id = ? AND JSON_EXTRACT(data, ?) = ?",
+			v.collection.ID, "$."+field.Name, value)
+		if excludeDocID > 0 {
+			query = query.Where("id != ?", excludeDocID)
+		}
+		query.Count(&count)
+		if count > 0 {
+			w.fail(field.Name, field, "已存在相同的值")
+		}
+	}
+
+	if len(w.errs) == 0 {
+		return nil
+	}
+	return w.errs
+}
+
+// checkLookup 检查引用的文档或文件是否存在，返回错误信息
+func (v *DocumentValidator) checkLookup(lookup lookupCheck) string {
+	var count int64
+	if lookup.field.Type == "file" {
+		v.db.Model(&model.File{}).Where("id = ? AND app_id = ?", lookup.id, v.collection.AppID).Count(&count)
+		if count == 0 {
+			return "文件不存在"
+		}
+		return ""
+	}
+
+	var target DataCollection
+	if err := v.db.Where("app_id = ? AND name = ?", v.collection.AppID, lookup.field.Reference).First(&target).Error; err != nil {
+		return "引用的数据模型 " + lookup.field.Reference + " 不存在"
+	}
+	v.db.Model(&DataDocument{}).Where("id = ? AND collection_id = ?", lookup.id, target.ID).Count(&count)
+	if count == 0 {
+		return "引用的文档不存在"
+	}
+	return ""
+}
+
+// referrer 引用了某数据模型的字段
+type referrer struct {
+	collection DataCollection
+	field      FieldDefinition
+}
+
+// referrersOf 查找同一应用内引用了指定数据模型的顶层字段
+func referrersOf(db *gorm.DB, collection *DataCollection) ([]referrer, error) {
+	var collections []DataCollection
+	if err := db.Where("app_id = ?", collection.AppID).Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	var result []referrer
+	for _, c := range collections {
+		for _, f := range parseFields(c.Fields) {
+			if f.Type == "reference" && f.Reference == collection.Name {
+				result = append(result, referrer{collection: c, field: f})
+			}
+		}
+	}
+	return result, nil
+}
+
+// deleteWithReferences 按引用字段的删除策略删除文档，必须在事务中调用
+func deleteWithReferences(tx *gorm.DB, collection *DataCollection, document *DataDocument) error {
+	deleted := 0
+	return deleteCascade(tx, collection, document.ID, 1, &deleted)
+}
+
+func deleteCascade(tx *gorm.DB, collection *DataCollection, docID uint, depth int, deleted *int) error {
+	if depth > maxCascadeDepth {
+		return fmt.Errorf("级联删除层级超过%d层", maxCascadeDepth)
+	}
+
+	referrers, err := referrersOf(tx, collection)
+	if err != nil {
+		return err
+	}
+	for _, ref := range referrers {
+		path := "$." + ref.field.Name
+		query := tx.Model(&DataDocument{}).Where("collection_id = ? AND JSON_EXTRACT(data, ?) = ?", ref.collection.ID, path, docID)
+
+		switch ref.field.OnDelete {
+		case OnDeleteCascade:
+			var ids []uint
+			if err := query.Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := deleteCascade(tx, &ref.collection, id, depth+1, deleted); err != nil {
+					return err
+				}
+			}
+		case OnDeleteSetNull:
+			if err := query.Update("data", gorm.Expr("JSON_SET(data, ?, CAST('null' AS JSON))", path)).Error; err != nil {
+				return err
+			}
+		default:
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				name := ref.collection.DisplayName
+				if name == "" {
+					name = ref.collection.Name
+				}
+				return &ValidationError{Field: name, Path: ref.collection.Name + "." + ref.field.Name,
+					Message: fmt.Sprintf("有%d条数据引用了该文档，无法删除", count)}
+			}
+		}
+	}
+
+	*deleted++
+	if *deleted > maxCascadeDeletes {
+		return fmt.Errorf("级联删除的文档数量超过%d条", maxCascadeDeletes)
+	}
+	return tx.Where("id = ? AND collection_id = ?", docID, collection.ID).Delete(&DataDocument{}).Error
+}
+
+// validationData 校验错误在响应中的明细
+func validationData(err error) interface{} {
+	switch e := err.(type) {
+	case ValidationErrors:
+		return map[string]interface{}{"errors": e}
+	case *ValidationError:
+		return map[string]interface{}{"errors": ValidationErrors{e}}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package baas
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+func intPtr(i int) *int           { return &i }
+
+func TestValidateFields_CollectsAllErrors(t *testing.T) {
+	fields := []FieldDefinition{
+		{Name: "title", DisplayName: "标题", Type: "string", Required: true, MaxLength: intPtr(5)},
+		{Name: "code", Type: "string", Pattern: `^[A-Z]{3}$`},
+		{Name: "price", Type: "number", Min: floatPtr(0)},
+		{Name: "status", Type: "enum", Options: []interface{}{"draft", "published"}},
+		{Name: "birthday", Type: "date"},
+		{Name: "location", Type: "geopoint"},
+		{Name: "address", Type: "object", Fields: []FieldDefinition{
+			{Name: "city", Type: "string", Required: true},
+		}},
+	}
+
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"title": "too long title",
+		"code": "abc",
+		"price": -1,
+		"status": "deleted",
+		"birthday": "2024/01/01",
+		"location": {"lat": 91, "lng": 0},
+		"address": {}
+	}`), &data)
+
+	errs := validateFields(fields, data)
+	want := []string{"title", "code", "price", "status", "birthday", "location", "address.city"}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, path := range want {
+		if errs[i].Path != path {
+			t.Errorf("Expected error %d on %s, got %s", i, path, errs[i].Path)
+		}
+	}
+}
+
+func TestValidateFields_Valid(t *testing.T) {
+	fields := []FieldDefinition{
+		{Name: "status", Type: "enum", Options: []interface{}{"draft", float64(1)}},
+		{Name: "published_at", Type: "datetime"},
+		{Name: "location", Type: "geopoint"},
+		{Name: "author", Type: "reference", Reference: "users"},
+	}
+
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"status": 1,
+		"published_at": "2024-05-01T08:00:00+08:00",
+		"location": {"lat": 31.2, "lng": 121.5},
+		"author": 12
+	}`), &data)
+
+	if errs := validateFields(fields, data); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
+
+func TestValidateFieldDefinitions(t *testing.T) {
+	invalid := [][]FieldDefinition{
+		{{Name: "a", Type: "unknown"}},
+		{{Name: "a", Type: "enum"}},
+		{{Name: "a", Type: "reference"}},
+		{{Name: "a", Type: "reference", Reference: "b", OnDelete: "ignore"}},
+		{{Name: "a", Type: "string", Pattern: "("}},
+		{{Name: "a", Type: "number", Min: floatPtr(2), Max: floatPtr(1)}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "object", Fields: []FieldDefinition{{Name: "bad name"}}}},
+	}
+	for i, fields := range invalid {
+		if err := validateFieldDefinitions(fields); err == nil {
+			t.Errorf("Expected definition %d to be rejected", i)
+		}
+	}
+}
@@ -1,26 +1,715 @@
+// Package config APP远程配置：草稿编辑、发布、变更历史与客户端拉取
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/response"
+	"app-platform-backend/internal/validator"
+
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 配置值类型
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeJSON   = "json"
+)
+
+// 历史记录操作类型
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpPublish = "publish"
+	OpDelete  = "delete"
 )
 
+// maxValueSize 单个配置值的最大字节数
+const maxValueSize = 64 << 10
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,128}$`)
+
+// errConflict 配置键已存在
+var errConflict = errors.New("config key exists")
+
+var db *gorm.DB
+
+func InitDB(database *gorm.DB) {
+	db = database
+}
+
+// MigrateDB 迁移配置数据表
+func MigrateDB(database *gorm.DB) error {
+	return database.AutoMigrate(&model.Config{}, &model.ConfigHistory{}, &Exposure{})
+}
+
+// normalizeValue 按类型校验配置值，返回紧凑的 JSON 文本
+func normalizeValue(valueType string, raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", errors.New("value 不能为空")
+	}
+	if len(raw) > maxValueSize {
+		return "", fmt.Errorf("value 不能超过 %dKB", maxValueSize>>10)
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", errors.New("value 不是合法的 JSON")
+	}
+
+	ok := false
+	switch valueType {
+	case TypeString:
+		_, ok = value.(string)
+	case TypeNumber:
+		_, ok = value.(json.Number)
+	case TypeBool:
+		_, ok = value.(bool)
+	case TypeJSON:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			ok = true
+		}
+	default:
+		return "", fmt.Errorf("value_type 无效，可选值: %s、%s、%s、%s", TypeString, TypeNumber, TypeBool, TypeJSON)
+	}
+	if !ok {
+		if valueType == TypeJSON {
+			return "", errors.New("json 类型的值必须是对象或数组")
+		}
+		return "", fmt.Errorf("value 应为 %s 类型", valueType)
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return "", errors.New("value 不是合法的 JSON")
+	}
+	return compact.String(), nil
+}
+
+// configView 管理端展示的配置，值与变体以原始 JSON 返回
+type configView struct {
+	model.Config
+	Value             json.RawMessage `json:"value"`
+	PublishedValue    json.RawMessage `json:"published_value"`
+	Variants          []Variant       `json:"variants"`
+	PublishedVariants []Variant       `json:"published_variants"`
+}
+
+func viewOf(cfg *model.Config) configView {
+	v := configView{Config: *cfg, Value: json.RawMessage(cfg.ConfigValue)}
+	v.Variants, _ = decodeVariants(cfg.Variants)
+	if cfg.PublishedValue != nil {
+		v.PublishedValue = json.RawMessage(*cfg.PublishedValue)
+	}
+	if cfg.PublishedVariants != nil {
+		v.PublishedVariants, _ = decodeVariants(*cfg.PublishedVariants)
+	}
+	return v
+}
+
+// prepareVariants 校验变体并确认引用的分群属于该APP，返回序列化结果
+func prepareVariants(c *gin.Context, appID uint, valueType string, variants []Variant) (string, bool) {
+	if err := validateVariants(valueType, variants); err != nil {
+		response.ParamError(c, err.Error())
+		return "", false
+	}
+	for _, v := range variants {
+		if v.SegmentID == 0 {
+			continue
+		}
+		var count int64
+		if err := db.Model(&segmentapi.Segment{}).Where("id = ? AND app_id = ?", v.SegmentID, appID).Count(&count).Error; err != nil {
+			response.DBError(c, err)
+			return "", false
+		}
+		if count == 0 {
+			response.ParamError(c, fmt.Sprintf("变体 %s 引用的分群 %d 不存在", v.Name, v.SegmentID))
+			return "", false
+		}
+	}
+	return encodeVariants(variants), true
+}
+
+// operatorID 当前管理员ID，未登录时为空
+func operatorID(c *gin.Context) *uint {
+	if id := c.GetUint("user_id"); id > 0 {
+		return &id
+	}
+	return nil
+}
+
+// record 写入一条配置变更历史
+func record(tx *gorm.DB, cfg *model.Config, operation, value string, operator *uint) error {
+	return tx.Create(&model.ConfigHistory{
+		AppID:       cfg.AppID,
+		ConfigID:    cfg.ID,
+		ConfigKey:   cfg.ConfigKey,
+		ValueType:   cfg.ValueType,
+		ConfigValue: value,
+		Variants:    cfg.Variants,
+		Version:     cfg.Version,
+		OperatorID:  operator,
+		Operation:   operation,
+	}).Error
+}
+
+// List 配置列表
 func List(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "data": []interface{}{}})
+	appID := c.Query("app_id")
+	if appID == "" {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	query := db.Model(&model.Config{}).Where("app_id = ?", appID)
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("config_key LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	// status: published 已发布, unpublished 从未发布, draft 有待发布的修改
+	switch c.Query("status") {
+	case "published":
+		query = query.Where("is_published = ?", 1)
+	case "unpublished":
+		query = query.Where("is_published = ?", 0)
+	case "draft":
+		query = query.Where("has_draft = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var configs []model.Config
+	if err := query.Offset((page - 1) * size).Limit(size).Order("config_key ASC").Find(&configs).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	list := make([]configView, 0, len(configs))
+	for i := range configs {
+		list = append(list, viewOf(&configs[i]))
+	}
+	response.PageSuccess(c, list, total, page, size)
+}
+
+// find 按路由参数查找配置，app_id 参数存在时同时校验归属
+func find(c *gin.Context) (*model.Config, bool) {
+	id, err := validator.ValidateID(c.Param("id"))
+	if err != nil {
+		response.ParamError(c, "无效的配置ID")
+		return nil, false
+	}
+
+	query := db.Where("id = ?", id)
+	if appID := c.Query("app_id"); appID != "" {
+		query = query.Where("app_id = ?", appID)
+	}
+	var cfg model.Config
+	if err := query.First(&cfg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "配置不存在或无权限操作")
+			return nil, false
+		}
+		response.DBError(c, err)
+		return nil, false
+	}
+	return &cfg, true
 }
 
+// Detail 配置详情
+func Detail(c *gin.Context) {
+	cfg, ok := find(c)
+	if !ok {
+		return
+	}
+	response.Success(c, viewOf(cfg))
+}
+
+// Create 创建配置，新配置为草稿，发布后客户端可见
 func Create(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Config created"})
+	var req struct {
+		AppID       uint            `json:"app_id" binding:"required"`
+		Key         string          `json:"key" binding:"required"`
+		ValueType   string          `json:"value_type"`
+		Value       json.RawMessage `json:"value"`
+		Variants    []Variant       `json:"variants"`
+		Description string          `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if !keyPattern.MatchString(req.Key) {
+		response.ParamError(c, "配置键只能包含字母、数字、下划线、点和连字符，长度1-128")
+		return
+	}
+	if req.ValueType == "" {
+		req.ValueType = TypeString
+	}
+	value, err := normalizeValue(req.ValueType, req.Value)
+	if err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+	variants, ok := prepareVariants(c, req.AppID, req.ValueType, req.Variants)
+	if !ok {
+		return
+	}
+
+	var cfg model.Config
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 唯一索引包含已删除的配置，同名配置删除后再创建时复用原记录
+		var existing model.Config
+		err := tx.Unscoped().Where("app_id = ? AND config_key = ?", req.AppID, req.Key).First(&existing).Error
+		switch {
+		case err == nil && !existing.DeletedAt.Valid:
+			return errConflict
+		case err == nil:
+			cfg = existing
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		cfg.AppID = req.AppID
+		cfg.ConfigKey = req.Key
+		cfg.ValueType = req.ValueType
+		cfg.ConfigValue = value
+		cfg.PublishedValue = nil
+		cfg.Variants = variants
+		cfg.PublishedVariants = nil
+		cfg.Description = req.Description
+		cfg.IsPublished = 0
+		cfg.HasDraft = true
+		cfg.PublishedAt = nil
+		cfg.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Save(&cfg).Error; err != nil {
+			return err
+		}
+		return record(tx, &cfg, OpCreate, value, operatorID(c))
+	})
+	if errors.Is(err, errConflict) {
+		response.Conflict(c, "配置键已存在")
+		return
+	}
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, viewOf(&cfg), "配置创建成功")
 }
 
+// Update 修改配置草稿，需发布后客户端才能看到新值
 func Update(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Config updated"})
+	cfg, ok := find(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ValueType   string          `json:"value_type"`
+		Value       json.RawMessage `json:"value"`
+		Variants    *[]Variant      `json:"variants"` // 传入时整体替换，[] 表示清空
+		Description *string         `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	valueType := cfg.ValueType
+	if req.ValueType != "" {
+		valueType = req.ValueType
+	}
+	value := cfg.ConfigValue
+	if len(req.Value) > 0 {
+		normalized, err := normalizeValue(valueType, req.Value)
+		if err != nil {
+			response.ParamError(c, err.Error())
+			return
+		}
+		value = normalized
+	} else if valueType != cfg.ValueType {
+		response.ParamError(c, "修改 value_type 时必须同时提供 value")
+		return
+	}
+
+	// 修改类型时未传入变体，也需按新类型重新校验已有变体
+	variants := cfg.Variants
+	if req.Variants != nil || valueType != cfg.ValueType {
+		list, err := decodeVariants(cfg.Variants)
+		if err != nil {
+			response.ServerError(c, "已保存的变体数据损坏")
+			return
+		}
+		if req.Variants != nil {
+			list = *req.Variants
+		}
+		if variants, ok = prepareVariants(c, cfg.AppID, valueType, list); !ok {
+			return
+		}
+	}
+
+	changed := valueType != cfg.ValueType || value != cfg.ConfigValue || variants != cfg.Variants
+	if !changed && req.Description == nil {
+		response.SuccessWithMessage(c, viewOf(cfg), "配置无变更")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{}
+		if changed {
+			updates["value_type"] = valueType
+			updates["config_value"] = value
+			updates["variants"] = variants
+			updates["has_draft"] = true
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if err := tx.Model(cfg).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		cfg.ValueType, cfg.ConfigValue, cfg.Variants, cfg.HasDraft = valueType, value, variants, true
+		return record(tx, cfg, OpUpdate, value, operatorID(c))
+	})
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+	if req.Description != nil {
+		cfg.Description = *req.Description
+	}
+
+	response.SuccessWithMessage(c, viewOf(cfg), "配置更新成功")
+}
+
+// Delete 删除配置，已发布的值立即对客户端失效
+func Delete(c *gin.Context) {
+	cfg, ok := find(c)
+	if !ok {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(cfg).Error; err != nil {
+			return err
+		}
+		return record(tx, cfg, OpDelete, cfg.ConfigValue, operatorID(c))
+	})
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+	response.SuccessWithMessage(c, nil, "配置删除成功")
+}
+
+// publish 在事务中发布已锁定的配置草稿
+func publish(tx *gorm.DB, cfg *model.Config, operator *uint, now time.Time) error {
+	cfg.PublishedValue = &cfg.ConfigValue
+	cfg.PublishedVariants = &cfg.Variants
+	cfg.IsPublished = 1
+	cfg.HasDraft = false
+	cfg.Version++
+	cfg.PublishedAt = &now
+	if err := tx.Model(cfg).Updates(map[string]interface{}{
+		"published_value":    cfg.ConfigValue,
+		"published_variants": cfg.Variants,
+		"is_published":       1,
+		"has_draft":          false,
+		"version":            cfg.Version,
+		"published_at":       now,
+	}).Error; err != nil {
+		return err
+	}
+	return record(tx, cfg, OpPublish, cfg.ConfigValue, operator)
 }
 
+// Publish 发布单个配置的草稿
 func Publish(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Config published"})
+	cfg, ok := find(c)
+	if !ok {
+		return
+	}
+
+	var published bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 加锁后重新读取，避免发布与并发修改交错
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(cfg, cfg.ID).Error; err != nil {
+			return err
+		}
+		if !cfg.HasDraft {
+			return nil
+		}
+		published = true
+		return publish(tx, cfg, operatorID(c), time.Now())
+	})
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+	if !published {
+		response.ParamError(c, "配置没有待发布的修改")
+		return
+	}
+
+	response.SuccessWithMessage(c, viewOf(cfg), "配置发布成功")
+}
+
+// PublishAll 批量发布APP的配置草稿，未指定 ids 时发布全部草稿
+// 同一事务内完成，客户端不会拉取到发布一半的配置
+func PublishAll(c *gin.Context) {
+	var req struct {
+		AppID uint   `json:"app_id" binding:"required"`
+		IDs   []uint `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	var keys []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("app_id = ? AND has_draft = ?", req.AppID, true)
+		if len(req.IDs) > 0 {
+			query = query.Where("id IN ?", req.IDs)
+		}
+		var drafts []model.Config
+		if err := query.Order("id ASC").Find(&drafts).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		operator := operatorID(c)
+		for i := range drafts {
+			if err := publish(tx, &drafts[i], operator, now); err != nil {
+				return err
+			}
+			keys = append(keys, drafts[i].ConfigKey)
+		}
+		return nil
+	})
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, gin.H{"published": len(keys), "keys": keys}, fmt.Sprintf("已发布 %d 个配置", len(keys)))
 }
 
+// History 配置变更历史
 func History(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "data": []interface{}{}})
+	id, err := validator.ValidateID(c.Param("id"))
+	if err != nil {
+		response.ParamError(c, "无效的配置ID")
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	// 已删除的配置仍可查看历史
+	query := db.Model(&model.ConfigHistory{}).Where("config_id = ?", id)
+	if appID := c.Query("app_id"); appID != "" {
+		query = query.Where("app_id = ?", appID)
+	}
+	if operation := c.Query("operation"); operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var histories []model.ConfigHistory
+	if err := query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&histories).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.PageSuccess(c, histories, total, page, size)
+}
+
+// published 客户端可见的已发布配置
+type published struct {
+	ID                uint
+	ConfigKey         string
+	Version           int
+	PublishedValue    string
+	PublishedVariants *string
+}
+
+// resolved 按请求方解析后的配置集合
+type resolved struct {
+	values    map[string]json.RawMessage
+	variants  map[string]string // 配置了变体的键实际下发的变体名
+	exposures []exposureKey     // 配置了变体的键的曝光，由 Fetch 按是否实际下发决定是否计数
+}
+
+// resolve 读取APP全部已发布配置并按请求方匹配变体
+func resolve(appID uint, aud *audience) (*resolved, error) {
+	var rows []published
+	err := db.Model(&model.Config{}).
+		Select("id, config_key, version, published_value, published_variants").
+		Where("app_id = ? AND is_published = ?", appID, 1).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	day := time.Now().Format("2006-01-02")
+	result := &resolved{
+		values:   make(map[string]json.RawMessage, len(rows)),
+		variants: make(map[string]string),
+	}
+	for _, row := range rows {
+		result.values[row.ConfigKey] = json.RawMessage(row.PublishedValue)
+		if row.PublishedVariants == nil || *row.PublishedVariants == "" {
+			continue
+		}
+		variants, err := decodeVariants(*row.PublishedVariants)
+		if err != nil {
+			log.Printf("[Config] Invalid variants on config %d: %v", row.ID, err)
+			continue
+		}
+
+		name := DefaultVariant
+		variant, bucket := evaluate(row.ConfigKey, variants, aud)
+		if variant != nil {
+			name = variant.Name
+			result.values[row.ConfigKey] = variant.Value
+		}
+		result.variants[row.ConfigKey] = name
+		result.exposures = append(result.exposures, exposureKey{
+			appID:    appID,
+			configID: row.ID,
+			version:  row.Version,
+			day:      day,
+			variant:  name,
+			bucket:   reportBucket(bucket),
+		})
+	}
+	return result, nil
+}
+
+// etagOf 按键排序后对下发内容取哈希，内容不变时 ETag 不变
+func etagOf(r *resolved) string {
+	keys := make([]string, 0, len(r.values))
+	for key := range r.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(r.values[key])
+		h.Write([]byte{0})
+		h.Write([]byte(r.variants[key]))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches 判断 If-None-Match 是否命中当前 ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch 客户端拉取已发布配置
+// 变体在服务端按 X-App-User-Token 声明的用户与 app_version 参数匹配，
+// 携带 If-None-Match 且下发内容未变化时返回 304，SDK 可低成本轮询；
+// 已声明用户的曝光每天每个变体只计一次，未声明用户的请求只在实际下发内容（非 304）时计数
+func Fetch(c *gin.Context) {
+	appID, ok := middleware.BoundAppID(c)
+	if !ok {
+		response.Unauthorized(c, "缺少APP签名认证")
+		return
+	}
+
+	aud := &audience{appVersion: c.Query("app_version")}
+	if user, ok := middleware.GetAppUser(c); ok {
+		aud.userID = user.ID
+		// 同一请求内分群成员关系只查询一次
+		membership := make(map[uint]bool)
+		aud.inSegment = func(segmentID uint) bool {
+			member, seen := membership[segmentID]
+			if !seen {
+				var err error
+				if member, err = segmentapi.Contains(db, appID, segmentID, user.ID); err != nil {
+					log.Printf("[Config] Check segment %d failed: %v", segmentID, err)
+				}
+				membership[segmentID] = member
+			}
+			return member
+		}
+	}
+
+	result, err := resolve(appID, aud)
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	etag := etagOf(result)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	notModified := false
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, etag) {
+		notModified = true
+	}
+	for _, key := range result.exposures {
+		if aud.userID != 0 {
+			exposures.addOnce(key, aud.userID)
+		} else if !notModified {
+			exposures.add(key)
+		}
+	}
+	if notModified {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"configs":  result.values,
+		"variants": result.variants,
+		"etag":     etag,
+	})
 }
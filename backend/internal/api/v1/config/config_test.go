@@ -0,0 +1,63 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	cases := []struct {
+		valueType string
+		raw       string
+		want      string
+		ok        bool
+	}{
+		{TypeString, `"hello"`, `"hello"`, true},
+		{TypeString, `12`, "", false},
+		{TypeNumber, ` 12.50 `, `12.50`, true},
+		{TypeNumber, `"12"`, "", false},
+		{TypeBool, `false`, `false`, true},
+		{TypeBool, `"true"`, "", false},
+		{TypeJSON, `{ "a": [1, 2] }`, `{"a":[1,2]}`, true},
+		{TypeJSON, `"{}"`, "", false},
+		{TypeJSON, `{"a":`, "", false},
+		{"date", `"2024-01-01"`, "", false},
+		{TypeString, ``, "", false},
+	}
+	for _, tc := range cases {
+		got, err := normalizeValue(tc.valueType, json.RawMessage(tc.raw))
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("normalizeValue(%s, %s) = %q, %v", tc.valueType, tc.raw, got, err)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	a := &resolved{values: map[string]json.RawMessage{"theme": json.RawMessage(`"dark"`), "limit": json.RawMessage(`10`)}}
+	b := &resolved{values: map[string]json.RawMessage{"limit": json.RawMessage(`10`), "theme": json.RawMessage(`"dark"`)}}
+	if etagOf(a) != etagOf(b) {
+		t.Error("etag should not depend on map order")
+	}
+	b.variants = map[string]string{"limit": "treatment"}
+	if etagOf(a) == etagOf(b) {
+		t.Error("etag should change with variant")
+	}
+	b.values["limit"] = json.RawMessage(`11`)
+	b.variants = nil
+	if etagOf(a) == etagOf(b) {
+		t.Error("etag should change with values")
+	}
+
+	etag := etagOf(a)
+	for header, want := range map[string]bool{
+		etag:               true,
+		"W/" + etag:        true,
+		`"other", ` + etag: true,
+		"*":                true,
+		`"other"`:          false,
+	} {
+		if etagMatches(header, etag) != want {
+			t.Errorf("etagMatches(%s) != %v", header, want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"app-platform-backend/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	exposureFlushPeriod = 30 * time.Second
+	// reportBuckets 曝光报表的分桶粒度，每桶对应 1% 用户
+	reportBuckets = 100
+	// maxExposureSeen 当天已计数用户的去重记录上限，超出后清空重新记录
+	maxExposureSeen = 1000000
+)
+
+// Exposure 配置变体曝光计数，按天、发布版本、变体与分桶聚合
+// Bucket 为 0-99 的百分位分桶，-1 表示未声明用户的请求
+type Exposure struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	AppID     uint      `gorm:"index" json:"app_id"`
+	ConfigID  uint      `gorm:"uniqueIndex:idx_config_exposure,priority:1" json:"config_id"`
+	Version   int       `gorm:"uniqueIndex:idx_config_exposure,priority:2" json:"version"`
+	Day       string    `gorm:"size:10;uniqueIndex:idx_config_exposure,priority:3" json:"day"`
+	Variant   string    `gorm:"size:64;uniqueIndex:idx_config_exposure,priority:4" json:"variant"`
+	Bucket    int       `gorm:"uniqueIndex:idx_config_exposure,priority:5" json:"bucket"`
+	Count     int64     `json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 曝光表名
+func (Exposure) TableName() string {
+	return "config_exposures"
+}
+
+type exposureKey struct {
+	appID    uint
+	configID uint
+	version  int
+	day      string
+	variant  string
+	bucket   int
+}
+
+// seenKey 已计数的用户曝光，去重记录只保留当天
+type seenKey struct {
+	exposureKey
+	userID uint
+}
+
+// ExposureRecorder 在内存中累计曝光并定期批量写入，避免每次拉取都写库
+// 用户去重在每个实例内进行，多实例部署时同一用户在不同实例上可能各计一次
+type ExposureRecorder struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	counts  map[exposureKey]int64
+	seen    map[seenKey]struct{}
+	seenDay string
+	once    sync.Once
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+var exposures *ExposureRecorder
+
+// StartExposureRecorder 启动全局曝光记录器
+func StartExposureRecorder() {
+	if exposures == nil {
+		exposures = &ExposureRecorder{
+			db:      db,
+			counts:  make(map[exposureKey]int64),
+			seen:    make(map[seenKey]struct{}),
+			stopped: make(chan struct{}),
+			done:    make(chan struct{}),
+		}
+	}
+	exposures.Start()
+}
+
+// StopExposureRecorder 停止全局曝光记录器并写入剩余计数
+func StopExposureRecorder() {
+	if exposures != nil {
+		exposures.Stop()
+	}
+}
+
+// Start 启动定期写入协程
+func (r *ExposureRecorder) Start() {
+	r.once.Do(func() {
+		go r.loop()
+		log.Println("[Config] Exposure recorder started")
+	})
+}
+
+// Stop 停止记录器并写入剩余的计数
+func (r *ExposureRecorder) Stop() {
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+		<-r.done
+	}
+}
+
+func (r *ExposureRecorder) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(exposureFlushPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopped:
+			r.flush()
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+// add 累计一次曝光，记录器未启动时忽略
+func (r *ExposureRecorder) add(key exposureKey) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.counts[key]++
+	r.mu.Unlock()
+}
+
+// addOnce 累计用户的一次曝光，同一用户当天对同一发布版本的同一变体只计一次
+func (r *ExposureRecorder) addOnce(key exposureKey, userID uint) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seenDay != key.day || len(r.seen) >= maxExposureSeen {
+		r.seen = make(map[seenKey]struct{})
+		r.seenDay = key.day
+	}
+	seen := seenKey{exposureKey: key, userID: userID}
+	if _, ok := r.seen[seen]; ok {
+		return
+	}
+	r.seen[seen] = struct{}{}
+	r.counts[key]++
+}
+
+// flush 将累计的计数叠加写入数据库，失败的计数放回下一轮
+func (r *ExposureRecorder) flush() {
+	r.mu.Lock()
+	counts := r.counts
+	r.counts = make(map[exposureKey]int64)
+	r.mu.Unlock()
+	if len(counts) == 0 {
+		return
+	}
+
+	rows := make([]Exposure, 0, len(counts))
+	for key, count := range counts {
+		rows = append(rows, Exposure{
+			AppID:    key.appID,
+			ConfigID: key.configID,
+			Version:  key.version,
+			Day:      key.day,
+			Variant:  key.variant,
+			Bucket:   key.bucket,
+			Count:    count,
+		})
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      gorm.Expr("count + VALUES(count)"),
+			"updated_at": gorm.Expr("VALUES(updated_at)"),
+		}),
+	}).CreateInBatches(rows, 200).Error
+	if err != nil {
+		log.Printf("[Config] Flush exposures failed: %v", err)
+		r.mu.Lock()
+		for key, count := range counts {
+			r.counts[key] += count
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Exposures 配置变体曝光报表
+// 返回各变体的曝光总数，以及每个百分位分桶内各变体的曝光数
+func Exposures(c *gin.Context) {
+	cfg, ok := find(c)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 90 {
+		response.ParamError(c, "days 应在 1-90 之间")
+		return
+	}
+	version := cfg.Version
+	if v := c.Query("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil {
+			response.ParamError(c, "无效的 version")
+			return
+		}
+	}
+	since := time.Now().AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+
+	var rows []struct {
+		Variant string
+		Bucket  int
+		Count   int64
+	}
+	err = db.Model(&Exposure{}).
+		Select("variant, bucket, SUM(count) AS count").
+		Where("config_id = ? AND version = ? AND day >= ?", cfg.ID, version, since).
+		Group("variant, bucket").
+		Scan(&rows).Error
+	if err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	type bucketReport struct {
+		Bucket   int              `json:"bucket"`
+		Variants map[string]int64 `json:"variants"`
+	}
+	totals := make(map[string]int64)
+	byBucket := make(map[int]map[string]int64)
+	for _, row := range rows {
+		totals[row.Variant] += row.Count
+		if byBucket[row.Bucket] == nil {
+			byBucket[row.Bucket] = make(map[string]int64)
+		}
+		byBucket[row.Bucket][row.Variant] += row.Count
+	}
+	buckets := make([]bucketReport, 0, len(byBucket))
+	for bucket, variants := range byBucket {
+		buckets = append(buckets, bucketReport{Bucket: bucket, Variants: variants})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket < buckets[j].Bucket })
+
+	response.Success(c, gin.H{
+		"config_id":  cfg.ID,
+		"config_key": cfg.ConfigKey,
+		"version":    version,
+		"since":      since,
+		"variants":   totals,
+		"buckets":    buckets,
+	})
+}
+
+// reportBucket 将用户分桶折算为报表的百分位分桶
+func reportBucket(bucket int) int {
+	if bucket < 0 {
+		return -1
+	}
+	return bucket * reportBuckets / bucketCount
+}
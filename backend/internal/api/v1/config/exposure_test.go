@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestExposureRecorderAddOnce(t *testing.T) {
+	r := &ExposureRecorder{counts: make(map[exposureKey]int64), seen: make(map[seenKey]struct{})}
+	key := exposureKey{appID: 1, configID: 2, version: 3, day: "2026-10-18", variant: "blue", bucket: 5}
+
+	r.addOnce(key, 7)
+	r.addOnce(key, 7)
+	r.addOnce(key, 8)
+	if got := r.counts[key]; got != 2 {
+		t.Errorf("count = %d, want 2 (one per user)", got)
+	}
+
+	// 变体或发布版本变化时重新计数
+	other := key
+	other.variant = "red"
+	r.addOnce(other, 7)
+	if got := r.counts[other]; got != 1 {
+		t.Errorf("count of new variant = %d, want 1", got)
+	}
+
+	// 新的一天重新计数
+	next := key
+	next.day = "2026-10-19"
+	r.addOnce(next, 7)
+	if got := r.counts[next]; got != 1 || len(r.seen) != 1 {
+		t.Errorf("count on next day = %d, seen = %d, want 1 and 1", got, len(r.seen))
+	}
+
+	// 记录器未启动时忽略
+	var nilRecorder *ExposureRecorder
+	nilRecorder.addOnce(key, 7)
+}
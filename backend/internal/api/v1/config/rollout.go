@@ -0,0 +1,168 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+)
+
+// DefaultVariant 未命中任何变体时的变体名
+const DefaultVariant = "default"
+
+const (
+	maxVariants = 20
+	// bucketCount 用户分桶数，灰度比例精确到 0.01%
+	bucketCount = 10000
+)
+
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// Variant 配置的条件变体
+// 变体按顺序匹配，第一个满足全部条件的变体生效，都不满足时下发默认值。
+// 设置了 Percentage 的变体依次占用连续的分桶区间：10% 的 B 与 20% 的 C
+// 分别命中 [0%, 10%) 与 [10%, 30%)，互不重叠。
+type Variant struct {
+	Name          string          `json:"name"`
+	Value         json.RawMessage `json:"value"`
+	Percentage    *float64        `json:"percentage,omitempty"`      // 灰度比例 (0, 100]
+	MinAppVersion string          `json:"min_app_version,omitempty"` // APP版本下限（含）
+	MaxAppVersion string          `json:"max_app_version,omitempty"` // APP版本上限（含）
+	SegmentID     uint            `json:"segment_id,omitempty"`      // 用户所属分群，分群删除后不再命中
+}
+
+// validateVariants 校验变体定义并按配置类型规范化变体值
+func validateVariants(valueType string, variants []Variant) error {
+	if len(variants) > maxVariants {
+		return fmt.Errorf("变体数量不能超过 %d 个", maxVariants)
+	}
+	seen := make(map[string]bool, len(variants))
+	total := 0.0
+	for i := range variants {
+		v := &variants[i]
+		if !variantNamePattern.MatchString(v.Name) || v.Name == DefaultVariant {
+			return fmt.Errorf("变体名 %q 无效，只能包含字母、数字、下划线和连字符，且不能为 %s", v.Name, DefaultVariant)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("变体 %s 重复定义", v.Name)
+		}
+		seen[v.Name] = true
+
+		value, err := normalizeValue(valueType, v.Value)
+		if err != nil {
+			return fmt.Errorf("变体 %s: %s", v.Name, err.Error())
+		}
+		v.Value = json.RawMessage(value)
+
+		if v.Percentage == nil && v.MinAppVersion == "" && v.MaxAppVersion == "" && v.SegmentID == 0 {
+			return fmt.Errorf("变体 %s 至少需要一个条件（percentage、min_app_version、max_app_version、segment_id）", v.Name)
+		}
+		if p := v.Percentage; p != nil {
+			if *p <= 0 || *p > 100 || math.Abs(math.Round(*p*100)-*p*100) > 1e-6 {
+				return fmt.Errorf("变体 %s 的 percentage 应在 0-100 之间，最多两位小数", v.Name)
+			}
+			total += *p
+		}
+		if v.MinAppVersion != "" && v.MaxAppVersion != "" &&
+			segmentapi.CompareVersions(v.MinAppVersion, v.MaxAppVersion) > 0 {
+			return fmt.Errorf("变体 %s 的 min_app_version 不能大于 max_app_version", v.Name)
+		}
+	}
+	if math.Round(total*100) > 100*100 {
+		return errors.New("各变体 percentage 之和不能超过 100")
+	}
+	return nil
+}
+
+// encodeVariants 序列化变体，无变体时为空串
+func encodeVariants(variants []Variant) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(variants)
+	return string(data)
+}
+
+// decodeVariants 反序列化已保存的变体
+func decodeVariants(data string) ([]Variant, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var variants []Variant
+	if err := json.Unmarshal([]byte(data), &variants); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// bucketOf 按配置键与用户ID哈希分桶，同一用户在同一配置下的分桶稳定，
+// 不同配置之间相互独立
+func bucketOf(key string, userID uint) int {
+	sum := sha256.Sum256([]byte(key + ":" + strconv.FormatUint(uint64(userID), 10)))
+	return int(binary.BigEndian.Uint32(sum[:4]) % bucketCount)
+}
+
+// audience 变体匹配所需的请求方信息
+type audience struct {
+	userID     uint // 0 表示未声明用户，比例与分群条件均不命中
+	appVersion string
+	inSegment  func(segmentID uint) bool
+}
+
+// evaluate 返回命中的变体（nil 表示默认值）与用户分桶（匿名为 -1）
+func evaluate(key string, variants []Variant, aud *audience) (*Variant, int) {
+	bucket := -1
+	if aud.userID > 0 {
+		bucket = bucketOf(key, aud.userID)
+	}
+
+	start := 0.0
+	for i := range variants {
+		v := &variants[i]
+		var lo, hi float64
+		if v.Percentage != nil {
+			lo, hi = start, start+*v.Percentage
+			start = hi
+		}
+		if matches(v, aud, bucket, lo, hi) {
+			return v, bucket
+		}
+	}
+	return nil, bucket
+}
+
+// matches 判断变体的全部条件是否满足，[lo, hi) 为变体占用的比例区间
+func matches(v *Variant, aud *audience, bucket int, lo, hi float64) bool {
+	if v.Percentage != nil {
+		if bucket < 0 {
+			return false
+		}
+		b := float64(bucket)
+		if b < math.Round(lo*bucketCount/100) || b >= math.Round(hi*bucketCount/100) {
+			return false
+		}
+	}
+	if v.MinAppVersion != "" || v.MaxAppVersion != "" {
+		if aud.appVersion == "" {
+			return false
+		}
+		if v.MinAppVersion != "" && segmentapi.CompareVersions(aud.appVersion, v.MinAppVersion) < 0 {
+			return false
+		}
+		if v.MaxAppVersion != "" && segmentapi.CompareVersions(aud.appVersion, v.MaxAppVersion) > 0 {
+			return false
+		}
+	}
+	if v.SegmentID > 0 {
+		if aud.userID == 0 || aud.inSegment == nil || !aud.inSegment(v.SegmentID) {
+			return false
+		}
+	}
+	return true
+}
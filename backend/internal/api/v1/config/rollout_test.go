@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func percent(p float64) *float64 { return &p }
+
+func TestEvaluatePercentages(t *testing.T) {
+	variants := []Variant{
+		{Name: "b", Value: json.RawMessage(`"B"`), Percentage: percent(10)},
+		{Name: "c", Value: json.RawMessage(`"C"`), Percentage: percent(20)},
+	}
+	counts := map[string]int{}
+	for id := uint(1); id <= 20000; id++ {
+		v, bucket := evaluate("home.banner", variants, &audience{userID: id})
+		name := DefaultVariant
+		if v != nil {
+			name = v.Name
+		}
+		counts[name]++
+
+		// 分桶确定：同一用户重复计算结果不变
+		if again, _ := evaluate("home.banner", variants, &audience{userID: id}); again != v {
+			t.Fatalf("user %d evaluated inconsistently", id)
+		}
+		if bucket < 0 || bucket >= bucketCount {
+			t.Fatalf("bucket %d out of range", bucket)
+		}
+	}
+	// 允许 ±1.5% 的抽样误差
+	for name, want := range map[string]int{"b": 2000, "c": 4000, DefaultVariant: 14000} {
+		if got := counts[name]; got < want-300 || got > want+300 {
+			t.Errorf("variant %s: got %d, want about %d", name, got, want)
+		}
+	}
+
+	if v, bucket := evaluate("home.banner", variants, &audience{}); v != nil || bucket != -1 {
+		t.Errorf("anonymous request should get default, got %v bucket %d", v, bucket)
+	}
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	variants := []Variant{
+		{Name: "vip", Value: json.RawMessage(`3`), SegmentID: 9},
+		{Name: "new_app", Value: json.RawMessage(`2`), MinAppVersion: "2.3"},
+	}
+	inVIP := func(id uint) bool { return id == 9 }
+
+	cases := []struct {
+		aud  audience
+		want string
+	}{
+		{audience{userID: 1, appVersion: "2.10.0", inSegment: inVIP}, "vip"},
+		{audience{userID: 1, appVersion: "2.10.0"}, "new_app"},
+		{audience{appVersion: "2.3"}, "new_app"},
+		{audience{userID: 1, appVersion: "2.2.9"}, DefaultVariant},
+		{audience{userID: 1}, DefaultVariant},
+	}
+	for i, tc := range cases {
+		name := DefaultVariant
+		if v, _ := evaluate("limit", variants, &tc.aud); v != nil {
+			name = v.Name
+		}
+		if name != tc.want {
+			t.Errorf("case %d: got %s, want %s", i, name, tc.want)
+		}
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	valid := []Variant{{Name: "b", Value: json.RawMessage(` 5 `), Percentage: percent(12.5)}}
+	if err := validateVariants(TypeNumber, valid); err != nil || string(valid[0].Value) != "5" {
+		t.Fatalf("valid variants: %v %s", err, valid[0].Value)
+	}
+
+	invalid := [][]Variant{
+		{{Name: DefaultVariant, Value: json.RawMessage(`1`), Percentage: percent(10)}},
+		{{Name: "b", Value: json.RawMessage(`"1"`), Percentage: percent(10)}},
+		{{Name: "b", Value: json.RawMessage(`1`)}},
+		{{Name: "b", Value: json.RawMessage(`1`), Percentage: percent(0.001)}},
+		{{Name: "b", Value: json.RawMessage(`1`), Percentage: percent(60)}, {Name: "c", Value: json.RawMessage(`2`), Percentage: percent(50)}},
+		{{Name: "b", Value: json.RawMessage(`1`), MinAppVersion: "3.0", MaxAppVersion: "2.9"}},
+		{{Name: "b", Value: json.RawMessage(`1`), SegmentID: 1}, {Name: "b", Value: json.RawMessage(`2`), SegmentID: 2}},
+	}
+	for i, variants := range invalid {
+		if err := validateVariants(TypeNumber, variants); err == nil {
+			t.Errorf("case %d should fail", i)
+		}
+	}
+}
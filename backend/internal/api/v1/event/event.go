@@ -1,6 +1,7 @@
 package event
 
 import (
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"encoding/json"
 	"net/http"
@@ -17,10 +18,27 @@ func InitDB(database *gorm.DB) {
 	db = database
 }
 
+// resolveUserID 解析事件所属的终端用户
+// 签名认证的客户端请求以 X-App-User-Token 声明的用户为准，请求体中的 user_id 与其不一致或未携带令牌时返回 false；
+// 管理端请求使用请求体中的 user_id
+func resolveUserID(c *gin.Context, requested *uint) (*uint, bool) {
+	if _, ok := middleware.BoundAppID(c); !ok {
+		return requested, true
+	}
+	user, ok := middleware.GetAppUser(c)
+	if !ok {
+		return nil, requested == nil
+	}
+	if requested != nil && *requested != user.ID {
+		return nil, false
+	}
+	return &user.ID, true
+}
+
 // Report 上报事件
 func Report(c *gin.Context) {
 	var req struct {
-		AppID      uint                   `json:"app_id" binding:"required"`
+		AppID      uint                   `json:"app_id"`
 		UserID     *uint                  `json:"user_id"`
 		EventCode  string                 `json:"event_code" binding:"required"`
 		EventName  string                 `json:"event_name"`
@@ -32,6 +50,18 @@ func Report(c *gin.Context) {
 		return
 	}
 
+	// 签名认证的客户端请求以绑定的APP为准
+	req.AppID = middleware.ResolveAppID(c, req.AppID)
+	if req.AppID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "app_id is required"})
+		return
+	}
+	userID, ok := resolveUserID(c, req.UserID)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "user_id must match the X-App-User-Token user"})
+		return
+	}
+
 	propertiesJSON := "{}"
 	if req.Properties != nil {
 		if data, err := json.Marshal(req.Properties); err == nil {
@@ -41,7 +71,7 @@ func Report(c *gin.Context) {
 
 	event := model.Event{
 		AppID:      req.AppID,
-		UserID:     req.UserID,
+		UserID:     userID,
 		EventCode:  req.EventCode,
 		EventName:  req.EventName,
 		Properties: propertiesJSON,
@@ -63,7 +93,7 @@ func Report(c *gin.Context) {
 // BatchReport 批量上报事件
 func BatchReport(c *gin.Context) {
 	var req struct {
-		AppID  uint `json:"app_id" binding:"required"`
+		AppID  uint `json:"app_id"`
 		Events []struct {
 			UserID     *uint                  `json:"user_id"`
 			EventCode  string                 `json:"event_code"`
@@ -77,11 +107,23 @@ func BatchReport(c *gin.Context) {
 		return
 	}
 
+	// 签名认证的客户端请求以绑定的APP为准
+	req.AppID = middleware.ResolveAppID(c, req.AppID)
+	if req.AppID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "app_id is required"})
+		return
+	}
+
 	var events []model.Event
 	clientIP := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 
 	for _, e := range req.Events {
+		userID, ok := resolveUserID(c, e.UserID)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "user_id must match the X-App-User-Token user"})
+			return
+		}
 		propertiesJSON := "{}"
 		if e.Properties != nil {
 			if data, err := json.Marshal(e.Properties); err == nil {
@@ -91,7 +133,7 @@ func BatchReport(c *gin.Context) {
 
 		events = append(events, model.Event{
 			AppID:      req.AppID,
-			UserID:     e.UserID,
+			UserID:     userID,
 			EventCode:  e.EventCode,
 			EventName:  e.EventName,
 			Properties: propertiesJSON,
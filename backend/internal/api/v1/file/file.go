@@ -1,6 +1,7 @@
 package file
 
 import (
+	"app-platform-backend/core/module"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/response"
 	"app-platform-backend/internal/validator"
@@ -49,9 +50,40 @@ var dangerousExtensions = map[string]bool{
 	".jsp": true, ".py":  true, ".rb":  true, ".pl":  true,
 }
 
-// 最大文件大小 (50MB)
+// 最大文件大小 (50MB)，APP未配置 max_size_mb 时使用
 const maxFileSize = 50 * 1024 * 1024
 
+// UploadConfig APP模块 file_upload 的上传限制配置
+type UploadConfig struct {
+	MaxSizeMB        int64    `json:"max_size_mb"`
+	AllowedMimeTypes []string `json:"allowed_mime_types"`
+}
+
+// maxSize 单个文件大小上限（字节）
+func (c UploadConfig) maxSize() int64 {
+	if c.MaxSizeMB <= 0 {
+		return maxFileSize
+	}
+	return c.MaxSizeMB * 1024 * 1024
+}
+
+// allows 判断MIME类型是否允许上传
+// APP配置的白名单只能在平台白名单内收窄，不能放开 text/html、SVG 等平台未允许的类型
+func (c UploadConfig) allows(mimeType string) bool {
+	if !allowedMimeTypes[mimeType] {
+		return false
+	}
+	if len(c.AllowedMimeTypes) == 0 {
+		return true
+	}
+	for _, t := range c.AllowedMimeTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
 func InitDB(database *gorm.DB) {
 	db = database
 	// 确保上传目录存在
@@ -79,9 +111,16 @@ func Upload(c *gin.Context) {
 	}
 	defer file.Close()
 
+	// 上传限制按APP的 file_upload 配置
+	cfg, err := module.AppConfig[UploadConfig](uint(appID), "file_upload")
+	if err != nil {
+		response.ServerError(c, "读取上传配置失败")
+		return
+	}
+
 	// 验证文件大小
-	if header.Size > maxFileSize {
-		response.ParamError(c, fmt.Sprintf("文件大小不能超过 %dMB", maxFileSize/1024/1024))
+	if header.Size > cfg.maxSize() {
+		response.ParamError(c, fmt.Sprintf("文件大小不能超过 %dMB", cfg.maxSize()/1024/1024))
 		return
 	}
 
@@ -92,7 +131,7 @@ func Upload(c *gin.Context) {
 	}
 
 	// 验证文件类型（白名单）
-	if !allowedMimeTypes[mimeType] {
+	if !cfg.allows(mimeType) {
 		response.ParamError(c, "不支持的文件类型: "+mimeType)
 		return
 	}
@@ -1,10 +1,14 @@
 package health
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
+	"app-platform-backend/core/module"
 	"app-platform-backend/internal/pkg/database"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +23,7 @@ type HealthStatus struct {
 	Uptime    float64                `json:"uptime"`
 	Version   string                 `json:"version"`
 	Checks    map[string]CheckResult `json:"checks"`
+	Modules   []module.HealthReport  `json:"modules"`
 	System    SystemInfo             `json:"system"`
 }
 
@@ -45,6 +50,10 @@ func Check(c *gin.Context) {
 	// 数据库检查
 	checks["database"] = checkDatabase()
 
+	// 模块检查
+	var reports []module.HealthReport
+	checks["modules"], reports = checkModules(c.Request.Context())
+
 	// 计算整体状态
 	overallStatus := "healthy"
 	for _, check := range checks {
@@ -64,6 +73,7 @@ func Check(c *gin.Context) {
 		Uptime:    time.Since(startTime).Seconds(),
 		Version:   "1.0.0",
 		Checks:    checks,
+		Modules:   reports,
 		System: SystemInfo{
 			GoVersion:    runtime.Version(),
 			NumGoroutine: runtime.NumGoroutine(),
@@ -118,6 +128,25 @@ func checkDatabase() CheckResult {
 	}
 }
 
+// checkModules 汇总各模块的健康检查结果
+func checkModules(ctx context.Context) (CheckResult, []module.HealthReport) {
+	start := time.Now()
+	reports := module.CheckHealth(ctx)
+
+	var unhealthy []string
+	for _, r := range reports {
+		if !r.Healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", r.Code, r.Message))
+		}
+	}
+	result := CheckResult{Status: "healthy", Latency: time.Since(start).Milliseconds()}
+	if len(unhealthy) > 0 {
+		result.Status = "unhealthy"
+		result.Message = strings.Join(unhealthy, "; ")
+	}
+	return result, reports
+}
+
 // Liveness 存活探针
 func Liveness(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -137,6 +166,17 @@ func Readiness(c *gin.Context) {
 		return
 	}
 
+	// 检查各模块
+	moduleCheck, reports := checkModules(c.Request.Context())
+	if moduleCheck.Status != "healthy" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "not ready",
+			"message": moduleCheck.Message,
+			"modules": reports,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ready",
 	})
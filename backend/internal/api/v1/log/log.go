@@ -1,6 +1,7 @@
 package log
 
 import (
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"net/http"
 	"strconv"
@@ -71,7 +72,7 @@ func List(c *gin.Context) {
 // Report 上报日志
 func Report(c *gin.Context) {
 	var req struct {
-		AppID   uint   `json:"app_id" binding:"required"`
+		AppID   uint   `json:"app_id"`
 		Level   string `json:"level"`
 		Module  string `json:"module"`
 		Message string `json:"message" binding:"required"`
@@ -83,6 +84,13 @@ func Report(c *gin.Context) {
 		return
 	}
 
+	// 签名认证的客户端请求以绑定的APP为准
+	req.AppID = middleware.ResolveAppID(c, req.AppID)
+	if req.AppID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "app_id is required"})
+		return
+	}
+
 	if req.Level == "" {
 		req.Level = "info"
 	}
@@ -110,7 +118,7 @@ func Report(c *gin.Context) {
 // BatchReport 批量上报日志
 func BatchReport(c *gin.Context) {
 	var req struct {
-		AppID uint `json:"app_id" binding:"required"`
+		AppID uint `json:"app_id"`
 		Logs  []struct {
 			Level   string `json:"level"`
 			Module  string `json:"module"`
@@ -124,6 +132,13 @@ func BatchReport(c *gin.Context) {
 		return
 	}
 
+	// 签名认证的客户端请求以绑定的APP为准
+	req.AppID = middleware.ResolveAppID(c, req.AppID)
+	if req.AppID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "app_id is required"})
+		return
+	}
+
 	var logs []model.Log
 	clientIP := c.ClientIP()
 	for _, l := range req.Logs {
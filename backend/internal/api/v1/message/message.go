@@ -1,6 +1,8 @@
 package message
 
 import (
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	templateapi "app-platform-backend/internal/api/v1/template"
 	"app-platform-backend/internal/model"
 	"net/http"
 	"strconv"
@@ -52,15 +54,19 @@ func Send(c *gin.Context) {
 	var req struct {
 		AppID   uint   `json:"app_id" binding:"required"`
 		UserID  *uint  `json:"user_id"`
-		Title   string `json:"title" binding:"required"`
-		Content string `json:"content" binding:"required"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
 		Type    string `json:"type"`
+		templateRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
+	if !req.render(c, req.AppID, &req.Title, &req.Content) {
+		return
+	}
 
 	if req.Type == "" {
 		req.Type = "system"
@@ -87,8 +93,28 @@ func Send(c *gin.Context) {
 	})
 }
 
-func Templates(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"code": 0, "data": []interface{}{}})
+// templateRequest 按模板发送消息的参数
+type templateRequest struct {
+	TemplateID uint                   `json:"template_id"`
+	Variables  map[string]interface{} `json:"variables"`
+	Locale     string                 `json:"locale"`
+}
+
+// render 指定模板时由服务端渲染标题与内容，失败时已写入响应
+func (r *templateRequest) render(c *gin.Context, appID uint, title, content *string) bool {
+	if r.TemplateID > 0 {
+		rendered, err := templateapi.Render(appID, templateapi.ChannelMessage, r.TemplateID, r.Locale, r.Variables)
+		if err != nil {
+			templateapi.RenderFailed(c, err)
+			return false
+		}
+		*title, *content = rendered.Title, rendered.Content
+	}
+	if *title == "" || *content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "title and content are required"})
+		return false
+	}
+	return true
 }
 
 func UnreadCount(c *gin.Context) {
@@ -270,22 +296,44 @@ func BatchDelete(c *gin.Context) {
 // BatchSend 批量发送消息
 func BatchSend(c *gin.Context) {
 	var req struct {
-		AppID   uint    `json:"app_id" binding:"required"`
-		UserIDs []uint  `json:"user_ids"`
-		Title   string  `json:"title" binding:"required"`
-		Content string  `json:"content" binding:"required"`
-		Type    string  `json:"type"`
+		AppID     uint   `json:"app_id" binding:"required"`
+		UserIDs   []uint `json:"user_ids"`
+		SegmentID uint   `json:"segment_id"`
+		Title     string `json:"title"`
+		Content   string `json:"content"`
+		Type      string `json:"type"`
+		templateRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
+	if !req.render(c, req.AppID, &req.Title, &req.Content) {
+		return
+	}
 
 	if req.Type == "" {
 		req.Type = "system"
 	}
 
+	// 按分群发送时展开为分群内的用户
+	if req.SegmentID > 0 {
+		users, err := segmentapi.Users(db, req.AppID, req.SegmentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		if err := users.Pluck("id", &req.UserIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "Failed to resolve segment users"})
+			return
+		}
+		if len(req.UserIDs) == 0 {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Segment has no users", "data": gin.H{"count": 0}})
+			return
+		}
+	}
+
 	var messages []model.Message
 	if len(req.UserIDs) == 0 {
 		// 发送给所有用户（广播）
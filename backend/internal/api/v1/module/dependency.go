@@ -0,0 +1,393 @@
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	coremodule "app-platform-backend/core/module"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// dependencyGraph 构建依赖图：已注册模块的声明 + module_templates 中同步的依赖
+// 只读取启用中的模板，Syncer 停用的孤立功能不再参与依赖解析
+func dependencyGraph(tx *gorm.DB) (*coremodule.DependencyGraph, map[string]string, error) {
+	g := coremodule.BuildDependencyGraph()
+	names := make(map[string]string)
+	for _, m := range coremodule.GetAllModules() {
+		meta := m.Meta()
+		names[meta.Code] = meta.Name
+		for _, fn := range m.GetFunctions() {
+			names[fn.Code] = fn.Name
+		}
+	}
+
+	var records []coremodule.ModuleTemplateRecord
+	if err := tx.Where("is_active = ?", true).Find(&records).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, record := range records {
+		var deps []string
+		if record.Dependencies != "" {
+			if err := json.Unmarshal([]byte(record.Dependencies), &deps); err != nil {
+				return nil, nil, fmt.Errorf("功能 %s 的依赖声明无效: %w", record.ModuleCode, err)
+			}
+		}
+		g.Add(record.ModuleCode, record.SourceModule, deps)
+		if _, ok := names[record.ModuleCode]; !ok {
+			names[record.ModuleCode] = record.ModuleName
+		}
+	}
+	return g, names, nil
+}
+
+// enabledSet 应用已启用的模块/功能
+type enabledSet map[string]bool
+
+func loadEnabled(tx *gorm.DB, appID uint) (enabledSet, error) {
+	var codes []string
+	if err := tx.Model(&model.AppModule{}).
+		Where("app_id = ? AND status = ?", appID, 1).
+		Pluck("module_code", &codes).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(enabledSet, len(codes))
+	for _, code := range codes {
+		enabled[code] = true
+	}
+	return enabled, nil
+}
+
+// provides 判断功能是否可用：功能本身或其所属模块已启用
+func (e enabledSet) provides(g *coremodule.DependencyGraph, code string) bool {
+	if e[code] {
+		return true
+	}
+	src := g.Source(code)
+	return src != "" && e[src]
+}
+
+// missingDependencies 返回未启用的传递依赖，按启用顺序排列
+func missingDependencies(g *coremodule.DependencyGraph, enabled enabledSet, code string) ([]string, []string, error) {
+	required, err := g.Closure(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	missing := []string{}
+	for _, dep := range required {
+		if !enabled.provides(g, dep) {
+			missing = append(missing, dep)
+		}
+	}
+	return required, missing, nil
+}
+
+// disableBlockers 返回禁用 code 后会失去依赖的已启用模块
+func disableBlockers(appID uint, code string) ([]string, error) {
+	db := database.GetDB()
+	g, _, err := dependencyGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	before, err := loadEnabled(db, appID)
+	if err != nil {
+		return nil, err
+	}
+	after := make(enabledSet, len(before))
+	for k := range before {
+		if k != code {
+			after[k] = true
+		}
+	}
+
+	blockers := []string{}
+	for _, dependent := range g.Dependents(code) {
+		if g.Source(dependent) == code || !after.provides(g, dependent) {
+			continue
+		}
+		required, err := g.Closure(dependent)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range required {
+			if before.provides(g, dep) && !after.provides(g, dep) {
+				blockers = append(blockers, dependent)
+				break
+			}
+		}
+	}
+	return blockers, nil
+}
+
+// enableCheck 检查启用 codes 后依赖是否满足，codes 之间可以互相提供依赖
+// 返回仍未启用的传递依赖（code => missing），存在循环依赖时返回 *CycleError
+func enableCheck(tx *gorm.DB, appID uint, codes []string) (map[string][]string, error) {
+	g, _, err := dependencyGraph(tx)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := loadEnabled(tx, appID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		enabled[code] = true
+	}
+
+	missing := make(map[string][]string)
+	for _, code := range codes {
+		_, deps, err := missingDependencies(g, enabled, code)
+		if err != nil {
+			return nil, err
+		}
+		if len(deps) > 0 {
+			missing[code] = deps
+		}
+	}
+	return missing, nil
+}
+
+// enableConflict 依赖不满足或存在循环依赖时写入 409 响应
+func enableConflict(c *gin.Context, appID uint, codes []string) bool {
+	missing, err := enableCheck(database.GetDB(), appID, codes)
+	if err != nil {
+		if !cycleConflict(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return true
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "存在未启用的依赖，请先启用它们或使用自动启用依赖",
+			"data":    gin.H{"missing": missing},
+		})
+		return true
+	}
+	return false
+}
+
+// disableConflict 仍有已启用的模块依赖 code 时写入 409 响应
+func disableConflict(c *gin.Context, appID uint, code string) bool {
+	blockers, err := disableBlockers(appID, code)
+	if err != nil {
+		if !cycleConflict(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return true
+	}
+	if len(blockers) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "以下已启用的模块依赖该模块，请先禁用它们",
+			"data":    gin.H{"dependents": blockers},
+		})
+		return true
+	}
+	return false
+}
+
+// cycleConflict 返回循环依赖错误
+func cycleConflict(c *gin.Context, err error) bool {
+	var cycle *coremodule.CycleError
+	if !errors.As(err, &cycle) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"code":    409,
+		"message": cycle.Error(),
+		"data":    gin.H{"path": cycle.Path},
+	})
+	return true
+}
+
+// CheckModuleDependencies 检查模块的依赖是否满足
+// missing 包含间接依赖，顺序即建议的启用顺序
+func CheckModuleDependencies(c *gin.Context) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+	db := database.GetDB()
+
+	g, names, err := dependencyGraph(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if !g.Known(moduleCode) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+		return
+	}
+	enabled, err := loadEnabled(db, appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	required, missing, err := missingDependencies(g, enabled, moduleCode)
+	if err != nil {
+		if !cycleConflict(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return
+	}
+
+	suggestions := make([]string, 0, len(missing))
+	for _, code := range missing {
+		suggestions = append(suggestions, fmt.Sprintf("启用 %s (%s)", names[code], code))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"satisfied":    len(missing) == 0,
+			"dependencies": g.Dependencies(moduleCode),
+			"required":     required,
+			"missing":      missing,
+			"suggestions":  suggestions,
+		},
+	})
+}
+
+// CheckModuleReverseDependencies 查询依赖该模块的其他模块
+// dependents 为应用中已启用且禁用该模块后将失去依赖的模块，all 为全部直接或间接依赖方
+func CheckModuleReverseDependencies(c *gin.Context) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+
+	g, _, err := dependencyGraph(database.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if !g.Known(moduleCode) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+		return
+	}
+	blockers, err := disableBlockers(appID, moduleCode)
+	if err != nil {
+		if !cycleConflict(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return
+	}
+
+	all := g.Dependents(moduleCode)
+	if all == nil {
+		all = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"dependents":  blockers,
+			"all":         all,
+			"can_disable": len(blockers) == 0,
+		},
+	})
+}
+
+// AutoEnableModuleDependencies 按拓扑顺序启用缺失的依赖
+// 已存在但被停用的记录恢复启用，整个过程在一个事务内完成
+func AutoEnableModuleDependencies(c *gin.Context) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+
+	var enabledCodes []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		g, _, err := dependencyGraph(tx)
+		if err != nil {
+			return err
+		}
+		if !g.Known(moduleCode) {
+			return gorm.ErrRecordNotFound
+		}
+		enabled, err := loadEnabled(tx, appID)
+		if err != nil {
+			return err
+		}
+		_, missing, err := missingDependencies(g, enabled, moduleCode)
+		if err != nil {
+			return err
+		}
+
+		for _, code := range missing {
+			var existing model.AppModule
+			err := tx.Where("app_id = ? AND module_code = ?", appID, code).First(&existing).Error
+			switch {
+			case err == nil:
+				if err := tx.Model(&existing).Update("status", 1).Error; err != nil {
+					return err
+				}
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if err := tx.Create(&model.AppModule{
+					AppID:        appID,
+					ModuleCode:   code,
+					SourceModule: g.Source(code),
+					Config:       "{}",
+					Status:       1,
+				}).Error; err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+			enabledCodes = append(enabledCodes, code)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+		case cycleConflict(c, err):
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return
+	}
+
+	if enabledCodes == nil {
+		enabledCodes = []string{}
+	}
+	middleware.InvalidateModuleGate(appID)
+	publishModuleChange(c, coremodule.EventModuleEnabled, appID, enabledCodes...)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Dependencies enabled successfully",
+		"data": gin.H{
+			"enabled": enabledCodes,
+		},
+	})
+}
+
+// DetectCircularDependency 检测从该模块出发的循环依赖，返回完整的循环路径
+func DetectCircularDependency(c *gin.Context) {
+	moduleCode := c.Param("module_code")
+
+	g, _, err := dependencyGraph(database.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if !g.Known(moduleCode) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+		return
+	}
+
+	path := g.FindCycle(moduleCode)
+	if path == nil {
+		path = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"has_circular": len(path) > 0,
+			"path":         path,
+		},
+	})
+}
@@ -0,0 +1,167 @@
+package module
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	coremodule "app-platform-backend/core/module"
+	"app-platform-backend/internal/pkg/database"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// registerDependencyModules 注册测试用模块：
+// push_create -> push_send -> user_list，loop 模块的 loop_a 与 loop_b 互相依赖
+func registerDependencyModules(t *testing.T) {
+	t.Helper()
+	coremodule.Clear()
+	t.Cleanup(coremodule.Clear)
+	coremodule.Register(coremodule.NewBaseModule(coremodule.Meta{Code: "user_management"}, []coremodule.Function{
+		{Code: "user_list"},
+	}))
+	coremodule.Register(coremodule.NewBaseModule(coremodule.Meta{Code: "push_service"}, []coremodule.Function{
+		{Code: "push_send", Dependencies: []string{"user_list"}},
+		{Code: "push_create", Dependencies: []string{"push_send"}},
+	}))
+	coremodule.Register(coremodule.NewBaseModule(coremodule.Meta{Code: "loop"}, []coremodule.Function{
+		{Code: "loop_a", Dependencies: []string{"loop_b"}},
+		{Code: "loop_b", Dependencies: []string{"loop_a"}},
+	}))
+}
+
+// expectGraph 依赖图读取 module_templates（此处为空，只使用已注册模块）和APP已启用的模块
+func expectGraph(mock sqlmock.Sqlmock, enabled ...string) {
+	mock.ExpectQuery("SELECT \\* FROM `module_templates` WHERE is_active = \\?").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	rows := sqlmock.NewRows([]string{"module_code"})
+	for _, code := range enabled {
+		rows.AddRow(code)
+	}
+	mock.ExpectQuery("SELECT `module_code` FROM `app_modules`").WillReturnRows(rows)
+}
+
+func TestEnableCheck(t *testing.T) {
+	registerDependencyModules(t)
+
+	cases := []struct {
+		name    string
+		enabled []string
+		codes   []string
+		missing map[string][]string
+		cycle   bool
+	}{
+		{"missing transitive dependency", nil, []string{"push_create"},
+			map[string][]string{"push_create": {"user_list", "push_send"}}, false},
+		{"dependencies enabled", []string{"user_list", "push_send"}, []string{"push_create"}, map[string][]string{}, false},
+		{"module provides function", []string{"user_management"}, []string{"push_send"}, map[string][]string{}, false},
+		{"enabled together", nil, []string{"push_create", "push_send", "user_list"}, map[string][]string{}, false},
+		{"cycle", nil, []string{"loop_a"}, nil, true},
+	}
+	for _, tc := range cases {
+		mock := newMockDB(t)
+		expectGraph(mock, tc.enabled...)
+
+		missing, err := enableCheck(database.GetDB(), 1, tc.codes)
+		var cycle *coremodule.CycleError
+		if tc.cycle {
+			if !errors.As(err, &cycle) {
+				t.Errorf("%s: expected cycle error, got %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(missing, tc.missing) {
+			t.Errorf("%s: missing = %v, want %v", tc.name, missing, tc.missing)
+		}
+	}
+}
+
+func TestDisableBlockers(t *testing.T) {
+	registerDependencyModules(t)
+
+	cases := []struct {
+		name     string
+		enabled  []string
+		code     string
+		blockers []string
+		cycle    bool
+	}{
+		{"dependent enabled", []string{"user_list", "push_send"}, "user_list", []string{"push_send"}, false},
+		{"transitive dependents", []string{"user_list", "push_send", "push_create"}, "user_list", []string{"push_create", "push_send"}, false},
+		{"module disabled", []string{"user_management", "push_send"}, "user_management", []string{"push_send"}, false},
+		{"provided by module", []string{"user_management", "user_list", "push_send"}, "user_list", []string{}, false},
+		{"no dependents", []string{"user_list"}, "user_list", []string{}, false},
+		{"cycle", []string{"loop_a", "loop_b"}, "loop_a", nil, true},
+	}
+	for _, tc := range cases {
+		mock := newMockDB(t)
+		expectGraph(mock, tc.enabled...)
+
+		blockers, err := disableBlockers(1, tc.code)
+		var cycle *coremodule.CycleError
+		if tc.cycle {
+			if !errors.As(err, &cycle) {
+				t.Errorf("%s: expected cycle error, got %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(blockers, tc.blockers) {
+			t.Errorf("%s: blockers = %v, want %v", tc.name, blockers, tc.blockers)
+		}
+	}
+}
+
+func TestAutoEnableModuleDependencies(t *testing.T) {
+	registerDependencyModules(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/apps/:id/modules/:module_code/dependencies/enable", AutoEnableModuleDependencies)
+
+	t.Run("transitive", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectBegin()
+		expectGraph(mock)
+		// 按拓扑顺序：先新建 user_list，再恢复已停用的 push_send
+		mock.ExpectQuery("SELECT \\* FROM `app_modules` WHERE \\(app_id = \\? AND module_code = \\?\\)").
+			WithArgs(1, "user_list").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectExec("INSERT INTO `app_modules`").WillReturnResult(sqlmock.NewResult(11, 1))
+		mock.ExpectQuery("SELECT \\* FROM `app_modules` WHERE \\(app_id = \\? AND module_code = \\?\\)").
+			WithArgs(1, "push_send").WillReturnRows(sqlmock.NewRows([]string{"id", "app_id", "module_code", "status"}).AddRow(12, 1, "push_send", 0))
+		mock.ExpectExec("UPDATE `app_modules` SET `status`=\\?").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w := serve(router, "POST", "/apps/1/modules/push_create/dependencies/enable", "admin", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body.String())
+		}
+		if want := `"enabled":["user_list","push_send"]`; !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body = %s, want %s", w.Body.String(), want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectBegin()
+		expectGraph(mock)
+		mock.ExpectRollback()
+
+		w := serve(router, "POST", "/apps/1/modules/loop_a/dependencies/enable", "admin", "")
+		if w.Code != http.StatusConflict {
+			t.Errorf("got %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,493 @@
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	coremodule "app-platform-backend/core/module"
+	auditapi "app-platform-backend/internal/api/v1/audit"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/pkg/database"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 配置环境，按提升顺序排列
+// dev 环境的配置即 AppModule.Config，可直接编辑；staging 和 prod 只能通过审批后的提升变更
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+var environments = []string{EnvDev, EnvStaging, EnvProd}
+
+// 提升状态
+const (
+	PromotionPending  = "pending"
+	PromotionApproved = "approved"
+	PromotionRejected = "rejected"
+)
+
+// ModuleEnvConfig 模块在 staging/prod 环境生效的配置
+type ModuleEnvConfig struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	AppID       uint      `gorm:"uniqueIndex:uk_app_module_env" json:"app_id"`
+	ModuleCode  string    `gorm:"size:100;uniqueIndex:uk_app_module_env" json:"module_code"`
+	Environment string    `gorm:"size:20;uniqueIndex:uk_app_module_env" json:"environment"`
+	Config      string    `gorm:"type:text" json:"config"`
+	VersionID   uint      `json:"version_id"`
+	Version     string    `gorm:"size:50" json:"version"`
+	UpdatedBy   string    `gorm:"size:100" json:"updated_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ModuleEnvConfig) TableName() string {
+	return "module_env_configs"
+}
+
+// ModulePromotion 模块版本提升申请
+type ModulePromotion struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	AppID           uint       `gorm:"index" json:"app_id"`
+	ModuleCode      string     `gorm:"size:100;index" json:"module_code"`
+	VersionID       uint       `json:"version_id"`
+	Version         string     `gorm:"size:50" json:"version"`
+	FromEnvironment string     `gorm:"size:20" json:"from_environment"`
+	ToEnvironment   string     `gorm:"size:20" json:"to_environment"`
+	Status          string     `gorm:"size:20;default:pending;index" json:"status"`
+	Remark          string     `gorm:"type:text" json:"remark"`
+	RequestedBy     string     `gorm:"size:100" json:"requested_by"`
+	ReviewedBy      string     `gorm:"size:100" json:"reviewed_by"`
+	ReviewComment   string     `gorm:"type:text" json:"review_comment"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	ResultVersionID *uint      `json:"result_version_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ModulePromotion) TableName() string {
+	return "module_promotions"
+}
+
+// MigrateDB 迁移模块版本与环境配置相关的表
+func MigrateDB(db *gorm.DB) error {
+	return db.AutoMigrate(&ModuleVersion{}, &ModuleEnvConfig{}, &ModulePromotion{})
+}
+
+func validEnvironment(env string) bool {
+	for _, e := range environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// nextEnvironment 返回提升的目标环境，prod 没有下一级
+func nextEnvironment(env string) string {
+	for i, e := range environments {
+		if e == env && i+1 < len(environments) {
+			return environments[i+1]
+		}
+	}
+	return ""
+}
+
+// envConfig 读取模块在指定环境生效的配置，环境尚未发布时 found 为 false
+func envConfig(tx *gorm.DB, appID uint, moduleCode, env string) (config *ModuleEnvConfig, found bool, err error) {
+	if env == EnvDev {
+		var module model.AppModule
+		if err := tx.Where("app_id = ? AND module_code = ?", appID, moduleCode).First(&module).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return &ModuleEnvConfig{
+			AppID:       appID,
+			ModuleCode:  moduleCode,
+			Environment: EnvDev,
+			Config:      module.Config,
+			UpdatedAt:   module.UpdatedAt,
+		}, true, nil
+	}
+
+	var row ModuleEnvConfig
+	err = tx.Where("app_id = ? AND module_code = ? AND environment = ?", appID, moduleCode, env).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &row, true, nil
+}
+
+// setEnvConfig 写入模块在 staging/prod 环境生效的配置
+func setEnvConfig(tx *gorm.DB, version *ModuleVersion, operator string) error {
+	row := ModuleEnvConfig{
+		AppID:       version.AppID,
+		ModuleCode:  version.ModuleCode,
+		Environment: version.Environment,
+		Config:      version.ConfigSnapshot,
+		VersionID:   version.ID,
+		Version:     version.Version,
+		UpdatedBy:   operator,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "app_id"}, {Name: "module_code"}, {Name: "environment"}},
+		DoUpdates: clause.AssignmentColumns([]string{"config", "version_id", "version", "updated_by", "updated_at"}),
+	}).Create(&row).Error
+}
+
+func decodeConfigObject(raw string) interface{} {
+	var config interface{}
+	if raw == "" || json.Unmarshal([]byte(raw), &config) != nil {
+		return map[string]interface{}{}
+	}
+	return config
+}
+
+// ListModuleEnvironments 获取模块在各环境生效的配置
+func ListModuleEnvironments(c *gin.Context) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+	db := database.GetDB()
+
+	result := make([]gin.H, 0, len(environments))
+	for _, env := range environments {
+		row, found, err := envConfig(db, appID, moduleCode, env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+			return
+		}
+		if env == EnvDev && !found {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+			return
+		}
+		item := gin.H{"environment": env, "configured": found}
+		if found {
+			item["config"] = decodeConfigObject(row.Config)
+			item["version_id"] = row.VersionID
+			item["version"] = row.Version
+			item["updated_by"] = row.UpdatedBy
+			item["updated_at"] = row.UpdatedAt
+		}
+		result = append(result, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": result,
+	})
+}
+
+// RequestPromotion 申请将已发布的模块版本提升到下一个环境
+func RequestPromotion(c *gin.Context) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+
+	var req struct {
+		VersionID uint   `json:"version_id" binding:"required"`
+		Remark    string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	var version ModuleVersion
+	if err := database.GetDB().Where("id = ? AND app_id = ? AND module_code = ?", req.VersionID, appID, moduleCode).First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "版本不存在"})
+		return
+	}
+	if version.Status != "published" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "只能提升已发布的版本"})
+		return
+	}
+	target := nextEnvironment(version.Environment)
+	if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": fmt.Sprintf("%s 环境的版本无法继续提升", version.Environment)})
+		return
+	}
+
+	var pending int64
+	database.GetDB().Model(&ModulePromotion{}).
+		Where("app_id = ? AND module_code = ? AND to_environment = ? AND status = ?", appID, moduleCode, target, PromotionPending).
+		Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": fmt.Sprintf("已有提升到 %s 环境的申请待审批", target)})
+		return
+	}
+
+	promotion := ModulePromotion{
+		AppID:           appID,
+		ModuleCode:      moduleCode,
+		VersionID:       version.ID,
+		Version:         version.Version,
+		FromEnvironment: version.Environment,
+		ToEnvironment:   target,
+		Status:          PromotionPending,
+		Remark:          req.Remark,
+		RequestedBy:     c.GetString("username"),
+	}
+	if err := database.GetDB().Create(&promotion).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建提升申请失败"})
+		return
+	}
+
+	auditapi.RecordAppAudit(c, appID, "promotion_request", "module", moduleCode,
+		fmt.Sprintf("申请将 %s 版本 %s 从 %s 提升到 %s", moduleCode, version.Version, version.Environment, target),
+		map[string]interface{}{"promotion_id": promotion.ID, "version_id": version.ID})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": promotion,
+	})
+}
+
+// ListPromotions 获取模块的提升申请
+func ListPromotions(c *gin.Context) {
+	appID := c.Param("id")
+	moduleCode := c.Param("module_code")
+
+	query := database.GetDB().Where("app_id = ? AND module_code = ?", appID, moduleCode)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var promotions []ModulePromotion
+	if err := query.Order("created_at DESC").Limit(100).Find(&promotions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": promotions,
+	})
+}
+
+var (
+	errPromotionReviewed = errors.New("提升申请已处理")
+	errSelfApproval      = errors.New("不能批准自己发起的提升申请")
+)
+
+// reviewPromotion 审批或拒绝提升申请，approve 为 true 时在同一事务内完成提升
+func reviewPromotion(c *gin.Context, approve bool) {
+	appID := parseUint(c.Param("id"))
+	moduleCode := c.Param("module_code")
+	promotionID := c.Param("promotion_id")
+	reviewer := c.GetString("username")
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	var promotion ModulePromotion
+	var result *ModuleVersion
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND app_id = ? AND module_code = ?", promotionID, appID, moduleCode).
+			First(&promotion).Error; err != nil {
+			return err
+		}
+		if promotion.Status != PromotionPending {
+			return errPromotionReviewed
+		}
+		if approve && promotion.RequestedBy == reviewer {
+			return errSelfApproval
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"reviewed_by":    reviewer,
+			"review_comment": req.Comment,
+			"reviewed_at":    now,
+			"status":         PromotionRejected,
+		}
+		if approve {
+			version, err := promote(tx, &promotion, now)
+			if err != nil {
+				return err
+			}
+			result = version
+			updates["status"] = PromotionApproved
+			updates["result_version_id"] = version.ID
+		}
+		return tx.Model(&promotion).Updates(updates).Error
+	})
+
+	if err != nil {
+		var schemaErr *validator.SchemaError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提升申请不存在"})
+		case errors.Is(err, errPromotionReviewed):
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		case errors.Is(err, errSelfApproval):
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": err.Error()})
+		case errors.As(err, &schemaErr):
+			validationFailed(c, err)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		}
+		return
+	}
+
+	action, verb := "promotion_reject", "拒绝"
+	extra := map[string]interface{}{"promotion_id": promotion.ID, "version_id": promotion.VersionID, "comment": req.Comment}
+	if approve {
+		action, verb = "promotion_approve", "批准"
+		extra["result_version_id"] = result.ID
+		coremodule.ReloadConfig(c.Request.Context(), appID, moduleCode, c.GetString("username"))
+	}
+	auditapi.RecordAppAudit(c, appID, action, "module", moduleCode,
+		fmt.Sprintf("%s %s 版本 %s 从 %s 提升到 %s", verb, moduleCode, promotion.Version, promotion.FromEnvironment, promotion.ToEnvironment),
+		extra)
+
+	data := gin.H{"promotion": promotion}
+	if approve {
+		data["version"] = result
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": data,
+	})
+}
+
+// promote 将源版本复制为目标环境的已发布版本，并切换目标环境的生效配置
+func promote(tx *gorm.DB, promotion *ModulePromotion, now time.Time) (*ModuleVersion, error) {
+	var source ModuleVersion
+	if err := tx.Where("id = ? AND app_id = ? AND module_code = ?", promotion.VersionID, promotion.AppID, promotion.ModuleCode).
+		First(&source).Error; err != nil {
+		return nil, err
+	}
+
+	// 提升前按当前 Schema 重新校验，避免旧版本配置在新 Schema 下不可用
+	schema, _, err := functionSchema(promotion.ModuleCode)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot map[string]interface{}
+	if source.ConfigSnapshot != "" {
+		if err := json.Unmarshal([]byte(source.ConfigSnapshot), &snapshot); err != nil {
+			return nil, fmt.Errorf("版本配置不是合法的 JSON 对象: %w", err)
+		}
+	}
+	validated, err := validator.ValidateModuleConfig(schema, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, _ := json.Marshal(validated)
+
+	var maxVersionNum int
+	tx.Model(&ModuleVersion{}).
+		Where("app_id = ? AND module_code = ?", promotion.AppID, promotion.ModuleCode).
+		Select("COALESCE(MAX(version_num), 0)").
+		Scan(&maxVersionNum)
+
+	version := ModuleVersion{
+		AppID:          promotion.AppID,
+		ModuleCode:     promotion.ModuleCode,
+		VersionNum:     maxVersionNum + 1,
+		Version:        source.Version,
+		ConfigSnapshot: string(configJSON),
+		Status:         "published",
+		Environment:    promotion.ToEnvironment,
+		Changelog:      fmt.Sprintf("由 %s 环境版本 %s 提升", source.Environment, source.Version),
+		CreatedBy:      promotion.RequestedBy,
+		PublishedAt:    &now,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, err
+	}
+	if err := setEnvConfig(tx, &version, promotion.RequestedBy); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ApprovePromotion 批准提升申请
+func ApprovePromotion(c *gin.Context) {
+	reviewPromotion(c, true)
+}
+
+// RejectPromotion 拒绝提升申请
+func RejectPromotion(c *gin.Context) {
+	reviewPromotion(c, false)
+}
+
+// ClientModuleConfig 客户端拉取模块在服务部署环境生效的配置（签名认证）
+// 客户端只能读取部署环境的配置，environment 参数可省略，与部署环境不一致时拒绝；
+// Schema 中标记 writeOnly 的字段不会下发，没有 Schema 的模块不下发配置
+func ClientModuleConfig(c *gin.Context) {
+	appID, ok := middleware.BoundAppID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未绑定APP"})
+		return
+	}
+	moduleCode := c.Param("module_code")
+	env := coremodule.ConfigEnvironment()
+	if requested := c.Query("environment"); requested != "" && requested != env {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": fmt.Sprintf("客户端只能拉取 %s 环境的配置", env)})
+		return
+	}
+
+	schemas, err := redactionSchemas(moduleCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if len(schemas) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "模块未声明配置 Schema，不向客户端下发配置"})
+		return
+	}
+
+	var module model.AppModule
+	if err := database.GetDB().Where("app_id = ? AND module_code = ? AND status = ?", appID, moduleCode, 1).First(&module).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块未启用"})
+		return
+	}
+
+	row, found, err := envConfig(database.GetDB(), appID, moduleCode, env)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": fmt.Sprintf("%s 环境尚未发布配置", env)})
+		return
+	}
+
+	config, _ := decodeConfigObject(row.Config).(map[string]interface{})
+	for _, schema := range schemas {
+		config = validator.RedactWriteOnly(schema, config)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"module_code": moduleCode,
+			"environment": env,
+			"version":     row.Version,
+			"config":      config,
+		},
+	})
+}
@@ -5,10 +5,17 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"log"
+	"strings"
 	"time"
 
+	coremodule "app-platform-backend/core/module"
+	auditapi "app-platform-backend/internal/api/v1/audit"
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/pkg/database"
+	"app-platform-backend/internal/pkg/jsondiff"
+	"app-platform-backend/internal/validator"
 
 	"github.com/gin-gonic/gin"
 )
@@ -121,6 +128,10 @@ func EnableModule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Module already enabled"})
 		return
 	}
+	// 依赖未启用或存在循环依赖时拒绝
+	if enableConflict(c, parseUint(appID), []string{req.ModuleCode}) {
+		return
+	}
 
 	module := model.AppModule{
 		AppID:      parseUint(appID),
@@ -133,6 +144,8 @@ func EnableModule(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable module"})
 		return
 	}
+	middleware.InvalidateModuleGate(module.AppID)
+	publishModuleChange(c, coremodule.EventModuleEnabled, module.AppID, module.ModuleCode)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
@@ -160,7 +173,29 @@ func UpdateModule(c *gin.Context) {
 	}
 
 	if req.Status != nil {
-		database.GetDB().Model(&module).Update("status", *req.Status)
+		previous := module.Status
+		// 启用前检查依赖，停用前检查依赖方，与 EnableModule / DisableModule 一致
+		switch {
+		case previous != 1 && *req.Status == 1:
+			if enableConflict(c, module.AppID, []string{module.ModuleCode}) {
+				return
+			}
+		case previous == 1 && *req.Status != 1:
+			if disableConflict(c, module.AppID, module.ModuleCode) {
+				return
+			}
+		}
+		if err := database.GetDB().Model(&module).Update("status", *req.Status).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update module"})
+			return
+		}
+		middleware.InvalidateModuleGate(module.AppID)
+		switch {
+		case previous != 1 && *req.Status == 1:
+			publishModuleChange(c, coremodule.EventModuleEnabled, module.AppID, module.ModuleCode)
+		case previous == 1 && *req.Status != 1:
+			publishModuleChange(c, coremodule.EventModuleDisabled, module.AppID, module.ModuleCode)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -173,10 +208,17 @@ func DisableModule(c *gin.Context) {
 	appID := c.Param("id")
 	moduleCode := c.Param("module_code")
 
+	// 仍有已启用的模块依赖它时不允许禁用
+	if disableConflict(c, parseUint(appID), moduleCode) {
+		return
+	}
+
 	if err := database.GetDB().Where("app_id = ? AND module_code = ?", appID, moduleCode).Delete(&model.AppModule{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable module"})
 		return
 	}
+	middleware.InvalidateModuleGate(parseUint(appID))
+	publishModuleChange(c, coremodule.EventModuleDisabled, parseUint(appID), moduleCode)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -196,6 +238,12 @@ func BatchEnableModules(c *gin.Context) {
 		return
 	}
 
+	// 本批模块之间可以互相满足依赖
+	if enableConflict(c, parseUint(appID), req.ModuleCodes) {
+		return
+	}
+
+	var created []string
 	for _, code := range req.ModuleCodes {
 		var existing model.AppModule
 		if err := database.GetDB().Where("app_id = ? AND module_code = ?", appID, code).First(&existing).Error; err != nil {
@@ -205,9 +253,13 @@ func BatchEnableModules(c *gin.Context) {
 				Config:     "{}",
 				Status:     1,
 			}
-			database.GetDB().Create(&module)
+			if database.GetDB().Create(&module).Error == nil {
+				created = append(created, code)
+			}
 		}
 	}
+	middleware.InvalidateModuleGate(parseUint(appID))
+	publishModuleChange(c, coremodule.EventModuleEnabled, parseUint(appID), created...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -234,6 +286,18 @@ func SaveModuleConfig(c *gin.Context) {
 		return
 	}
 
+	// 按功能声明的 Schema 校验，并补全默认值
+	schema, _, err := functionSchema(moduleCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	config, err := validator.ValidateModuleConfig(schema, req.Config)
+	if err != nil {
+		validationFailed(c, err)
+		return
+	}
+
 	// 保存配置历史
 	var maxVersion int
 	database.GetDB().Model(&model.ModuleConfigHistory{}).
@@ -250,8 +314,9 @@ func SaveModuleConfig(c *gin.Context) {
 	database.GetDB().Create(&history)
 
 	// 更新配置
-	configJSON, _ := json.Marshal(req.Config)
+	configJSON, _ := json.Marshal(config)
 	database.GetDB().Model(&module).Update("config", string(configJSON))
+	coremodule.ReloadConfig(c.Request.Context(), module.AppID, moduleCode, c.GetString("username"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -269,10 +334,33 @@ func GetModuleConfig(c *gin.Context) {
 		return
 	}
 
+	// 指定 staging/prod 时返回该环境生效的配置
+	if env := c.Query("environment"); env != "" && env != EnvDev {
+		if !validEnvironment(env) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment"})
+			return
+		}
+		row, found, err := envConfig(database.GetDB(), module.AppID, moduleCode, env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data := gin.H{"environment": env, "config": "{}", "version": ""}
+		if found {
+			data["config"], data["version"] = row.Config, row.Version
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"data": data,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
 		"data": gin.H{
-			"config": module.Config,
+			"environment": EnvDev,
+			"config":      module.Config,
 		},
 	})
 }
@@ -288,6 +376,7 @@ func ResetModuleConfig(c *gin.Context) {
 	}
 
 	database.GetDB().Model(&module).Update("config", "{}")
+	coremodule.ReloadConfig(c.Request.Context(), module.AppID, moduleCode, c.GetString("username"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -295,16 +384,6 @@ func ResetModuleConfig(c *gin.Context) {
 	})
 }
 
-func TestModuleConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"code":    0,
-		"message": "Config test passed",
-		"data": gin.H{
-			"success": true,
-		},
-	})
-}
-
 func GetConfigHistory(c *gin.Context) {
 	appID := c.Param("id")
 	moduleCode := c.Param("module_code")
@@ -333,6 +412,7 @@ func RollbackConfig(c *gin.Context) {
 	database.GetDB().Model(&model.AppModule{}).
 		Where("app_id = ? AND module_code = ?", appID, moduleCode).
 		Update("config", history.Config)
+	coremodule.ReloadConfig(c.Request.Context(), parseUint(appID), moduleCode, c.GetString("username"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -340,48 +420,50 @@ func RollbackConfig(c *gin.Context) {
 	})
 }
 
+// CompareConfig 对比模块配置
+// from 为配置历史ID；to 为配置历史ID，为空时与当前配置对比
 func CompareConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"code": 0,
-		"data": gin.H{
-			"diff": []string{},
-		},
-	})
-}
+	appID := c.Param("id")
+	moduleCode := c.Param("module_code")
 
-func CheckModuleDependencies(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"code": 0,
-		"data": gin.H{
-			"satisfied":   true,
-			"missing":     []string{},
-			"suggestions": []string{},
-		},
-	})
-}
+	var from model.ModuleConfigHistory
+	if err := database.GetDB().Where("id = ? AND app_id = ? AND module_code = ?", c.Query("from"), appID, moduleCode).First(&from).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "配置历史不存在"})
+		return
+	}
+	fromLabel := fmt.Sprintf("v%d", from.Version)
 
-func CheckModuleReverseDependencies(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"code": 0,
-		"data": gin.H{
-			"dependents": []string{},
-		},
-	})
-}
+	toConfig, toLabel := "", "current"
+	if toID := c.Query("to"); toID != "" {
+		var to model.ModuleConfigHistory
+		if err := database.GetDB().Where("id = ? AND app_id = ? AND module_code = ?", toID, appID, moduleCode).First(&to).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "配置历史不存在"})
+			return
+		}
+		toConfig, toLabel = to.Config, fmt.Sprintf("v%d", to.Version)
+	} else {
+		var module model.AppModule
+		if err := database.GetDB().Where("app_id = ? AND module_code = ?", appID, moduleCode).First(&module).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+			return
+		}
+		toConfig = module.Config
+	}
 
-func AutoEnableModuleDependencies(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"code":    0,
-		"message": "Dependencies enabled successfully",
-	})
-}
+	changes, err := jsondiff.CompareJSON([]byte(from.Config), []byte(toConfig), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
 
-func DetectCircularDependency(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
 		"data": gin.H{
-			"has_circular": false,
-			"path":         []string{},
+			"from":    fromLabel,
+			"to":      toLabel,
+			"diff":    changes,
+			"summary": jsondiff.Summarize(changes),
+			"text":    jsondiff.Unified(changes, fromLabel, toLabel),
 		},
 	})
 }
@@ -392,6 +474,24 @@ func parseUint(s string) uint {
 	return id
 }
 
+// publishModuleChange 为每个模块发布启用/禁用事件，发布失败只记录日志
+// 启用/禁用会增删配置行，同时使该APP的模块配置缓存失效
+func publishModuleChange(c *gin.Context, eventType string, appID uint, codes ...string) {
+	if len(codes) > 0 {
+		coremodule.InvalidateConfig(appID)
+	}
+	for _, code := range codes {
+		err := coremodule.Publish(c.Request.Context(), eventType, "module", appID, coremodule.ModuleChanged{
+			AppID:      appID,
+			ModuleCode: code,
+			Operator:   c.GetString("username"),
+		})
+		if err != nil {
+			log.Printf("[Module] Failed to publish %s for %s (app %d): %v", eventType, code, appID, err)
+		}
+	}
+}
+
 
 
 // ==================== 模块版本管理 API ====================
@@ -496,10 +596,14 @@ func CreateModuleVersion(c *gin.Context) {
 		version = fmt.Sprintf("%d.0.0", maxVersion+1)
 	}
 
-	// 默认环境
+	// 新版本只能从 dev 配置创建，staging/prod 的版本由提升产生
 	environment := req.Environment
 	if environment == "" {
-		environment = "dev"
+		environment = EnvDev
+	}
+	if environment != EnvDev {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "staging/prod 版本需通过提升创建"})
+		return
 	}
 
 	// 获取最大版本号
@@ -574,10 +678,25 @@ func RollbackModuleVersion(c *gin.Context) {
 		return
 	}
 
-	// 将配置快照恢复到模块
-	database.GetDB().Model(&model.AppModule{}).
-		Where("app_id = ? AND module_code = ?", appID, moduleCode).
-		Update("config", version.ConfigSnapshot)
+	// 将配置快照恢复到版本所属的环境，staging/prod 只能回滚到该环境发布过的版本
+	if version.Environment == EnvStaging || version.Environment == EnvProd {
+		if version.Status != "published" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "只能回滚到已发布的版本"})
+			return
+		}
+		if err := setEnvConfig(database.GetDB(), &version, c.GetString("username")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "版本回滚失败"})
+			return
+		}
+		auditapi.RecordAppAudit(c, version.AppID, "rollback", "module", moduleCode,
+			fmt.Sprintf("将 %s 的 %s 环境回滚到版本 %s", moduleCode, version.Environment, version.Version),
+			map[string]interface{}{"version_id": version.ID})
+	} else {
+		database.GetDB().Model(&model.AppModule{}).
+			Where("app_id = ? AND module_code = ?", appID, moduleCode).
+			Update("config", version.ConfigSnapshot)
+	}
+	coremodule.ReloadConfig(c.Request.Context(), version.AppID, moduleCode, c.GetString("username"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -602,43 +721,10 @@ func CompareModuleVersions(c *gin.Context) {
 		return
 	}
 
-	// 解析配置JSON进行对比
-	var config1, config2 map[string]interface{}
-	json.Unmarshal([]byte(v1.ConfigSnapshot), &config1)
-	json.Unmarshal([]byte(v2.ConfigSnapshot), &config2)
-
-	// 简单对比
-	changes := []map[string]interface{}{}
-	
-	// 检查v1中的字段
-	for key, val1 := range config1 {
-		if val2, ok := config2[key]; ok {
-			if fmt.Sprintf("%v", val1) != fmt.Sprintf("%v", val2) {
-				changes = append(changes, map[string]interface{}{
-					"field":     key,
-					"type":      "modified",
-					"old_value": val1,
-					"new_value": val2,
-				})
-			}
-		} else {
-			changes = append(changes, map[string]interface{}{
-				"field":     key,
-				"type":      "removed",
-				"old_value": val1,
-			})
-		}
-	}
-	
-	// 检查v2中新增的字段
-	for key, val2 := range config2 {
-		if _, ok := config1[key]; !ok {
-			changes = append(changes, map[string]interface{}{
-				"field":     key,
-				"type":      "added",
-				"new_value": val2,
-			})
-		}
+	changes, err := jsondiff.CompareJSON([]byte(v1.ConfigSnapshot), []byte(v2.ConfigSnapshot), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -646,8 +732,39 @@ func CompareModuleVersions(c *gin.Context) {
 		"data": gin.H{
 			"version1": v1,
 			"version2": v2,
-			"changes":  changes,
+			"changes":  versionChanges(changes),
+			"summary":  jsondiff.Summarize(changes),
+			"text":     jsondiff.Unified(changes, v1.Version, v2.Version),
 		},
 	})
 }
 
+// versionChanges 在 op/path/old/new 之外保留旧版接口的 field/type/old_value/new_value 字段，
+// 版本对比页面按旧字段渲染
+func versionChanges(changes []jsondiff.Change) []gin.H {
+	legacyTypes := map[jsondiff.Op]string{
+		jsondiff.OpAdded:   "added",
+		jsondiff.OpRemoved: "removed",
+		jsondiff.OpChanged: "modified",
+	}
+	result := make([]gin.H, 0, len(changes))
+	for _, ch := range changes {
+		item := gin.H{
+			"op":    ch.Op,
+			"path":  ch.Path,
+			"old":   ch.Old,
+			"new":   ch.New,
+			"field": strings.TrimPrefix(ch.Path, "$."),
+			"type":  legacyTypes[ch.Op],
+		}
+		if ch.Op != jsondiff.OpAdded {
+			item["old_value"] = ch.Old
+		}
+		if ch.Op != jsondiff.OpRemoved {
+			item["new_value"] = ch.New
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
@@ -0,0 +1,197 @@
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	coremodule "app-platform-backend/core/module"
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/pkg/database"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// configTestTimeout 配置连通性测试的超时时间
+const configTestTimeout = 15 * time.Second
+
+// functionSchema 读取功能的配置 Schema 及其所属模块
+// 优先使用 Syncer 写入 module_templates 的 Schema，未同步时回退到已注册模块的声明
+func functionSchema(code string) (map[string]interface{}, string, error) {
+	var record coremodule.ModuleTemplateRecord
+	err := database.GetDB().Where("module_code = ?", code).First(&record).Error
+	if err == nil {
+		var schema map[string]interface{}
+		if record.ConfigSchema != "" {
+			if err := json.Unmarshal([]byte(record.ConfigSchema), &schema); err != nil {
+				return nil, "", fmt.Errorf("功能 %s 的配置 Schema 无效: %w", code, err)
+			}
+		}
+		return schema, record.SourceModule, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+
+	for _, m := range coremodule.GetAllModules() {
+		meta := m.Meta()
+		if meta.Code == code {
+			return nil, meta.Code, nil
+		}
+		for _, fn := range m.GetFunctions() {
+			if fn.Code == code {
+				return fn.ConfigSchema, meta.Code, nil
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// redactionSchemas 返回下发配置前用于移除 writeOnly 字段的 Schema
+// 功能Code 使用功能自身的 Schema；模块级配置会合并进模块下每个功能的配置，因此使用模块下全部功能的 Schema。
+// 没有找到任何 Schema 时返回空，调用方无法判断哪些字段是密钥，应拒绝下发
+func redactionSchemas(code string) ([]map[string]interface{}, error) {
+	var records []coremodule.ModuleTemplateRecord
+	if err := database.GetDB().Where("source_module = ?", code).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var schemas []map[string]interface{}
+	for _, record := range records {
+		if record.ConfigSchema == "" {
+			continue
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(record.ConfigSchema), &schema); err != nil {
+			return nil, fmt.Errorf("功能 %s 的配置 Schema 无效: %w", record.ModuleCode, err)
+		}
+		schemas = append(schemas, schema)
+	}
+	if len(records) > 0 {
+		return schemas, nil
+	}
+
+	// 模块未同步到 module_templates 时回退到已注册模块的声明
+	if m, ok := coremodule.Get(code); ok {
+		for _, fn := range m.GetFunctions() {
+			if len(fn.ConfigSchema) > 0 {
+				schemas = append(schemas, fn.ConfigSchema)
+			}
+		}
+		return schemas, nil
+	}
+
+	schema, _, err := functionSchema(code)
+	if err != nil || len(schema) == 0 {
+		return nil, err
+	}
+	return []map[string]interface{}{schema}, nil
+}
+
+// validationFailed 返回字段级的配置校验错误
+func validationFailed(c *gin.Context, err error) {
+	var schemaErr *validator.SchemaError
+	if !errors.As(err, &schemaErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":    400,
+		"message": "配置校验失败",
+		"errors":  schemaErr.Errors,
+	})
+}
+
+// TestModuleConfig 测试模块配置
+// 请求体中的 config 为空时测试已保存的配置；先按 Schema 校验，
+// 通过后若模块实现了 ConfigTester 则继续测试连通性
+func TestModuleConfig(c *gin.Context) {
+	appID := c.Param("id")
+	moduleCode := c.Param("module_code")
+
+	var module model.AppModule
+	if err := database.GetDB().Where("app_id = ? AND module_code = ?", appID, moduleCode).First(&module).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "模块不存在"})
+		return
+	}
+
+	var req struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	config := req.Config
+	if config == nil && module.Config != "" {
+		if err := json.Unmarshal([]byte(module.Config), &config); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"data": gin.H{
+					"success": false,
+					"errors":  []validator.FieldError{{Path: "$", Message: "已保存的配置不是合法的 JSON 对象"}},
+				},
+			})
+			return
+		}
+	}
+
+	schema, source, err := functionSchema(moduleCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	if module.SourceModule != "" {
+		source = module.SourceModule
+	}
+
+	validated, err := validator.ValidateModuleConfig(schema, config)
+	if err != nil {
+		var schemaErr *validator.SchemaError
+		errors.As(err, &schemaErr)
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"data": gin.H{
+				"success": false,
+				"errors":  schemaErr.Errors,
+			},
+		})
+		return
+	}
+
+	connectivity := gin.H{"checked": false}
+	success := true
+	if m, ok := coremodule.Get(source); ok {
+		if tester, ok := m.(coremodule.ConfigTester); ok {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), configTestTimeout)
+			start := time.Now()
+			err := tester.TestConfig(ctx, moduleCode, validated)
+			cancel()
+
+			connectivity = gin.H{
+				"checked":    true,
+				"success":    err == nil,
+				"latency_ms": time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				success = false
+				connectivity["message"] = err.Error()
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"success":      success,
+			"errors":       []validator.FieldError{},
+			"config":       validated,
+			"connectivity": connectivity,
+		},
+	})
+}
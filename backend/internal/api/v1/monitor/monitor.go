@@ -1,10 +1,14 @@
 package monitor
 
 import (
+	"app-platform-backend/core/module"
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/response"
 	"app-platform-backend/internal/validator"
+	"context"
 	"encoding/json"
+	"log"
 	"strconv"
 	"time"
 
@@ -21,7 +25,7 @@ func InitDB(database *gorm.DB) {
 // ReportMetric 上报监控指标
 func ReportMetric(c *gin.Context) {
 	var req struct {
-		AppID       uint              `json:"app_id" binding:"required"`
+		AppID       uint              `json:"app_id"`
 		MetricName  string            `json:"metric_name" binding:"required"`
 		MetricValue float64           `json:"metric_value" binding:"required"`
 		Tags        map[string]string `json:"tags"`
@@ -32,6 +36,13 @@ func ReportMetric(c *gin.Context) {
 		return
 	}
 
+	// 签名认证的客户端请求以绑定的APP为准
+	req.AppID = middleware.ResolveAppID(c, req.AppID)
+	if req.AppID == 0 {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+
 	// 验证指标名称
 	if len(req.MetricName) < 1 || len(req.MetricName) > 100 {
 		response.ParamError(c, "指标名称长度应在1-100个字符之间")
@@ -58,13 +69,14 @@ func ReportMetric(c *gin.Context) {
 	}
 
 	// 检查是否触发告警
-	checkAlerts(req.AppID, req.MetricName, req.MetricValue)
+	checkAlerts(c.Request.Context(), req.AppID, req.MetricName, req.MetricValue)
 
 	response.SuccessWithMessage(c, nil, "指标上报成功")
 }
 
 // 检查告警规则
-func checkAlerts(appID uint, metricName string, value float64) {
+// 规则从正常进入告警状态时发布 alert.triggered，持续告警期间只更新 last_alert_at
+func checkAlerts(ctx context.Context, appID uint, metricName string, value float64) {
 	var alerts []model.MonitorAlert
 	db.Where("app_id = ? AND metric_name = ? AND is_active = 1", appID, metricName).Find(&alerts)
 
@@ -84,11 +96,26 @@ func checkAlerts(appID uint, metricName string, value float64) {
 		}
 
 		if triggered {
+			wasAlerting := alert.Status == "alerting"
 			now := time.Now()
 			db.Model(&alert).Updates(map[string]interface{}{
 				"status":        "alerting",
 				"last_alert_at": now,
 			})
+			if wasAlerting {
+				continue
+			}
+			if err := module.Publish(ctx, module.EventAlertTriggered, "monitor", appID, module.AlertTriggered{
+				AppID:      appID,
+				AlertID:    alert.ID,
+				Name:       alert.AlertName,
+				MetricName: alert.MetricName,
+				Condition:  alert.Condition,
+				Threshold:  alert.Threshold,
+				Value:      value,
+			}); err != nil {
+				log.Printf("[Monitor] Failed to publish %s for alert %d: %v", module.EventAlertTriggered, alert.ID, err)
+			}
 		}
 	}
 }
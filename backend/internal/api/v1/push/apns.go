@@ -0,0 +1,201 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	apnsProductionHost = "https://api.push.apple.com"
+	apnsSandboxHost    = "https://api.sandbox.push.apple.com"
+	// APNs 要求鉴权令牌在20~60分钟之间刷新
+	apnsTokenTTL = 40 * time.Minute
+)
+
+// apnsConfig APNs 通道配置（基于 .p8 密钥的令牌鉴权）
+type apnsConfig struct {
+	TeamID     string `json:"team_id"`
+	KeyID      string `json:"key_id"`
+	PrivateKey string `json:"private_key"` // .p8 文件内容（PEM）
+	Topic      string `json:"topic"`       // 一般为 App 的 Bundle ID
+	Sandbox    bool   `json:"sandbox"`
+	Endpoint   string `json:"endpoint"` // 可选，覆盖默认地址
+}
+
+// apnsProvider 通过 HTTP/2 调用 APNs
+type apnsProvider struct {
+	config apnsConfig
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func newAPNsProvider(raw json.RawMessage) (Provider, error) {
+	var cfg apnsConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.TeamID == "" || cfg.KeyID == "" || cfg.PrivateKey == "" || cfg.Topic == "" {
+		return nil, errors.New("team_id、key_id、private_key、topic 不能为空")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("private_key 无效: %w", err)
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = apnsProductionHost
+		if cfg.Sandbox {
+			cfg.Endpoint = apnsSandboxHost
+		}
+	}
+	return &apnsProvider{
+		config: cfg,
+		key:    key,
+		client: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{ForceAttemptHTTP2: true, MaxIdleConnsPerHost: 10},
+		},
+	}, nil
+}
+
+// Name 通道名称
+func (p *apnsProvider) Name() string {
+	return ProviderAPNs
+}
+
+// bearer 返回缓存的鉴权令牌，过期后重新签发
+func (p *apnsProvider) bearer() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Since(p.issuedAt) < apnsTokenTTL {
+		return p.token, nil
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.config.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = p.config.KeyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	p.token, p.issuedAt = signed, now
+	return signed, nil
+}
+
+// Send 发送通知
+func (p *apnsProvider) Send(ctx context.Context, deviceToken string, n *Notification) Result {
+	bearer, err := p.bearer()
+	if err != nil {
+		return Result{Status: ResultRejected, Error: "签发APNs令牌失败: " + err.Error()}
+	}
+
+	alert := map[string]interface{}{"title": n.Title, "body": n.Body}
+	aps := map[string]interface{}{"alert": alert}
+	if n.Badge != nil {
+		aps["badge"] = *n.Badge
+	}
+	if n.Sound != "" {
+		aps["sound"] = n.Sound
+	}
+	payload := map[string]interface{}{"aps": aps}
+	for k, v := range n.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint+"/3/device/"+deviceToken, bytes.NewReader(body))
+	if err != nil {
+		return Result{Status: ResultRejected, Error: err.Error()}
+	}
+	req.Header.Set("authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", p.config.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Result{Status: ResultFailed, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return Result{Status: ResultSuccess, MessageID: resp.Header.Get("apns-id")}
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(data, &apnsErr)
+	if apnsErr.Reason == "ExpiredProviderToken" {
+		p.mu.Lock()
+		p.token = ""
+		p.mu.Unlock()
+	}
+	return classifyAPNs(resp.StatusCode, apnsErr.Reason)
+}
+
+// Check 用占位令牌发送请求测试凭据：鉴权通过时 APNs 返回 BadDeviceToken，
+// 鉴权或主题配置错误时返回 InvalidProviderToken、TopicDisallowed 等
+func (p *apnsProvider) Check(ctx context.Context) error {
+	bearer, err := p.bearer()
+	if err != nil {
+		return fmt.Errorf("签发APNs令牌失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint+"/3/device/"+strings.Repeat("0", 64), strings.NewReader(`{"aps":{}}`))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", p.config.Topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法连接APNs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apnsErr)
+	if resp.StatusCode == http.StatusOK || apnsErr.Reason == "BadDeviceToken" {
+		return nil
+	}
+	return fmt.Errorf("APNs %d %s", resp.StatusCode, apnsErr.Reason)
+}
+
+// classifyAPNs 按状态码与错误原因对APNs响应分类
+func classifyAPNs(status int, reason string) Result {
+	msg := fmt.Sprintf("APNs %d %s", status, reason)
+	switch {
+	case status == http.StatusGone, reason == "BadDeviceToken", reason == "Unregistered", reason == "DeviceTokenNotForTopic":
+		return Result{Status: ResultInvalidToken, Error: msg}
+	case status == http.StatusTooManyRequests, status >= 500:
+		return Result{Status: ResultFailed, Error: msg}
+	case reason == "ExpiredProviderToken":
+		// 令牌过期属于偶发情况，下次发送会重新签发
+		return Result{Status: ResultFailed, Error: msg}
+	}
+	return Result{Status: ResultRejected, Error: msg}
+}
@@ -0,0 +1,157 @@
+package push
+
+import (
+	"time"
+
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/response"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// 设备令牌状态
+const (
+	DeviceActive   = "active"
+	DeviceDisabled = "disabled"
+)
+
+// DeviceToken APP终端用户的推送设备令牌
+type DeviceToken struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	AppID      uint      `gorm:"uniqueIndex:idx_push_device_token,priority:1;index:idx_push_device_user,priority:1" json:"app_id"`
+	UserID     uint      `gorm:"index:idx_push_device_user,priority:2" json:"user_id"`
+	Platform   string    `gorm:"size:20" json:"platform"` // ios / android / mock
+	Provider   string    `gorm:"size:20" json:"provider"`
+	Token      string    `gorm:"size:255;uniqueIndex:idx_push_device_token,priority:2" json:"token"`
+	AppVersion string    `gorm:"size:50" json:"app_version"`
+	Timezone   string    `gorm:"size:64" json:"timezone"`
+	Status     string    `gorm:"size:20;default:active;index" json:"status"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (DeviceToken) TableName() string {
+	return "push_device_tokens"
+}
+
+// RegisterDevice 客户端注册或刷新设备令牌（需声明APP终端用户）
+// 同一令牌换绑用户时直接转移到新用户名下
+func RegisterDevice(c *gin.Context) {
+	var req struct {
+		Token      string `json:"token" binding:"required"`
+		Platform   string `json:"platform" binding:"required"`
+		Provider   string `json:"provider"`
+		AppVersion string `json:"app_version"`
+		Timezone   string `json:"timezone"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	appID, ok := middleware.BoundAppID(c)
+	if !ok {
+		response.Unauthorized(c, "缺少APP签名认证")
+		return
+	}
+	user, ok := middleware.GetAppUser(c)
+	if !ok {
+		response.ParamError(c, "缺少 X-App-User-Token 请求头")
+		return
+	}
+
+	if req.Platform != "ios" && req.Platform != "android" && req.Platform != "mock" {
+		response.ParamError(c, "无效的平台，请使用: ios, android, mock")
+		return
+	}
+	if len(req.Token) > 255 {
+		response.ParamError(c, "设备令牌过长")
+		return
+	}
+	if req.Provider == "" {
+		req.Provider = providerForPlatform(req.Platform)
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			response.ParamError(c, "无效的时区: "+req.Timezone)
+			return
+		}
+	}
+
+	now := time.Now()
+	device := DeviceToken{
+		AppID:      appID,
+		UserID:     user.ID,
+		Platform:   req.Platform,
+		Provider:   req.Provider,
+		Token:      req.Token,
+		AppVersion: req.AppVersion,
+		Timezone:   req.Timezone,
+		Status:     DeviceActive,
+		LastSeenAt: now,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "provider", "app_version", "timezone", "status", "last_seen_at", "updated_at"}),
+	}).Create(&device).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, gin.H{"token": device.Token, "provider": device.Provider}, "设备注册成功")
+}
+
+// UnregisterDevice 客户端注销设备令牌（退出登录或关闭通知时调用）
+func UnregisterDevice(c *gin.Context) {
+	appID, ok := middleware.BoundAppID(c)
+	if !ok {
+		response.Unauthorized(c, "缺少APP签名认证")
+		return
+	}
+
+	query := db.Where("app_id = ? AND token = ?", appID, c.Param("token"))
+	if user, ok := middleware.GetAppUser(c); ok {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	if err := query.Delete(&DeviceToken{}).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, nil, "设备已注销")
+}
+
+// ListDevices 设备令牌列表
+func ListDevices(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	query := db.Model(&DeviceToken{}).Where("app_id = ?", appID)
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if platform := c.Query("platform"); platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var devices []DeviceToken
+	if err := query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&devices).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.PageSuccess(c, devices, total, page, size)
+}
@@ -0,0 +1,521 @@
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	"app-platform-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 推送任务状态
+const (
+	PushPending   = "pending"
+	PushSending   = "sending"
+	PushSent      = "sent"
+	PushCancelled = "cancelled"
+)
+
+// 单个设备的投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliverySuccess   = "success"
+	DeliveryFailed    = "failed"
+	DeliveryInvalid   = "invalid" // 令牌失效，设备已移除
+	DeliveryCancelled = "cancelled"
+)
+
+const (
+	deliveryBatchSize   = 20
+	deliveryLease       = 10 * time.Minute // 需大于一批投递的最长耗时
+	deliverySendTimeout = 20 * time.Second
+	deliveryMaxAttempts = 5
+	deliveryRetryBase   = 30 * time.Second
+	deliveryPollPeriod  = 2 * time.Second
+	fanoutBatchSize     = 500
+)
+
+// PushDelivery 推送任务到单个设备的投递记录，作为持久化发送队列
+type PushDelivery struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	PushID        uint       `gorm:"uniqueIndex:idx_push_delivery_device,priority:1" json:"push_id"`
+	AppID         uint       `gorm:"index" json:"app_id"`
+	DeviceID      uint       `gorm:"uniqueIndex:idx_push_delivery_device,priority:2" json:"device_id"`
+	Token         string     `gorm:"size:255" json:"token"`
+	Provider      string     `gorm:"size:20" json:"provider"`
+	Status        string     `gorm:"size:20;default:pending;index:idx_push_delivery_queue,priority:1" json:"status"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_push_delivery_queue,priority:2" json:"next_attempt_at"`
+	LeaseUntil    *time.Time `json:"-"`
+	ClaimToken    string     `gorm:"size:32;index" json:"-"`
+	MessageID     string     `gorm:"size:255" json:"message_id"`
+	Error         string     `gorm:"size:500" json:"error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (PushDelivery) TableName() string {
+	return "push_deliveries"
+}
+
+// MigrateDB 迁移推送模块自有的数据表
+func MigrateDB(database *gorm.DB) error {
+	return database.AutoMigrate(&DeviceToken{}, &PushDelivery{}, &PushSchedule{})
+}
+
+// errNotPending 推送任务已被发送或取消
+var errNotPending = errors.New("只有待发送状态的推送可以发送")
+
+// errInvalidTarget 推送目标无效（目标为空、分群不存在或规则无效），重试也无法发送
+var errInvalidTarget = errors.New("无效的推送目标")
+
+func invalidTarget(err error) error {
+	return fmt.Errorf("%w: %v", errInvalidTarget, err)
+}
+
+// enqueue 将待发送的推送任务展开为设备投递记录并标记为发送中
+// 状态切换、展开与生成重复推送的下一期在同一事务内完成，同一任务只会被展开一次
+// 设置了投递窗口时，各设备的首次投递时间推迟到其本地时间的窗口内
+func enqueue(record *model.PushRecord) (int64, error) {
+	var total int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.PushRecord{}).
+			Where("id = ? AND status = ?", record.ID, PushPending).
+			Updates(map[string]interface{}{"status": PushSending, "sent_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotPending
+		}
+
+		query, err := targetDevices(tx, record)
+		if err != nil {
+			return err
+		}
+		schedule := scheduleFor(tx, record.ID)
+		window := schedule.window()
+
+		var devices []DeviceToken
+		err = query.FindInBatches(&devices, fanoutBatchSize, func(batch *gorm.DB, _ int) error {
+			deliveries := make([]PushDelivery, 0, len(devices))
+			for _, d := range devices {
+				deliveries = append(deliveries, PushDelivery{
+					PushID:        record.ID,
+					AppID:         record.AppID,
+					DeviceID:      d.ID,
+					Token:         d.Token,
+					Provider:      d.Provider,
+					Status:        DeliveryPending,
+					NextAttemptAt: window.next(now, d.Timezone),
+				})
+			}
+			total += int64(len(deliveries))
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+		}).Error
+		if err != nil {
+			return err
+		}
+		return spawnNext(tx, record, schedule, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if total == 0 {
+		// 没有可投递的设备，直接完成
+		rollup(record.ID)
+	}
+	wakeDispatcher()
+	return total, nil
+}
+
+// targetDevices 按推送目标查询设备
+// 目标本身无效时返回包装 errInvalidTarget 的错误，数据库错误原样返回
+func targetDevices(tx *gorm.DB, record *model.PushRecord) (*gorm.DB, error) {
+	query := ActiveDevices(tx, record.AppID)
+
+	switch record.TargetType {
+	case "", "all":
+		return query, nil
+	case "user":
+		// 目标可以是用户主键ID或 open_id
+		var ids []uint
+		var openIDs []string
+		for _, target := range splitTargets(record.TargetIDs) {
+			if id, err := strconv.ParseUint(target, 10, 64); err == nil {
+				ids = append(ids, uint(id))
+			} else {
+				openIDs = append(openIDs, target)
+			}
+		}
+		if len(openIDs) > 0 {
+			var resolved []uint
+			if err := tx.Model(&model.User{}).Where("app_id = ? AND open_id IN ?", record.AppID, openIDs).
+				Pluck("id", &resolved).Error; err != nil {
+				return nil, err
+			}
+			ids = append(ids, resolved...)
+		}
+		if len(ids) == 0 {
+			return nil, invalidTarget(errors.New("目标用户不能为空"))
+		}
+		return query.Where("user_id IN ?", ids), nil
+	case "tag":
+		tags := splitTargets(record.TargetIDs)
+		if len(tags) == 0 {
+			return nil, invalidTarget(errors.New("目标标签不能为空"))
+		}
+		return query.Where("user_id IN (?)", segmentapi.TaggedUsers(tx, record.AppID, tags)), nil
+	case "segment":
+		segmentID, err := segmentapi.ParseID(record.TargetIDs)
+		if err != nil {
+			return nil, invalidTarget(err)
+		}
+		users, err := segmentapi.Users(tx, record.AppID, segmentID)
+		var ruleErr *segmentapi.RuleError
+		if errors.Is(err, segmentapi.ErrNotFound) || errors.As(err, &ruleErr) {
+			return nil, invalidTarget(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return query.Where("user_id IN (?)", users), nil
+	}
+	return nil, invalidTarget(fmt.Errorf("无效的目标类型: %s", record.TargetType))
+}
+
+// splitTargets 拆分逗号分隔的目标列表
+func splitTargets(targets string) []string {
+	var list []string
+	for _, target := range strings.Split(targets, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			list = append(list, target)
+		}
+	}
+	return list
+}
+
+// ActiveDevices 返回APP有效设备的查询，作为分群按版本圈选与估算可触达用户的数据来源
+func ActiveDevices(tx *gorm.DB, appID uint) *gorm.DB {
+	return tx.Model(&DeviceToken{}).Where("app_id = ? AND status = ?", appID, DeviceActive)
+}
+
+// cancelDeliveries 取消推送任务尚未发出的投递
+// 已被工作协程认领但未发出的投递同样取消，清空认领令牌后工作协程不会再发送
+func cancelDeliveries(pushID uint) error {
+	err := db.Model(&PushDelivery{}).
+		Where("push_id = ? AND status IN ?", pushID, []string{DeliveryPending, DeliverySending}).
+		Updates(map[string]interface{}{"status": DeliveryCancelled, "claim_token": "", "lease_until": nil}).Error
+	if err == nil {
+		rollup(pushID)
+	}
+	return err
+}
+
+// rollup 按投递记录汇总推送任务的发送数据，全部投递结束后标记为已发送
+func rollup(pushID uint) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	if err := db.Model(&PushDelivery{}).Select("status, COUNT(*) AS count").
+		Where("push_id = ?", pushID).Group("status").Scan(&rows).Error; err != nil {
+		log.Printf("[Push] Rollup push %d failed: %v", pushID, err)
+		return
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	stats := summarize(counts)
+
+	db.Model(&model.PushRecord{}).Where("id = ?", pushID).Updates(map[string]interface{}{
+		"sent_count":    stats.sent,
+		"success_count": stats.success,
+		"failed_count":  stats.failed,
+	})
+	if !stats.inFlight {
+		db.Model(&model.PushRecord{}).Where("id = ? AND status = ?", pushID, PushSending).Update("status", PushSent)
+	}
+}
+
+type deliveryStats struct {
+	sent, success, failed int
+	inFlight              bool
+}
+
+// summarize 按投递状态计数汇总：已发送数为已有结果的投递数，令牌失效计为失败
+func summarize(counts map[string]int) deliveryStats {
+	stats := deliveryStats{
+		success: counts[DeliverySuccess],
+		failed:  counts[DeliveryFailed] + counts[DeliveryInvalid],
+	}
+	stats.sent = stats.success + stats.failed
+	stats.inFlight = counts[DeliveryPending]+counts[DeliverySending] > 0
+	return stats
+}
+
+// retryDelay 第 attempts 次失败后的重试间隔（指数退避）
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return deliveryRetryBase << uint(attempts-1)
+}
+
+// Dispatcher 推送投递工作池
+// 各工作协程通过租约认领投递记录，进程崩溃后租约过期的记录会被重新认领
+type Dispatcher struct {
+	db      *gorm.DB
+	workers int
+	notify  chan struct{}
+	once    sync.Once
+	stopped chan struct{}
+}
+
+var dispatcher *Dispatcher
+
+// NewDispatcher 创建推送投递工作池
+func NewDispatcher(database *gorm.DB, workers int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Dispatcher{
+		db:      database,
+		workers: workers,
+		notify:  make(chan struct{}, workers),
+		stopped: make(chan struct{}),
+	}
+}
+
+// StartDispatcher 启动全局推送投递工作池
+func StartDispatcher(workers int) {
+	if dispatcher == nil {
+		dispatcher = NewDispatcher(db, workers)
+	}
+	dispatcher.Start()
+}
+
+// StopDispatcher 停止全局推送投递工作池
+func StopDispatcher() {
+	if dispatcher != nil {
+		dispatcher.Stop()
+	}
+}
+
+// CheckWorkers 检查投递工作池与计划推送调度器是否在运行
+func CheckWorkers() error {
+	if dispatcher == nil || isClosed(dispatcher.stopped) {
+		return errors.New("推送投递工作池未运行")
+	}
+	if scheduler == nil || isClosed(scheduler.stopped) {
+		return errors.New("计划推送调度器未运行")
+	}
+	return nil
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func wakeDispatcher() {
+	if dispatcher != nil {
+		dispatcher.wake()
+	}
+}
+
+// Start 启动工作协程
+func (d *Dispatcher) Start() {
+	d.once.Do(func() {
+		for i := 0; i < d.workers; i++ {
+			go d.loop()
+		}
+		log.Printf("[Push] Delivery dispatcher started (%d workers)", d.workers)
+	})
+}
+
+// Stop 停止工作协程，已认领的投递会在租约到期后由其他实例继续
+func (d *Dispatcher) Stop() {
+	select {
+	case <-d.stopped:
+	default:
+		close(d.stopped)
+	}
+}
+
+func (d *Dispatcher) wake() {
+	for i := 0; i < d.workers; i++ {
+		select {
+		case d.notify <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) loop() {
+	ticker := time.NewTicker(deliveryPollPeriod)
+	defer ticker.Stop()
+
+	for {
+		for d.runBatch() {
+			select {
+			case <-d.stopped:
+				return
+			default:
+			}
+		}
+		select {
+		case <-d.stopped:
+			return
+		case <-d.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBatch 认领并投递一批记录，没有可投递的记录时返回 false
+func (d *Dispatcher) runBatch() bool {
+	claim := newClaimToken()
+	now := time.Now()
+	lease := now.Add(deliveryLease)
+
+	result := d.db.Model(&PushDelivery{}).
+		Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND lease_until < ?)",
+			DeliveryPending, now, DeliverySending, now).
+		Order("id ASC").Limit(deliveryBatchSize).
+		Updates(map[string]interface{}{
+			"status":      DeliverySending,
+			"claim_token": claim,
+			"lease_until": lease,
+			"attempts":    gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil {
+		log.Printf("[Push] Claim deliveries failed: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	var deliveries []PushDelivery
+	d.db.Where("claim_token = ? AND status = ?", claim, DeliverySending).Order("id ASC").Find(&deliveries)
+
+	records := make(map[uint]*model.PushRecord)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		record, ok := records[delivery.PushID]
+		if !ok {
+			record = &model.PushRecord{}
+			if err := d.db.Unscoped().First(record, delivery.PushID).Error; err != nil {
+				record = nil
+			}
+			records[delivery.PushID] = record
+		}
+		d.deliver(claim, delivery, record)
+	}
+
+	for pushID := range records {
+		rollup(pushID)
+	}
+	return true
+}
+
+// deliver 投递单条记录并保存结果，仅在仍持有认领时写回
+func (d *Dispatcher) deliver(claim string, delivery *PushDelivery, record *model.PushRecord) {
+	var res Result
+	switch {
+	case record == nil || record.DeletedAt.Valid || record.Status == PushCancelled:
+		d.finish(claim, delivery, map[string]interface{}{"status": DeliveryCancelled})
+		return
+	case !d.holds(claim, delivery.ID):
+		// 认领期间任务被取消
+		return
+	default:
+		provider, err := providers.get(delivery.AppID, delivery.Provider)
+		if err != nil {
+			res = Result{Status: ResultRejected, Error: err.Error()}
+			break
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), deliverySendTimeout)
+		res = provider.Send(ctx, delivery.Token, notificationFor(record))
+		cancel()
+	}
+
+	updates := map[string]interface{}{"error": truncate(res.Error, 500), "message_id": res.MessageID}
+	switch res.Status {
+	case ResultSuccess:
+		updates["status"] = DeliverySuccess
+	case ResultInvalidToken:
+		updates["status"] = DeliveryInvalid
+		// 失效令牌直接从设备表中移除，避免后续推送继续投递
+		d.db.Where("id = ? AND token = ?", delivery.DeviceID, delivery.Token).Delete(&DeviceToken{})
+	case ResultFailed:
+		if delivery.Attempts < deliveryMaxAttempts {
+			updates["status"] = DeliveryPending
+			updates["next_attempt_at"] = time.Now().Add(retryDelay(delivery.Attempts))
+		} else {
+			updates["status"] = DeliveryFailed
+		}
+	default:
+		updates["status"] = DeliveryFailed
+	}
+	d.finish(claim, delivery, updates)
+}
+
+// holds 判断投递记录是否仍由本次认领持有
+func (d *Dispatcher) holds(claim string, id uint) bool {
+	var count int64
+	d.db.Model(&PushDelivery{}).Where("id = ? AND claim_token = ?", id, claim).Count(&count)
+	return count > 0
+}
+
+func (d *Dispatcher) finish(claim string, delivery *PushDelivery, updates map[string]interface{}) {
+	updates["claim_token"] = ""
+	updates["lease_until"] = nil
+	d.db.Model(&PushDelivery{}).Where("id = ? AND claim_token = ?", delivery.ID, claim).Updates(updates)
+}
+
+// notificationFor 由推送任务生成通知内容
+func notificationFor(record *model.PushRecord) *Notification {
+	return &Notification{
+		Title: record.Title,
+		Body:  record.Content,
+		Data:  map[string]string{"push_id": fmt.Sprint(record.ID)},
+	}
+}
+
+func newClaimToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// truncate 按字符截断，与 varchar 长度语义一致
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
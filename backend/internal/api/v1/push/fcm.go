@@ -0,0 +1,237 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	fcmEndpoint = "https://fcm.googleapis.com"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+	googleToken = "https://oauth2.googleapis.com/token"
+)
+
+// fcmConfig FCM HTTP v1 通道配置，字段与 Firebase 服务账号JSON一致
+type fcmConfig struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	Endpoint    string `json:"endpoint"` // 可选，覆盖默认地址
+}
+
+// fcmProvider 通过 FCM HTTP v1 接口发送通知
+type fcmProvider struct {
+	config fcmConfig
+	key    *rsa.PrivateKey
+	client *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func newFCMProvider(raw json.RawMessage) (Provider, error) {
+	var cfg fcmConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ProjectID == "" || cfg.ClientEmail == "" || cfg.PrivateKey == "" {
+		return nil, errors.New("project_id、client_email、private_key 不能为空")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("private_key 无效: %w", err)
+	}
+	if cfg.TokenURI == "" {
+		cfg.TokenURI = googleToken
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fcmEndpoint
+	}
+	return &fcmProvider{config: cfg, key: key, client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+// Name 通道名称
+func (p *fcmProvider) Name() string {
+	return ProviderFCM
+}
+
+// token 使用服务账号签名换取 OAuth2 访问令牌，提前一分钟刷新
+func (p *fcmProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.expiresAt.Add(-time.Minute)) {
+		return p.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.config.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.config.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("获取访问令牌失败: %d %s", resp.StatusCode, result.Error)
+	}
+	p.accessToken = result.AccessToken
+	p.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return p.accessToken, nil
+}
+
+// Send 发送通知
+func (p *fcmProvider) Send(ctx context.Context, deviceToken string, n *Notification) Result {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		// 鉴权失败多为网络或配置问题，按可重试处理
+		return Result{Status: ResultFailed, Error: err.Error()}
+	}
+
+	message := map[string]interface{}{
+		"token":        deviceToken,
+		"notification": map[string]string{"title": n.Title, "body": n.Body},
+	}
+	if len(n.Data) > 0 {
+		message["data"] = n.Data
+	}
+	if n.Sound != "" {
+		message["android"] = map[string]interface{}{"notification": map[string]string{"sound": n.Sound}}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"message": message})
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.config.Endpoint, p.config.ProjectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{Status: ResultRejected, Error: err.Error()}
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Result{Status: ResultFailed, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	if resp.StatusCode == http.StatusOK {
+		var ok struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(data, &ok)
+		return Result{Status: ResultSuccess, MessageID: ok.Name}
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		p.mu.Lock()
+		p.accessToken = ""
+		p.mu.Unlock()
+	}
+	return classifyFCM(resp.StatusCode, data)
+}
+
+// Check 换取访问令牌并以 validate_only 方式发送到占位令牌：
+// 凭据与项目正确时 FCM 只会拒绝令牌本身（INVALID_ARGUMENT）
+func (p *fcmProvider) Check(ctx context.Context) error {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"validate_only": true,
+		"message":       map[string]interface{}{"token": "connectivity-check"},
+	})
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.config.Endpoint, p.config.ProjectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法连接FCM: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusBadRequest {
+		return nil
+	}
+	return errors.New(classifyFCM(resp.StatusCode, data).Error)
+}
+
+// classifyFCM 按状态码与错误码对FCM响应分类
+func classifyFCM(status int, body []byte) Result {
+	var fcmErr struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &fcmErr)
+	code := fcmErr.Error.Status
+	for _, d := range fcmErr.Error.Details {
+		if d.ErrorCode != "" {
+			code = d.ErrorCode
+		}
+	}
+	msg := fmt.Sprintf("FCM %d %s %s", status, code, fcmErr.Error.Message)
+
+	switch {
+	case code == "UNREGISTERED", status == http.StatusNotFound:
+		return Result{Status: ResultInvalidToken, Error: msg}
+	case code == "INVALID_ARGUMENT" && strings.Contains(strings.ToLower(fcmErr.Error.Message), "token"):
+		return Result{Status: ResultInvalidToken, Error: msg}
+	case status == http.StatusUnauthorized, status == http.StatusTooManyRequests, status >= 500:
+		return Result{Status: ResultFailed, Error: msg}
+	}
+	return Result{Status: ResultRejected, Error: msg}
+}
@@ -0,0 +1,259 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"app-platform-backend/core/module"
+)
+
+// 推送通道
+const (
+	ProviderAPNs = "apns"
+	ProviderFCM  = "fcm"
+	ProviderMock = "mock"
+)
+
+// 单个设备的投递结果
+const (
+	ResultSuccess      = "success"
+	ResultFailed       = "failed"        // 可重试的失败（网络错误、限流、服务端错误）
+	ResultRejected     = "rejected"      // 不可重试的失败（内容不合法、证书错误等）
+	ResultInvalidToken = "invalid_token" // 设备令牌已失效，需要从设备表中移除
+)
+
+// pushConfigModule 推送通道配置所在的APP模块
+// 配置格式：{"providers": {"apns": {...}, "fcm": {...}, "mock": {...}}}
+const pushConfigModule = "push_send"
+
+// providerCacheTTL 通道实例缓存时间，过期后重新读取APP配置
+const providerCacheTTL = time.Minute
+
+// Notification 发送给单个设备的通知内容
+type Notification struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+	Badge *int              `json:"badge,omitempty"`
+	Sound string            `json:"sound,omitempty"`
+}
+
+// Result 单个设备的投递结果
+type Result struct {
+	Status    string
+	MessageID string
+	Error     string
+}
+
+// Provider 推送通道
+type Provider interface {
+	// Name 通道名称，与 DeviceToken.Provider 对应
+	Name() string
+	// Send 向单个设备发送通知，错误通过 Result 返回
+	Send(ctx context.Context, token string, n *Notification) Result
+}
+
+// ProviderFactory 根据APP的通道配置创建通道实例
+type ProviderFactory func(config json.RawMessage) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]ProviderFactory{
+		ProviderAPNs: newAPNsProvider,
+		ProviderFCM:  newFCMProvider,
+		ProviderMock: newMockProvider,
+	}
+)
+
+// RegisterProvider 注册或替换推送通道实现
+func RegisterProvider(name string, factory ProviderFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+	providers.reset()
+}
+
+// checker 是通道可选实现的接口，用于测试凭据与网络连通性
+type checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckProviders 按推送配置创建全部通道并逐个测试连通性，
+// 配置格式与APP模块 push_send 的配置相同
+func CheckProviders(ctx context.Context, config json.RawMessage) error {
+	var cfg struct {
+		Providers map[string]json.RawMessage `json:"providers"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return fmt.Errorf("推送配置格式错误: %w", err)
+	}
+	if len(cfg.Providers) == 0 {
+		return errors.New("未配置任何推送通道")
+	}
+
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failures []string
+	for _, name := range names {
+		factoriesMu.RLock()
+		factory, ok := factories[name]
+		factoriesMu.RUnlock()
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: 不支持的推送通道", name))
+			continue
+		}
+		p, err := factory(cfg.Providers[name])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if c, ok := p.(checker); ok {
+			if err := c.Check(ctx); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// providerForPlatform 设备平台默认使用的通道
+func providerForPlatform(platform string) string {
+	switch platform {
+	case "ios":
+		return ProviderAPNs
+	case "android":
+		return ProviderFCM
+	}
+	return platform
+}
+
+// providerCache 按APP缓存通道实例（APNs/FCM 的鉴权令牌可在实例内复用）
+type providerCache struct {
+	mu      sync.Mutex
+	entries map[uint]*providerEntry
+}
+
+type providerEntry struct {
+	providers map[string]Provider
+	errors    map[string]error
+	expires   time.Time
+}
+
+var providers = &providerCache{entries: make(map[uint]*providerEntry)}
+
+func (c *providerCache) reset() {
+	c.mu.Lock()
+	c.entries = make(map[uint]*providerEntry)
+	c.mu.Unlock()
+}
+
+// InvalidateProviders 丢弃APP的通道实例，下次投递时按最新配置重新创建
+func InvalidateProviders(appID uint) {
+	providers.mu.Lock()
+	delete(providers.entries, appID)
+	providers.mu.Unlock()
+}
+
+// get 获取APP的指定通道，APP未配置该通道时返回错误
+func (c *providerCache) get(appID uint, name string) (Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[appID]
+	if !ok || time.Now().After(entry.expires) {
+		entry = loadProviders(appID)
+		c.entries[appID] = entry
+	}
+	if p, ok := entry.providers[name]; ok {
+		return p, nil
+	}
+	if err, ok := entry.errors[name]; ok {
+		return nil, err
+	}
+	return nil, fmt.Errorf("APP未配置推送通道 %s", name)
+}
+
+// loadProviders 读取APP的推送通道配置并创建通道实例
+func loadProviders(appID uint) *providerEntry {
+	entry := &providerEntry{
+		providers: make(map[string]Provider),
+		errors:    make(map[string]error),
+		expires:   time.Now().Add(providerCacheTTL),
+	}
+
+	cfg, err := module.AppConfig[struct {
+		Providers map[string]json.RawMessage `json:"providers"`
+	}](appID, pushConfigModule)
+	if err != nil {
+		log.Printf("[Push] Failed to load provider config for app %d: %v", appID, err)
+		return entry
+	}
+
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	for name, raw := range cfg.Providers {
+		factory, ok := factories[name]
+		if !ok {
+			entry.errors[name] = fmt.Errorf("不支持的推送通道: %s", name)
+			continue
+		}
+		p, err := factory(raw)
+		if err != nil {
+			entry.errors[name] = fmt.Errorf("推送通道 %s 配置无效: %w", name, err)
+			continue
+		}
+		entry.providers[name] = p
+	}
+	return entry
+}
+
+// MockProvider 本地模拟通道，用于测试和联调
+// 令牌以 invalid 开头视为失效，以 fail 开头视为可重试失败，其余均成功
+type MockProvider struct {
+	mu   sync.Mutex
+	Sent []MockDelivery
+}
+
+// MockDelivery 模拟通道记录的一次发送
+type MockDelivery struct {
+	Token        string
+	Notification Notification
+}
+
+func newMockProvider(json.RawMessage) (Provider, error) {
+	return &MockProvider{}, nil
+}
+
+// Name 通道名称
+func (p *MockProvider) Name() string {
+	return ProviderMock
+}
+
+// Send 记录发送内容并按令牌前缀返回结果
+func (p *MockProvider) Send(ctx context.Context, token string, n *Notification) Result {
+	p.mu.Lock()
+	p.Sent = append(p.Sent, MockDelivery{Token: token, Notification: *n})
+	p.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(token, "invalid"):
+		return Result{Status: ResultInvalidToken, Error: "unregistered"}
+	case strings.HasPrefix(token, "fail"):
+		return Result{Status: ResultFailed, Error: "mock failure"}
+	}
+	return Result{Status: ResultSuccess, MessageID: fmt.Sprintf("mock-%d", time.Now().UnixNano())}
+}
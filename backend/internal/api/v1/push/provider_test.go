@@ -0,0 +1,54 @@
+package push
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClassifyResponses(t *testing.T) {
+	cases := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{"apns gone", classifyAPNs(410, "Unregistered"), ResultInvalidToken},
+		{"apns bad token", classifyAPNs(400, "BadDeviceToken"), ResultInvalidToken},
+		{"apns throttled", classifyAPNs(429, "TooManyRequests"), ResultFailed},
+		{"apns bad payload", classifyAPNs(400, "PayloadEmpty"), ResultRejected},
+		{"fcm unregistered", classifyFCM(404, []byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`)), ResultInvalidToken},
+		{"fcm bad token", classifyFCM(400, []byte(`{"error":{"status":"INVALID_ARGUMENT","message":"The registration token is not a valid FCM registration token"}}`)), ResultInvalidToken},
+		{"fcm unavailable", classifyFCM(503, []byte(`{"error":{"status":"UNAVAILABLE"}}`)), ResultFailed},
+		{"fcm bad field", classifyFCM(400, []byte(`{"error":{"status":"INVALID_ARGUMENT","message":"Invalid JSON payload"}}`)), ResultRejected},
+	}
+	for _, tc := range cases {
+		if tc.result.Status != tc.want {
+			t.Errorf("%s: got %s (%s), want %s", tc.name, tc.result.Status, tc.result.Error, tc.want)
+		}
+	}
+}
+
+func TestMockProvider(t *testing.T) {
+	p, _ := newMockProvider(nil)
+	n := &Notification{Title: "t", Body: "b"}
+	for token, want := range map[string]string{"ok-1": ResultSuccess, "invalid-1": ResultInvalidToken, "fail-1": ResultFailed} {
+		if got := p.Send(context.Background(), token, n).Status; got != want {
+			t.Errorf("token %s: got %s, want %s", token, got, want)
+		}
+	}
+	if sent := len(p.(*MockProvider).Sent); sent != 3 {
+		t.Errorf("recorded %d sends, want 3", sent)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	stats := summarize(map[string]int{DeliverySuccess: 7, DeliveryFailed: 2, DeliveryInvalid: 1, DeliveryCancelled: 4})
+	if stats.sent != 10 || stats.success != 7 || stats.failed != 3 || stats.inFlight {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if !summarize(map[string]int{DeliverySuccess: 1, DeliveryPending: 1}).inFlight {
+		t.Error("pending deliveries should keep the push in flight")
+	}
+	if retryDelay(1) != deliveryRetryBase || retryDelay(3) != 4*deliveryRetryBase {
+		t.Errorf("unexpected backoff %v %v", retryDelay(1), retryDelay(3))
+	}
+}
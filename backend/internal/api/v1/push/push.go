@@ -1,6 +1,8 @@
 package push
 
 import (
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	templateapi "app-platform-backend/internal/api/v1/template"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/response"
 	"app-platform-backend/internal/validator"
@@ -56,12 +58,16 @@ func List(c *gin.Context) {
 // Create 创建推送任务
 func Create(c *gin.Context) {
 	var req struct {
-		AppID       uint     `json:"app_id" binding:"required"`
-		Title       string   `json:"title" binding:"required"`
-		Content     string   `json:"content" binding:"required"`
-		TargetType  string   `json:"target_type"`
-		TargetIDs   []string `json:"target_ids"`
-		ScheduledAt string   `json:"scheduled_at"`
+		AppID       uint                   `json:"app_id" binding:"required"`
+		Title       string                 `json:"title"`
+		Content     string                 `json:"content"`
+		TemplateID  uint                   `json:"template_id"`
+		Variables   map[string]interface{} `json:"variables"`
+		Locale      string                 `json:"locale"`
+		TargetType  string                 `json:"target_type"`
+		TargetIDs   []string               `json:"target_ids"`
+		ScheduledAt string                 `json:"scheduled_at"`
+		scheduleRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -69,6 +75,16 @@ func Create(c *gin.Context) {
 		return
 	}
 
+	// 指定模板时由服务端渲染标题与内容
+	if req.TemplateID > 0 {
+		rendered, err := templateapi.Render(req.AppID, templateapi.ChannelPush, req.TemplateID, req.Locale, req.Variables)
+		if err != nil {
+			templateapi.RenderFailed(c, err)
+			return
+		}
+		req.Title, req.Content = rendered.Title, rendered.Content
+	}
+
 	// 验证标题长度
 	if len(req.Title) < 1 || len(req.Title) > 100 {
 		response.ParamError(c, "标题长度应在1-100个字符之间")
@@ -91,6 +107,28 @@ func Create(c *gin.Context) {
 		response.ParamError(c, "无效的目标类型，请使用: all, user, tag, segment")
 		return
 	}
+	switch req.TargetType {
+	case "user", "tag":
+		if len(req.TargetIDs) == 0 {
+			response.ParamError(c, "target_ids 不能为空")
+			return
+		}
+	case "segment":
+		// 分群推送只能指定一个分群，发送时按分群规则实时圈选
+		if len(req.TargetIDs) != 1 {
+			response.ParamError(c, "分群推送需要在 target_ids 中指定一个分群ID")
+			return
+		}
+		segmentID, err := segmentapi.ParseID(req.TargetIDs[0])
+		if err != nil {
+			response.ParamError(c, err.Error())
+			return
+		}
+		if _, err := segmentapi.Users(db, req.AppID, segmentID); err != nil {
+			response.ParamError(c, err.Error())
+			return
+		}
+	}
 
 	record := model.PushRecord{
 		AppID:      req.AppID,
@@ -101,8 +139,18 @@ func Create(c *gin.Context) {
 		Status:     "pending",
 	}
 
+	// 设置了时区时计划时间按该时区解析
+	loc := time.UTC
+	if req.Timezone != "" {
+		var err error
+		if loc, err = loadLocation(req.Timezone); err != nil {
+			response.ParamError(c, err.Error())
+			return
+		}
+	}
+
 	if req.ScheduledAt != "" {
-		scheduledTime, err := time.Parse("2006-01-02 15:04:05", req.ScheduledAt)
+		scheduledTime, err := time.ParseInLocation("2006-01-02 15:04:05", req.ScheduledAt, loc)
 		if err != nil {
 			response.ParamError(c, "计划发送时间格式错误，请使用: 2006-01-02 15:04:05")
 			return
@@ -114,7 +162,27 @@ func Create(c *gin.Context) {
 		record.ScheduledAt = &scheduledTime
 	}
 
-	if err := db.Create(&record).Error; err != nil {
+	var schedule *PushSchedule
+	if !req.scheduleRequest.empty() {
+		var err error
+		if schedule, err = req.scheduleRequest.build(record.ScheduledAt); err != nil {
+			response.ParamError(c, err.Error())
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if schedule == nil {
+			return nil
+		}
+		schedule.PushID = record.ID
+		schedule.SeriesID = record.ID
+		return tx.Create(schedule).Error
+	})
+	if err != nil {
 		response.DBError(c, err)
 		return
 	}
@@ -145,6 +213,38 @@ func Detail(c *gin.Context) {
 	response.Success(c, record)
 }
 
+// Deliveries 推送任务的设备投递明细
+func Deliveries(c *gin.Context) {
+	id := c.Param("id")
+
+	// 验证ID
+	if _, err := validator.ValidateID(id); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	query := db.Model(&PushDelivery{}).Where("push_id = ?", id)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var deliveries []PushDelivery
+	if err := query.Offset((page - 1) * size).Limit(size).Order("id ASC").Find(&deliveries).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.PageSuccess(c, deliveries, total, page, size)
+}
+
 // Send 立即发送推送
 func Send(c *gin.Context) {
 	id := c.Param("id")
@@ -165,33 +265,22 @@ func Send(c *gin.Context) {
 		return
 	}
 
-	if record.Status != "pending" {
+	if record.Status != PushPending {
 		response.ParamError(c, "只有待发送状态的推送可以发送")
 		return
 	}
 
-	// 模拟发送推送
-	now := time.Now()
-	sentCount := 100
-	successCount := 95
-	failedCount := 5
-
-	if err := db.Model(&record).Updates(map[string]interface{}{
-		"status":        "sent",
-		"sent_at":       now,
-		"sent_count":    sentCount,
-		"success_count": successCount,
-		"failed_count":  failedCount,
-	}).Error; err != nil {
-		response.DBError(c, err)
+	// 展开为设备投递记录，由后台工作池通过各推送通道发送
+	queued, err := enqueue(&record)
+	if err != nil {
+		response.ParamError(c, err.Error())
 		return
 	}
 
 	response.SuccessWithMessage(c, gin.H{
-		"sent_count":    sentCount,
-		"success_count": successCount,
-		"failed_count":  failedCount,
-	}, "推送发送成功")
+		"status": PushSending,
+		"queued": queued,
+	}, "推送已进入发送队列")
 }
 
 // Cancel 取消推送任务
@@ -214,12 +303,23 @@ func Cancel(c *gin.Context) {
 		return
 	}
 
-	if record.Status != "pending" {
-		response.ParamError(c, "只有待发送状态的推送可以取消")
+	if record.Status != PushPending && record.Status != PushSending {
+		response.ParamError(c, "只有待发送或发送中的推送可以取消")
 		return
 	}
 
-	if err := db.Model(&record).Update("status", "cancelled").Error; err != nil {
+	result := db.Model(&model.PushRecord{}).Where("id = ? AND status IN ?", record.ID, []string{PushPending, PushSending}).
+		Update("status", PushCancelled)
+	if result.Error != nil {
+		response.DBError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.ParamError(c, "推送已发送完成，无法取消")
+		return
+	}
+	// 已发出的投递无法撤回，仅取消尚未发出的部分
+	if err := cancelDeliveries(record.ID); err != nil {
 		response.DBError(c, err)
 		return
 	}
@@ -263,11 +363,12 @@ func Stats(c *gin.Context) {
 		return
 	}
 
-	var total, pending, sent, cancelled int64
+	var total, pending, sending, sent, cancelled int64
 	var totalSent, totalSuccess, totalFailed int64
 
 	db.Model(&model.PushRecord{}).Where("app_id = ?", appID).Count(&total)
 	db.Model(&model.PushRecord{}).Where("app_id = ? AND status = ?", appID, "pending").Count(&pending)
+	db.Model(&model.PushRecord{}).Where("app_id = ? AND status = ?", appID, "sending").Count(&sending)
 	db.Model(&model.PushRecord{}).Where("app_id = ? AND status = ?", appID, "sent").Count(&sent)
 	db.Model(&model.PushRecord{}).Where("app_id = ? AND status = ?", appID, "cancelled").Count(&cancelled)
 
@@ -286,6 +387,7 @@ func Stats(c *gin.Context) {
 	response.Success(c, gin.H{
 		"total":         total,
 		"pending":       pending,
+		"sending":       sending,
 		"sent":          sent,
 		"cancelled":     cancelled,
 		"total_sent":    totalSent,
@@ -299,12 +401,3 @@ func Stats(c *gin.Context) {
 func Tasks(c *gin.Context) {
 	List(c)
 }
-
-// Templates 推送模板（兼容旧接口）
-func Templates(c *gin.Context) {
-	response.Success(c, []gin.H{
-		{"id": 1, "name": "系统通知", "title_template": "【系统通知】{{title}}", "content_template": "{{content}}"},
-		{"id": 2, "name": "活动推送", "title_template": "【活动】{{title}}", "content_template": "{{content}}，点击查看详情"},
-		{"id": 3, "name": "订单通知", "title_template": "订单{{order_id}}状态更新", "content_template": "您的订单{{order_id}}{{status}}"},
-	})
-}
@@ -0,0 +1,429 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/response"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 重复周期
+const (
+	RepeatNone    = ""
+	RepeatDaily   = "daily"
+	RepeatWeekly  = "weekly"
+	RepeatMonthly = "monthly"
+)
+
+const (
+	schedulePollPeriod = 15 * time.Second
+	scheduleBatchSize  = 50
+	scheduleRetryMax   = 10 * time.Minute
+)
+
+// PushSchedule 推送任务的计划发送设置
+// 重复推送每次触发时生成下一期推送任务，各期共用 SeriesID（首期任务ID）
+// 手动取消某一期待发送的任务即终止整个系列；因目标无效被自动取消的一期不影响后续期数
+type PushSchedule struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	PushID      uint       `gorm:"uniqueIndex" json:"push_id"`
+	SeriesID    uint       `gorm:"index" json:"series_id"`
+	Occurrence  int        `gorm:"default:1" json:"occurrence"`
+	Timezone    string     `gorm:"size:64" json:"timezone"`    // 计划时间与未上报时区设备所用的时区
+	WindowStart string     `gorm:"size:5" json:"window_start"` // 设备本地时间的投递窗口，如 09:00
+	WindowEnd   string     `gorm:"size:5" json:"window_end"`   // 早于 WindowStart 表示跨越午夜
+	Repeat      string     `gorm:"size:20" json:"repeat"`
+	RepeatUntil *time.Time `json:"repeat_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (PushSchedule) TableName() string {
+	return "push_schedules"
+}
+
+// scheduleRequest 创建推送时的计划设置
+type scheduleRequest struct {
+	Timezone    string `json:"timezone"`
+	WindowStart string `json:"window_start"`
+	WindowEnd   string `json:"window_end"`
+	Repeat      string `json:"repeat"`
+	RepeatUntil string `json:"repeat_until"`
+}
+
+// empty 未设置任何计划选项
+func (r *scheduleRequest) empty() bool {
+	return r.Timezone == "" && r.WindowStart == "" && r.WindowEnd == "" && r.Repeat == "" && r.RepeatUntil == ""
+}
+
+// build 校验计划设置，scheduledAt 为空时不允许重复推送
+func (r *scheduleRequest) build(scheduledAt *time.Time) (*PushSchedule, error) {
+	schedule := &PushSchedule{Timezone: r.Timezone, Repeat: r.Repeat, WindowStart: r.WindowStart, WindowEnd: r.WindowEnd, Occurrence: 1}
+	loc, err := loadLocation(r.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if (r.WindowStart == "") != (r.WindowEnd == "") {
+		return nil, errors.New("投递窗口需要同时设置 window_start 和 window_end")
+	}
+	if r.WindowStart != "" {
+		start, err1 := parseClock(r.WindowStart)
+		end, err2 := parseClock(r.WindowEnd)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("投递窗口格式错误，请使用: HH:MM")
+		}
+		if start == end {
+			return nil, errors.New("投递窗口的开始与结束时间不能相同")
+		}
+	}
+
+	switch r.Repeat {
+	case RepeatNone:
+		if r.RepeatUntil != "" {
+			return nil, errors.New("repeat_until 仅适用于重复推送")
+		}
+	case RepeatDaily, RepeatWeekly, RepeatMonthly:
+		if scheduledAt == nil {
+			return nil, errors.New("重复推送需要设置计划发送时间")
+		}
+	default:
+		return nil, errors.New("无效的重复周期，请使用: daily, weekly, monthly")
+	}
+	if r.RepeatUntil != "" {
+		until, err := time.ParseInLocation("2006-01-02 15:04:05", r.RepeatUntil, loc)
+		if err != nil {
+			return nil, errors.New("重复截止时间格式错误，请使用: 2006-01-02 15:04:05")
+		}
+		if until.Before(*scheduledAt) {
+			return nil, errors.New("重复截止时间不能早于计划发送时间")
+		}
+		schedule.RepeatUntil = &until
+	}
+	return schedule, nil
+}
+
+// loadLocation 加载时区，为空时使用服务器本地时区
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", name)
+	}
+	return loc, nil
+}
+
+// parseClock 解析 HH:MM，返回自零点起的分钟数
+func parseClock(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, errors.New("invalid clock")
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, errors.New("invalid clock")
+	}
+	return h*60 + m, nil
+}
+
+// deliveryWindow 设备本地时间的投递窗口
+type deliveryWindow struct {
+	start, end int // 自零点起的分钟数
+	fallback   *time.Location
+}
+
+// window 返回计划的投递窗口，未设置时返回 nil
+func (s *PushSchedule) window() *deliveryWindow {
+	if s == nil || s.WindowStart == "" {
+		return nil
+	}
+	start, _ := parseClock(s.WindowStart)
+	end, _ := parseClock(s.WindowEnd)
+	loc, err := loadLocation(s.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	return &deliveryWindow{start: start, end: end, fallback: loc}
+}
+
+// next 返回 now 之后（含）设备本地时间落在窗口内的最早时刻
+func (w *deliveryWindow) next(now time.Time, timezone string) time.Time {
+	if w == nil {
+		return now
+	}
+	loc := w.fallback
+	if timezone != "" {
+		if l, err := time.LoadLocation(timezone); err == nil {
+			loc = l
+		}
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	inside := minute >= w.start && minute < w.end
+	if w.start > w.end {
+		inside = minute >= w.start || minute < w.end
+	}
+	if inside {
+		return now
+	}
+
+	start := time.Date(local.Year(), local.Month(), local.Day(), w.start/60, w.start%60, 0, 0, loc)
+	if !start.After(local) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// nextOccurrence 重复推送的下一期时间，按计划时区计算以正确处理夏令时
+func nextOccurrence(t time.Time, repeat string, loc *time.Location) time.Time {
+	local := t.In(loc)
+	switch repeat {
+	case RepeatDaily:
+		return local.AddDate(0, 0, 1)
+	case RepeatWeekly:
+		return local.AddDate(0, 0, 7)
+	case RepeatMonthly:
+		return local.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// scheduleFor 读取推送任务的计划设置，没有时返回 nil
+func scheduleFor(tx *gorm.DB, pushID uint) *PushSchedule {
+	var schedule PushSchedule
+	if err := tx.Where("push_id = ?", pushID).First(&schedule).Error; err != nil {
+		return nil
+	}
+	return &schedule
+}
+
+// spawnNext 为重复推送生成下一期任务，已过的期数直接跳过，超过截止时间时不再生成
+func spawnNext(tx *gorm.DB, record *model.PushRecord, schedule *PushSchedule, now time.Time) error {
+	if schedule == nil || schedule.Repeat == RepeatNone || record.ScheduledAt == nil {
+		return nil
+	}
+	loc, err := loadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+
+	next := *record.ScheduledAt
+	skipped := 0
+	for !next.After(now) || skipped == 0 {
+		next = nextOccurrence(next, schedule.Repeat, loc)
+		if next.IsZero() {
+			return nil
+		}
+		skipped++
+	}
+	if schedule.RepeatUntil != nil && next.After(*schedule.RepeatUntil) {
+		return nil
+	}
+
+	nextRecord := model.PushRecord{
+		AppID:       record.AppID,
+		Title:       record.Title,
+		Content:     record.Content,
+		TargetType:  record.TargetType,
+		TargetIDs:   record.TargetIDs,
+		Status:      PushPending,
+		ScheduledAt: &next,
+	}
+	if err := tx.Create(&nextRecord).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&PushSchedule{
+		PushID:      nextRecord.ID,
+		SeriesID:    schedule.SeriesID,
+		Occurrence:  schedule.Occurrence + skipped,
+		Timezone:    schedule.Timezone,
+		WindowStart: schedule.WindowStart,
+		WindowEnd:   schedule.WindowEnd,
+		Repeat:      schedule.Repeat,
+		RepeatUntil: schedule.RepeatUntil,
+	}).Error
+}
+
+// Scheduler 计划推送调度器
+// 到期的待发送任务通过 enqueue 中带状态条件的更新认领，多实例同时运行时每个任务只会发送一次
+type Scheduler struct {
+	db      *gorm.DB
+	once    sync.Once
+	stopped chan struct{}
+
+	// retries 暂时失败的任务（如数据库错误）的重试次数与下次重试时间，只在调度协程中访问
+	retries map[uint]scheduleRetry
+}
+
+type scheduleRetry struct {
+	attempts int
+	next     time.Time
+}
+
+var scheduler *Scheduler
+
+// StartScheduler 启动全局计划推送调度器
+func StartScheduler() {
+	if scheduler == nil {
+		scheduler = &Scheduler{db: db, stopped: make(chan struct{}), retries: make(map[uint]scheduleRetry)}
+	}
+	scheduler.Start()
+}
+
+// StopScheduler 停止全局计划推送调度器
+func StopScheduler() {
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+}
+
+// Start 启动调度协程
+func (s *Scheduler) Start() {
+	s.once.Do(func() {
+		go s.loop()
+		log.Println("[Push] Scheduler started")
+	})
+}
+
+// Stop 停止调度协程
+func (s *Scheduler) Stop() {
+	select {
+	case <-s.stopped:
+	default:
+		close(s.stopped)
+	}
+}
+
+func (s *Scheduler) loop() {
+	ticker := time.NewTicker(schedulePollPeriod)
+	defer ticker.Stop()
+
+	for {
+		for s.runDue() {
+		}
+		select {
+		case <-s.stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue 发送一批到期的推送任务，本批已满时返回 true 以继续下一批
+// 目标无效的任务标记为已取消并照常生成下一期；其他错误按退避时间重试，期间跳过该任务
+func (s *Scheduler) runDue() bool {
+	now := time.Now()
+	query := s.db.Where("status = ? AND scheduled_at IS NOT NULL AND scheduled_at <= ?", PushPending, now)
+	if waiting := s.waitingRetries(now); len(waiting) > 0 {
+		query = query.Where("id NOT IN ?", waiting)
+	}
+	var records []model.PushRecord
+	if err := query.Order("scheduled_at ASC").Limit(scheduleBatchSize).Find(&records).Error; err != nil {
+		log.Printf("[Push] Load due pushes failed: %v", err)
+		return false
+	}
+
+	for i := range records {
+		record := &records[i]
+		_, err := enqueue(record)
+		switch {
+		case err == nil, errors.Is(err, errNotPending):
+			delete(s.retries, record.ID)
+		case errors.Is(err, errInvalidTarget):
+			delete(s.retries, record.ID)
+			log.Printf("[Push] Scheduled push %d cancelled: %v", record.ID, err)
+			if err := s.cancelOccurrence(record); err != nil {
+				log.Printf("[Push] Cancel scheduled push %d failed: %v", record.ID, err)
+			}
+		default:
+			retry := s.retries[record.ID]
+			retry.attempts++
+			retry.next = now.Add(scheduleBackoff(retry.attempts))
+			s.retries[record.ID] = retry
+			log.Printf("[Push] Scheduled push %d failed (attempt %d), retrying at %s: %v",
+				record.ID, retry.attempts, retry.next.Format(time.RFC3339), err)
+		}
+	}
+	return len(records) == scheduleBatchSize
+}
+
+// waitingRetries 返回仍在退避中的任务ID
+// 重试时间早已过去却未再出现的任务（已被手动发送或取消）不再跟踪
+func (s *Scheduler) waitingRetries(now time.Time) []uint {
+	var ids []uint
+	for id, retry := range s.retries {
+		switch {
+		case now.Before(retry.next):
+			ids = append(ids, id)
+		case now.Sub(retry.next) > scheduleRetryMax:
+			delete(s.retries, id)
+		}
+	}
+	return ids
+}
+
+// scheduleBackoff 第 attempts 次失败后的重试间隔，从轮询周期开始翻倍，最长 scheduleRetryMax
+func scheduleBackoff(attempts int) time.Duration {
+	backoff := schedulePollPeriod
+	for i := 1; i < attempts && backoff < scheduleRetryMax; i++ {
+		backoff *= 2
+	}
+	if backoff > scheduleRetryMax {
+		backoff = scheduleRetryMax
+	}
+	return backoff
+}
+
+// cancelOccurrence 取消无法发送的一期任务，重复推送照常生成下一期
+func (s *Scheduler) cancelOccurrence(record *model.PushRecord) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.PushRecord{}).Where("id = ? AND status = ?", record.ID, PushPending).
+			Update("status", PushCancelled)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return spawnNext(tx, record, scheduleFor(tx, record.ID), time.Now())
+	})
+}
+
+// Schedule 推送任务的计划设置
+func Schedule(c *gin.Context) {
+	id := c.Param("id")
+
+	// 验证ID
+	pushID, err := validator.ValidateID(id)
+	if err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	schedule := scheduleFor(db, pushID)
+	if schedule == nil {
+		response.NotFound(c, "该推送没有计划设置")
+		return
+	}
+
+	// 重复推送同时返回各期任务
+	var series []model.PushRecord
+	if schedule.Repeat != RepeatNone {
+		db.Where("id IN (?)", db.Model(&PushSchedule{}).Select("push_id").Where("series_id = ?", schedule.SeriesID)).
+			Order("scheduled_at ASC").Find(&series)
+	}
+
+	response.Success(c, gin.H{"schedule": schedule, "series": series})
+}
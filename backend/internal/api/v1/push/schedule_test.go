@@ -0,0 +1,80 @@
+package push
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeliveryWindow(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	w := (&PushSchedule{WindowStart: "09:00", WindowEnd: "21:00", Timezone: "Asia/Shanghai"}).window()
+
+	inside := time.Date(2024, 5, 1, 10, 30, 0, 0, shanghai)
+	if got := w.next(inside, ""); !got.Equal(inside) {
+		t.Errorf("inside window: got %v", got)
+	}
+
+	late := time.Date(2024, 5, 1, 22, 0, 0, 0, shanghai)
+	if got, want := w.next(late, ""), time.Date(2024, 5, 2, 9, 0, 0, 0, shanghai); !got.Equal(want) {
+		t.Errorf("after window: got %v, want %v", got, want)
+	}
+
+	// 设备上报的时区优先于计划时区：上海 10:30 为伦敦凌晨 03:30
+	london, _ := time.LoadLocation("Europe/London")
+	if got, want := w.next(inside, "Europe/London"), time.Date(2024, 5, 1, 9, 0, 0, 0, london); !got.Equal(want) {
+		t.Errorf("device timezone: got %v, want %v", got, want)
+	}
+
+	overnight := (&PushSchedule{WindowStart: "22:00", WindowEnd: "02:00", Timezone: "Asia/Shanghai"}).window()
+	if got := overnight.next(late, ""); !got.Equal(late) {
+		t.Errorf("overnight window: got %v", got)
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	// 跨越夏令时切换后仍保持本地时间 09:00
+	start := time.Date(2024, 3, 9, 9, 0, 0, 0, ny)
+	if got := nextOccurrence(start, RepeatDaily, ny); got.Hour() != 9 || got.Day() != 10 {
+		t.Errorf("daily across DST: got %v", got)
+	}
+	if got := nextOccurrence(start, RepeatMonthly, ny); got.Month() != time.April || got.Day() != 9 {
+		t.Errorf("monthly: got %v", got)
+	}
+}
+
+func TestScheduleRequestBuild(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	cases := []struct {
+		req scheduleRequest
+		at  *time.Time
+		ok  bool
+	}{
+		{scheduleRequest{WindowStart: "09:00", WindowEnd: "21:00"}, nil, true},
+		{scheduleRequest{WindowStart: "09:00"}, nil, false},
+		{scheduleRequest{WindowStart: "25:00", WindowEnd: "21:00"}, nil, false},
+		{scheduleRequest{Repeat: RepeatDaily}, nil, false},
+		{scheduleRequest{Repeat: RepeatWeekly, Timezone: "Asia/Tokyo"}, &at, true},
+		{scheduleRequest{Repeat: "hourly"}, &at, false},
+		{scheduleRequest{Timezone: "Mars/Olympus"}, nil, false},
+	}
+	for i, tc := range cases {
+		if _, err := tc.req.build(tc.at); (err == nil) != tc.ok {
+			t.Errorf("case %d: err=%v, want ok=%v", i, err, tc.ok)
+		}
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  15 * time.Second,
+		2:  30 * time.Second,
+		3:  time.Minute,
+		10: scheduleRetryMax,
+	}
+	for attempts, want := range cases {
+		if got := scheduleBackoff(attempts); got != want {
+			t.Errorf("scheduleBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package segment
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"app-platform-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 条件类型
+const (
+	RuleAttribute  = "attribute"   // 用户字段
+	RuleTag        = "tag"         // 用户标签
+	RuleEvent      = "event"       // 事件行为
+	RuleAppVersion = "app_version" // 设备上报的APP版本
+)
+
+const (
+	maxRuleDepth        = 5
+	maxRuleConditions   = 50
+	defaultWithinDays   = 7
+	maxWithinDays       = 365
+	attributeDateLayout = "2006-01-02"
+)
+
+// Rule 分群规则：All/Any/Not 组合子规则，Type 不为空时为单个条件
+type Rule struct {
+	All []Rule `json:"all,omitempty"`
+	Any []Rule `json:"any,omitempty"`
+	Not *Rule  `json:"not,omitempty"`
+
+	Type  string      `json:"type,omitempty"`
+	Field string      `json:"field,omitempty"` // attribute 条件的用户字段
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+
+	// event 条件：最近 WithinDays 天内触发 Event 的次数在 [MinCount, MaxCount] 之间
+	Event      string `json:"event,omitempty"`
+	MinCount   int    `json:"min_count,omitempty"`
+	MaxCount   int    `json:"max_count,omitempty"`
+	WithinDays int    `json:"within_days,omitempty"`
+}
+
+// RuleError 规则定义错误
+type RuleError struct {
+	Message string
+}
+
+func (e *RuleError) Error() string {
+	return e.Message
+}
+
+func ruleErrorf(format string, args ...interface{}) error {
+	return &RuleError{Message: fmt.Sprintf(format, args...)}
+}
+
+// attributeKind 用户字段类型
+type attributeKind int
+
+const (
+	kindString attributeKind = iota
+	kindNumber
+	kindTime
+)
+
+// attributes 可用于圈选的 model.User 字段
+var attributes = map[string]attributeKind{
+	"id":            kindNumber,
+	"open_id":       kindString,
+	"nickname":      kindString,
+	"phone":         kindString,
+	"email":         kindString,
+	"status":        kindNumber,
+	"created_at":    kindTime,
+	"last_login_at": kindTime,
+}
+
+// DeviceSource 返回APP设备的查询（需包含 user_id 与 app_version 列），
+// 用于按APP版本圈选与估算可触达用户，由推送模块提供
+type DeviceSource func(tx *gorm.DB, appID uint) *gorm.DB
+
+var deviceSource DeviceSource
+
+// SetDeviceSource 设置设备数据来源
+func SetDeviceSource(source DeviceSource) {
+	deviceSource = source
+}
+
+// compiler 将规则编译为针对 users 表的SQL条件
+type compiler struct {
+	tx         *gorm.DB
+	appID      uint
+	now        time.Time
+	conditions int
+}
+
+// compile 编译规则，返回SQL片段与参数
+func (c *compiler) compile(rule *Rule, depth int) (string, []interface{}, error) {
+	if depth > maxRuleDepth {
+		return "", nil, ruleErrorf("规则嵌套层级不能超过%d层", maxRuleDepth)
+	}
+
+	set := 0
+	for _, present := range []bool{rule.All != nil, rule.Any != nil, rule.Not != nil, rule.Type != ""} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", nil, ruleErrorf("每条规则必须且只能包含 all、any、not、type 之一")
+	}
+
+	switch {
+	case rule.All != nil, rule.Any != nil:
+		items, joiner := rule.All, " AND "
+		if rule.Any != nil {
+			items, joiner = rule.Any, " OR "
+		}
+		if len(items) == 0 {
+			return "", nil, ruleErrorf("all/any 不能为空")
+		}
+		var parts []string
+		var args []interface{}
+		for i := range items {
+			sql, vars, err := c.compile(&items[i], depth+1)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, sql)
+			args = append(args, vars...)
+		}
+		return "(" + strings.Join(parts, joiner) + ")", args, nil
+	case rule.Not != nil:
+		sql, args, err := c.compile(rule.Not, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		// 可空字段（如 last_login_at）比较结果为 NULL 时 NOT 仍为 NULL，用户会被排除在取反结果之外，
+		// 因此先将 NULL 视为不满足再取反
+		return "NOT COALESCE(" + sql + ", FALSE)", args, nil
+	}
+
+	c.conditions++
+	if c.conditions > maxRuleConditions {
+		return "", nil, ruleErrorf("规则条件不能超过%d个", maxRuleConditions)
+	}
+	switch rule.Type {
+	case RuleAttribute:
+		return c.attribute(rule)
+	case RuleTag:
+		return c.tag(rule)
+	case RuleEvent:
+		return c.event(rule)
+	case RuleAppVersion:
+		return c.appVersion(rule)
+	}
+	return "", nil, ruleErrorf("不支持的条件类型: %s", rule.Type)
+}
+
+// attribute 用户字段条件
+func (c *compiler) attribute(rule *Rule) (string, []interface{}, error) {
+	kind, ok := attributes[rule.Field]
+	if !ok {
+		return "", nil, ruleErrorf("不支持的用户字段: %s", rule.Field)
+	}
+	column := rule.Field
+
+	if rule.Op == "exists" {
+		want, ok := rule.Value.(bool)
+		if !ok {
+			return "", nil, ruleErrorf("字段 %s 的 exists 条件需要布尔值", rule.Field)
+		}
+		sql := fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", column, column)
+		if kind != kindString {
+			sql = fmt.Sprintf("(%s IS NOT NULL)", column)
+		}
+		if !want {
+			sql = "NOT " + sql
+		}
+		return sql, nil, nil
+	}
+
+	switch kind {
+	case kindString:
+		switch rule.Op {
+		case "eq", "ne":
+			s, ok := rule.Value.(string)
+			if !ok {
+				return "", nil, ruleErrorf("字段 %s 需要字符串值", rule.Field)
+			}
+			return fmt.Sprintf("%s %s ?", column, sqlOps[rule.Op]), []interface{}{s}, nil
+		case "contains", "prefix":
+			s, ok := rule.Value.(string)
+			if !ok || s == "" {
+				return "", nil, ruleErrorf("字段 %s 需要非空字符串值", rule.Field)
+			}
+			pattern := escapeLike(s) + "%"
+			if rule.Op == "contains" {
+				pattern = "%" + pattern
+			}
+			return fmt.Sprintf("%s LIKE ?", column), []interface{}{pattern}, nil
+		case "in":
+			values, err := stringList(rule.Value)
+			if err != nil {
+				return "", nil, ruleErrorf("字段 %s 的 in 条件需要字符串数组", rule.Field)
+			}
+			return fmt.Sprintf("%s IN ?", column), []interface{}{values}, nil
+		}
+	case kindNumber:
+		switch rule.Op {
+		case "eq", "ne", "gt", "gte", "lt", "lte":
+			n, ok := rule.Value.(float64)
+			if !ok {
+				return "", nil, ruleErrorf("字段 %s 需要数值", rule.Field)
+			}
+			return fmt.Sprintf("%s %s ?", column, sqlOps[rule.Op]), []interface{}{n}, nil
+		case "in":
+			items, ok := rule.Value.([]interface{})
+			if !ok || len(items) == 0 {
+				return "", nil, ruleErrorf("字段 %s 的 in 条件需要数值数组", rule.Field)
+			}
+			for _, item := range items {
+				if _, ok := item.(float64); !ok {
+					return "", nil, ruleErrorf("字段 %s 的 in 条件需要数值数组", rule.Field)
+				}
+			}
+			return fmt.Sprintf("%s IN ?", column), []interface{}{items}, nil
+		}
+	case kindTime:
+		switch rule.Op {
+		case "gt", "gte", "lt", "lte":
+			s, _ := rule.Value.(string)
+			t, err := time.ParseInLocation(attributeDateLayout, s, time.Local)
+			if err != nil {
+				return "", nil, ruleErrorf("字段 %s 需要日期值，格式: 2006-01-02", rule.Field)
+			}
+			return fmt.Sprintf("%s %s ?", column, sqlOps[rule.Op]), []interface{}{t}, nil
+		case "within_days", "before_days":
+			days, ok := rule.Value.(float64)
+			if !ok || days < 1 || days > maxWithinDays || days != float64(int(days)) {
+				return "", nil, ruleErrorf("字段 %s 的天数应为1-%d之间的整数", rule.Field, maxWithinDays)
+			}
+			since := c.now.AddDate(0, 0, -int(days))
+			if rule.Op == "within_days" {
+				return fmt.Sprintf("%s >= ?", column), []interface{}{since}, nil
+			}
+			return fmt.Sprintf("%s < ?", column), []interface{}{since}, nil
+		}
+	}
+	return "", nil, ruleErrorf("字段 %s 不支持运算符 %s", rule.Field, rule.Op)
+}
+
+// tag 用户标签条件，Value 为单个标签或标签数组（任一命中）
+func (c *compiler) tag(rule *Rule) (string, []interface{}, error) {
+	tags, err := stringList(rule.Value)
+	if err != nil {
+		if s, ok := rule.Value.(string); ok && s != "" {
+			tags = []string{s}
+		} else {
+			return "", nil, ruleErrorf("标签条件需要标签名或标签数组")
+		}
+	}
+	return "id IN (?)", []interface{}{TaggedUsers(c.tx, c.appID, tags)}, nil
+}
+
+// event 事件行为条件
+func (c *compiler) event(rule *Rule) (string, []interface{}, error) {
+	if rule.Event == "" {
+		return "", nil, ruleErrorf("事件条件需要设置 event")
+	}
+	minCount := rule.MinCount
+	if minCount == 0 {
+		minCount = 1
+	}
+	if minCount < 1 {
+		return "", nil, ruleErrorf("min_count 不能小于1，圈选未触发事件的用户请使用 not")
+	}
+	if rule.MaxCount != 0 && rule.MaxCount < minCount {
+		return "", nil, ruleErrorf("max_count 不能小于 min_count")
+	}
+	days := rule.WithinDays
+	if days == 0 {
+		days = defaultWithinDays
+	}
+	if days < 1 || days > maxWithinDays {
+		return "", nil, ruleErrorf("within_days 应在1-%d之间", maxWithinDays)
+	}
+
+	sub := c.tx.Model(&model.Event{}).Select("user_id").
+		Where("app_id = ? AND event_code = ? AND user_id IS NOT NULL AND created_at >= ?",
+			c.appID, rule.Event, c.now.AddDate(0, 0, -days)).
+		Group("user_id")
+	if rule.MaxCount > 0 {
+		sub = sub.Having("COUNT(*) BETWEEN ? AND ?", minCount, rule.MaxCount)
+	} else {
+		sub = sub.Having("COUNT(*) >= ?", minCount)
+	}
+	return "id IN (?)", []interface{}{sub}, nil
+}
+
+// appVersion 设备APP版本条件，版本号按数字分段比较
+// 版本取值有限，先查出APP中出现过的版本再在内存中比较
+func (c *compiler) appVersion(rule *Rule) (string, []interface{}, error) {
+	if deviceSource == nil {
+		return "", nil, ruleErrorf("未启用设备数据，无法按APP版本圈选")
+	}
+
+	var match func(v string) bool
+	switch rule.Op {
+	case "eq", "ne", "gt", "gte", "lt", "lte":
+		want, ok := rule.Value.(string)
+		if !ok || want == "" {
+			return "", nil, ruleErrorf("APP版本条件需要版本号")
+		}
+		op := rule.Op
+		match = func(v string) bool {
+			cmp := CompareVersions(v, want)
+			switch op {
+			case "eq":
+				return cmp == 0
+			case "ne":
+				return cmp != 0
+			case "gt":
+				return cmp > 0
+			case "gte":
+				return cmp >= 0
+			case "lt":
+				return cmp < 0
+			}
+			return cmp <= 0
+		}
+	case "in":
+		wants, err := stringList(rule.Value)
+		if err != nil {
+			return "", nil, ruleErrorf("APP版本的 in 条件需要版本号数组")
+		}
+		match = func(v string) bool {
+			for _, want := range wants {
+				if CompareVersions(v, want) == 0 {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		return "", nil, ruleErrorf("APP版本条件不支持运算符 %s", rule.Op)
+	}
+
+	var versions []string
+	if err := deviceSource(c.tx, c.appID).Distinct("app_version").Pluck("app_version", &versions).Error; err != nil {
+		return "", nil, err
+	}
+	matched := []string{}
+	for _, v := range versions {
+		if v != "" && match(v) {
+			matched = append(matched, v)
+		}
+	}
+	if len(matched) == 0 {
+		return "1 = 0", nil, nil
+	}
+	sub := deviceSource(c.tx, c.appID).Select("user_id").Where("app_version IN ?", matched)
+	return "id IN (?)", []interface{}{sub}, nil
+}
+
+var sqlOps = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// CompareVersions 按数字分段比较版本号（1.10.0 > 1.9.2），非数字段按字符串比较
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errX := strconv.Atoi(defaultString(x, "0"))
+		ny, errY := strconv.Atoi(defaultString(y, "0"))
+		switch {
+		case errX == nil && errY == nil:
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func defaultString(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// stringList 将JSON数组转换为去重排序后的字符串列表
+func stringList(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.New("not a string list")
+	}
+	seen := make(map[string]bool, len(items))
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok || s == "" {
+			return nil, errors.New("not a string list")
+		}
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
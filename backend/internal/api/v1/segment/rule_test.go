@@ -0,0 +1,102 @@
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"app-platform-backend/internal/model"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestCompileRules(t *testing.T) {
+	tx := dryRunDB(t)
+	rules := `{"all":[
+		{"type":"attribute","field":"status","op":"eq","value":1},
+		{"any":[{"type":"tag","value":["vip","beta"]},{"type":"event","event":"purchase","min_count":3,"within_days":7}]},
+		{"not":{"type":"attribute","field":"email","op":"exists","value":true}}
+	]}`
+	query, err := compileRules(tx, 7, json.RawMessage(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := query.Select("id").Find(&[]model.User{}).Statement.SQL.String()
+	for _, want := range []string{
+		"status = ?",
+		"FROM `user_tags` WHERE app_id = ? AND tag IN (?,?)",
+		"FROM `events` WHERE app_id = ? AND event_code = ?",
+		"HAVING COUNT(*) >= ?",
+		"NOT COALESCE((email IS NOT NULL AND email <> ''), FALSE)",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL missing %q:\n%s", want, sql)
+		}
+	}
+}
+
+func TestCompileNotNullable(t *testing.T) {
+	tx := dryRunDB(t)
+	// 从未登录（last_login_at 为 NULL）的用户也属于“近7天未登录”
+	rules := `{"not":{"type":"attribute","field":"last_login_at","op":"within_days","value":7}}`
+	query, err := compileRules(tx, 7, json.RawMessage(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := query.Select("id").Find(&[]model.User{}).Statement.SQL.String()
+	if want := "NOT COALESCE(last_login_at >= ?, FALSE)"; !strings.Contains(sql, want) {
+		t.Errorf("SQL missing %q:\n%s", want, sql)
+	}
+}
+
+func TestCompileRuleErrors(t *testing.T) {
+	tx := dryRunDB(t)
+	cases := []string{
+		`{"type":"attribute","field":"password","op":"eq","value":"x"}`,
+		`{"type":"attribute","field":"status","op":"eq","value":"1"}`,
+		`{"type":"attribute","field":"created_at","op":"within_days","value":0}`,
+		`{"type":"event","event":"login","min_count":5,"max_count":2}`,
+		`{"type":"tag"}`,
+		`{"all":[]}`,
+		`{"type":"tag","value":"vip","all":[{"type":"tag","value":"x"}]}`,
+		`{"not":{"not":{"not":{"not":{"not":{"type":"tag","value":"x"}}}}}}`,
+	}
+	for _, rules := range cases {
+		_, err := compileRules(tx, 1, json.RawMessage(rules))
+		var ruleErr *RuleError
+		if !errors.As(err, &ruleErr) {
+			t.Errorf("%s: expected rule error, got %v", rules, err)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0", "1.9.2", 1},
+		{"2.0", "2.0.0", 0},
+		{"v3.1.4", "3.1.5", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	}
+	for _, tc := range cases {
+		if got := CompareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
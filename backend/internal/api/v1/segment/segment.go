@@ -0,0 +1,482 @@
+// Package segment 用户分群：按用户字段、标签、事件行为与APP版本圈选推送和消息的目标用户
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/response"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxTagLength     = 50
+	maxTagsPerUpdate = 20
+	estimateSample   = 10
+)
+
+var db *gorm.DB
+
+func InitDB(database *gorm.DB) {
+	db = database
+}
+
+// MigrateDB 迁移分群数据表
+func MigrateDB(database *gorm.DB) error {
+	return database.AutoMigrate(&Segment{}, &UserTag{})
+}
+
+// ErrNotFound 分群不存在
+var ErrNotFound = errors.New("分群不存在")
+
+// Segment 用户分群
+type Segment struct {
+	ID           uint            `gorm:"primarykey" json:"id"`
+	AppID        uint            `gorm:"uniqueIndex:idx_segment_name,priority:1" json:"app_id"`
+	Name         string          `gorm:"size:100;uniqueIndex:idx_segment_name,priority:2" json:"name"`
+	Description  string          `gorm:"size:500" json:"description"`
+	Rules        json.RawMessage `gorm:"type:json" json:"rules"`
+	LastEstimate int64           `json:"last_estimate"`
+	EstimatedAt  *time.Time      `json:"estimated_at"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+func (Segment) TableName() string {
+	return "audience_segments"
+}
+
+// UserTag 用户标签
+type UserTag struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	AppID     uint      `gorm:"uniqueIndex:idx_user_tag,priority:1;index:idx_tag_users,priority:1" json:"app_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_tag,priority:2" json:"user_id"`
+	Tag       string    `gorm:"size:50;uniqueIndex:idx_user_tag,priority:3;index:idx_tag_users,priority:2" json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UserTag) TableName() string {
+	return "user_tags"
+}
+
+// compileRules 解析并编译规则，返回 users 表的查询
+func compileRules(tx *gorm.DB, appID uint, raw json.RawMessage) (*gorm.DB, error) {
+	var rule Rule
+	if err := json.Unmarshal(raw, &rule); err != nil {
+		return nil, ruleErrorf("规则不是合法的JSON对象")
+	}
+	c := &compiler{tx: tx, appID: appID, now: time.Now()}
+	where, args, err := c.compile(&rule, 1)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Model(&model.User{}).Where("app_id = ?", appID).Where(where, args...), nil
+}
+
+// Users 返回分群内用户ID的子查询，供推送与消息圈选目标用户
+func Users(tx *gorm.DB, appID, segmentID uint) (*gorm.DB, error) {
+	var segment Segment
+	if err := tx.Where("id = ? AND app_id = ?", segmentID, appID).First(&segment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	query, err := compileRules(tx, appID, segment.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return query.Select("id"), nil
+}
+
+// Contains 判断用户当前是否属于分群
+func Contains(tx *gorm.DB, appID, segmentID, userID uint) (bool, error) {
+	query, err := Users(tx, appID, segmentID)
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	if err := query.Where("id = ?", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// TaggedUsers 返回带有任一标签的用户ID子查询
+func TaggedUsers(tx *gorm.DB, appID uint, tags []string) *gorm.DB {
+	return tx.Model(&UserTag{}).Select("user_id").Where("app_id = ? AND tag IN ?", appID, tags)
+}
+
+// ParseID 解析推送或消息目标中的分群ID
+func ParseID(target string) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(target), 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("无效的分群ID")
+	}
+	return uint(id), nil
+}
+
+// Estimate 分群规模估算
+type Estimate struct {
+	Users     int64        `json:"users"`               // 满足规则的用户数
+	Reachable *int64       `json:"reachable,omitempty"` // 其中拥有有效推送设备的用户数
+	Sample    []model.User `json:"sample"`
+}
+
+// estimate 统计满足规则的用户数、可触达用户数并返回样例用户
+func estimate(appID uint, raw json.RawMessage) (*Estimate, error) {
+	query, err := compileRules(db, appID, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Estimate{Sample: []model.User{}}
+	if err := query.Session(&gorm.Session{}).Count(&result.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := query.Session(&gorm.Session{}).Order("id ASC").Limit(estimateSample).Find(&result.Sample).Error; err != nil {
+		return nil, err
+	}
+	if deviceSource != nil {
+		var reachable int64
+		users := query.Session(&gorm.Session{}).Select("id")
+		if err := deviceSource(db, appID).Where("user_id IN (?)", users).
+			Distinct("user_id").Count(&reachable).Error; err != nil {
+			return nil, err
+		}
+		result.Reachable = &reachable
+	}
+	return result, nil
+}
+
+// ruleFailed 返回规则错误或数据库错误
+func ruleFailed(c *gin.Context, err error) {
+	var ruleErr *RuleError
+	if errors.As(err, &ruleErr) {
+		response.ParamError(c, "分群规则无效: "+err.Error())
+		return
+	}
+	response.DBError(c, err)
+}
+
+// segmentRequest 创建或更新分群的请求
+type segmentRequest struct {
+	AppID       uint            `json:"app_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Rules       json.RawMessage `json:"rules"`
+}
+
+// List 分群列表
+func List(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	query := db.Model(&Segment{}).Where("app_id = ?", appID)
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ?", "%"+keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var segments []Segment
+	if err := query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&segments).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.PageSuccess(c, segments, total, page, size)
+}
+
+// Create 创建分群
+func Create(c *gin.Context) {
+	var req segmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if req.AppID == 0 {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+	if req.Name == "" || len([]rune(req.Name)) > 100 {
+		response.ParamError(c, "分群名称长度应在1-100个字符之间")
+		return
+	}
+	if _, err := compileRules(db, req.AppID, req.Rules); err != nil {
+		ruleFailed(c, err)
+		return
+	}
+
+	var count int64
+	db.Model(&Segment{}).Where("app_id = ? AND name = ?", req.AppID, req.Name).Count(&count)
+	if count > 0 {
+		response.Conflict(c, "分群名称已存在")
+		return
+	}
+
+	segment := Segment{AppID: req.AppID, Name: req.Name, Description: req.Description, Rules: req.Rules}
+	if err := db.Create(&segment).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, segment, "分群创建成功")
+}
+
+// find 按路由参数查找分群
+func find(c *gin.Context) (*Segment, bool) {
+	id, err := validator.ValidateID(c.Param("id"))
+	if err != nil {
+		response.ParamError(c, err.Error())
+		return nil, false
+	}
+
+	query := db.Where("id = ?", id)
+	if appID := c.Query("app_id"); appID != "" {
+		query = query.Where("app_id = ?", appID)
+	}
+	var segment Segment
+	if err := query.First(&segment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, ErrNotFound.Error())
+			return nil, false
+		}
+		response.DBError(c, err)
+		return nil, false
+	}
+	return &segment, true
+}
+
+// Detail 分群详情
+func Detail(c *gin.Context) {
+	segment, ok := find(c)
+	if !ok {
+		return
+	}
+	response.Success(c, segment)
+}
+
+// Update 更新分群
+func Update(c *gin.Context) {
+	segment, ok := find(c)
+	if !ok {
+		return
+	}
+
+	var req segmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if req.Name != "" {
+		if len([]rune(req.Name)) > 100 {
+			response.ParamError(c, "分群名称长度应在1-100个字符之间")
+			return
+		}
+		var count int64
+		db.Model(&Segment{}).Where("app_id = ? AND name = ? AND id <> ?", segment.AppID, req.Name, segment.ID).Count(&count)
+		if count > 0 {
+			response.Conflict(c, "分群名称已存在")
+			return
+		}
+		segment.Name = req.Name
+	}
+	if req.Description != "" {
+		segment.Description = req.Description
+	}
+	if len(req.Rules) > 0 {
+		if _, err := compileRules(db, segment.AppID, req.Rules); err != nil {
+			ruleFailed(c, err)
+			return
+		}
+		segment.Rules = req.Rules
+		segment.EstimatedAt = nil
+		segment.LastEstimate = 0
+	}
+
+	if err := db.Save(segment).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, segment, "分群更新成功")
+}
+
+// Delete 删除分群，仍有待发送的推送使用该分群时拒绝删除
+func Delete(c *gin.Context) {
+	segment, ok := find(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	db.Model(&model.PushRecord{}).
+		Where("app_id = ? AND target_type = ? AND target_ids = ? AND status IN ?",
+			segment.AppID, "segment", strconv.FormatUint(uint64(segment.ID), 10), []string{"pending", "sending"}).
+		Count(&count)
+	if count > 0 {
+		response.Conflict(c, "有待发送的推送正在使用该分群")
+		return
+	}
+
+	if err := db.Delete(segment).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+	response.SuccessWithMessage(c, nil, "分群删除成功")
+}
+
+// EstimateSegment 估算已保存分群的规模
+func EstimateSegment(c *gin.Context) {
+	segment, ok := find(c)
+	if !ok {
+		return
+	}
+
+	result, err := estimate(segment.AppID, segment.Rules)
+	if err != nil {
+		ruleFailed(c, err)
+		return
+	}
+
+	now := time.Now()
+	db.Model(segment).Updates(map[string]interface{}{"last_estimate": result.Users, "estimated_at": now})
+	response.Success(c, result)
+}
+
+// EstimateRules 保存前估算规则的规模
+func EstimateRules(c *gin.Context) {
+	var req struct {
+		AppID uint            `json:"app_id" binding:"required"`
+		Rules json.RawMessage `json:"rules"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := estimate(req.AppID, req.Rules)
+	if err != nil {
+		ruleFailed(c, err)
+		return
+	}
+	response.Success(c, result)
+}
+
+// Tags 标签列表及各标签的用户数
+func Tags(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+
+	var tags []struct {
+		Tag   string `json:"tag"`
+		Users int64  `json:"users"`
+	}
+	if err := db.Model(&UserTag{}).Select("tag, COUNT(*) AS users").
+		Where("app_id = ?", appID).Group("tag").Order("tag ASC").Scan(&tags).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+	response.Success(c, tags)
+}
+
+// tagRequest 批量添加或移除用户标签的请求
+type tagRequest struct {
+	AppID   uint     `json:"app_id" binding:"required"`
+	UserIDs []uint   `json:"user_ids" binding:"required"`
+	Tags    []string `json:"tags" binding:"required"`
+}
+
+func (r *tagRequest) validate() error {
+	if len(r.UserIDs) == 0 || len(r.Tags) == 0 {
+		return errors.New("user_ids 与 tags 不能为空")
+	}
+	if len(r.Tags) > maxTagsPerUpdate {
+		return errors.New("单次最多操作20个标签")
+	}
+	for _, tag := range r.Tags {
+		if strings.TrimSpace(tag) == "" || len([]rune(tag)) > maxTagLength {
+			return errors.New("标签长度应在1-50个字符之间")
+		}
+	}
+	return nil
+}
+
+// AddTags 为用户添加标签，已存在的标签忽略
+func AddTags(c *gin.Context) {
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	// 只为属于该APP的用户打标签
+	var userIDs []uint
+	if err := db.Model(&model.User{}).Where("app_id = ? AND id IN ?", req.AppID, req.UserIDs).Pluck("id", &userIDs).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+	if len(userIDs) == 0 {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+
+	rows := make([]UserTag, 0, len(userIDs)*len(req.Tags))
+	for _, userID := range userIDs {
+		for _, tag := range req.Tags {
+			rows = append(rows, UserTag{AppID: req.AppID, UserID: userID, Tag: strings.TrimSpace(tag)})
+		}
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+	if result.Error != nil {
+		response.DBError(c, result.Error)
+		return
+	}
+
+	response.SuccessWithMessage(c, gin.H{"users": len(userIDs), "affected": result.RowsAffected}, "标签添加成功")
+}
+
+// RemoveTags 移除用户标签
+func RemoveTags(c *gin.Context) {
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	result := db.Where("app_id = ? AND user_id IN ? AND tag IN ?", req.AppID, req.UserIDs, req.Tags).Delete(&UserTag{})
+	if result.Error != nil {
+		response.DBError(c, result.Error)
+		return
+	}
+	response.SuccessWithMessage(c, gin.H{"affected": result.RowsAffected}, "标签移除成功")
+}
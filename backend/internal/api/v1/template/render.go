@@ -0,0 +1,244 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 变量类型
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+	TypeEnum    = "enum"
+)
+
+var (
+	// placeholderPattern 模板占位符，如 {{order_id}}
+	placeholderPattern  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	localePattern       = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+)
+
+// dateLayouts date 类型变量接受的格式
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}
+
+// Variable 模板变量定义
+type Variable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Options     []string    `json:"options,omitempty"` // enum 类型的可选值
+	Description string      `json:"description,omitempty"`
+}
+
+// Localized 某一语言的标题与内容
+type Localized struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// Rendered 渲染结果
+type Rendered struct {
+	Locale  string `json:"locale"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// RenderError 变量缺失或类型错误
+type RenderError struct {
+	Variable string
+	Message  string
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("变量 %s %s", e.Variable, e.Message)
+}
+
+// validateVariables 校验变量定义，默认值须与类型一致
+func validateVariables(vars []Variable) error {
+	seen := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		if !variableNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("变量名 %q 无效，只能包含字母、数字和下划线且不能以数字开头", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("变量 %s 重复定义", v.Name)
+		}
+		seen[v.Name] = true
+
+		switch v.Type {
+		case TypeString, TypeNumber, TypeInteger, TypeBoolean, TypeDate:
+		case TypeEnum:
+			if len(v.Options) == 0 {
+				return fmt.Errorf("枚举变量 %s 需要设置 options", v.Name)
+			}
+		default:
+			return fmt.Errorf("变量 %s 的类型 %q 无效", v.Name, v.Type)
+		}
+		if v.Default != nil {
+			if _, err := formatValue(&v, v.Default); err != nil {
+				return fmt.Errorf("变量 %s 的默认值无效: %s", v.Name, err.Message)
+			}
+		}
+	}
+	return nil
+}
+
+// validateText 校验模板文本只引用已定义的变量
+func validateText(text string, declared map[string]*Variable) error {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if declared[match[1]] == nil {
+			return fmt.Errorf("模板引用了未定义的变量 %s", match[1])
+		}
+	}
+	return nil
+}
+
+// resolveLocale 按 精确匹配 → 语言前缀 → 默认语言 的顺序选择语言版本
+func resolveLocale(requested, defaultLocale string, locales map[string]Localized) string {
+	if requested == "" {
+		return defaultLocale
+	}
+	normalized := strings.ReplaceAll(requested, "_", "-")
+	for name := range locales {
+		if strings.EqualFold(name, normalized) {
+			return name
+		}
+	}
+	lang := strings.SplitN(normalized, "-", 2)[0]
+	// 遍历顺序固定，保证多个同语言版本时结果稳定
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(strings.SplitN(name, "-", 2)[0], lang) {
+			return name
+		}
+	}
+	return defaultLocale
+}
+
+// resolveValues 合并默认值并校验变量，返回格式化后的文本值
+func resolveValues(vars []Variable, values map[string]interface{}) (map[string]string, error) {
+	declared := make(map[string]bool, len(vars))
+	resolved := make(map[string]string, len(vars))
+	for i := range vars {
+		v := &vars[i]
+		declared[v.Name] = true
+
+		value, ok := values[v.Name]
+		if !ok || value == nil {
+			if v.Default == nil {
+				if v.Required {
+					return nil, &RenderError{Variable: v.Name, Message: "缺失"}
+				}
+				resolved[v.Name] = ""
+				continue
+			}
+			value = v.Default
+		}
+		text, err := formatValue(v, value)
+		if err != nil {
+			return nil, err
+		}
+		resolved[v.Name] = text
+	}
+
+	// 按名称排序，错误信息稳定
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &RenderError{Variable: unknown[0], Message: "未在模板中定义"}
+	}
+	return resolved, nil
+}
+
+// formatValue 校验值的类型并转换为文本
+func formatValue(v *Variable, value interface{}) (string, *RenderError) {
+	typeError := &RenderError{Variable: v.Name, Message: "应为 " + v.Type}
+	switch v.Type {
+	case TypeString:
+		s, ok := value.(string)
+		if !ok {
+			return "", typeError
+		}
+		return s, nil
+	case TypeNumber, TypeInteger:
+		var f float64
+		switch n := value.(type) {
+		case float64:
+			f = n
+		case int:
+			f = float64(n)
+		case json.Number:
+			parsed, err := n.Float64()
+			if err != nil {
+				return "", typeError
+			}
+			f = parsed
+		default:
+			return "", typeError
+		}
+		if v.Type == TypeInteger && f != math.Trunc(f) {
+			return "", typeError
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case TypeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return "", typeError
+		}
+		return strconv.FormatBool(b), nil
+	case TypeDate:
+		s, ok := value.(string)
+		if !ok {
+			return "", typeError
+		}
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, s); err == nil {
+				return s, nil
+			}
+		}
+		return "", &RenderError{Variable: v.Name, Message: "应为日期（2006-01-02、2006-01-02 15:04:05 或 RFC3339）"}
+	case TypeEnum:
+		s, ok := value.(string)
+		if !ok {
+			return "", typeError
+		}
+		for _, option := range v.Options {
+			if s == option {
+				return s, nil
+			}
+		}
+		return "", &RenderError{Variable: v.Name, Message: "应为以下值之一: " + strings.Join(v.Options, ", ")}
+	}
+	return "", typeError
+}
+
+// substitute 替换文本中的占位符
+func substitute(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
@@ -0,0 +1,92 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func testTemplate() *Template {
+	vars, _ := json.Marshal([]Variable{
+		{Name: "order_id", Type: TypeString, Required: true},
+		{Name: "amount", Type: TypeNumber, Default: 0.0},
+		{Name: "status", Type: TypeEnum, Options: []string{"paid", "shipped"}, Default: "paid"},
+	})
+	locales, _ := json.Marshal(map[string]Localized{
+		"en-US": {Title: "Order {{order_id}}", Content: "Order {{ order_id }} is {{status}}, total {{amount}}"},
+	})
+	return &Template{
+		Title:         "订单{{order_id}}",
+		Content:       "您的订单{{order_id}}{{status}}，金额{{amount}}",
+		DefaultLocale: "zh-CN",
+		Locales:       locales,
+		Variables:     vars,
+	}
+}
+
+func TestRender(t *testing.T) {
+	tpl := testTemplate()
+
+	got, err := tpl.Render("", map[string]interface{}{"order_id": "A1", "amount": 12.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Locale != "zh-CN" || got.Title != "订单A1" || got.Content != "您的订单A1paid，金额12.5" {
+		t.Errorf("default locale: %+v", got)
+	}
+
+	// en_GB 回退到同语言的 en-US
+	got, err = tpl.Render("en_GB", map[string]interface{}{"order_id": "A1", "status": "shipped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Locale != "en-US" || got.Content != "Order A1 is shipped, total 0" {
+		t.Errorf("fallback locale: %+v", got)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tpl := testTemplate()
+	cases := []struct {
+		values   map[string]interface{}
+		variable string
+	}{
+		{map[string]interface{}{}, "order_id"},
+		{map[string]interface{}{"order_id": 1.0}, "order_id"},
+		{map[string]interface{}{"order_id": "A1", "amount": "12"}, "amount"},
+		{map[string]interface{}{"order_id": "A1", "status": "lost"}, "status"},
+		{map[string]interface{}{"order_id": "A1", "coupon": "X"}, "coupon"},
+	}
+	for i, tc := range cases {
+		_, err := tpl.Render("", tc.values)
+		var renderErr *RenderError
+		if !errors.As(err, &renderErr) || renderErr.Variable != tc.variable {
+			t.Errorf("case %d: got %v, want error on %s", i, err, tc.variable)
+		}
+	}
+}
+
+func TestTemplateRequestApply(t *testing.T) {
+	valid := templateRequest{
+		Code:      "order_update",
+		Name:      "订单通知",
+		Content:   "订单{{order_id}}",
+		Variables: []Variable{{Name: "order_id", Type: TypeString}},
+	}
+	var tpl Template
+	if err := valid.apply(&tpl); err != nil || tpl.DefaultLocale != DefaultLocale {
+		t.Fatalf("valid request: err=%v locale=%s", err, tpl.DefaultLocale)
+	}
+
+	undeclared := valid
+	undeclared.Locales = map[string]Localized{"en": {Content: "Order {{order_no}}"}}
+	if err := undeclared.apply(&tpl); err == nil {
+		t.Error("undeclared variable in locale should fail")
+	}
+
+	badDefault := valid
+	badDefault.Variables = []Variable{{Name: "order_id", Type: TypeInteger, Default: 1.5}}
+	if err := badDefault.apply(&tpl); err == nil {
+		t.Error("ill-typed default should fail")
+	}
+}
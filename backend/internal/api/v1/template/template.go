@@ -0,0 +1,397 @@
+// Package template 推送与消息共用的模板管理与渲染
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"app-platform-backend/internal/response"
+	"app-platform-backend/internal/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 模板渠道
+const (
+	ChannelPush    = "push"
+	ChannelMessage = "message"
+)
+
+// DefaultLocale 未指定默认语言时使用的语言
+const DefaultLocale = "zh-CN"
+
+var codePattern = regexp.MustCompile(`^[a-z0-9_\-]{1,64}$`)
+
+var (
+	// ErrNotFound 模板不存在
+	ErrNotFound = errors.New("模板不存在")
+	// ErrDisabled 模板已停用
+	ErrDisabled = errors.New("模板已停用")
+)
+
+var db *gorm.DB
+
+func InitDB(database *gorm.DB) {
+	db = database
+}
+
+// MigrateDB 迁移模板数据表
+func MigrateDB(database *gorm.DB) error {
+	return database.AutoMigrate(&Template{})
+}
+
+// Template 推送或消息模板
+// Title/Content 为默认语言版本，Locales 保存其他语言版本
+type Template struct {
+	ID            uint            `gorm:"primarykey" json:"id"`
+	AppID         uint            `gorm:"uniqueIndex:idx_template_code,priority:1" json:"app_id"`
+	Channel       string          `gorm:"size:20;uniqueIndex:idx_template_code,priority:2" json:"channel"`
+	Code          string          `gorm:"size:64;uniqueIndex:idx_template_code,priority:3" json:"code"`
+	Name          string          `gorm:"size:100" json:"name"`
+	Title         string          `gorm:"size:255" json:"title"`
+	Content       string          `gorm:"type:text" json:"content"`
+	DefaultLocale string          `gorm:"size:16" json:"default_locale"`
+	Locales       json.RawMessage `gorm:"type:json" json:"locales"`
+	Variables     json.RawMessage `gorm:"type:json" json:"variables"`
+	Status        int             `gorm:"default:1" json:"status"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+func (Template) TableName() string {
+	return "notification_templates"
+}
+
+func (t *Template) variables() []Variable {
+	var vars []Variable
+	json.Unmarshal(t.Variables, &vars)
+	return vars
+}
+
+func (t *Template) locales() map[string]Localized {
+	locales := make(map[string]Localized)
+	json.Unmarshal(t.Locales, &locales)
+	return locales
+}
+
+// Render 按请求的语言渲染模板
+func (t *Template) Render(locale string, values map[string]interface{}) (*Rendered, error) {
+	resolved, err := resolveValues(t.variables(), values)
+	if err != nil {
+		return nil, err
+	}
+
+	locales := t.locales()
+	text := Localized{Title: t.Title, Content: t.Content}
+	locales[t.DefaultLocale] = text
+	chosen := resolveLocale(locale, t.DefaultLocale, locales)
+	text = locales[chosen]
+
+	return &Rendered{
+		Locale:  chosen,
+		Title:   substitute(text.Title, resolved),
+		Content: substitute(text.Content, resolved),
+	}, nil
+}
+
+// Render 渲染APP指定渠道的模板，供创建推送与发送消息时调用
+func Render(appID uint, channel string, id uint, locale string, values map[string]interface{}) (*Rendered, error) {
+	var t Template
+	if err := db.Where("id = ? AND app_id = ? AND channel = ?", id, appID, channel).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if t.Status != 1 {
+		return nil, ErrDisabled
+	}
+	return t.Render(locale, values)
+}
+
+// templateRequest 创建或更新模板的请求
+type templateRequest struct {
+	AppID         uint                 `json:"app_id"`
+	Code          string               `json:"code"`
+	Name          string               `json:"name"`
+	Title         string               `json:"title"`
+	Content       string               `json:"content"`
+	DefaultLocale string               `json:"default_locale"`
+	Locales       map[string]Localized `json:"locales"`
+	Variables     []Variable           `json:"variables"`
+	Status        *int                 `json:"status"`
+}
+
+// apply 校验请求并写入模板
+func (r *templateRequest) apply(t *Template) error {
+	if !codePattern.MatchString(r.Code) {
+		return errors.New("模板编码只能包含小写字母、数字、下划线和中划线，长度1-64")
+	}
+	if r.Name == "" || len([]rune(r.Name)) > 100 {
+		return errors.New("模板名称长度应在1-100个字符之间")
+	}
+	if strings.TrimSpace(r.Content) == "" {
+		return errors.New("模板内容不能为空")
+	}
+	if r.DefaultLocale == "" {
+		r.DefaultLocale = DefaultLocale
+	}
+	if !localePattern.MatchString(r.DefaultLocale) {
+		return fmt.Errorf("无效的语言: %s", r.DefaultLocale)
+	}
+	if err := validateVariables(r.Variables); err != nil {
+		return err
+	}
+
+	declared := make(map[string]*Variable, len(r.Variables))
+	for i := range r.Variables {
+		declared[r.Variables[i].Name] = &r.Variables[i]
+	}
+	texts := map[string]Localized{r.DefaultLocale: {Title: r.Title, Content: r.Content}}
+	for locale, text := range r.Locales {
+		if !localePattern.MatchString(locale) {
+			return fmt.Errorf("无效的语言: %s", locale)
+		}
+		if strings.EqualFold(locale, r.DefaultLocale) {
+			return fmt.Errorf("默认语言 %s 的内容请填写在 title 与 content 中", locale)
+		}
+		if strings.TrimSpace(text.Content) == "" {
+			return fmt.Errorf("语言 %s 的内容不能为空", locale)
+		}
+		texts[locale] = text
+	}
+	for locale, text := range texts {
+		if err := validateText(text.Title+text.Content, declared); err != nil {
+			return fmt.Errorf("%s（%s）", err.Error(), locale)
+		}
+	}
+
+	if r.Locales == nil {
+		r.Locales = map[string]Localized{}
+	}
+	if r.Variables == nil {
+		r.Variables = []Variable{}
+	}
+	t.Code = r.Code
+	t.Name = r.Name
+	t.Title = r.Title
+	t.Content = r.Content
+	t.DefaultLocale = r.DefaultLocale
+	t.Locales, _ = json.Marshal(r.Locales)
+	t.Variables, _ = json.Marshal(r.Variables)
+	if r.Status != nil {
+		t.Status = *r.Status
+	}
+	return nil
+}
+
+// Handler 指定渠道的模板管理接口
+type Handler struct {
+	channel string
+}
+
+// NewHandler 创建模板管理接口
+func NewHandler(channel string) *Handler {
+	return &Handler{channel: channel}
+}
+
+// RegisterRoutes 在 group 下注册模板管理路由
+func (h *Handler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("", h.List)
+	group.POST("", h.Create)
+	group.GET("/:templateId", h.Detail)
+	group.PUT("/:templateId", h.Update)
+	group.DELETE("/:templateId", h.Delete)
+	group.POST("/:templateId/preview", h.Preview)
+}
+
+// List 模板列表
+func (h *Handler) List(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+	page, size := validator.ParsePagination(c.DefaultQuery("page", "1"), c.DefaultQuery("size", "20"))
+	page, size = validator.ValidatePagination(page, size)
+
+	query := db.Model(&Template{}).Where("app_id = ? AND channel = ?", appID, h.channel)
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ? OR code LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	var templates []Template
+	if err := query.Offset((page - 1) * size).Limit(size).Order("id DESC").Find(&templates).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.PageSuccess(c, templates, total, page, size)
+}
+
+// Create 创建模板
+func (h *Handler) Create(c *gin.Context) {
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if req.AppID == 0 {
+		response.ParamError(c, "app_id 不能为空")
+		return
+	}
+
+	t := Template{AppID: req.AppID, Channel: h.channel, Status: 1}
+	if err := req.apply(&t); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	var count int64
+	db.Model(&Template{}).Where("app_id = ? AND channel = ? AND code = ?", t.AppID, h.channel, t.Code).Count(&count)
+	if count > 0 {
+		response.Conflict(c, "模板编码已存在")
+		return
+	}
+
+	if err := db.Create(&t).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, t, "模板创建成功")
+}
+
+// find 按路由参数查找模板，app_id 参数存在时同时校验归属
+func (h *Handler) find(c *gin.Context) (*Template, bool) {
+	id, err := validator.ValidateID(c.Param("templateId"))
+	if err != nil {
+		response.ParamError(c, err.Error())
+		return nil, false
+	}
+
+	query := db.Where("id = ? AND channel = ?", id, h.channel)
+	if appID := c.Query("app_id"); appID != "" {
+		query = query.Where("app_id = ?", appID)
+	}
+	var t Template
+	if err := query.First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, ErrNotFound.Error())
+			return nil, false
+		}
+		response.DBError(c, err)
+		return nil, false
+	}
+	return &t, true
+}
+
+// Detail 模板详情
+func (h *Handler) Detail(c *gin.Context) {
+	t, ok := h.find(c)
+	if !ok {
+		return
+	}
+	response.Success(c, t)
+}
+
+// Update 更新模板
+func (h *Handler) Update(c *gin.Context) {
+	t, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+	if req.Code == "" {
+		req.Code = t.Code
+	}
+	if err := req.apply(t); err != nil {
+		response.ParamError(c, err.Error())
+		return
+	}
+
+	var count int64
+	db.Model(&Template{}).Where("app_id = ? AND channel = ? AND code = ? AND id <> ?", t.AppID, h.channel, t.Code, t.ID).Count(&count)
+	if count > 0 {
+		response.Conflict(c, "模板编码已存在")
+		return
+	}
+
+	if err := db.Save(t).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+
+	response.SuccessWithMessage(c, t, "模板更新成功")
+}
+
+// Delete 删除模板，已按模板创建的推送和消息不受影响
+func (h *Handler) Delete(c *gin.Context) {
+	t, ok := h.find(c)
+	if !ok {
+		return
+	}
+	if err := db.Delete(t).Error; err != nil {
+		response.DBError(c, err)
+		return
+	}
+	response.SuccessWithMessage(c, nil, "模板删除成功")
+}
+
+// Preview 使用给定变量预览渲染结果
+func (h *Handler) Preview(c *gin.Context) {
+	t, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Locale    string                 `json:"locale"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ParamError(c, "参数错误: "+err.Error())
+		return
+	}
+
+	rendered, err := t.Render(req.Locale, req.Variables)
+	if err != nil {
+		RenderFailed(c, err)
+		return
+	}
+	response.Success(c, rendered)
+}
+
+// RenderFailed 返回渲染失败的响应，变量错误时附带变量名
+func RenderFailed(c *gin.Context, err error) {
+	var renderErr *RenderError
+	switch {
+	case errors.As(err, &renderErr):
+		response.ErrorWithData(c, response.CodeBadRequest, "模板渲染失败: "+err.Error(), gin.H{"variable": renderErr.Variable})
+	case errors.Is(err, ErrNotFound):
+		response.NotFound(c, err.Error())
+	case errors.Is(err, ErrDisabled):
+		response.ParamError(c, err.Error())
+	default:
+		response.DBError(c, err)
+	}
+}
@@ -1,6 +1,7 @@
 package version
 
 import (
+	"app-platform-backend/internal/middleware"
 	"app-platform-backend/internal/model"
 	"app-platform-backend/internal/response"
 	"app-platform-backend/internal/validator"
@@ -358,6 +359,11 @@ func CheckUpdate(c *gin.Context) {
 	appID := c.Query("app_id")
 	currentVersion := c.Query("version")
 
+	// 签名认证的客户端请求以绑定的APP为准
+	if boundID, ok := middleware.BoundAppID(c); ok {
+		appID = strconv.FormatUint(uint64(boundID), 10)
+	}
+
 	if appID == "" {
 		response.ParamError(c, "app_id 不能为空")
 		return
@@ -22,13 +22,43 @@ var upgrader = ws.Upgrader{
 
 // Client 表示一个WebSocket客户端连接
 type Client struct {
-	ID       string
-	AppID    uint
-	UserID   string
-	Conn     *ws.Conn
-	Send     chan []byte
-	Hub      *Hub
-	mu       sync.Mutex
+	ID     string
+	AppID  uint
+	UserID string
+	Conn   *ws.Conn
+	Send   chan []byte
+	Hub    *Hub
+	mu     sync.Mutex
+
+	subscriber    Subscriber               // 处理订阅请求，为nil时连接不支持订阅
+	subscriptions map[string]*Subscription // 按订阅ID索引，受 mu 保护
+
+	// Send 只由Hub协程关闭，读协程的回复经 trySend 发送，两者通过 sendMu 和 closed 互斥
+	sendMu sync.Mutex
+	closed bool
+}
+
+// maxSubscriptionsPerClient 单个连接最多的订阅数量
+const maxSubscriptionsPerClient = 20
+
+// Subscription 客户端对某个频道的订阅
+type Subscription struct {
+	ID      string          // 客户端指定的订阅ID，推送消息时原样带回
+	Channel string          // 订阅的频道，如 baas:<集合名>
+	Filter  json.RawMessage // 客户端提交的过滤条件，由订阅处理器解释
+	// Match 由订阅处理器设置，判断频道消息是否推送给该订阅；在Hub协程中调用，不能阻塞
+	Match func(data interface{}) bool
+}
+
+// Subscriber 订阅处理器：校验订阅请求（频道、权限、过滤条件）并设置 Match
+type Subscriber func(sub *Subscription) error
+
+// subscribeFrame 客户端的 subscribe / unsubscribe 帧
+type subscribeFrame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Channel string          `json:"channel"`
+	Filter  json.RawMessage `json:"filter"`
 }
 
 // Hub 管理所有WebSocket连接
@@ -43,11 +73,13 @@ type Hub struct {
 
 // Message WebSocket消息结构
 type Message struct {
-	Type      string      `json:"type"`      // 消息类型: monitor, alert, notification, log
-	AppID     uint        `json:"app_id"`    // 目标APP ID，0表示广播
-	UserID    string      `json:"user_id"`   // 目标用户ID，空表示广播
-	Data      interface{} `json:"data"`      // 消息数据
-	Timestamp int64       `json:"timestamp"` // 时间戳
+	Type         string      `json:"type"`                   // 消息类型: monitor, alert, notification, log, change
+	AppID        uint        `json:"app_id"`                 // 目标APP ID，0表示广播
+	Channel      string      `json:"channel,omitempty"`      // 频道消息只推送给订阅了该频道的客户端
+	Subscription string      `json:"subscription,omitempty"` // 命中的订阅ID
+	UserID       string      `json:"user_id"`                // 目标用户ID，空表示广播
+	Data         interface{} `json:"data"`                   // 消息数据
+	Timestamp    int64       `json:"timestamp"`              // 时间戳
 }
 
 // MonitorData 监控数据结构
@@ -63,11 +95,11 @@ type MonitorData struct {
 // AlertData 告警数据结构
 type AlertData struct {
 	ID        uint   `json:"id"`
-	Level     string `json:"level"`     // critical, warning, info
+	Level     string `json:"level"` // critical, warning, info
 	Title     string `json:"title"`
 	Message   string `json:"message"`
 	Source    string `json:"source"`
-	Status    string `json:"status"`    // active, resolved
+	Status    string `json:"status"` // active, resolved
 	CreatedAt int64  `json:"created_at"`
 }
 
@@ -110,42 +142,129 @@ func (h *Hub) Run() {
 				if appClients, ok := h.appClients[client.AppID]; ok {
 					delete(appClients, client)
 				}
-				close(client.Send)
+				client.close()
 			}
 			h.mu.Unlock()
 			log.Printf("[WebSocket] Client unregistered: %s", client.ID)
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			data, _ := json.Marshal(message)
-			
-			// 如果指定了AppID，只发送给该APP的客户端
-			if message.AppID > 0 {
-				if appClients, ok := h.appClients[message.AppID]; ok {
-					for client := range appClients {
-						select {
-						case client.Send <- data:
-						default:
-							close(client.Send)
-							delete(h.clients, client)
-							delete(appClients, client)
-						}
-					}
+			if message.Channel != "" {
+				h.publish(message)
+				continue
+			}
+
+			h.deliver(message)
+		}
+	}
+}
+
+// deliver 推送非频道消息（监控、告警、通知等）
+// 这些消息面向管理端连接，支持订阅的连接属于APP终端用户，只接收其订阅的频道消息
+func (h *Hub) deliver(message *Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, _ := json.Marshal(message)
+
+	// 如果指定了AppID，只发送给该APP的客户端
+	if message.AppID > 0 {
+		if appClients, ok := h.appClients[message.AppID]; ok {
+			for client := range appClients {
+				if client.subscriber != nil {
+					continue
 				}
-			} else {
-				// 广播给所有客户端
-				for client := range h.clients {
-					select {
-					case client.Send <- data:
-					default:
-						close(client.Send)
-						delete(h.clients, client)
-					}
+				select {
+				case client.Send <- data:
+				default:
+					client.close()
+					delete(h.clients, client)
+					delete(appClients, client)
 				}
 			}
-			h.mu.RUnlock()
+		}
+		return
+	}
+	// 广播给所有客户端
+	for client := range h.clients {
+		if client.subscriber != nil {
+			continue
+		}
+		select {
+		case client.Send <- data:
+		default:
+			client.close()
+			delete(h.clients, client)
+			if appClients, ok := h.appClients[client.AppID]; ok {
+				delete(appClients, client)
+			}
+		}
+	}
+}
+
+// publish 将频道消息推送给APP内订阅了该频道且匹配的客户端，每个命中的订阅推送一次
+func (h *Hub) publish(message *Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	appClients, ok := h.appClients[message.AppID]
+	if !ok {
+		return
+	}
+	for client := range appClients {
+		for _, sub := range client.matching(message.Channel, message.Data) {
+			msg := *message
+			msg.Subscription = sub
+			data, _ := json.Marshal(&msg)
+			select {
+			case client.Send <- data:
+			default:
+				client.close()
+				delete(h.clients, client)
+				delete(appClients, client)
+			}
+			if _, ok := h.clients[client]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// close 关闭发送队列，只在Hub协程中调用
+func (c *Client) close() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// trySend 供读协程回复控制帧：连接已被Hub关闭或发送队列已满时丢弃，不阻塞读协程
+func (c *Client) trySend(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// matching 返回客户端在该频道上匹配消息的订阅ID
+func (c *Client) matching(channel string, data interface{}) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []string
+	for id, sub := range c.subscriptions {
+		if sub.Channel == channel && (sub.Match == nil || sub.Match(data)) {
+			ids = append(ids, id)
 		}
 	}
+	return ids
 }
 
 // GetHub 获取全局Hub实例
@@ -168,6 +287,16 @@ func (h *Hub) BroadcastToApp(appID uint, msgType string, data interface{}) {
 	})
 }
 
+// Publish 向APP内订阅了指定频道的客户端推送消息
+func (h *Hub) Publish(appID uint, channel, msgType string, data interface{}) {
+	h.Broadcast(&Message{
+		Type:    msgType,
+		AppID:   appID,
+		Channel: channel,
+		Data:    data,
+	})
+}
+
 // BroadcastMonitorData 广播监控数据
 func BroadcastMonitorData(appID uint, data *MonitorData) {
 	hub.BroadcastToApp(appID, "monitor", data)
@@ -190,7 +319,7 @@ func BroadcastNotification(appID uint, title, message string) {
 func HandleWebSocket(c *gin.Context) {
 	appIDStr := c.Query("app_id")
 	userID := c.Query("user_id")
-	
+
 	var appID uint
 	if appIDStr != "" {
 		var id uint64
@@ -200,6 +329,13 @@ func HandleWebSocket(c *gin.Context) {
 		}
 	}
 
+	// 该端点未认证，不支持订阅
+	Serve(c, appID, userID, nil)
+}
+
+// Serve 将请求升级为WebSocket连接并注册到全局Hub
+// subscriber 不为nil时连接可发送 subscribe 帧订阅频道，调用方需已完成认证
+func Serve(c *gin.Context, appID uint, userID string, subscriber Subscriber) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("[WebSocket] Upgrade error: %v", err)
@@ -213,6 +349,9 @@ func HandleWebSocket(c *gin.Context) {
 		Conn:   conn,
 		Send:   make(chan []byte, 256),
 		Hub:    hub,
+
+		subscriber:    subscriber,
+		subscriptions: make(map[string]*Subscription),
 	}
 
 	hub.register <- client
@@ -251,16 +390,79 @@ func (c *Client) readPump() {
 			if msgType, ok := msg["type"].(string); ok {
 				switch msgType {
 				case "ping":
-					c.Send <- []byte(`{"type":"pong"}`)
+					c.trySend([]byte(`{"type":"pong"}`))
 				case "subscribe":
-					// 处理订阅请求
-					log.Printf("[WebSocket] Client %s subscribed", c.ID)
+					c.subscribe(message)
+				case "unsubscribe":
+					c.unsubscribe(message)
 				}
 			}
 		}
 	}
 }
 
+// subscribe 处理订阅请求，结果以 subscribed / error 帧回复
+func (c *Client) subscribe(raw []byte) {
+	var frame subscribeFrame
+	json.Unmarshal(raw, &frame)
+	if frame.ID == "" || frame.Channel == "" {
+		c.reply("error", frame.ID, "订阅请求缺少 id 或 channel")
+		return
+	}
+	if c.subscriber == nil {
+		c.reply("error", frame.ID, "当前连接不支持订阅")
+		return
+	}
+
+	c.mu.Lock()
+	_, exists := c.subscriptions[frame.ID]
+	count := len(c.subscriptions)
+	c.mu.Unlock()
+	if exists {
+		c.reply("error", frame.ID, "订阅ID已存在")
+		return
+	}
+	if count >= maxSubscriptionsPerClient {
+		c.reply("error", frame.ID, fmt.Sprintf("每个连接最多%d个订阅", maxSubscriptionsPerClient))
+		return
+	}
+
+	sub := &Subscription{ID: frame.ID, Channel: frame.Channel, Filter: frame.Filter}
+	if err := c.subscriber(sub); err != nil {
+		c.reply("error", frame.ID, err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	c.subscriptions[sub.ID] = sub
+	c.mu.Unlock()
+	log.Printf("[WebSocket] Client %s subscribed to %s", c.ID, sub.Channel)
+	c.reply("subscribed", sub.ID, "")
+}
+
+// unsubscribe 取消订阅
+func (c *Client) unsubscribe(raw []byte) {
+	var frame subscribeFrame
+	json.Unmarshal(raw, &frame)
+
+	c.mu.Lock()
+	delete(c.subscriptions, frame.ID)
+	c.mu.Unlock()
+	c.reply("unsubscribed", frame.ID, "")
+}
+
+// reply 回复订阅相关的控制帧
+func (c *Client) reply(msgType, id, message string) {
+	data, _ := json.Marshal(map[string]string{
+		"type":    msgType,
+		"id":      id,
+		"message": message,
+	})
+	if !c.trySend(data) {
+		log.Printf("[WebSocket] Dropped %s reply to client %s", msgType, c.ID)
+	}
+}
+
 // writePump 向客户端发送消息
 func (c *Client) writePump() {
 	ticker := time.NewTicker(30 * time.Second)
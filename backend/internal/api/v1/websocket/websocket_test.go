@@ -0,0 +1,51 @@
+package websocket
+
+import "testing"
+
+func TestClientTrySend(t *testing.T) {
+	c := &Client{ID: "c1", Send: make(chan []byte, 1)}
+	if !c.trySend([]byte("a")) {
+		t.Fatal("expected send to succeed")
+	}
+	// 队列已满时丢弃，不阻塞读协程
+	if c.trySend([]byte("b")) {
+		t.Error("expected send to a full queue to be dropped")
+	}
+
+	<-c.Send
+	c.close()
+	c.close()
+	// Hub 关闭连接后回复不再发送，也不会 panic
+	if c.trySend([]byte("c")) {
+		t.Error("expected send after close to be dropped")
+	}
+}
+
+func TestDeliverSkipsSubscriberClients(t *testing.T) {
+	h := NewHub()
+	console := &Client{ID: "console", AppID: 1, Send: make(chan []byte, 1)}
+	// 由 baas 实时订阅接口建立的终端用户连接
+	enduser := &Client{ID: "enduser", AppID: 1, Send: make(chan []byte, 1),
+		subscriber: func(*Subscription) error { return nil }}
+	for _, c := range []*Client{console, enduser} {
+		h.clients[c] = true
+		if h.appClients[c.AppID] == nil {
+			h.appClients[c.AppID] = make(map[*Client]bool)
+		}
+		h.appClients[c.AppID][c] = true
+	}
+
+	for _, msg := range []*Message{
+		{Type: "alert", AppID: 1, Data: "cpu high"},
+		{Type: "notification", Data: "maintenance"},
+	} {
+		h.deliver(msg)
+		if len(console.Send) != 1 {
+			t.Errorf("%s: console client should receive the message", msg.Type)
+		}
+		if len(enduser.Send) != 0 {
+			t.Errorf("%s: realtime client must not receive app-wide messages", msg.Type)
+		}
+		<-console.Send
+	}
+}
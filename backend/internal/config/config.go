@@ -11,11 +11,14 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	JWT      JWTConfig      `yaml:"jwt"`
 	CORS     CORSConfig     `yaml:"cors"`
+	Events   EventsConfig   `yaml:"events"`
 }
 
 type ServerConfig struct {
 	Port int    `yaml:"port"`
 	Mode string `yaml:"mode"`
+	// Environment 模块配置生效的环境: dev, staging, prod，默认 prod
+	Environment string `yaml:"environment"`
 }
 
 type DatabaseConfig struct {
@@ -38,6 +41,10 @@ type CORSConfig struct {
 	AllowCredentials bool     `yaml:"allow_credentials"`
 }
 
+type EventsConfig struct {
+	Outbox bool `yaml:"outbox"` // 异步事件先写入 event_outbox 表，重启后继续投递
+}
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,462 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 客户端签名请求头
+const (
+	HeaderAppID     = "X-App-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+	// HeaderAppUserToken 可选，服务端签发的APP终端用户令牌，见 IssueAppUserToken
+	// AppSecret 随客户端分发，不能用来证明用户身份，因此终端用户必须由令牌声明
+	HeaderAppUserToken = "X-App-User-Token"
+	// HeaderAppUser 旧版客户端直接声明 open_id 的请求头，已不再接受
+	HeaderAppUser = "X-App-User"
+)
+
+// DefaultAppUserTokenTTL 终端用户令牌的默认有效期
+const DefaultAppUserTokenTTL = 24 * time.Hour
+
+// 上下文中绑定的APP信息键名
+const (
+	ContextAppKey   = "app"
+	ContextAppIDKey = "app_id"
+	ContextUserKey  = "app_user"
+)
+
+// AppAuthConfig 客户端签名认证配置
+type AppAuthConfig struct {
+	MaxClockSkew time.Duration // 允许的客户端时钟偏差
+	MaxBodySize  int64         // 参与签名的最大请求体大小
+}
+
+// DefaultAppAuthConfig 默认配置
+var DefaultAppAuthConfig = AppAuthConfig{
+	MaxClockSkew: 5 * time.Minute,
+	MaxBodySize:  10 << 20,
+}
+
+var (
+	appAuthDB     *gorm.DB
+	appAuthConfig            = DefaultAppAuthConfig
+	nonceStore    NonceStore = NewMemoryNonceStore()
+)
+
+// appLoader 根据AppID加载APP，测试中可替换
+var appLoader = func(appID string) (*model.App, error) {
+	if appAuthDB == nil {
+		return nil, errors.New("app auth not initialized")
+	}
+	var app model.App
+	if err := appAuthDB.Where("app_id = ?", appID).First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// userLoader 根据APP和open_id加载终端用户，测试中可替换
+var userLoader = func(appID uint, openID string) (*model.User, error) {
+	if appAuthDB == nil {
+		return nil, errors.New("app auth not initialized")
+	}
+	var user model.User
+	if err := appAuthDB.Where("app_id = ? AND open_id = ?", appID, openID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// InitAppAuth 初始化客户端签名认证
+// nonce 记录在数据库中，多实例部署时共享防重放状态；共享存储不可用时返回错误，
+// 不退回进程内存储，否则其他实例可以重放同一个签名请求
+func InitAppAuth(db *gorm.DB, config ...AppAuthConfig) error {
+	appAuthDB = db
+	if len(config) > 0 {
+		appAuthConfig = config[0]
+	}
+	store, err := NewDBNonceStore(db)
+	if err != nil {
+		return fmt.Errorf("init shared nonce store: %w", err)
+	}
+	nonceStore = store
+	return nil
+}
+
+// NonceStore 记录近期使用过的nonce，用于防重放
+type NonceStore interface {
+	// Use 登记一个nonce，若在有效期内已被使用则返回false
+	Use(key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore 进程内nonce存储，仅适用于单实例部署和测试
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewMemoryNonceStore 创建进程内nonce存储
+func NewMemoryNonceStore() *MemoryNonceStore {
+	s := &MemoryNonceStore{nonces: make(map[string]time.Time)}
+	go s.cleanup()
+	return s
+}
+
+// Use 登记一个nonce，若在有效期内已被使用则返回false
+func (s *MemoryNonceStore) Use(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expireAt, exists := s.nonces[key]; exists && now.Before(expireAt) {
+		return false, nil
+	}
+	s.nonces[key] = now.Add(ttl)
+	return true, nil
+}
+
+// cleanup 定期清理过期的nonce
+func (s *MemoryNonceStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, expireAt := range s.nonces {
+			if now.After(expireAt) {
+				delete(s.nonces, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// UsedNonce 已使用的nonce，nonce_key 唯一，过期后可被同一key复用
+type UsedNonce struct {
+	ID        uint      `gorm:"primarykey"`
+	NonceKey  string    `gorm:"size:128;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// TableName 指定表名
+func (UsedNonce) TableName() string {
+	return "app_auth_nonces"
+}
+
+// DBNonceStore 基于数据库唯一索引的nonce存储，多个实例共享
+type DBNonceStore struct {
+	db *gorm.DB
+}
+
+// NewDBNonceStore 创建数据库nonce存储并启动过期记录清理
+func NewDBNonceStore(db *gorm.DB) (*DBNonceStore, error) {
+	if err := db.AutoMigrate(&UsedNonce{}); err != nil {
+		return nil, err
+	}
+	s := &DBNonceStore{db: db}
+	go s.cleanup()
+	return s, nil
+}
+
+// Use 登记一个nonce，若在有效期内已被使用则返回false
+// 插入依赖唯一索引判重；key 已存在但已过期时通过条件更新续期，并发请求中只有一个成功
+func (s *DBNonceStore) Use(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&UsedNonce{NonceKey: key, ExpiresAt: now.Add(ttl)})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	result = s.db.Model(&UsedNonce{}).
+		Where("nonce_key = ? AND expires_at < ?", key, now).
+		Update("expires_at", now.Add(ttl))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// cleanup 定期删除过期的nonce
+func (s *DBNonceStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := s.db.Where("expires_at < ?", time.Now()).Delete(&UsedNonce{}).Error; err != nil {
+			log.Printf("[AppAuth] Failed to clean up expired nonces: %v", err)
+		}
+	}
+}
+
+// CanonicalQuery 规范化查询字符串：参数按名称排序，同名参数按值排序，再按 URL 编码拼接
+// 解析方式与 gin 的 c.Query 一致，保证处理器读到的参数都经过签名
+func CanonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	for _, v := range values {
+		sort.Strings(v)
+	}
+	return values.Encode()
+}
+
+// BuildSignString 构造待签名字符串
+// 格式: METHOD\nPATH\nCANONICAL_QUERY\nTIMESTAMP\nNONCE\nSHA256(BODY)
+// 无查询参数时 CANONICAL_QUERY 为空行
+func BuildSignString(method, path, rawQuery, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		CanonicalQuery(rawQuery),
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// SignRequest 使用AppSecret计算请求签名（HMAC-SHA256，十六进制小写）
+// rawQuery 为未规范化的查询字符串（不含 ?），顺序不影响签名
+func SignRequest(appSecret, method, path, rawQuery, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write([]byte(BuildSignString(method, path, rawQuery, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AppAuthMiddleware 客户端签名认证中间件
+// 校验 AppID/AppSecret 签名、时间戳偏差和nonce重放，并将APP绑定到上下文
+func AppAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID := c.GetHeader(HeaderAppID)
+		timestamp := c.GetHeader(HeaderTimestamp)
+		nonce := c.GetHeader(HeaderNonce)
+		signature := c.GetHeader(HeaderSignature)
+
+		if appID == "" || timestamp == "" || nonce == "" || signature == "" {
+			abortUnauthorized(c, "缺少签名认证请求头")
+			return
+		}
+
+		// 时间戳校验（秒级Unix时间戳）
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			abortUnauthorized(c, "无效的时间戳")
+			return
+		}
+		skew := time.Since(time.Unix(ts, 0))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > appAuthConfig.MaxClockSkew {
+			abortUnauthorized(c, "请求已过期或客户端时间偏差过大")
+			return
+		}
+
+		if len(nonce) < 8 || len(nonce) > 64 {
+			abortUnauthorized(c, "无效的nonce")
+			return
+		}
+
+		app, err := appLoader(appID)
+		if err != nil || app == nil {
+			abortUnauthorized(c, "应用不存在")
+			return
+		}
+		if app.Status != 1 {
+			response.Forbidden(c, "应用已被禁用")
+			c.Abort()
+			return
+		}
+
+		// 读取请求体并恢复，供后续处理器使用
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(io.LimitReader(c.Request.Body, appAuthConfig.MaxBodySize+1))
+			if err != nil {
+				response.BadRequest(c, "读取请求体失败")
+				c.Abort()
+				return
+			}
+			if int64(len(body)) > appAuthConfig.MaxBodySize {
+				response.BadRequest(c, "请求体过大")
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		expected := SignRequest(app.AppSecret, c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, timestamp, nonce, body)
+		if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+			abortUnauthorized(c, "签名校验失败")
+			return
+		}
+
+		// 签名通过后再登记nonce，避免伪造请求占用合法nonce
+		fresh, err := nonceStore.Use(app.AppID+":"+nonce, 2*appAuthConfig.MaxClockSkew)
+		if err != nil {
+			response.InternalError(c, "校验请求nonce失败")
+			c.Abort()
+			return
+		}
+		if !fresh {
+			abortUnauthorized(c, "重复的请求")
+			return
+		}
+
+		// 解析终端用户（未声明时视为匿名访问）
+		if c.GetHeader(HeaderAppUser) != "" && c.GetHeader(HeaderAppUserToken) == "" {
+			abortUnauthorized(c, "请使用 "+HeaderAppUserToken+" 声明终端用户")
+			return
+		}
+		if token := c.GetHeader(HeaderAppUserToken); token != "" {
+			openID, err := ParseAppUserToken(token, app.ID)
+			if err != nil {
+				abortUnauthorized(c, "无效的用户令牌")
+				return
+			}
+			user, err := userLoader(app.ID, openID)
+			if err != nil || user == nil {
+				abortUnauthorized(c, "用户不存在")
+				return
+			}
+			if user.Status != 1 {
+				response.Forbidden(c, "用户已被禁用")
+				c.Abort()
+				return
+			}
+			c.Set(ContextUserKey, user)
+		}
+
+		c.Set(ContextAppKey, app)
+		c.Set(ContextAppIDKey, app.ID)
+		c.Next()
+	}
+}
+
+// AppUserClaims 终端用户令牌声明，Subject 为 open_id
+type AppUserClaims struct {
+	AppID uint `json:"app_id"`
+	jwt.RegisteredClaims
+}
+
+// appUserTokenAudience 区分终端用户令牌与管理端令牌
+const appUserTokenAudience = "app-user"
+
+// appUserTokenKey 终端用户令牌的签名密钥
+// 由 JWT 密钥派生，避免终端用户令牌被当作管理端令牌使用
+func appUserTokenKey() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("app-user-token"))
+	return mac.Sum(nil)
+}
+
+// IssueAppUserToken 为APP终端用户签发令牌
+// APP后端完成自身的用户登录后经管理接口获取令牌，下发给客户端放入 X-App-User-Token
+func IssueAppUserToken(appID uint, openID string, ttl time.Duration) (string, time.Time, error) {
+	if ttl <= 0 {
+		ttl = DefaultAppUserTokenTTL
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := AppUserClaims{
+		AppID: appID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   openID,
+			Audience:  jwt.ClaimStrings{appUserTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(appUserTokenKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ParseAppUserToken 校验终端用户令牌并返回 open_id，令牌必须签发给 appID
+func ParseAppUserToken(tokenString string, appID uint) (string, error) {
+	claims := &AppUserClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return appUserTokenKey(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !token.Valid || !claims.VerifyAudience(appUserTokenAudience, true) {
+		return "", jwt.ErrSignatureInvalid
+	}
+	if claims.AppID != appID || claims.Subject == "" {
+		return "", errors.New("用户令牌不属于该应用")
+	}
+	return claims.Subject, nil
+}
+
+// GetBoundApp 获取签名认证绑定的APP
+func GetBoundApp(c *gin.Context) (*model.App, bool) {
+	value, exists := c.Get(ContextAppKey)
+	if !exists {
+		return nil, false
+	}
+	app, ok := value.(*model.App)
+	return app, ok
+}
+
+// BoundAppID 获取签名认证绑定的APP主键ID
+// 客户端请求应使用该值，而不是信任请求体中的 app_id
+func BoundAppID(c *gin.Context) (uint, bool) {
+	app, ok := GetBoundApp(c)
+	if !ok {
+		return 0, false
+	}
+	return app.ID, true
+}
+
+// GetAppUser 获取终端用户令牌对应的APP终端用户
+func GetAppUser(c *gin.Context) (*model.User, bool) {
+	value, exists := c.Get(ContextUserKey)
+	if !exists {
+		return nil, false
+	}
+	user, ok := value.(*model.User)
+	return user, ok
+}
+
+// ResolveAppID 解析请求对应的APP主键ID
+// 签名认证请求始终使用绑定的APP，管理端请求回退到请求参数中的 app_id
+func ResolveAppID(c *gin.Context, requested uint) uint {
+	if appID, ok := BoundAppID(c); ok {
+		return appID
+	}
+	return requested
+}
+
+// abortUnauthorized 返回401并终止请求
+func abortUnauthorized(c *gin.Context, message string) {
+	response.Unauthorized(c, message)
+	c.Abort()
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"app-platform-backend/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func setupAppAuthRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	origLoader := appLoader
+	appLoader = func(appID string) (*model.App, error) {
+		switch appID {
+		case "app_test":
+			return &model.App{ID: 7, AppID: "app_test", AppSecret: "secret", Status: 1}, nil
+		case "app_disabled":
+			return &model.App{ID: 8, AppID: "app_disabled", AppSecret: "secret", Status: 0}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	t.Cleanup(func() { appLoader = origLoader })
+
+	origUserLoader := userLoader
+	userLoader = func(appID uint, openID string) (*model.User, error) {
+		if appID == 7 && openID == "user_1" {
+			return &model.User{ID: 1, AppID: 7, OpenID: "user_1", Status: 1}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	t.Cleanup(func() { userLoader = origUserLoader })
+
+	router := gin.New()
+	router.Use(AppAuthMiddleware())
+	router.POST("/api/v1/client/events", func(c *gin.Context) {
+		appID, _ := BoundAppID(c)
+		openID := ""
+		if user, ok := GetAppUser(c); ok {
+			openID = user.OpenID
+		}
+		c.JSON(http.StatusOK, gin.H{"app_id": appID, "open_id": openID})
+	})
+	router.GET("/api/v1/client/versions/check", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": c.Query("version")})
+	})
+	return router
+}
+
+func newSignedRequest(appID, secret, nonce string, ts int64, body []byte) *http.Request {
+	path := "/api/v1/client/events"
+	timestamp := strconv.FormatInt(ts, 10)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set(HeaderAppID, appID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, SignRequest(secret, "POST", path, "", timestamp, nonce, body))
+	return req
+}
+
+func newSignedGet(path, rawQuery, nonce string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest("GET", path+"?"+rawQuery, nil)
+	req.Header.Set(HeaderAppID, "app_test")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, SignRequest("secret", "GET", path, rawQuery, timestamp, nonce, nil))
+	return req
+}
+
+func TestAppAuthMiddleware_ValidSignature(t *testing.T) {
+	router := setupAppAuthRouter(t)
+
+	body := []byte(`{"event_code":"open","app_id":999}`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest("app_test", "secret", "nonce-valid-1", time.Now().Unix(), body))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"app_id":7`)) {
+		t.Errorf("Expected bound app_id 7, got %s", w.Body.String())
+	}
+}
+
+func TestAppAuthMiddleware_Rejections(t *testing.T) {
+	router := setupAppAuthRouter(t)
+	now := time.Now().Unix()
+	body := []byte(`{"event_code":"open"}`)
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		wantCode int
+	}{
+		{
+			name:     "wrong secret",
+			req:      newSignedRequest("app_test", "wrong", "nonce-reject-1", now, body),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown app",
+			req:      newSignedRequest("app_unknown", "secret", "nonce-reject-2", now, body),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "disabled app",
+			req:      newSignedRequest("app_disabled", "secret", "nonce-reject-3", now, body),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "expired timestamp",
+			req:      newSignedRequest("app_test", "secret", "nonce-reject-4", now-3600, body),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "missing headers",
+			req:      httptest.NewRequest("POST", "/api/v1/client/events", bytes.NewReader(body)),
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAppAuthMiddleware_TamperedBody(t *testing.T) {
+	router := setupAppAuthRouter(t)
+
+	req := newSignedRequest("app_test", "secret", "nonce-tamper-1", time.Now().Unix(), []byte(`{"a":1}`))
+	req.Body = httptest.NewRequest("POST", "/", bytes.NewReader([]byte(`{"a":2}`))).Body
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered body to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAppAuthMiddleware_ReplayRejected(t *testing.T) {
+	router := setupAppAuthRouter(t)
+	now := time.Now().Unix()
+	body := []byte(`{"event_code":"open"}`)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest("app_test", "secret", "nonce-replay-1", now, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("First request should succeed, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest("app_test", "secret", "nonce-replay-1", now, body))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Replayed request should be rejected, got %d", w.Code)
+	}
+}
+
+func TestAppAuthMiddleware_SignedQuery(t *testing.T) {
+	router := setupAppAuthRouter(t)
+	path := "/api/v1/client/versions/check"
+
+	// 参数顺序不影响签名
+	req := newSignedGet(path, "version=1.2.0&channel=ios", "nonce-query-1")
+	req.URL.RawQuery = "channel=ios&version=1.2.0"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected reordered query to pass, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = newSignedGet(path, "version=1.2.0", "nonce-query-2")
+	req.URL.RawQuery = "version=0.0.1"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered query to be rejected, got %d", w.Code)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"b=2&a=1":               "a=1&b=2",
+		"tag=z&tag=a&env=prod":  "env=prod&tag=a&tag=z",
+		"q=hello%20world&x=%2F": "q=hello+world&x=%2F",
+	}
+	for raw, want := range tests {
+		if got := CanonicalQuery(raw); got != want {
+			t.Errorf("CanonicalQuery(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestAppAuthMiddleware_AppUserToken(t *testing.T) {
+	router := setupAppAuthRouter(t)
+	body := []byte(`{"event_code":"open"}`)
+
+	valid, _, err := IssueAppUserToken(7, "user_1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherApp, _, _ := IssueAppUserToken(8, "user_1", time.Hour)
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, AppUserClaims{
+		AppID: 7,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user_1",
+			Audience:  jwt.ClaimStrings{appUserTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+	}).SignedString(appUserTokenKey())
+	tampered := valid[:len(valid)-2] + "xx"
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{"valid token", HeaderAppUserToken, valid, http.StatusOK},
+		{"token of another app", HeaderAppUserToken, otherApp, http.StatusUnauthorized},
+		{"expired token", HeaderAppUserToken, expired, http.StatusUnauthorized},
+		{"tampered token", HeaderAppUserToken, tampered, http.StatusUnauthorized},
+		// 客户端不能再直接声明 open_id
+		{"bare open_id", HeaderAppUser, "user_1", http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest("app_test", "secret", "nonce-user-"+strconv.Itoa(i), time.Now().Unix(), body)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && !bytes.Contains(w.Body.Bytes(), []byte(`"open_id":"user_1"`)) {
+				t.Errorf("Expected user_1 to be bound, got %s", w.Body.String())
+			}
+		})
+	}
+
+	// 终端用户令牌不能当作管理端令牌使用
+	if _, err := ParseToken(valid); err == nil {
+		t.Error("app user token must not pass admin token verification")
+	}
+}
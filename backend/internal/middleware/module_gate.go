@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"app-platform-backend/core/module"
+	"app-platform-backend/internal/model"
+	"app-platform-backend/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// moduleGateTTL 启用状态缓存的有效期
+// 本实例内的启用/禁用会立即失效缓存，有效期只用于感知其他实例的变更
+const moduleGateTTL = time.Minute
+
+var moduleGateDB *gorm.DB
+
+// enabledLoader 加载APP已启用（status=1）的模块与功能Code，测试中可替换
+var enabledLoader = func(appID uint) (map[string]bool, error) {
+	if moduleGateDB == nil {
+		return nil, fmt.Errorf("module gate not initialized")
+	}
+	var codes []string
+	if err := moduleGateDB.Model(&model.AppModule{}).
+		Where("app_id = ? AND status = ?", appID, 1).
+		Pluck("module_code", &codes).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		enabled[code] = true
+	}
+	return enabled, nil
+}
+
+type enabledEntry struct {
+	codes   map[string]bool
+	expires time.Time
+}
+
+// enabledCache 按APP缓存已启用的模块与功能
+var enabledCache = struct {
+	sync.RWMutex
+	entries map[uint]enabledEntry
+}{entries: make(map[uint]enabledEntry)}
+
+// InitModuleGate 初始化模块访问控制的数据库连接
+func InitModuleGate(db *gorm.DB) {
+	moduleGateDB = db
+}
+
+// InvalidateModuleGate 清除APP的启用状态缓存，启用、禁用或修改模块状态后调用
+func InvalidateModuleGate(appID uint) {
+	enabledCache.Lock()
+	delete(enabledCache.entries, appID)
+	enabledCache.Unlock()
+}
+
+func enabledCodes(appID uint) (map[string]bool, error) {
+	enabledCache.RLock()
+	entry, ok := enabledCache.entries[appID]
+	enabledCache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.codes, nil
+	}
+
+	codes, err := enabledLoader(appID)
+	if err != nil {
+		return nil, err
+	}
+	enabledCache.Lock()
+	enabledCache.entries[appID] = enabledEntry{codes: codes, expires: time.Now().Add(moduleGateTTL)}
+	enabledCache.Unlock()
+	return codes, nil
+}
+
+// ModuleGate 限制模块路由只对启用了该模块的APP开放
+// APP启用了模块Code或其任一功能即视为启用；路由参数指向模块声明的 RecordTables 中的记录时按记录所属APP校验，
+// 请求中的 app_id 与记录所属APP不一致时拒绝；仍无法确定APP时拒绝请求，声明为 PlatformScoped 的模块除外
+func ModuleGate(m module.Module) gin.HandlerFunc {
+	meta := m.Meta()
+	codes := []string{meta.Code}
+	for _, fn := range m.GetFunctions() {
+		codes = append(codes, fn.Code)
+	}
+	return gate(meta.Name, meta.Code, codes, gateScope(m))
+}
+
+// FunctionGate 限制路由只对启用了指定功能（或其所属模块）的APP开放
+func FunctionGate(moduleCode, functionCode string) gin.HandlerFunc {
+	name := functionCode
+	var scope recordScope
+	if m, ok := module.Get(moduleCode); ok {
+		for _, fn := range m.GetFunctions() {
+			if fn.Code == functionCode {
+				name = fn.Name
+			}
+		}
+		scope = gateScope(m)
+	}
+	return gate(name, functionCode, []string{moduleCode, functionCode}, scope)
+}
+
+// recordScope 模块声明的记录归属
+type recordScope struct {
+	tables   map[string]string // 路由参数名 => 记录表
+	platform bool
+}
+
+func gateScope(m module.Module) recordScope {
+	var scope recordScope
+	if owner, ok := m.(module.RecordOwner); ok {
+		scope.tables = owner.RecordTables()
+	}
+	if p, ok := m.(module.PlatformScoped); ok {
+		scope.platform = p.PlatformScoped()
+	}
+	return scope
+}
+
+func gate(name, code string, accepted []string, scope recordScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID, ok, err := requestAppID(c)
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			c.Abort()
+			return
+		}
+		// 处理器按路由参数操作记录，即使请求声明了 app_id 也以记录实际所属的APP为准
+		owner, owned, err := recordAppID(c, scope.tables)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "记录不存在")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			response.InternalError(c, "查询记录所属APP失败")
+			c.Abort()
+			return
+		}
+		if owned {
+			if ok && owner != appID {
+				response.BadRequest(c, "请求的 app_id 与记录所属APP不一致")
+				c.Abort()
+				return
+			}
+			appID, ok = owner, true
+		}
+		if !ok {
+			if scope.platform {
+				c.Next()
+				return
+			}
+			response.Forbidden(c, "无法确定请求所属的APP，请携带 app_id")
+			c.Abort()
+			return
+		}
+
+		enabled, err := enabledCodes(appID)
+		if err != nil {
+			response.InternalError(c, "查询模块启用状态失败")
+			c.Abort()
+			return
+		}
+		for _, accept := range accepted {
+			if enabled[accept] {
+				// 供 module.RequestConfig 读取该APP的模块配置
+				c.Set(module.AppIDContextKey, appID)
+				c.Next()
+				return
+			}
+		}
+
+		response.Forbidden(c, fmt.Sprintf("APP未启用%s (%s)", name, code))
+		c.Abort()
+	}
+}
+
+// moduleGateMaxBody 解析 app_id 时读取的最大JSON请求体
+const moduleGateMaxBody = 10 << 20
+
+// requestAppID 解析请求所属的APP
+// 签名认证请求使用绑定的APP；管理端请求读取 app_id 路径参数、查询参数、表单和JSON请求体，
+// 多处同时携带且不一致时返回错误，避免按一个APP校验、按另一个APP执行
+func requestAppID(c *gin.Context) (uint, bool, error) {
+	if appID, ok := BoundAppID(c); ok {
+		return appID, true, nil
+	}
+
+	sources := []string{c.Param("app_id"), c.Query("app_id")}
+	contentType := c.ContentType()
+	switch {
+	case contentType == "application/json":
+		raw, err := bodyAppID(c)
+		if err != nil {
+			return 0, false, err
+		}
+		sources = append(sources, raw)
+	case strings.HasPrefix(contentType, "multipart/") || contentType == "application/x-www-form-urlencoded":
+		sources = append(sources, c.PostForm("app_id"))
+	}
+
+	var appID uint
+	for _, raw := range sources {
+		// 0 表示未指定APP
+		if raw == "" || raw == "0" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || id == 0 {
+			return 0, false, fmt.Errorf("无效的 app_id: %s", raw)
+		}
+		if appID != 0 && uint(id) != appID {
+			return 0, false, errors.New("请求中的 app_id 不一致")
+		}
+		appID = uint(id)
+	}
+	return appID, appID != 0, nil
+}
+
+// recordLoader 读取记录所属的APP，测试中可替换
+var recordLoader = func(table, id string) (uint, error) {
+	if moduleGateDB == nil {
+		return 0, fmt.Errorf("module gate not initialized")
+	}
+	var appIDs []uint
+	if err := moduleGateDB.Table(table).Where("id = ?", id).Limit(1).Pluck("app_id", &appIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(appIDs) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return appIDs[0], nil
+}
+
+// recordAppID 按模块声明的记录表，从路由参数指向的记录解析所属APP
+func recordAppID(c *gin.Context, tables map[string]string) (uint, bool, error) {
+	for _, param := range c.Params {
+		table, ok := tables[param.Key]
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseUint(param.Value, 10, 64); err != nil {
+			return 0, false, gorm.ErrRecordNotFound
+		}
+		appID, err := recordLoader(table, param.Value)
+		if err != nil {
+			return 0, false, err
+		}
+		return appID, true, nil
+	}
+	return 0, false, nil
+}
+
+// bodyAppID 读取JSON请求体中的 app_id 并恢复请求体，数字和字符串形式都支持
+func bodyAppID(c *gin.Context) (string, error) {
+	if c.Request.Body == nil {
+		return "", nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, moduleGateMaxBody))
+	if err != nil {
+		return "", errors.New("请求体过大或读取失败")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+	if len(body) == 0 {
+		return "", nil
+	}
+
+	var payload struct {
+		AppID json.RawMessage `json:"app_id"`
+	}
+	if json.Unmarshal(body, &payload) != nil || len(payload.AppID) == 0 || string(payload.AppID) == "null" {
+		return "", nil
+	}
+	return strings.Trim(string(payload.AppID), `"`), nil
+}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app-platform-backend/core/module"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type recordModule struct {
+	*module.BaseModule
+}
+
+func (m *recordModule) RecordTables() map[string]string {
+	return map[string]string{"id": "configs"}
+}
+
+func setupModuleGateRouter(t *testing.T, enabled map[uint][]string) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+
+	loads := 0
+	origLoader := enabledLoader
+	enabledLoader = func(appID uint) (map[string]bool, error) {
+		loads++
+		codes := make(map[string]bool)
+		for _, code := range enabled[appID] {
+			codes[code] = true
+		}
+		return codes, nil
+	}
+	t.Cleanup(func() {
+		enabledLoader = origLoader
+		for appID := range enabled {
+			InvalidateModuleGate(appID)
+		}
+	})
+
+	origRecordLoader := recordLoader
+	recordLoader = func(table, id string) (uint, error) {
+		if table == "configs" && id == "10" {
+			return 1, nil
+		}
+		if table == "configs" && id == "30" {
+			return 3, nil
+		}
+		return 0, gorm.ErrRecordNotFound
+	}
+	t.Cleanup(func() { recordLoader = origRecordLoader })
+
+	m := &recordModule{module.NewBaseModule(module.Meta{Code: "config_management", Name: "配置管理"}, []module.Function{
+		{Code: "config_list"},
+		{Code: "config_fetch"},
+	})}
+	router := gin.New()
+	group := router.Group("", ModuleGate(m))
+	group.GET("/configs", func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.GET("/configs/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.POST("/configs", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	group.GET("/configs/fetch", FunctionGate("config_management", "config_fetch"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router, &loads
+}
+
+func TestModuleGate(t *testing.T) {
+	router, loads := setupModuleGateRouter(t, map[uint][]string{
+		1: {"config_list"},
+		2: {"config_management"},
+		3: {"push_send"},
+	})
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"function enabled", httptest.NewRequest("GET", "/configs?app_id=1", nil), http.StatusOK},
+		{"module enabled", httptest.NewRequest("GET", "/configs?app_id=2", nil), http.StatusOK},
+		{"not enabled", httptest.NewRequest("GET", "/configs?app_id=3", nil), http.StatusForbidden},
+		{"unknown app", httptest.NewRequest("GET", "/configs", nil), http.StatusForbidden},
+		{"record of enabled app", httptest.NewRequest("GET", "/configs/10", nil), http.StatusOK},
+		{"record of disabled app", httptest.NewRequest("GET", "/configs/30", nil), http.StatusForbidden},
+		{"missing record", httptest.NewRequest("GET", "/configs/99", nil), http.StatusNotFound},
+		{"function gate rejects other function", httptest.NewRequest("GET", "/configs/fetch?app_id=1", nil), http.StatusForbidden},
+		{"function gate accepts module", httptest.NewRequest("GET", "/configs/fetch?app_id=2", nil), http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, tc.req)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d: %s", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+	if *loads != 3 {
+		t.Errorf("expected one lookup per app, got %d", *loads)
+	}
+}
+
+func TestModuleGateJSONBody(t *testing.T) {
+	router, _ := setupModuleGateRouter(t, map[uint][]string{1: {"config_list"}})
+
+	for body, want := range map[string]int{
+		`{"app_id":1,"key":"a"}`:   http.StatusOK,
+		`{"app_id":"1","key":"a"}`: http.StatusOK,
+		`{"app_id":3,"key":"a"}`:   http.StatusForbidden,
+		`{"key":"a"}`:              http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("POST", "/configs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", body, w.Code, want)
+		}
+		// 处理器仍能读取完整的请求体
+		if want == http.StatusOK && w.Body.String() != body {
+			t.Errorf("body not restored: %s", w.Body.String())
+		}
+	}
+}
+
+func TestModuleGateAppIDMismatch(t *testing.T) {
+	router, _ := setupModuleGateRouter(t, map[uint][]string{1: {"config_list"}})
+
+	// 按查询参数中已启用的APP通过校验、按请求体中的APP执行的请求被拒绝
+	req := httptest.NewRequest("POST", "/configs?app_id=1", strings.NewReader(`{"app_id":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest("POST", "/configs?app_id=1", strings.NewReader(`{"app_id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("matching app_id: got %d", w.Code)
+	}
+}
+
+func TestModuleGateRecordAppMismatch(t *testing.T) {
+	router, _ := setupModuleGateRouter(t, map[uint][]string{1: {"config_list"}})
+
+	// 以已启用的APP声明 app_id、实际操作未启用APP的记录的请求被拒绝
+	for url, want := range map[string]int{
+		"/configs/30?app_id=1": http.StatusBadRequest,
+		"/configs/10?app_id=3": http.StatusBadRequest,
+		"/configs/10?app_id=1": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", url, w.Code, want)
+		}
+	}
+}
+
+func TestModuleGatePlatformScoped(t *testing.T) {
+	setupModuleGateRouter(t, map[uint][]string{1: {"audit_list"}})
+
+	router := gin.New()
+	router.GET("/audit", ModuleGate(&platformModule{module.NewBaseModule(module.Meta{Code: "audit_log"}, []module.Function{{Code: "audit_list"}})}),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for url, want := range map[string]int{
+		"/audit":          http.StatusOK,
+		"/audit?app_id=1": http.StatusOK,
+		"/audit?app_id=2": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", url, w.Code, want)
+		}
+	}
+}
+
+type platformModule struct {
+	*module.BaseModule
+}
+
+func (m *platformModule) PlatformScoped() bool { return true }
+
+func TestInvalidateModuleGate(t *testing.T) {
+	enabled := map[uint][]string{1: {}}
+	router, _ := setupModuleGateRouter(t, enabled)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/configs?app_id=1", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got %d", w.Code)
+	}
+
+	enabled[1] = []string{"config_list"}
+	InvalidateModuleGate(1)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/configs?app_id=1", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected access after invalidation, got %d", w.Code)
+	}
+}
@@ -207,29 +207,47 @@ type File struct {
 }
 
 // Config 配置模型
+// ConfigValue 为草稿值，PublishedValue 为客户端可见的已发布值，均以 JSON 文本保存
+// Variants 为条件变体（灰度比例、APP版本、分群），与值一同发布
 type Config struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	AppID       uint           `gorm:"index" json:"app_id"`
-	ConfigKey   string         `gorm:"size:255" json:"config_key"`
-	ConfigValue string         `gorm:"type:text" json:"config_value"`
-	Description string         `gorm:"type:text" json:"description"`
-	IsPublished int            `gorm:"default:0" json:"is_published"`
-	PublishedAt *time.Time     `json:"published_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                uint           `gorm:"primarykey" json:"id"`
+	AppID             uint           `gorm:"uniqueIndex:uk_app_key,priority:1" json:"app_id"`
+	ConfigKey         string         `gorm:"size:255;uniqueIndex:uk_app_key,priority:2" json:"config_key"`
+	ValueType         string         `gorm:"size:20;default:string" json:"value_type"`
+	ConfigValue       string         `gorm:"type:text" json:"config_value"`
+	PublishedValue    *string        `gorm:"type:text" json:"published_value"`
+	Variants          string         `gorm:"type:text" json:"variants"`
+	PublishedVariants *string        `gorm:"type:text" json:"published_variants"`
+	Description       string         `gorm:"type:text" json:"description"`
+	IsPublished       int            `gorm:"default:0" json:"is_published"`
+	HasDraft          bool           `gorm:"default:false" json:"has_draft"`
+	Version           int            `gorm:"default:0" json:"version"`
+	PublishedAt       *time.Time     `json:"published_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // ConfigHistory 配置历史模型
 type ConfigHistory struct {
 	ID          uint      `gorm:"primarykey" json:"id"`
+	AppID       uint      `gorm:"index" json:"app_id"`
 	ConfigID    uint      `gorm:"index" json:"config_id"`
+	ConfigKey   string    `gorm:"size:255" json:"config_key"`
+	ValueType   string    `gorm:"size:20" json:"value_type"`
 	ConfigValue string    `gorm:"type:text" json:"config_value"`
+	Variants    string    `gorm:"type:text" json:"variants"`
+	Version     int       `json:"version"`
 	OperatorID  *uint     `json:"operator_id"`
 	Operation   string    `gorm:"size:50" json:"operation"`
 	CreatedAt   time.Time `gorm:"index" json:"created_at"`
 }
 
+// TableName 与建表脚本中的表名保持一致
+func (ConfigHistory) TableName() string {
+	return "config_history"
+}
+
 // Version 版本模型
 type Version struct {
 	ID            uint           `gorm:"primarykey" json:"id"`
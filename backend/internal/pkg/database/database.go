@@ -117,6 +117,11 @@ func GetDB() *gorm.DB {
 	return db
 }
 
+// SetDB 替换全局数据库连接，供测试注入模拟连接
+func SetDB(conn *gorm.DB) {
+	db = conn
+}
+
 func Close() {
 	if db != nil {
 		sqlDB, _ := db.DB()
@@ -0,0 +1,289 @@
+// Package jsondiff 计算两个 JSON 值之间的结构化差异
+// 对象按字段递归比较；对象数组优先按键（id、key、name、code）匹配元素，
+// 无法按键匹配时按下标比较。结果可直接作为 JSON 返回，也可渲染为统一格式文本
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Op 变更类型
+type Op string
+
+const (
+	OpAdded   Op = "added"
+	OpRemoved Op = "removed"
+	OpChanged Op = "changed"
+)
+
+// DefaultKeys 对象数组默认尝试的匹配键，按顺序取第一个可用的
+var DefaultKeys = []string{"id", "key", "name", "code"}
+
+// Change 单个路径上的变更
+type Change struct {
+	Op   Op          `json:"op"`
+	Path string      `json:"path"` // 形如 $.a.b[0]、$.fields[name="title"]
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Summary 变更统计
+type Summary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// Options 比较选项
+type Options struct {
+	// Keys 对象数组的候选匹配键，为空时使用 DefaultKeys
+	// 某个键在两侧数组的每个元素中都存在、取值为标量且不重复时才会被采用
+	Keys []string
+}
+
+// Compare 比较两个值，值会先经过 JSON 往返统一表示，因此可以直接传入结构体
+func Compare(from, to interface{}, opts *Options) []Change {
+	d := &differ{keys: DefaultKeys}
+	if opts != nil && len(opts.Keys) > 0 {
+		d.keys = opts.Keys
+	}
+	d.diff("$", normalize(from), normalize(to))
+	if d.changes == nil {
+		return []Change{}
+	}
+	return d.changes
+}
+
+// CompareJSON 比较两段 JSON 文本，空文本视为 null
+func CompareJSON(from, to []byte, opts *Options) ([]Change, error) {
+	a, err := decode(from)
+	if err != nil {
+		return nil, fmt.Errorf("解析原始 JSON 失败: %w", err)
+	}
+	b, err := decode(to)
+	if err != nil {
+		return nil, fmt.Errorf("解析目标 JSON 失败: %w", err)
+	}
+	return Compare(a, b, opts), nil
+}
+
+// Summarize 统计各类变更数量
+func Summarize(changes []Change) Summary {
+	var s Summary
+	for _, ch := range changes {
+		switch ch.Op {
+		case OpAdded:
+			s.Added++
+		case OpRemoved:
+			s.Removed++
+		case OpChanged:
+			s.Changed++
+		}
+	}
+	return s
+}
+
+// Unified 将变更渲染为统一格式文本，供审核界面展示
+//
+//	--- v1
+//	+++ v2
+//	@@ $.retries @@
+//	-3
+//	+5
+func Unified(changes []Change, fromLabel, toLabel string) string {
+	var b strings.Builder
+	b.WriteString("--- " + fromLabel + "\n")
+	b.WriteString("+++ " + toLabel + "\n")
+	for _, ch := range changes {
+		b.WriteString("@@ " + ch.Path + " @@\n")
+		if ch.Op != OpAdded {
+			writeLines(&b, "-", ch.Old)
+		}
+		if ch.Op != OpRemoved {
+			writeLines(&b, "+", ch.New)
+		}
+	}
+	return b.String()
+}
+
+func writeLines(b *strings.Builder, prefix string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		data = []byte(fmt.Sprintf("%v", value))
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+}
+
+type differ struct {
+	keys    []string
+	changes []Change
+}
+
+func (d *differ) add(op Op, path string, old, new interface{}) {
+	d.changes = append(d.changes, Change{Op: op, Path: path, Old: old, New: new})
+}
+
+func (d *differ) diff(path string, a, b interface{}) {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		if y, ok := b.(map[string]interface{}); ok {
+			d.diffObject(path, x, y)
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			d.diffArray(path, x, y)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		d.add(OpChanged, path, a, b)
+	}
+}
+
+func (d *differ) diffObject(path string, a, b map[string]interface{}) {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := childPath(path, name)
+		x, inA := a[name]
+		y, inB := b[name]
+		switch {
+		case !inA:
+			d.add(OpAdded, child, nil, y)
+		case !inB:
+			d.add(OpRemoved, child, x, nil)
+		default:
+			d.diff(child, x, y)
+		}
+	}
+}
+
+func (d *differ) diffArray(path string, a, b []interface{}) {
+	key := d.matchKey(a, b)
+	if key == "" {
+		d.diffByIndex(path, a, b)
+		return
+	}
+
+	index := make(map[string]int, len(a))
+	for i, item := range a {
+		index[keyOf(item, key)] = i
+	}
+	seen := make(map[string]bool, len(b))
+	// 先按新数组的顺序输出新增和修改，再输出删除
+	for _, item := range b {
+		k := keyOf(item, key)
+		seen[k] = true
+		child := fmt.Sprintf("%s[%s=%s]", path, key, k)
+		if i, ok := index[k]; ok {
+			d.diff(child, a[i], item)
+		} else {
+			d.add(OpAdded, child, nil, item)
+		}
+	}
+	for _, item := range a {
+		if k := keyOf(item, key); !seen[k] {
+			d.add(OpRemoved, fmt.Sprintf("%s[%s=%s]", path, key, k), item, nil)
+		}
+	}
+}
+
+func (d *differ) diffByIndex(path string, a, b []interface{}) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		child := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(a):
+			d.add(OpAdded, child, nil, b[i])
+		case i >= len(b):
+			d.add(OpRemoved, child, a[i], nil)
+		default:
+			d.diff(child, a[i], b[i])
+		}
+	}
+}
+
+// matchKey 返回两侧数组都可用的匹配键，不可用时返回空串
+func (d *differ) matchKey(a, b []interface{}) string {
+	if len(a) == 0 && len(b) == 0 {
+		return ""
+	}
+candidates:
+	for _, key := range d.keys {
+		for _, items := range [][]interface{}{a, b} {
+			seen := make(map[string]bool, len(items))
+			for _, item := range items {
+				obj, ok := item.(map[string]interface{})
+				if !ok {
+					return ""
+				}
+				switch obj[key].(type) {
+				case string, float64, bool:
+				default:
+					continue candidates
+				}
+				k := keyOf(obj, key)
+				if seen[k] {
+					continue candidates
+				}
+				seen[k] = true
+			}
+		}
+		return key
+	}
+	return ""
+}
+
+// keyOf 返回元素键值在路径中的表示，字符串带引号以区分 "1" 与 1
+func keyOf(item interface{}, key string) string {
+	data, _ := json.Marshal(item.(map[string]interface{})[key])
+	return string(data)
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func childPath(path, name string) string {
+	if identPattern.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+func decode(data []byte) (interface{}, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// normalize 通过 JSON 往返统一 Go 值的表示
+func normalize(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var result interface{}
+	json.Unmarshal(data, &result)
+	return result
+}
@@ -0,0 +1,77 @@
+package jsondiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareJSONObjects(t *testing.T) {
+	changes, err := CompareJSON(
+		[]byte(`{"retries":3,"auth":{"key":"k","region":"cn"},"tags":["a","b"],"mode":"fast"}`),
+		[]byte(`{"retries":5,"auth":{"key":"k"},"tags":["a","c","d"],"mode":"fast","debug":true}`),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Op: OpRemoved, Path: "$.auth.region", Old: "cn"},
+		{Op: OpAdded, Path: "$.debug", New: true},
+		{Op: OpChanged, Path: "$.retries", Old: 3.0, New: 5.0},
+		{Op: OpChanged, Path: "$.tags[1]", Old: "b", New: "c"},
+		{Op: OpAdded, Path: "$.tags[2]", New: "d"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got %+v\nwant %+v", changes, want)
+	}
+	if s := Summarize(changes); s != (Summary{Added: 2, Removed: 1, Changed: 2}) {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestCompareArrayByKey(t *testing.T) {
+	type field struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Required bool   `json:"required"`
+	}
+	from := []field{{"title", "string", false}, {"count", "number", false}, {"legacy", "string", false}}
+	to := []field{{"count", "number", false}, {"title", "string", true}, {"score", "number", false}}
+
+	changes := Compare(from, to, nil)
+	want := []Change{
+		{Op: OpChanged, Path: `$[name="title"].required`, Old: false, New: true},
+		{Op: OpAdded, Path: `$[name="score"]`, New: map[string]interface{}{"name": "score", "type": "number", "required": false}},
+		{Op: OpRemoved, Path: `$[name="legacy"]`, Old: map[string]interface{}{"name": "legacy", "type": "string", "required": false}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got %+v\nwant %+v", changes, want)
+	}
+}
+
+func TestCompareDuplicateKeysFallsBackToIndex(t *testing.T) {
+	changes := Compare(
+		[]interface{}{map[string]interface{}{"id": 1, "v": "a"}, map[string]interface{}{"id": 1, "v": "b"}},
+		[]interface{}{map[string]interface{}{"id": 1, "v": "a"}, map[string]interface{}{"id": 1, "v": "c"}},
+		nil,
+	)
+	if len(changes) != 1 || changes[0].Path != "$[1].v" {
+		t.Errorf("got %+v", changes)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	changes := Compare(
+		map[string]interface{}{"a": 1, "b": map[string]interface{}{"x": "y"}},
+		map[string]interface{}{"a": 2, "my key": "z"},
+		nil,
+	)
+	got := Unified(changes, "v1", "v2")
+	want := "--- v1\n+++ v2\n" +
+		"@@ $.a @@\n-1\n+2\n" +
+		"@@ $.b @@\n-{\n-  \"x\": \"y\"\n-}\n" +
+		"@@ $[\"my key\"] @@\n+\"z\"\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
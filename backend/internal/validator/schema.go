@@ -0,0 +1,416 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type schemaValidator struct {
+	errors []FieldError
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate 校验单个值并返回补全默认值后的副本
+func (v *schemaValidator) validate(value interface{}, schema map[string]interface{}, path string) interface{} {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if isType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "类型应为 %s，实际为 %s", strings.Join(types, " 或 "), typeName(value))
+			return value
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if jsonEqual(value, option) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "取值应为以下之一: %s", formatOptions(enum))
+		}
+	}
+	if expected, ok := schema["const"]; ok && !jsonEqual(value, expected) {
+		v.fail(path, "取值应为 %s", formatOptions([]interface{}{expected}))
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return v.validateObject(typed, schema, path)
+	case []interface{}:
+		return v.validateArray(typed, schema, path)
+	case string:
+		v.validateString(typed, schema, path)
+	default:
+		if n, ok := toFloat(value); ok {
+			v.validateNumber(n, schema, path)
+		}
+	}
+	return value
+}
+
+func (v *schemaValidator) validateObject(obj map[string]interface{}, schema map[string]interface{}, path string) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	result := make(map[string]interface{}, len(obj))
+
+	// 按字段名排序，错误顺序稳定
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := childPath(path, name)
+		if propSchema, ok := properties[name].(map[string]interface{}); ok {
+			result[name] = v.validate(obj[name], propSchema, child)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(child, "不允许的字段")
+				continue
+			}
+		case map[string]interface{}:
+			result[name] = v.validate(obj[name], additional, child)
+			continue
+		}
+		result[name] = obj[name]
+	}
+
+	// 缺失字段按 default 补全，补全的值同样需要满足子 Schema
+	propNames := make([]string, 0, len(properties))
+	for name := range properties {
+		propNames = append(propNames, name)
+	}
+	sort.Strings(propNames)
+	for _, name := range propNames {
+		if _, exists := result[name]; exists {
+			continue
+		}
+		propSchema, ok := properties[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if def, ok := propSchema["default"]; ok {
+			result[name] = v.validate(deepCopy(def), propSchema, childPath(path, name))
+		}
+	}
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			name, _ := item.(string)
+			if _, exists := result[name]; !exists && name != "" {
+				v.fail(childPath(path, name), "必填字段缺失")
+			}
+		}
+	}
+
+	if min, ok := intKeyword(schema, "minProperties"); ok && len(result) < min {
+		v.fail(path, "至少需要 %d 个字段", min)
+	}
+	if max, ok := intKeyword(schema, "maxProperties"); ok && len(result) > max {
+		v.fail(path, "最多允许 %d 个字段", max)
+	}
+	return result
+}
+
+func (v *schemaValidator) validateArray(items []interface{}, schema map[string]interface{}, path string) []interface{} {
+	if min, ok := intKeyword(schema, "minItems"); ok && len(items) < min {
+		v.fail(path, "至少需要 %d 项", min)
+	}
+	if max, ok := intKeyword(schema, "maxItems"); ok && len(items) > max {
+		v.fail(path, "最多允许 %d 项", max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	outer:
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if jsonEqual(items[i], items[j]) {
+					v.fail(fmt.Sprintf("%s[%d]", path, i), "与第 %d 项重复", j)
+					break outer
+				}
+			}
+		}
+	}
+
+	result := make([]interface{}, len(items))
+	itemSchema, _ := schema["items"].(map[string]interface{})
+	for i, item := range items {
+		if itemSchema == nil {
+			result[i] = item
+			continue
+		}
+		result[i] = v.validate(item, itemSchema, fmt.Sprintf("%s[%d]", path, i))
+	}
+	return result
+}
+
+func (v *schemaValidator) validateString(s string, schema map[string]interface{}, path string) {
+	length := utf8.RuneCountInString(s)
+	if min, ok := intKeyword(schema, "minLength"); ok && length < min {
+		if min == 1 {
+			v.fail(path, "不能为空")
+		} else {
+			v.fail(path, "长度不能少于 %d 个字符", min)
+		}
+	}
+	if max, ok := intKeyword(schema, "maxLength"); ok && length > max {
+		v.fail(path, "长度不能超过 %d 个字符", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			v.fail(path, "Schema 中的 pattern 无效: %s", err.Error())
+		} else if !re.MatchString(s) {
+			v.fail(path, "格式不匹配 %s", pattern)
+		}
+	}
+	if format, ok := schema["format"].(string); ok && s != "" {
+		if msg := checkFormat(format, s); msg != "" {
+			v.fail(path, "%s", msg)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(n float64, schema map[string]interface{}, path string) {
+	if min, ok := toFloat(schema["minimum"]); ok {
+		// draft-04 以布尔值表示 exclusiveMinimum
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && n <= min {
+			v.fail(path, "应大于 %s", formatNumber(min))
+		} else if n < min {
+			v.fail(path, "不能小于 %s", formatNumber(min))
+		}
+	}
+	if max, ok := toFloat(schema["maximum"]); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && n >= max {
+			v.fail(path, "应小于 %s", formatNumber(max))
+		} else if n > max {
+			v.fail(path, "不能大于 %s", formatNumber(max))
+		}
+	}
+	if min, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= min {
+		v.fail(path, "应大于 %s", formatNumber(min))
+	}
+	if max, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= max {
+		v.fail(path, "应小于 %s", formatNumber(max))
+	}
+	if step, ok := toFloat(schema["multipleOf"]); ok && step > 0 {
+		if q := n / step; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "应为 %s 的整数倍", formatNumber(step))
+		}
+	}
+}
+
+// checkFormat 校验常用 format，返回错误信息，未知 format 忽略
+func checkFormat(format, s string) string {
+	switch format {
+	case "email":
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			return "应为合法的邮箱地址"
+		}
+	case "uri", "url":
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+			return "应为合法的URL"
+		}
+	case "hostname":
+		if !hostnamePattern.MatchString(s) {
+			return "应为合法的主机名"
+		}
+	case "ipv4":
+		if ip := net.ParseIP(s); ip == nil || ip.To4() == nil || strings.Contains(s, ":") {
+			return "应为合法的IPv4地址"
+		}
+	case "ipv6":
+		if ip := net.ParseIP(s); ip == nil || !strings.Contains(s, ":") {
+			return "应为合法的IPv6地址"
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return "应为 RFC3339 格式的时间"
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return "应为 2006-01-02 格式的日期"
+		}
+	}
+	return ""
+}
+
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?)*$`)
+
+// patternCache 缓存 Schema 中的正则，避免每次校验重复编译
+var patternCache sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// schemaTypes 读取 type 关键字，支持字符串或字符串数组
+func schemaTypes(raw interface{}) []string {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func isType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n)
+	}
+	// 未知类型不做限制
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if n, ok := toFloat(value); ok {
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toFloat 将 JSON 数值（以及 Go 代码中声明 Schema 时的整数）转换为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func intKeyword(schema map[string]interface{}, key string) (int, bool) {
+	n, ok := toFloat(schema[key])
+	return int(n), ok
+}
+
+func childPath(path, name string) string {
+	if identPattern.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonEqual 按 JSON 语义比较两个值，数值忽略 int/float 差异
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+// normalizeJSON 通过 JSON 往返统一 Go 值的表示
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var result interface{}
+	json.Unmarshal(data, &result)
+	return result
+}
+
+func deepCopy(value interface{}) interface{} {
+	return normalizeJSON(value)
+}
+
+func formatOptions(options []interface{}) string {
+	parts := make([]string, 0, len(options))
+	for _, option := range options {
+		data, _ := json.Marshal(option)
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"endpoint", "mode"},
+	"properties": map[string]interface{}{
+		"endpoint": map[string]interface{}{"type": "string", "format": "uri"},
+		"mode":     map[string]interface{}{"type": "string", "enum": []string{"fast", "safe"}},
+		"retries":  map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 10, "default": 3},
+		"auth": map[string]interface{}{
+			"type":                 "object",
+			"required":             []string{"key"},
+			"additionalProperties": false,
+			"properties": map[string]interface{}{
+				"key":     map[string]interface{}{"type": "string", "minLength": 1},
+				"timeout": map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "default": 1.5},
+			},
+		},
+		"tags": map[string]interface{}{
+			"type":     "array",
+			"maxItems": 2,
+			"items":    map[string]interface{}{"type": "string", "pattern": "^[a-z]+$"},
+		},
+	},
+}
+
+func decodeConfig(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestValidateModuleConfigDefaults(t *testing.T) {
+	config := decodeConfig(t, `{"endpoint":"https://api.example.com","mode":"fast","auth":{"key":"k"}}`)
+	got, err := ValidateModuleConfig(testSchema, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decodeConfig(t, `{"endpoint":"https://api.example.com","mode":"fast","retries":3,"auth":{"key":"k","timeout":1.5}}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := config["retries"]; ok {
+		t.Error("input config should not be modified")
+	}
+}
+
+func TestValidateModuleConfigErrors(t *testing.T) {
+	config := decodeConfig(t, `{
+		"endpoint": "not a url",
+		"retries": 2.5,
+		"auth": {"timeout": 0, "extra": true},
+		"tags": ["ok", "Bad", "x"]
+	}`)
+	_, err := ValidateModuleConfig(testSchema, config)
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected SchemaError, got %v", err)
+	}
+	paths := map[string]bool{}
+	for _, e := range schemaErr.Errors {
+		paths[e.Path] = true
+	}
+	for _, want := range []string{
+		"$.endpoint",
+		"$.mode",
+		"$.retries",
+		"$.auth.key",
+		"$.auth.timeout",
+		"$.auth.extra",
+		"$.tags",
+		"$.tags[1]",
+	} {
+		if !paths[want] {
+			t.Errorf("missing error for %s, got %v", want, schemaErr.Errors)
+		}
+	}
+}
+
+func TestValidateModuleConfigEmptySchema(t *testing.T) {
+	config := map[string]interface{}{"anything": 1.0}
+	got, err := ValidateModuleConfig(nil, config)
+	if err != nil || !reflect.DeepEqual(got, config) {
+		t.Errorf("empty schema should accept config: %v %v", got, err)
+	}
+}
+
+func TestRedactWriteOnly(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"endpoint": map[string]interface{}{"type": "string"},
+			"auth": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"key": map[string]interface{}{"type": "string", "writeOnly": true},
+				},
+			},
+		},
+	}
+	config := decodeConfig(t, `{"endpoint":"https://a","auth":{"key":"secret","region":"cn"}}`)
+	got := RedactWriteOnly(schema, config)
+	want := decodeConfig(t, `{"endpoint":"https://a","auth":{"region":"cn"}}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := config["auth"].(map[string]interface{})["key"]; !ok {
+		t.Error("input config should not be modified")
+	}
+}
@@ -4,11 +4,104 @@ import (
 	"fmt"
 )
 
-// ValidateModuleConfig 验证模块配置
-func ValidateModuleConfig(moduleCode string, config map[string]interface{}) error {
-	if moduleCode == "" {
-		return fmt.Errorf("module code is required")
+// FieldError 某个配置字段的校验错误，Path 形如 $.providers.apns.team_id
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaError 配置不满足 JSON Schema 时返回，包含全部字段错误
+type SchemaError struct {
+	Errors []FieldError
+}
+
+func (e *SchemaError) Error() string {
+	if len(e.Errors) == 0 {
+		return "配置校验失败"
+	}
+	first := e.Errors[0]
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("%s: %s", first.Path, first.Message)
+	}
+	return fmt.Sprintf("%s: %s（共 %d 处错误）", first.Path, first.Message, len(e.Errors))
+}
+
+// ValidateModuleConfig 按功能声明的 JSON Schema 校验模块配置
+// 支持 type、enum、const、properties、required、additionalProperties、items、
+// 长度/数量/数值范围、pattern 与常用 format，缺失字段按 default 补全。
+// 校验通过时返回补全默认值后的配置，失败时返回 *SchemaError。
+// schema 为空时只要求配置是对象。
+func ValidateModuleConfig(schema map[string]interface{}, config map[string]interface{}) (map[string]interface{}, error) {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	if len(schema) == 0 {
+		return config, nil
+	}
+
+	// 统一为 JSON 解码后的表示，Go 代码中声明的 Schema（如 []string）也能正确读取
+	schema, _ = normalizeJSON(schema).(map[string]interface{})
+
+	v := &schemaValidator{}
+	result := v.validate(config, schema, "$")
+	if len(v.errors) > 0 {
+		return nil, &SchemaError{Errors: v.errors}
+	}
+	return result.(map[string]interface{}), nil
+}
+
+// ApplyDefaults 按 Schema 的 default 补全缺失字段，不做校验
+// 用于配置校验失败时回退到默认配置
+func ApplyDefaults(schema map[string]interface{}, config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	if len(schema) == 0 {
+		return config
+	}
+	schema, _ = normalizeJSON(schema).(map[string]interface{})
+	v := &schemaValidator{}
+	if result, ok := v.validate(config, schema, "$").(map[string]interface{}); ok {
+		return result
+	}
+	return config
+}
+
+// RedactWriteOnly 返回去掉 writeOnly 字段后的配置副本
+// 密钥等只供服务端使用的字段在 Schema 中标记 "writeOnly": true，下发给客户端前需要移除
+func RedactWriteOnly(schema map[string]interface{}, config map[string]interface{}) map[string]interface{} {
+	copied, _ := deepCopy(config).(map[string]interface{})
+	if copied == nil {
+		copied = map[string]interface{}{}
+	}
+	if len(schema) == 0 {
+		return copied
+	}
+	schema, _ = normalizeJSON(schema).(map[string]interface{})
+	redact(copied, schema)
+	return copied
+}
+
+func redact(value interface{}, schema map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, child := range typed {
+			propSchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if writeOnly, _ := propSchema["writeOnly"].(bool); writeOnly {
+				delete(typed, name)
+				continue
+			}
+			redact(child, propSchema)
+		}
+	case []interface{}:
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for _, item := range typed {
+				redact(item, itemSchema)
+			}
+		}
 	}
-	// 简单验证，实际可以根据模块类型做更复杂的验证
-	return nil
 }
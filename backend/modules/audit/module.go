@@ -24,6 +24,9 @@ func (m *AuditModule) GetFunctions() []module.Function {
 	}
 }
 
+// PlatformScoped 审计日志属于平台，不归属任何APP，未携带 app_id 的请求不受APP启用状态限制
+func (m *AuditModule) PlatformScoped() bool { return true }
+
 func (m *AuditModule) RegisterRoutes(group *gin.RouterGroup) {
 	auditapi.InitDB(database.GetDB())
 
@@ -1,30 +1,83 @@
 package config
 
 import (
-"app-platform-backend/core/module"
-configapi "app-platform-backend/internal/api/v1/config"
-"github.com/gin-gonic/gin"
+	"context"
+
+	"app-platform-backend/core/module"
+	configapi "app-platform-backend/internal/api/v1/config"
+	"app-platform-backend/internal/middleware"
+	"app-platform-backend/internal/pkg/database"
+
+	"github.com/gin-gonic/gin"
 )
 
 func init() { module.Register(&ConfigModule{}) }
+
 type ConfigModule struct{}
+
 func (m *ConfigModule) Meta() module.Meta {
-return module.Meta{Code: "config_management", Name: "配置管理", Description: "配置管理模块", Icon: "settings", SortOrder: 8}
+	return module.Meta{Code: "config_management", Name: "配置管理", Description: "配置管理模块", Icon: "settings", SortOrder: 8}
 }
+
 func (m *ConfigModule) GetFunctions() []module.Function {
-return []module.Function{
-{Code: "config_list", Name: "配置列表", Type: "passive", Description: "获取配置列表"},
-{Code: "config_create", Name: "创建配置", Type: "active", Description: "创建新配置"},
-{Code: "config_update", Name: "更新配置", Type: "active", Description: "更新配置"},
-{Code: "config_publish", Name: "发布配置", Type: "active", Description: "发布配置"},
-{Code: "config_history", Name: "配置历史", Type: "passive", Description: "查看配置历史"},
+	return []module.Function{
+		{Code: "config_list", Name: "配置列表", Type: "passive", Description: "获取配置列表"},
+		{Code: "config_create", Name: "创建配置", Type: "active", Description: "创建新配置"},
+		{Code: "config_update", Name: "更新配置", Type: "active", Description: "更新配置"},
+		{Code: "config_delete", Name: "删除配置", Type: "active", Description: "删除配置"},
+		{Code: "config_publish", Name: "发布配置", Type: "active", Description: "发布配置"},
+		{Code: "config_history", Name: "配置历史", Type: "passive", Description: "查看配置历史"},
+		{Code: "config_rollout", Name: "灰度变体", Type: "active", Description: "按比例、APP版本和分群下发配置变体", Dependencies: []string{"segment_manage"}},
+		{Code: "config_exposure", Name: "曝光报表", Type: "passive", Description: "查看配置变体曝光分布"},
+		{Code: "config_fetch", Name: "拉取配置", Type: "passive", Description: "客户端拉取已发布配置"},
+	}
 }
+
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *ConfigModule) RecordTables() map[string]string {
+	return map[string]string{"id": "configs"}
 }
+
 func (m *ConfigModule) RegisterRoutes(group *gin.RouterGroup) {
-group.GET("/configs", configapi.List)
-group.POST("/configs", configapi.Create)
-group.PUT("/configs/:id", configapi.Update)
-group.POST("/configs/:id/publish", configapi.Publish)
-group.GET("/configs/:id/history", configapi.History)
+	group.GET("/configs", configapi.List)
+	group.POST("/configs", configapi.Create)
+	group.POST("/configs/publish", configapi.PublishAll)
+	group.GET("/configs/:id", configapi.Detail)
+	group.PUT("/configs/:id", configapi.Update)
+	group.DELETE("/configs/:id", configapi.Delete)
+	group.POST("/configs/:id/publish", configapi.Publish)
+	group.GET("/configs/:id/history", configapi.History)
+	group.GET("/configs/:id/exposures", configapi.Exposures)
+}
+
+// RegisterClientRoutes 注册客户端配置拉取路由（签名认证）
+func (m *ConfigModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	group.GET("/configs", middleware.FunctionGate("config_management", "config_fetch"), configapi.Fetch)
+}
+
+func (m *ConfigModule) Init() error {
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	configapi.InitDB(db)
+	if err := configapi.MigrateDB(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Start 启动曝光记录器
+func (m *ConfigModule) Start(ctx context.Context) error {
+	if database.GetDB() == nil {
+		return nil
+	}
+	configapi.StartExposureRecorder()
+	return nil
+}
+
+// Stop 停止曝光记录器并写入剩余计数
+func (m *ConfigModule) Stop(ctx context.Context) error {
+	configapi.StopExposureRecorder()
+	return nil
 }
-func (m *ConfigModule) Init() error { return nil }
@@ -22,11 +22,16 @@ func (m *EventModule) GetFunctions() []module.Function {
 		{Code: "event_batch_report", Name: "批量上报", Type: "active", Description: "批量上报事件"},
 		{Code: "event_list", Name: "事件列表", Type: "passive", Description: "获取事件列表"},
 		{Code: "event_stats", Name: "事件统计", Type: "passive", Description: "事件数据统计"},
-		{Code: "event_funnel", Name: "漏斗分析", Type: "passive", Description: "漏斗分析"},
+		{Code: "event_funnel", Name: "漏斗分析", Type: "passive", Description: "漏斗分析", Dependencies: []string{"event_report"}},
 		{Code: "event_definition", Name: "事件定义", Type: "passive", Description: "管理事件定义"},
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *EventModule) RecordTables() map[string]string {
+	return map[string]string{"id": "event_definitions"}
+}
+
 func (m *EventModule) RegisterRoutes(group *gin.RouterGroup) {
 	eventapi.InitDB(database.GetDB())
 
@@ -45,4 +50,13 @@ func (m *EventModule) RegisterRoutes(group *gin.RouterGroup) {
 	}
 }
 
+// RegisterClientRoutes 注册客户端上报路由（签名认证）
+func (m *EventModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	g := group.Group("/events")
+	{
+		g.POST("", eventapi.Report)
+		g.POST("/batch", eventapi.BatchReport)
+	}
+}
+
 func (m *EventModule) Init() error { return nil }
@@ -12,6 +12,20 @@ import (
 
 func init() { module.Register(&FileModule{}) }
 
+// uploadConfigSchema file_upload 功能的上传限制配置
+var uploadConfigSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"max_size_mb": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 1024, "default": 50, "description": "单个文件大小上限（MB）"},
+		"allowed_mime_types": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "minLength": 1},
+			"uniqueItems": true,
+			"description": "允许上传的MIME类型，为空时使用平台默认白名单",
+		},
+	},
+}
+
 type FileModule struct{}
 
 func (m *FileModule) Meta() module.Meta {
@@ -20,7 +34,7 @@ func (m *FileModule) Meta() module.Meta {
 
 func (m *FileModule) GetFunctions() []module.Function {
 	return []module.Function{
-		{Code: "file_upload", Name: "文件上传", Type: "active", Description: "上传文件"},
+		{Code: "file_upload", Name: "文件上传", Type: "active", Description: "上传文件", ConfigSchema: uploadConfigSchema},
 		{Code: "file_download", Name: "文件下载", Type: "active", Description: "下载文件"},
 		{Code: "file_list", Name: "文件列表", Type: "passive", Description: "获取文件列表"},
 		{Code: "file_delete", Name: "文件删除", Type: "active", Description: "删除文件"},
@@ -28,6 +42,11 @@ func (m *FileModule) GetFunctions() []module.Function {
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *FileModule) RecordTables() map[string]string {
+	return map[string]string{"id": "files"}
+}
+
 func (m *FileModule) RegisterRoutes(group *gin.RouterGroup) {
 	fileapi.InitDB(database.GetDB())
 
@@ -11,6 +11,7 @@ import (
 	_ "app-platform-backend/modules/message"
 	_ "app-platform-backend/modules/monitor"
 	_ "app-platform-backend/modules/push"
+	_ "app-platform-backend/modules/segment"
 	_ "app-platform-backend/modules/user"
 	_ "app-platform-backend/modules/version"
 	_ "app-platform-backend/modules/websocket"
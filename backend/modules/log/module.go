@@ -43,4 +43,13 @@ func (m *LogModule) RegisterRoutes(group *gin.RouterGroup) {
 	}
 }
 
+// RegisterClientRoutes 注册客户端上报路由（签名认证）
+func (m *LogModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	g := group.Group("/logs")
+	{
+		g.POST("/report", logapi.Report)
+		g.POST("/batch-report", logapi.BatchReport)
+	}
+}
+
 func (m *LogModule) Init() error { return nil }
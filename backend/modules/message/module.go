@@ -3,6 +3,7 @@ package message
 import (
 	"app-platform-backend/core/module"
 	messageapi "app-platform-backend/internal/api/v1/message"
+	templateapi "app-platform-backend/internal/api/v1/template"
 	"app-platform-backend/internal/pkg/database"
 
 	"github.com/gin-gonic/gin"
@@ -23,18 +24,23 @@ func (m *MessageModule) GetFunctions() []module.Function {
 		{Code: "message_template", Name: "消息模板", Type: "passive", Description: "管理消息模板"},
 		{Code: "message_unread", Name: "未读统计", Type: "passive", Description: "获取未读消息数"},
 		{Code: "message_mark_read", Name: "标记已读", Type: "active", Description: "标记消息已读"},
-		{Code: "message_batch_send", Name: "批量发送", Type: "active", Description: "批量发送消息"},
+		{Code: "message_batch_send", Name: "批量发送", Type: "active", Description: "批量发送消息", Dependencies: []string{"message_send"}},
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *MessageModule) RecordTables() map[string]string {
+	return map[string]string{"id": "messages", "templateId": "notification_templates"}
+}
+
 func (m *MessageModule) RegisterRoutes(group *gin.RouterGroup) {
 	messageapi.InitDB(database.GetDB())
+	templateapi.InitDB(database.GetDB())
 
 	g := group.Group("/messages")
 	{
 		g.GET("", messageapi.List)
 		g.POST("", messageapi.Send)
-		g.GET("/templates", messageapi.Templates)
 		g.GET("/unread", messageapi.UnreadCount)
 		g.GET("/stats", messageapi.Stats)
 		g.GET("/:id", messageapi.Detail)
@@ -44,6 +50,15 @@ func (m *MessageModule) RegisterRoutes(group *gin.RouterGroup) {
 		g.POST("/batch-delete", messageapi.BatchDelete)
 		g.POST("/batch-send", messageapi.BatchSend)
 	}
+	templateapi.NewHandler(templateapi.ChannelMessage).RegisterRoutes(g.Group("/templates"))
 }
 
-func (m *MessageModule) Init() error { return nil }
+// Init 迁移消息模板数据表
+func (m *MessageModule) Init() error {
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	templateapi.InitDB(db)
+	return templateapi.MigrateDB(db)
+}
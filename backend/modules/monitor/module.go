@@ -26,6 +26,11 @@ func (m *MonitorModule) GetFunctions() []module.Function {
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *MonitorModule) RecordTables() map[string]string {
+	return map[string]string{"id": "monitor_alerts"}
+}
+
 func (m *MonitorModule) RegisterRoutes(group *gin.RouterGroup) {
 	monitorapi.InitDB(database.GetDB())
 
@@ -47,4 +52,9 @@ func (m *MonitorModule) RegisterRoutes(group *gin.RouterGroup) {
 	}
 }
 
+// RegisterClientRoutes 注册客户端上报路由（签名认证）
+func (m *MonitorModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	group.POST("/monitor/metrics", monitorapi.ReportMetric)
+}
+
 func (m *MonitorModule) Init() error { return nil }
@@ -1,8 +1,13 @@
 package push
 
 import (
+	"context"
+	"encoding/json"
+
 	"app-platform-backend/core/module"
 	pushapi "app-platform-backend/internal/api/v1/push"
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	templateapi "app-platform-backend/internal/api/v1/template"
 	"app-platform-backend/internal/pkg/database"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +15,50 @@ import (
 
 func init() { module.Register(&PushModule{}) }
 
+// dispatcherWorkers 推送投递工作协程数
+const dispatcherWorkers = 4
+
+// providerConfigSchema push_send 功能的推送通道配置
+var providerConfigSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"providers"},
+	"properties": map[string]interface{}{
+		"providers": map[string]interface{}{
+			"type":                 "object",
+			"minProperties":        1,
+			"additionalProperties": false,
+			"properties": map[string]interface{}{
+				"apns": map[string]interface{}{
+					"type":                 "object",
+					"required":             []string{"team_id", "key_id", "private_key", "topic"},
+					"additionalProperties": false,
+					"properties": map[string]interface{}{
+						"team_id":     map[string]interface{}{"type": "string", "pattern": "^[A-Z0-9]{10}$", "description": "Apple 开发者团队ID"},
+						"key_id":      map[string]interface{}{"type": "string", "pattern": "^[A-Z0-9]{10}$", "description": "APNs 密钥ID"},
+						"private_key": map[string]interface{}{"type": "string", "minLength": 1, "writeOnly": true, "description": ".p8 密钥内容"},
+						"topic":       map[string]interface{}{"type": "string", "minLength": 1, "description": "Bundle ID"},
+						"sandbox":     map[string]interface{}{"type": "boolean", "default": false},
+						"endpoint":    map[string]interface{}{"type": "string", "format": "uri"},
+					},
+				},
+				"fcm": map[string]interface{}{
+					"type":                 "object",
+					"required":             []string{"project_id", "client_email", "private_key"},
+					"additionalProperties": false,
+					"properties": map[string]interface{}{
+						"project_id":   map[string]interface{}{"type": "string", "minLength": 1},
+						"client_email": map[string]interface{}{"type": "string", "format": "email"},
+						"private_key":  map[string]interface{}{"type": "string", "minLength": 1, "writeOnly": true, "description": "服务账号私钥（PEM）"},
+						"token_uri":    map[string]interface{}{"type": "string", "format": "uri"},
+						"endpoint":     map[string]interface{}{"type": "string", "format": "uri"},
+					},
+				},
+				"mock": map[string]interface{}{"type": "object"},
+			},
+		},
+	},
+}
+
 type PushModule struct{}
 
 func (m *PushModule) Meta() module.Meta {
@@ -18,8 +67,8 @@ func (m *PushModule) Meta() module.Meta {
 
 func (m *PushModule) GetFunctions() []module.Function {
 	return []module.Function{
-		{Code: "push_create", Name: "创建推送", Type: "active", Description: "创建推送任务"},
-		{Code: "push_send", Name: "发送推送", Type: "active", Description: "发送推送通知"},
+		{Code: "push_create", Name: "创建推送", Type: "active", Description: "创建推送任务", Dependencies: []string{"push_send"}},
+		{Code: "push_send", Name: "发送推送", Type: "active", Description: "发送推送通知", ConfigSchema: providerConfigSchema},
 		{Code: "push_list", Name: "推送列表", Type: "passive", Description: "推送任务列表"},
 		{Code: "push_stats", Name: "推送统计", Type: "passive", Description: "推送数据统计"},
 		{Code: "push_template", Name: "推送模板", Type: "passive", Description: "管理推送模板"},
@@ -27,22 +76,98 @@ func (m *PushModule) GetFunctions() []module.Function {
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *PushModule) RecordTables() map[string]string {
+	return map[string]string{"id": "push_records", "templateId": "notification_templates"}
+}
+
 func (m *PushModule) RegisterRoutes(group *gin.RouterGroup) {
 	pushapi.InitDB(database.GetDB())
+	templateapi.InitDB(database.GetDB())
 
 	g := group.Group("/push")
 	{
 		g.GET("", pushapi.List)
 		g.POST("", pushapi.Create)
 		g.GET("/stats", pushapi.Stats)
-		g.GET("/templates", pushapi.Templates)
+		g.GET("/devices", pushapi.ListDevices)
 		g.GET("/:id", pushapi.Detail)
+		g.GET("/:id/deliveries", pushapi.Deliveries)
+		g.GET("/:id/schedule", pushapi.Schedule)
 		g.POST("/:id/send", pushapi.Send)
 		g.POST("/:id/cancel", pushapi.Cancel)
 		g.DELETE("/:id", pushapi.Delete)
 		// 兼容旧接口
 		g.GET("/tasks", pushapi.Tasks)
 	}
+	templateapi.NewHandler(templateapi.ChannelPush).RegisterRoutes(g.Group("/templates"))
+}
+
+// RegisterClientRoutes 注册客户端设备令牌路由（签名认证）
+func (m *PushModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	g := group.Group("/push")
+	{
+		g.POST("/devices", pushapi.RegisterDevice)
+		g.DELETE("/devices/:token", pushapi.UnregisterDevice)
+	}
+}
+
+// Init 迁移推送数据表
+func (m *PushModule) Init() error {
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	pushapi.InitDB(db)
+	templateapi.InitDB(db)
+	if err := pushapi.MigrateDB(db); err != nil {
+		return err
+	}
+	if err := templateapi.MigrateDB(db); err != nil {
+		return err
+	}
+	// 分群按设备上报的APP版本圈选用户
+	segmentapi.SetDeviceSource(pushapi.ActiveDevices)
+	// 推送通道配置修改后重建该APP的通道实例
+	module.On(module.EventModuleConfigChanged, "push.providers", module.Sync, func(ctx context.Context, e module.Event, change module.ModuleChanged) error {
+		if change.ModuleCode == "push_send" || change.ModuleCode == m.Meta().Code {
+			pushapi.InvalidateProviders(change.AppID)
+		}
+		return nil
+	})
+	return nil
 }
 
-func (m *PushModule) Init() error { return nil }
+// Start 启动投递工作池与计划推送调度器
+func (m *PushModule) Start(ctx context.Context) error {
+	if database.GetDB() == nil {
+		return nil
+	}
+	pushapi.StartDispatcher(dispatcherWorkers)
+	pushapi.StartScheduler()
+	return nil
+}
+
+// Stop 停止调度器与投递工作池，未完成的投递在租约到期后由其他实例继续
+func (m *PushModule) Stop(ctx context.Context) error {
+	pushapi.StopScheduler()
+	pushapi.StopDispatcher()
+	return nil
+}
+
+// HealthCheck 检查后台工作协程是否在运行
+func (m *PushModule) HealthCheck(ctx context.Context) error {
+	return pushapi.CheckWorkers()
+}
+
+// TestConfig 测试 push_send 配置中各推送通道的凭据与连通性
+func (m *PushModule) TestConfig(ctx context.Context, functionCode string, config map[string]interface{}) error {
+	if functionCode != "push_send" {
+		return nil
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return pushapi.CheckProviders(ctx, raw)
+}
@@ -0,0 +1,58 @@
+package segment
+
+import (
+	"app-platform-backend/core/module"
+	segmentapi "app-platform-backend/internal/api/v1/segment"
+	"app-platform-backend/internal/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() { module.Register(&SegmentModule{}) }
+
+type SegmentModule struct{}
+
+func (m *SegmentModule) Meta() module.Meta {
+	return module.Meta{Code: "audience_segment", Name: "用户分群", Description: "按用户属性、标签、行为与版本圈选目标用户", Icon: "team", SortOrder: 12}
+}
+
+func (m *SegmentModule) GetFunctions() []module.Function {
+	return []module.Function{
+		{Code: "segment_manage", Name: "分群管理", Type: "passive", Description: "管理用户分群规则", Dependencies: []string{"user_list"}},
+		{Code: "segment_estimate", Name: "分群估算", Type: "passive", Description: "估算分群用户规模", Dependencies: []string{"segment_manage"}},
+		{Code: "user_tag", Name: "用户标签", Type: "active", Description: "为用户添加或移除标签"},
+	}
+}
+
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *SegmentModule) RecordTables() map[string]string {
+	return map[string]string{"id": "audience_segments"}
+}
+
+func (m *SegmentModule) RegisterRoutes(group *gin.RouterGroup) {
+	segmentapi.InitDB(database.GetDB())
+
+	g := group.Group("/segments")
+	{
+		g.GET("", segmentapi.List)
+		g.POST("", segmentapi.Create)
+		g.POST("/estimate", segmentapi.EstimateRules)
+		g.GET("/tags", segmentapi.Tags)
+		g.POST("/tags", segmentapi.AddTags)
+		g.POST("/tags/remove", segmentapi.RemoveTags)
+		g.GET("/:id", segmentapi.Detail)
+		g.PUT("/:id", segmentapi.Update)
+		g.DELETE("/:id", segmentapi.Delete)
+		g.GET("/:id/estimate", segmentapi.EstimateSegment)
+	}
+}
+
+// Init 迁移分群与用户标签数据表
+func (m *SegmentModule) Init() error {
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	segmentapi.InitDB(db)
+	return segmentapi.MigrateDB(db)
+}
@@ -30,6 +30,9 @@ func (m *UserModule) GetFunctions() []module.Function {
 	}
 }
 
+// PlatformScoped 用户数据来自平台用户表，不归属单个APP，未携带 app_id 的请求不受APP启用状态限制
+func (m *UserModule) PlatformScoped() bool { return true }
+
 func (m *UserModule) RegisterRoutes(group *gin.RouterGroup) {
 	group.GET("/users", userapi.List)
 	group.GET("/users/:id", userapi.Detail)
@@ -33,6 +33,11 @@ func (m *VersionModule) GetFunctions() []module.Function {
 	}
 }
 
+// RecordTables 路由中记录ID所在的表，供模块访问控制确定请求所属的APP
+func (m *VersionModule) RecordTables() map[string]string {
+	return map[string]string{"id": "versions"}
+}
+
 func (m *VersionModule) RegisterRoutes(group *gin.RouterGroup) {
 	group.GET("/versions", versionapi.List)
 	group.POST("/versions", versionapi.Create)
@@ -44,6 +49,11 @@ func (m *VersionModule) RegisterRoutes(group *gin.RouterGroup) {
 	group.GET("/versions/stats", versionapi.Stats)
 }
 
+// RegisterClientRoutes 注册客户端更新检查路由（签名认证）
+func (m *VersionModule) RegisterClientRoutes(group *gin.RouterGroup) {
+	group.GET("/versions/check", versionapi.CheckUpdate)
+}
+
 func (m *VersionModule) Init() error {
 	versionapi.InitDB(database.GetDB())
 	return nil
@@ -1,7 +1,11 @@
 package websocket
 
 import (
+	"context"
+	"fmt"
+
 	"app-platform-backend/core/module"
+	wsapi "app-platform-backend/internal/api/v1/websocket"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,4 +31,21 @@ func (m *WebSocketModule) RegisterRoutes(group *gin.RouterGroup) {
 	// 原因：WebSocket不支持在连接时发送Authorization头，需要通过URL参数传递token
 }
 
-func (m *WebSocketModule) Init() error { return nil }
+// Init 订阅告警事件，告警触发时推送给APP的在线客户端
+func (m *WebSocketModule) Init() error {
+	module.On(module.EventAlertTriggered, "websocket.alert", module.Async, pushAlert)
+	return nil
+}
+
+func pushAlert(ctx context.Context, e module.Event, alert module.AlertTriggered) error {
+	wsapi.BroadcastAlert(alert.AppID, &wsapi.AlertData{
+		ID:        alert.AlertID,
+		Level:     "warning",
+		Title:     alert.Name,
+		Message:   fmt.Sprintf("%s 当前值 %v，触发条件 %s %v", alert.MetricName, alert.Value, alert.Condition, alert.Threshold),
+		Source:    e.Source,
+		Status:    "active",
+		CreatedAt: e.CreatedAt.UnixMilli(),
+	})
+	return nil
+}